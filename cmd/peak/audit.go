@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// runAudit lists generated .cls files that no current source produces any more,
+// e.g. concrete classes left behind when a template or instantiation was removed.
+// A file counts as generated if it has a provenance header or is listed in the
+// .peak-tooling.json of a previous build. Nothing is written or deleted.
+func runAudit(dir string, flags config.CLIFlags) error {
+	startTime := time.Now()
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return; the summary prints them otherwise
+
+	cfg, err := config.LoadConfig(dir, flags)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+
+	peakFiles, err := findPeakFiles(cfg, nil)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory '%s' does not exist\n\nTip: Check the directory path and try again", cfg.SourceDir)
+		}
+		return fmt.Errorf("error finding .peak files: %w", err)
+	}
+	files, err := readFiles(peakFiles, cfg.MaxFileSize, false)
+	if err != nil {
+		return err
+	}
+
+	results, _, err := transpileProject(cfg, files, nil)
+	if err != nil {
+		return err
+	}
+
+	// Without a complete set of outputs, live classes would be reported as orphaned
+	var errorCount int
+	expected := make(map[string]bool)
+	for _, result := range results {
+		if result.Error != nil {
+			errorCount++
+			out.diagnostic(diagnostic.FromError(result.OriginalPath, result.Error), result.Error)
+			continue
+		}
+		if !result.IsTemplate {
+			expected[filepath.Clean(result.OutputPath)] = true
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("audit needs sources that compile: %d compilation error(s)", errorCount)
+	}
+
+	generated, err := findGeneratedFiles(cfg)
+	if err != nil {
+		return err
+	}
+
+	var orphans int
+	for _, g := range generated {
+		if expected[g.path] {
+			continue
+		}
+		orphans++
+		reason := "generated by Peak"
+		if !g.marked {
+			reason = "listed in " + toolingFile
+		}
+		out.diagnostic(diagnostic.Diagnostic{
+			Severity: diagnostic.SeverityError,
+			Code:     diagnostic.CodeOrphanedOutput,
+			File:     g.path,
+			Message:  reason + ", but no current source produces it (delete it along with its -meta.xml)",
+		}, nil)
+	}
+
+	out.audited(len(generated), orphans, time.Since(startTime))
+	if orphans > 0 {
+		return fmt.Errorf("audit found %d orphaned output(s)", orphans)
+	}
+	return nil
+}
+
+// generatedFile is an existing .cls file that a previous build wrote
+type generatedFile struct {
+	path   string
+	marked bool // Has a provenance header; otherwise only known from .peak-tooling.json
+}
+
+// findGeneratedFiles returns the generated .cls files under the source and output
+// directories, in path order
+func findGeneratedFiles(cfg *config.Config) ([]generatedFile, error) {
+	classes, err := findClassFiles(cfg.SourceDir, cfg.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, list := range classes {
+		paths = append(paths, list...)
+	}
+	contents, err := readFiles(paths, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool) // Path to whether it has a provenance header
+	for path, content := range contents {
+		if transpiler.IsGenerated(content) {
+			found[filepath.Clean(path)] = true
+		}
+	}
+	for _, path := range toolingOutputs(cfg.SourceDir) {
+		if _, err := os.Stat(path); err == nil && !found[path] {
+			found[path] = false
+		}
+	}
+
+	generated := make([]generatedFile, 0, len(found))
+	for path, marked := range found {
+		generated = append(generated, generatedFile{path: path, marked: marked})
+	}
+	sort.Slice(generated, func(i, j int) bool { return generated[i].path < generated[j].path })
+	return generated, nil
+}
+
+// toolingOutputs returns the .cls paths recorded in .peak-tooling.json by a previous
+// build, or nothing if the file does not exist or cannot be read
+func toolingOutputs(sourceDir string) []string {
+	content, err := os.ReadFile(filepath.Join(sourceDir, toolingFile))
+	if err != nil {
+		return nil
+	}
+	var data toolingData
+	if err := json.Unmarshal(content, &data); err != nil || data.Version != toolingVersion {
+		return nil
+	}
+
+	paths := make([]string, 0, len(data.Outputs))
+	for _, output := range data.Outputs {
+		if filepath.Ext(output.Path) == apexExtension {
+			paths = append(paths, filepath.Join(sourceDir, filepath.FromSlash(output.Path)))
+		}
+	}
+	return paths
+}
@@ -1,53 +1,121 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/ipavlic/peak/pkg/config"
-	"github.com/ipavlic/peak/pkg/parser"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/sourcemap"
+	"github.com/ipavlic/peak/pkg/templatecache"
 	"github.com/ipavlic/peak/pkg/transpiler"
 )
 
-// runFolder compiles all .peak files in the specified directory.
-func runFolder(dir string, rootDir string, outDir string, apiVersion string) error {
-	return compileDirectory(dir, rootDir, outDir, apiVersion)
+// runFolder compiles all .peak files in the specified directory, then deploys the
+// generated classes with --deploy.
+func runFolder(dir string, flags config.CLIFlags) error {
+	build := &buildResult{keepLines: flags.Deploy}
+	if err := compileDirectory(dir, flags, nil, build); err != nil {
+		return err
+	}
+	if flags.Deploy {
+		return runDeploy(dir, flags, build, deployedOutputs(build))
+	}
+	return nil
 }
 
 const (
-	filePermission = 0o644   // Standard file permission for generated .cls files
-	peakExtension  = ".peak" // Peak source file extension
-	apexExtension  = ".cls"  // Apex output file extension
-
-	// ANSI color codes (matching help output style)
-	blue     = "\033[34m"
-	boldBlue = "\033[1;34m"
-	green    = "\033[32m"
-	yellow   = "\033[33m"
-	red      = "\033[31m"
-	gray     = "\033[90m"
-	reset    = "\033[0m"
+	filePermission   = 0o644       // Standard file permission for generated .cls files
+	peakExtension    = ".peak"     // Peak source file extension
+	snippetExtension = ".peakpart" // Extension of snippets for peak:include, by convention
+	apexExtension    = ".cls"      // Apex output file extension
+	outputBatchSize  = 256         // Outputs written together before their contents are released
 )
 
-// compileDirectory compiles all .peak files in the specified directory.
-func compileDirectory(dir string, rootDir string, outDir string, apiVersion string) error {
-	startTime := time.Now()
+// buildResult collects what a single compilation produced, for summaries and reports
+type buildResult struct {
+	startTime    time.Time
+	elapsed      time.Duration
+	inputs       map[string]string         // Source path to content hash
+	templates    []string                  // Source paths of template files
+	templateDefs []transpiler.TemplateInfo // Class and method templates found
+	classNames   map[string]string         // Shortened class name to its instantiation (nil = not planned)
+	outputs      []transpiler.FileResult   // Successfully written outputs, without content
+	outputHashes map[string]string         // Output path to content hash
+	diagnostics  []diagnostic.Diagnostic   // Errors and warnings, in reporting order
+	readTime     time.Duration             // Time spent reading sources
+	writeTime    time.Duration             // Time spent writing outputs
+	stats        transpiler.Stats          // Transpiler phase timings and template cache use
+	keepLines    bool                      // Keep the source lines of outputs, to locate deploy errors
+	state        *outputState              // Outputs of earlier builds, to skip unchanged ones in watch mode (nil = regenerate all)
+	unchanged    int                       // Outputs skipped as unchanged since the previous build
+	upToDate     int                       // Outputs not written since their files already had the same content
+}
+
+// addOutput records a written output, releasing its content, and its source lines
+// unless keepLines is set
+func (b *buildResult) addOutput(result transpiler.FileResult) {
+	if b.outputHashes == nil {
+		b.outputHashes = make(map[string]string)
+	}
+	b.outputHashes[result.OutputPath] = hashContent(result.Content)
+	result.Content = ""
+	if !b.keepLines {
+		result.SourceLines = nil
+	}
+	b.outputs = append(b.outputs, result)
+}
+
+// addUnchanged records an output that was skipped as unchanged, as the build that
+// wrote it recorded it
+func (b *buildResult) addUnchanged(result transpiler.FileResult, hash string) {
+	if b.outputHashes == nil {
+		b.outputHashes = make(map[string]string)
+	}
+	b.outputHashes[result.OutputPath] = hash
+	b.outputs = append(b.outputs, result)
+	b.unchanged++
+}
+
+// compileDirectory compiles all .peak files in the specified directory, recording
+// what the compilation produced in build. cache, if not nil, keeps source contents
+// between calls (watch mode).
+func compileDirectory(dir string, flags config.CLIFlags, cache *sourceCache, build *buildResult) (err error) {
+	build.startTime = time.Now()
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return; the summary prints them otherwise
+	out.events = newEventStream(flags.Events)
+	out.events.buildStart(dir)
+	defer func() { out.events.buildEnd(build, err) }()
+	var cfg *config.Config
+	switch flags.Format {
+	case formatJSON:
+		defer func() { printReport(dir, cfg, build, err) }()
+	case formatSARIF:
+		defer func() { printSarif(build, err) }()
+	}
 
 	// Load configuration
-	cfg, err := config.LoadConfig(dir, config.CLIFlags{
-		RootDir:    rootDir,
-		OutDir:     outDir,
-		ApiVersion: apiVersion,
-	})
+	cfg, err = config.LoadConfig(dir, flags)
 	if err != nil {
 		return fmt.Errorf("error loading configuration: %w", err)
 	}
+	out.verbose = cfg.Verbose
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+	logger.Debug("loaded configuration", "sourceDir", cfg.SourceDir, "outDir", cfg.OutDir, "rootDir", cfg.RootDir)
 
-	// Find all .peak files recursively
-	peakFiles, err := findPeakFiles(cfg.SourceDir)
+	// Find all .peak files recursively, skipping directories that cannot be read
+	peakFiles, err := findPeakFiles(cfg, func(path string, err error) {
+		readFailed(build, out, path, "directory", err)
+	})
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("directory '%s' does not exist\n\nTip: Check the directory path and try again", cfg.SourceDir)
@@ -55,123 +123,487 @@ func compileDirectory(dir string, rootDir string, outDir string, apiVersion stri
 		return fmt.Errorf("error finding .peak files: %w", err)
 	}
 
-	if len(peakFiles) == 0 {
+	if len(peakFiles) == 0 && len(build.diagnostics) == 0 {
 		return fmt.Errorf("no .peak files found in '%s'\n\nTip: Make sure the directory contains .peak source files", cfg.SourceDir)
 	}
 
-	// Read all input files
-	files := make(map[string]string, len(peakFiles))
-	for _, peakFile := range peakFiles {
-		content, err := os.ReadFile(peakFile)
+	logger.Debug("found sources", "count", len(peakFiles))
+
+	// With --files, every source is read for templates and usages, but only the listed ones are compiled
+	var selected []string
+	if flags.Files != "" {
+		listed, err := readFileList(flags.Files)
 		if err != nil {
-			return fmt.Errorf("error reading %s: %w", peakFile, err)
+			return err
 		}
-		files[peakFile] = string(content)
+		if selected = selectSources(peakFiles, listed); len(selected) == 0 {
+			logger.Info("No listed .peak sources to compile")
+			return nil
+		}
+		logger.Debug("selected sources", "count", len(selected))
 	}
 
-	// Create output path resolver function
-	outputPathFn := func(sourcePath string) (string, error) {
-		return cfg.ResolveOutputPath(sourcePath, apexExtension)
+	// Keep other runs, such as a watcher, from writing the same outputs meanwhile
+	release, err := acquireBuildLock(cfg.OutputRoot())
+	if err != nil {
+		return fmt.Errorf("error locking %s: %w", cfg.OutputRoot(), err)
 	}
+	defer release()
+	build.startTime = time.Now() // Waiting is not building
 
-	// Transpile all files
-	tr := transpiler.NewTranspiler(outputPathFn)
-	if cfg.Instantiate != nil {
-		tr.SetInstantiate(cfg.Instantiate)
+	peakFiles = checkSourceSizes(cfg, peakFiles, build, out)
+	readStart := time.Now()
+	read, peakFiles := sourceReader(cfg, peakFiles, build, cache, out)
+	build.readTime = time.Since(readStart)
+
+	err = transpileAndWrite(cfg, peakFiles, selected, read, build, out)
+	if err == nil && cfg.PackagePath != "" {
+		if err = writePackage(cfg.PackagePath, cfg, build.outputs); err != nil {
+			err = fmt.Errorf("error writing package %s: %w", cfg.PackagePath, err)
+		} else {
+			out.packaged(cfg.PackagePath, len(build.outputs))
+		}
 	}
-	results, err := tr.TranspileFiles(files)
+	build.elapsed = time.Since(build.startTime)
+
+	if cfg.Tooling {
+		if toolingErr := writeTooling(cfg, build); toolingErr != nil {
+			logger.Warn("could not write tooling metadata", "path", toolingFile, "error", toolingErr)
+		}
+	}
+
+	if cfg.Notify != nil {
+		if notifyErr := notifyBuild(cfg, build, err); notifyErr != nil {
+			logger.Warn("could not send build notification", "error", notifyErr)
+		}
+	}
+
+	if cfg.ReportPath != "" {
+		if reportErr := writeReport(cfg.ReportPath, cfg, build); reportErr != nil {
+			logger.Warn("could not write report", "path", cfg.ReportPath, "error", reportErr)
+		}
+	}
+
+	if cfg.MetricsPath != "" {
+		if metricsErr := writeMetrics(cfg.MetricsPath, build); metricsErr != nil {
+			logger.Warn("could not write metrics", "path", cfg.MetricsPath, "error", metricsErr)
+		}
+	}
+
+	return err
+}
+
+// sourceReader returns the function the transpiler uses to load sources, and the
+// paths it can load. By default all sources are read concurrently up front,
+// skipping unchanged files if a cache is given; with lowMemory each source is read
+// from disk whenever the transpiler needs it, trading repeated reads for never
+// holding the whole project in memory. Content hashes are recorded in build.inputs
+// either way. Sources that cannot be read are reported and left out, so the rest of
+// the project still compiles.
+func sourceReader(cfg *config.Config, paths []string, build *buildResult, cache *sourceCache, out *printer) (func(string) (string, error), []string) {
+	build.inputs = make(map[string]string, len(paths))
+	readable := func(errs []error) []string {
+		kept := paths[:0:0]
+		for i, path := range paths {
+			if errs[i] != nil {
+				readFailed(build, out, path, "file", errs[i])
+				continue
+			}
+			kept = append(kept, path)
+		}
+		return kept
+	}
+
+	if cfg.LowMemory {
+		// Only check that sources can be opened; a file that becomes unreadable
+		// while the transpiler runs still aborts the build
+		paths = readable(runParallel(len(paths), func(i int) error {
+			f, err := os.Open(paths[i])
+			if err == nil {
+				f.Close()
+			}
+			return err
+		}))
+		return func(path string) (string, error) {
+			start := time.Now()
+			defer func() { build.readTime += time.Since(start) }()
+			content, err := readSource(path, cfg.MaxFileSize)
+			if err != nil {
+				return "", fmt.Errorf("error reading %s: %w", path, err)
+			}
+			if _, ok := build.inputs[path]; !ok {
+				build.inputs[path] = hashContent(content)
+			}
+			return content, nil
+		}, paths
+	}
+
+	contents := make([]string, len(paths))
+	hashes := make([]string, len(paths))
+	var errs []error
+	if cache != nil {
+		cache.retain(paths)
+		errs = runParallel(len(paths), func(i int) error {
+			var err error
+			contents[i], hashes[i], err = cache.read(paths[i], cfg.MaxFileSize)
+			return err
+		})
+	} else {
+		errs = runParallel(len(paths), func(i int) error {
+			var err error
+			if contents[i], err = readSource(paths[i], cfg.MaxFileSize); err == nil {
+				hashes[i] = hashContent(contents[i])
+			}
+			return err
+		})
+	}
+	files := make(map[string]string, len(paths))
+	for i, path := range paths {
+		if errs[i] == nil {
+			files[path] = contents[i]
+			build.inputs[path] = hashes[i]
+		}
+	}
+	return func(path string) (string, error) {
+		return files[path], nil
+	}, readable(errs)
+}
+
+// readFailed reports that path, a source file or directory that kind names, could
+// not be read and is skipped
+func readFailed(build *buildResult, out *printer, path, kind string, err error) {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err // The diagnostic names the path already
+	}
+	d := diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Code:     diagnostic.CodeReadFailed,
+		File:     path,
+		Message:  fmt.Sprintf("%s could not be read (%v); skipped", kind, err),
+	}
+	build.diagnostics = append(build.diagnostics, d)
+	out.diagnostic(d, nil)
+}
+
+// transpileAndWrite transpiles the sources at paths and writes the resulting .cls files
+// in batches as they are produced, recording outputs and diagnostics in build. If
+// selected is not nil, only those sources are compiled; the others still contribute
+// templates and usages.
+func transpileAndWrite(cfg *config.Config, paths, selected []string, read func(string) (string, error), build *buildResult, out *printer) error {
+	tr := newProjectTranspiler(cfg)
+	tr.SetSelection(selected)
+	if build.state != nil {
+		tr.SetIncremental(build.state.previous(cfg))
+		defer func() {
+			// Also after a failure, for the outputs written before it
+			build.state.update(build, tr.Fingerprints())
+			logger.Debug("skipped unchanged outputs", "count", build.unchanged)
+		}()
+	}
+	metaContent := cfg.GenerateMetaXML()
+	var skippedTemplates int
+
+	var templates *templatecache.Cache
+	if cfg.CacheDir != "" {
+		templates = templatecache.Load(cfg.CacheDir)
+		tr.SetTemplateCache(templates)
+	}
+	var batch []transpiler.FileResult
+
+	// Concrete classes must not replace classes Peak did not generate
+	existing, err := findClassFiles(cfg.SourceDir, cfg.OutDir)
 	if err != nil {
-		return fmt.Errorf("error transpiling: %w", err)
+		return err
 	}
+	manifest := loadManifest(cfg.OutputRoot(), cfg.SourceDir)
+
+	// Include errors found before transpiling, e.g. oversized sources
+	errorCount := diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityError)
 
-	// Write output files and collect statistics
-	var generatedFiles, skippedTemplates, errorCount int
+	// flush writes the pending outputs concurrently, then releases them. A failed
+	// write becomes an error diagnostic for that output; the others are still written.
+	flush := func() {
+		writeTimes := make([]time.Duration, len(batch))
+		written := make([]bool, len(batch))
+		flushStart := time.Now()
+		errs := runParallel(len(batch), func(i int) error {
+			start := time.Now()
+			defer func() { writeTimes[i] = time.Since(start) }()
+			var err error
+			written[i], err = writeOutput(cfg, batch[i], metaContent)
+			return err
+		})
+		build.writeTime += time.Since(flushStart)
+		for i, result := range batch {
+			if errs[i] != nil {
+				errorCount++
+				if build.state != nil {
+					build.state.forget(result.OutputPath)
+				}
+				d := diagnostic.FromError(result.OutputPath, diagnostic.WithCode(diagnostic.CodeWriteFailed, errs[i]))
+				build.diagnostics = append(build.diagnostics, d)
+				out.diagnostic(d, errs[i])
+				continue
+			}
+			if !written[i] {
+				build.upToDate++
+			}
+			out.generated(result, writeTimes[i], !written[i])
+			build.addOutput(result)
+		}
+		batch = batch[:0]
+	}
 
-	for _, result := range results {
+	emit := func(result transpiler.FileResult) error {
 		// Handle errors
 		if result.Error != nil {
 			errorCount++
-			if parseErr, ok := result.Error.(*parser.ParseError); ok {
-				fmt.Fprint(os.Stderr, parseErr.FormatError())
-			} else {
-				fmt.Fprintf(os.Stderr, "  %sERROR%s in %s%s%s: %v\n",
-					red, reset,
-					blue, result.OriginalPath, reset,
-					result.Error)
+			d := diagnostic.FromError(result.OriginalPath, result.Error)
+			build.diagnostics = append(build.diagnostics, d)
+			out.diagnostic(d, result.Error)
+			return nil
+		}
+
+		if result.Unchanged {
+			if previous, hash, ok := build.state.unchanged(result.OutputPath); ok {
+				build.addUnchanged(previous, hash)
+				return nil
 			}
-			continue
+			return fmt.Errorf("%s was skipped as unchanged but no earlier build wrote it", result.OutputPath)
 		}
 
 		if result.IsTemplate {
 			skippedTemplates++
-			fmt.Fprintf(os.Stderr, "%sSkipped template:%s %s\n", yellow, reset, result.OriginalPath)
-			continue
+			build.templates = append(build.templates, result.OriginalPath)
+			out.skippedTemplate(result.OriginalPath, result.Timings)
+			return nil
 		}
 
-		// Ensure output directory exists
-		outputDir := filepath.Dir(result.OutputPath)
-		if err := os.MkdirAll(outputDir, 0o755); err != nil {
-			return fmt.Errorf("error creating output directory %s: %w", outputDir, err)
+		if d := existing.conflict(cfg, manifest, result); d != nil {
+			*d = promoteWarning(cfg, *d)
+			if d.Severity == diagnostic.SeverityError {
+				errorCount++
+			}
+			build.diagnostics = append(build.diagnostics, *d)
+			out.diagnostic(*d, nil)
+			return nil
 		}
 
-		// Write the .cls file
-		if err := os.WriteFile(result.OutputPath, []byte(result.Content), filePermission); err != nil {
-			return fmt.Errorf("error writing %s: %w", result.OutputPath, err)
+		batch = append(batch, result)
+		if len(batch) >= outputBatchSize {
+			flush()
 		}
+		return nil
+	}
 
-		// Write the .cls-meta.xml file
-		metaPath := result.OutputPath + "-meta.xml"
-		metaContent := cfg.GenerateMetaXML()
-		if err := os.WriteFile(metaPath, []byte(metaContent), filePermission); err != nil {
-			return fmt.Errorf("error writing %s: %w", metaPath, err)
+	if err := tr.TranspileStream(paths, read, emit); err != nil {
+		return fmt.Errorf("error transpiling: %w", err)
+	}
+	build.templateDefs = tr.Templates()
+	build.classNames = tr.ShortenedClassNames()
+	build.stats = tr.Stats()
+	for _, d := range tr.Warnings() {
+		d = promoteWarning(cfg, d)
+		if d.Severity == diagnostic.SeverityError {
+			errorCount++
 		}
+		build.diagnostics = append(build.diagnostics, d)
+		out.diagnostic(d, nil)
+	}
 
-		generatedFiles++
-		if result.OriginalPath != "" {
-			fmt.Fprintf(os.Stderr, "%sGenerated:%s %s%s%s -> %s%s%s\n",
-				green, reset,
-				gray, result.OriginalPath, reset,
-				blue, result.OutputPath, reset)
-		} else {
-			fmt.Fprintf(os.Stderr, "%sGenerated concrete class:%s %s%s%s\n",
-				green, reset,
-				blue, result.OutputPath, reset)
+	if templates != nil {
+		if err := templates.Save(); err != nil {
+			logger.Warn("could not write template cache", "dir", cfg.CacheDir, "error", err)
 		}
 	}
 
-	// Report compilation results
-	elapsed := time.Since(startTime)
-	fmt.Fprintf(os.Stderr, "\n")
+	// Generate the registry once every concrete class is known
+	if cfg.Registry {
+		flush()
+		registry, err := registryResult(cfg, build.outputs)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, registry)
+	}
+	flush()
+	if cfg.Prune && errorCount == 0 && selected == nil {
+		// Only a complete, successful build knows every live output
+		if _, _, err := pruneOutputs(cfg, manifest, build.outputs, out); err != nil {
+			return err
+		}
+	}
+	if err := manifest.save(build); err != nil {
+		logger.Warn("could not write output manifest", "path", filepath.Join(manifest.dir, manifestFile), "error", err)
+	}
 
+	// Report compilation results
+	if out.verbose {
+		out.outliers()
+	} else {
+		out.outputTable(cfg.SourceDir, build.templateDefs, build.outputs)
+	}
+	out.summary(len(build.outputs), build.unchanged+build.upToDate, skippedTemplates, errorCount, time.Since(build.startTime))
 	if errorCount > 0 {
-		fmt.Fprintf(os.Stderr, "%s✗%s Compiled %s%d%s file(s) (skipped %s%d%s template(s)) with %s%d error(s)%s in %s%v%s\n",
-			red, reset,
-			boldBlue, generatedFiles, reset,
-			yellow, skippedTemplates, reset,
-			red, errorCount, reset,
-			gray, elapsed.Round(time.Millisecond), reset)
 		return fmt.Errorf("compilation had %d error(s)", errorCount)
 	}
-
-	fmt.Fprintf(os.Stderr, "%s✓%s Compiled %s%d%s file(s) (skipped %s%d%s template(s)) in %s%v%s\n",
-		green, reset,
-		boldBlue, generatedFiles, reset,
-		yellow, skippedTemplates, reset,
-		gray, elapsed.Round(time.Millisecond), reset)
 	return nil
 }
 
-// findPeakFiles recursively finds all .peak files in a directory
-func findPeakFiles(root string) ([]string, error) {
+// promoteWarning returns d as an error if its code is listed in warningsAsErrors
+func promoteWarning(cfg *config.Config, d diagnostic.Diagnostic) diagnostic.Diagnostic {
+	if d.Severity == diagnostic.SeverityWarning && cfg.IsWarningAsError(d.Code) {
+		d.Severity = diagnostic.SeverityError
+	}
+	return d
+}
+
+// writeOutput writes a generated .cls file with its -meta.xml and, if enabled, its source map,
+// leaving files that already have their content alone. It reports whether the .cls or
+// -meta.xml file was written.
+func writeOutput(cfg *config.Config, result transpiler.FileResult, metaContent string) (bool, error) {
+	// Ensure output directory exists
+	outputDir := filepath.Dir(result.OutputPath)
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return false, fmt.Errorf("error creating output directory %s: %w", outputDir, err)
+	}
+
+	// Write the .cls file
+	written, err := writeIfChanged(result.OutputPath, result.Content)
+	if err != nil {
+		return false, fmt.Errorf("error writing %s: %w", result.OutputPath, err)
+	}
+
+	// Write the .cls-meta.xml file
+	metaPath := result.OutputPath + "-meta.xml"
+	metaWritten, err := writeIfChanged(metaPath, metaContent)
+	if err != nil {
+		return false, fmt.Errorf("error writing %s: %w", metaPath, err)
+	}
+
+	// Write the .peak.map sidecar
+	if cfg.SourceMap && (result.OriginalPath != "" || result.TemplatePath != "") {
+		if err := writeSourceMap(result); err != nil {
+			return false, fmt.Errorf("error writing source map for %s: %w", result.OutputPath, err)
+		}
+	}
+	return written || metaWritten, nil
+}
+
+// writeIfChanged writes content to path unless the file already has exactly that
+// content, so that unchanged outputs keep their modification times and do not show
+// as changed to Salesforce CLI source tracking. It reports whether it wrote the file.
+func writeIfChanged(path, content string) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == content {
+		return false, nil
+	}
+	if err := os.WriteFile(path, []byte(content), filePermission); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// newProjectTranspiler creates a transpiler using the configured output paths and instantiations
+func newProjectTranspiler(cfg *config.Config) *transpiler.Transpiler {
+	tr := transpiler.NewTranspiler(func(sourcePath string) (string, error) {
+		return cfg.ResolveOutputPath(sourcePath, apexExtension)
+	})
+	if cfg.Instantiate != nil {
+		tr.SetInstantiate(cfg.Instantiate)
+	}
+	tr.SetDocComments(cfg.DocComments)
+	tr.SetDynamicTypes(cfg.DynamicTypes)
+	tr.SetFactories(cfg.Factories)
+	tr.SetHolderClasses(cfg.HolderClasses)
+	tr.SetClassLimit(cfg.ClassLimit)
+	tr.SetLongClassNames(cfg.LongClassNames)
+	tr.SetClassNaming(cfg.ClassNaming)
+	tr.SetBuiltInGenerics(cfg.BuiltInGenerics)
+	tr.SetSelfCheck(cfg.SelfCheck)
+	tr.SetSymbols(cfg.Symbols)
+	tr.SetConstants(cfg.Defines)
+	tr.SetOutputDirs(cfg.OutputRoot(), cfg.OutputDirs)
+	tr.SetTestClasses(cfg.TestDir, cfg.TestClasses)
+	tr.SetVisibility(cfg.Visibility)
+	tr.SetManagedPackage(cfg.ManagedPackage, cfg.PackageApi)
+	tr.SetVersion(peakVersion())
+	tr.SetLogger(logger)
+	return tr
+}
+
+// transpileProject transpiles the given sources in memory using the configured
+// output paths and instantiations. readInclude reads peak:include snippets
+// (nil = from disk).
+func transpileProject(cfg *config.Config, files map[string]string, readInclude func(string) (string, error)) ([]transpiler.FileResult, *transpiler.Transpiler, error) {
+	tr := newProjectTranspiler(cfg)
+	if readInclude != nil {
+		tr.SetIncludeReader(readInclude)
+	}
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error transpiling: %w", err)
+	}
+
+	if cfg.Registry {
+		registry, err := registryResult(cfg, results)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, registry)
+	}
+	return results, tr, nil
+}
+
+// registryResult generates PeakRegistry.cls for the concrete classes among results
+func registryResult(cfg *config.Config, results []transpiler.FileResult) (transpiler.FileResult, error) {
+	registryPath, err := cfg.ResolveOutputPath(filepath.Join(cfg.SourceDir, transpiler.RegistryClassName+peakExtension), apexExtension)
+	if err != nil {
+		return transpiler.FileResult{}, fmt.Errorf("error resolving output path for %s: %w", transpiler.RegistryClassName, err)
+	}
+	return transpiler.FileResult{
+		OutputPath: registryPath,
+		Content:    transpiler.GenerateRegistry(results),
+	}, nil
+}
+
+// writeSourceMap writes the .peak.map sidecar for a generated class
+func writeSourceMap(result transpiler.FileResult) error {
+	mapPath := sourcemap.PathFor(result.OutputPath)
+	className := strings.TrimSuffix(filepath.Base(result.OutputPath), apexExtension)
+
+	source := result.OriginalPath
+	if source == "" {
+		source = result.TemplatePath
+	}
+	if rel, err := filepath.Rel(filepath.Dir(mapPath), source); err == nil {
+		source = rel
+	}
+
+	return sourcemap.New(className, source, result.Instantiation, result.SourceLines).Write(mapPath)
+}
+
+// findPeakFiles recursively finds all .peak files in cfg.SourceDir, skipping the
+// directories cfg excludes. If skip is not nil, subdirectories that cannot be read
+// are passed to it and skipped instead of failing the search.
+func findPeakFiles(cfg *config.Config, skip func(path string, err error)) ([]string, error) {
 	var peakFiles []string
+	root := cfg.SourceDir
 
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
+			if skip != nil && path != root {
+				skip(path, err)
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			return err
 		}
 
-		// Skip hidden directories and files
-		if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != root {
+		// Skip hidden and excluded directories
+		if info.IsDir() && cfg.IsExcludedDir(path) {
 			return filepath.SkipDir
 		}
 
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// sfCommand is the Salesforce CLI, which deploys generated classes to an org
+const sfCommand = "sf"
+
+// deployOutput is the part of the JSON output of sf project deploy start that Peak
+// reads. The deploy result is included whether the deploy succeeded or failed.
+type deployOutput struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Result  struct {
+		Status                   string `json:"status"`
+		NumberComponentsDeployed int    `json:"numberComponentsDeployed"`
+		Details                  struct {
+			// A single failure is an object rather than a list, as in the Metadata API
+			ComponentFailures json.RawMessage `json:"componentFailures"`
+		} `json:"details"`
+	} `json:"result"`
+}
+
+// componentFailure is a component that an org rejected, such as an Apex class that
+// does not compile
+type componentFailure struct {
+	ComponentType string      `json:"componentType"`
+	FullName      string      `json:"fullName"`
+	FileName      string      `json:"fileName"`
+	LineNumber    flexibleInt `json:"lineNumber"`
+	ColumnNumber  flexibleInt `json:"columnNumber"`
+	Problem       string      `json:"problem"`
+	ProblemType   string      `json:"problemType"`
+}
+
+// flexibleInt is a number that the Salesforce CLI writes as a JSON number or string
+type flexibleInt int
+
+func (n *flexibleInt) UnmarshalJSON(data []byte) error {
+	value, err := strconv.Atoi(strings.Trim(string(data), `"`))
+	if err != nil {
+		return nil // Not a line or column, such as null
+	}
+	*n = flexibleInt(value)
+	return nil
+}
+
+// componentFailures returns the failures of a deploy result, which sf writes as a
+// list, a single object, or not at all
+func (d *deployOutput) componentFailures() []componentFailure {
+	raw := bytes.TrimSpace(d.Result.Details.ComponentFailures)
+	if len(raw) == 0 || raw[0] == 'n' {
+		return nil
+	}
+	var failures []componentFailure
+	if raw[0] == '{' {
+		var failure componentFailure
+		if json.Unmarshal(raw, &failure) == nil {
+			failures = append(failures, failure)
+		}
+		return failures
+	}
+	_ = json.Unmarshal(raw, &failures)
+	return failures
+}
+
+// deployedOutputs returns the paths of the classes build wrote, in path order
+func deployedOutputs(build *buildResult) []string {
+	paths := make([]string, 0, len(build.outputs))
+	for _, result := range build.outputs {
+		paths = append(paths, result.OutputPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// runDeploy deploys the generated classes at paths, outputs of build, to the org
+// targetOrg names, or to the default org of the Salesforce CLI, with sf project
+// deploy start run in the enclosing SFDX project. Errors the org reports in a
+// generated class are mapped back to the line of the .peak source or template that
+// produced it, and printed like compilation errors.
+func runDeploy(dir string, flags config.CLIFlags, build *buildResult, paths []string) error {
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return
+
+	cfg, err := config.LoadConfig(dir, flags)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+	if cfg.SfdxProject == "" {
+		return fmt.Errorf("deploy needs an sfdx-project.json in '%s' or a parent directory", cfg.SourceDir)
+	}
+	if len(paths) == 0 {
+		logger.Info("No changed classes to deploy")
+		return nil
+	}
+
+	args := []string{"project", "deploy", "start", "--json"}
+	if flags.TargetOrg != "" {
+		args = append(args, "--target-org", flags.TargetOrg)
+	}
+	for _, path := range paths {
+		args = append(args, "--source-dir", path)
+	}
+	org := flags.TargetOrg
+	if org == "" {
+		org = "the default org"
+	}
+	fmt.Fprintf(out.w, "\nDeploying %s%d%s class(es) to %s%s%s\n", out.count, len(paths), out.reset, out.path, org, out.reset)
+
+	// sf reports progress on stderr and the result as JSON on stdout
+	var stdout bytes.Buffer
+	cmd := exec.Command(sfCommand, args...)
+	cmd.Dir = filepath.Dir(cfg.SfdxProject)
+	cmd.Stdout, cmd.Stderr = &stdout, os.Stderr
+	logger.Debug("running Salesforce CLI", "args", args)
+	runErr := cmd.Run()
+	if errors.Is(runErr, exec.ErrNotFound) {
+		return fmt.Errorf("deploy needs the Salesforce CLI (%s) on the PATH\n\nTip: Install it with npm install --global @salesforce/cli", sfCommand)
+	}
+
+	var result deployOutput
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		if runErr != nil {
+			return fmt.Errorf("%s project deploy start failed: %w", sfCommand, runErr)
+		}
+		return fmt.Errorf("error reading the result of %s project deploy start: %w", sfCommand, err)
+	}
+
+	failures := result.componentFailures()
+	sources := deploySources(build)
+	errorCount := 0
+	for _, failure := range failures {
+		if failure.ProblemType == "Warning" {
+			continue
+		}
+		errorCount++
+		out.diagnostic(deployDiagnostic(failure, sources), nil)
+	}
+	out.flushDiagnostics()
+
+	if runErr == nil && result.Status == 0 {
+		fmt.Fprintf(out.w, "%s✓%s Deployed %s%d%s component(s) to %s\n",
+			out.success, out.reset, out.count, result.Result.NumberComponentsDeployed, out.reset, org)
+		return nil
+	}
+	if errorCount == 0 {
+		message := result.Message
+		if message == "" {
+			message = result.Result.Status
+		}
+		return fmt.Errorf("deploy to %s failed: %s", org, message)
+	}
+	fmt.Fprintf(out.w, "\n%s✗%s Deploy to %s failed with %s%d error(s)%s\n", out.error, out.reset, org, out.error, errorCount, out.reset)
+	return fmt.Errorf("deploy had %d error(s)", errorCount)
+}
+
+// deploySources returns the outputs of build by lowercased class name, since Apex
+// class names are case-insensitive
+func deploySources(build *buildResult) map[string]transpiler.FileResult {
+	sources := make(map[string]transpiler.FileResult, len(build.outputs))
+	for _, result := range build.outputs {
+		name := strings.TrimSuffix(filepath.Base(result.OutputPath), apexExtension)
+		sources[strings.ToLower(name)] = result
+	}
+	return sources
+}
+
+// deployDiagnostic returns a deploy failure located in the .peak file that produced
+// the failing class, at the source line of the failing line, with a note pointing at
+// the generated class. Failures in lines Peak generated, and in classes Peak did not
+// generate, are located in the class itself.
+func deployDiagnostic(failure componentFailure, sources map[string]transpiler.FileResult) diagnostic.Diagnostic {
+	d := diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Code:     diagnostic.CodeDeployFailed,
+		File:     failure.FileName,
+		Line:     int(failure.LineNumber),
+		Column:   int(failure.ColumnNumber),
+		Message:  failure.Problem,
+	}
+	result, ok := sources[strings.ToLower(failure.FullName)]
+	if !ok {
+		return d
+	}
+
+	d.File = result.OutputPath
+	source := result.OriginalPath
+	if source == "" {
+		source = result.TemplatePath
+	}
+	line := int(failure.LineNumber)
+	if line > 0 && line <= len(result.SourceLines) && result.SourceLines[line-1] > 0 && source != "" {
+		note := fmt.Sprintf("in generated class %s", failure.FullName)
+		if result.Instantiation != "" {
+			note = fmt.Sprintf("in %s, generated as %s", result.Instantiation, failure.FullName)
+		}
+		d.Notes = []diagnostic.Note{{File: result.OutputPath, Line: line, Column: d.Column, Message: note}}
+		d.File, d.Line, d.Column = source, result.SourceLines[line-1], 0
+	}
+	return d
+}
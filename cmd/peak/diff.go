@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext  = 3         // Unchanged lines shown around each change
+	maxDiffCells = 4_000_000 // Largest changed region compared line by line; larger ones are replaced whole
+)
+
+// diffOp is one line of a diff: ' ' unchanged, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// printDiff prints a unified diff from the checked-in content of path to the
+// content the sources produce, colored like the rest of the output
+func (p *printer) printDiff(path, actual, expected string) {
+	ops := diffLines(splitLines(actual), splitLines(expected))
+	fmt.Fprintf(p.w, "\n%s--- %s (checked in)%s\n", p.error, path, p.reset)
+	fmt.Fprintf(p.w, "%s+++ %s (generated)%s\n", p.success, path, p.reset)
+	for _, hunk := range diffHunks(ops) {
+		fmt.Fprintf(p.w, "%s%s%s\n", p.muted, hunk.header, p.reset)
+		for _, op := range ops[hunk.start:hunk.end] {
+			switch op.kind {
+			case '-':
+				fmt.Fprintf(p.w, "%s-%s%s\n", p.error, op.text, p.reset)
+			case '+':
+				fmt.Fprintf(p.w, "%s+%s%s\n", p.success, op.text, p.reset)
+			default:
+				fmt.Fprintf(p.w, " %s\n", op.text)
+			}
+		}
+	}
+}
+
+// splitLines splits content into lines, ignoring line endings like verify does
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines returns the edit script turning a into b. Common leading and trailing
+// lines are matched first; the region between them is compared with a longest common
+// subsequence, unless it is larger than maxDiffCells, in which case it is replaced whole.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// diffMiddle diffs the changed region between the common prefix and suffix
+func diffMiddle(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i, j = i+1, j+1
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// diffHunk is a range of ops printed together, with its "@@ -a,b +c,d @@" header
+type diffHunk struct {
+	start, end int
+	header     string
+}
+
+// diffHunks groups changes with diffContext unchanged lines around them, merging
+// groups whose context overlaps
+func diffHunks(ops []diffOp) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == ' ' {
+			continue
+		}
+		start := max(i-diffContext, 0)
+		end := i
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContext; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// Trim the trailing context to diffContext lines
+		for end > i && ops[end-1].kind == ' ' && trailingUnchanged(ops[:end]) > diffContext {
+			end--
+		}
+		hunks = append(hunks, diffHunk{start: start, end: end, header: hunkHeader(ops, start, end)})
+		i = end - 1
+	}
+	return hunks
+}
+
+// trailingUnchanged counts the unchanged ops at the end of ops
+func trailingUnchanged(ops []diffOp) int {
+	n := 0
+	for n < len(ops) && ops[len(ops)-1-n].kind == ' ' {
+		n++
+	}
+	return n
+}
+
+// hunkHeader returns the "@@ -a,b +c,d @@" header of ops[start:end]
+func hunkHeader(ops []diffOp, start, end int) string {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	var oldCount, newCount int
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty range is numbered after the line it follows, as diff -u does
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldLine, oldCount, newLine, newCount)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+const eventsNDJSON = "ndjson" // --events format: one JSON object per line
+
+// Event names of the --events stream
+const (
+	eventBuildStart = "build-start" // Compilation starts
+	eventFileDone   = "file-done"   // An output was written, or a template file was parsed
+	eventDiagnostic = "diagnostic"  // An error or warning was reported
+	eventBuildEnd   = "build-end"   // Compilation finished, successfully or not
+)
+
+// event is a single line of the --events stream. Only the fields of its kind are set.
+type event struct {
+	Event string `json:"event"`
+	Time  string `json:"time"` // RFC 3339 with nanoseconds
+
+	Dir string `json:"dir,omitempty"` // build-start: directory being compiled
+
+	Source        string  `json:"source,omitempty"`        // file-done: source or template the file came from
+	Output        string  `json:"output,omitempty"`        // file-done: written .cls file, empty for templates
+	Instantiation string  `json:"instantiation,omitempty"` // file-done: generic expression of a concrete class
+	IsTemplate    bool    `json:"isTemplate,omitempty"`    // file-done: a template file, which has no output
+	DurationMs    float64 `json:"durationMs,omitempty"`    // file-done: time spent on the file
+
+	Diagnostic *diagnostic.Diagnostic `json:"diagnostic,omitempty"` // diagnostic
+	Summary    *eventSummary          `json:"summary,omitempty"`    // build-end
+}
+
+// eventSummary is the outcome of a build, reported by build-end
+type eventSummary struct {
+	Status     string  `json:"status"` // "success" or "failure"
+	DurationMs float64 `json:"durationMs"`
+	Outputs    int     `json:"outputs"` // Files written
+	Errors     int     `json:"errors"`
+	Warnings   int     `json:"warnings"`
+	Message    string  `json:"message,omitempty"` // Why the build failed
+}
+
+// eventStream writes --events to stdout as they happen, one line each, for editor
+// extensions and wrapper tools that show live progress. A nil stream writes nothing.
+type eventStream struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newEventStream returns the stream for the --events format, or nil without one
+func newEventStream(format string) *eventStream {
+	if format != eventsNDJSON {
+		return nil
+	}
+	return &eventStream{w: os.Stdout}
+}
+
+// emit writes e, stamped with the current time
+func (s *eventStream) emit(e event) {
+	if s == nil {
+		return
+	}
+	e.Time = time.Now().Format(time.RFC3339Nano)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enc := json.NewEncoder(s.w)
+	enc.SetEscapeHTML(false) // Keep Queue<Integer> readable
+	// Events are best effort: a closed pipe must not fail the build
+	_ = enc.Encode(e)
+}
+
+// buildStart reports that compilation of dir starts
+func (s *eventStream) buildStart(dir string) {
+	if absDir, err := filepath.Abs(dir); err == nil {
+		dir = absDir
+	}
+	s.emit(event{Event: eventBuildStart, Dir: dir})
+}
+
+// fileDone reports a written output, or a parsed template file, with the time spent on it
+func (s *eventStream) fileDone(result transpiler.FileResult, elapsed time.Duration) {
+	source := result.OriginalPath
+	if source == "" {
+		source = result.TemplatePath
+	}
+	s.emit(event{
+		Event:         eventFileDone,
+		Source:        source,
+		Output:        result.OutputPath,
+		Instantiation: result.Instantiation,
+		IsTemplate:    result.IsTemplate,
+		DurationMs:    durationMs(elapsed),
+	})
+}
+
+// diagnostic reports an error or warning as soon as it is found
+func (s *eventStream) diagnostic(d diagnostic.Diagnostic) {
+	s.emit(event{Event: eventDiagnostic, Diagnostic: &d})
+}
+
+// buildEnd reports the outcome of a build; err is the error the build returned, if any
+func (s *eventStream) buildEnd(build *buildResult, err error) {
+	summary := &eventSummary{
+		Status:     "success",
+		DurationMs: durationMs(time.Since(build.startTime)),
+		Outputs:    len(build.outputs),
+		Errors:     diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityError),
+		Warnings:   diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityWarning),
+	}
+	if err != nil {
+		summary.Status, summary.Message = "failure", err.Error()
+	}
+	s.emit(event{Event: eventBuildEnd, Summary: summary})
+}
+
+// durationMs converts d to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment variables set for the --exec command
+const (
+	envChangedOutputs = "PEAK_CHANGED_OUTPUTS" // Outputs whose content changed in the build, one path per line
+	envChangedCount   = "PEAK_CHANGED_COUNT"   // Number of changed outputs
+	envBuild          = "PEAK_BUILD"           // Number of the build in the watch session, starting at 1
+)
+
+// changedOutputs returns the outputs of build whose content differs from previous,
+// the output hashes of the session's previous successful build, in path order
+func changedOutputs(build *buildResult, previous map[string]string) []string {
+	var changed []string
+	for path, hash := range build.outputHashes {
+		if previous[path] != hash {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// runExec runs the --exec command through the shell after a successful rebuild, with
+// its output going to Peak's and the changed outputs in its environment. A failing
+// command is logged; it does not stop watching.
+func runExec(command string, buildNumber int, changed []string) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, nil
+	cmd.Env = append(os.Environ(),
+		envChangedOutputs+"="+strings.Join(changed, "\n"),
+		envChangedCount+"="+strconv.Itoa(len(changed)),
+		envBuild+"="+strconv.Itoa(buildNumber),
+	)
+
+	logger.Info("Running command", "command", command, "changedOutputs", len(changed))
+	if err := cmd.Run(); err != nil {
+		logger.Error("Command failed", "command", command, "error", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// runExplain prints the long-form description of a diagnostic code,
+// or lists all codes when none is given
+func runExplain(args []string) error {
+	var code string
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			printUsage()
+			return nil
+		}
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("unknown flag %s", arg)
+		}
+		if code != "" {
+			return fmt.Errorf("too many arguments")
+		}
+		code = arg
+	}
+
+	if code == "" {
+		for _, e := range diagnostic.Explanations() {
+			fmt.Printf("%s  %s\n", e.Code, e.Title)
+		}
+		return nil
+	}
+
+	e, ok := diagnostic.Explain(code)
+	if !ok {
+		return fmt.Errorf("unknown diagnostic code %q\n\nTip: Run 'peak explain' to list all codes", code)
+	}
+	printExplanation(os.Stdout, e)
+	return nil
+}
+
+// printExplanation writes an explanation as plain text
+func printExplanation(w io.Writer, e diagnostic.Explanation) {
+	fmt.Fprintf(w, "%s: %s\n\n", e.Code, e.Title)
+	fmt.Fprintf(w, "%s\n", e.Description)
+	if e.Example != "" {
+		fmt.Fprintf(w, "\nExample:\n\n")
+		for _, line := range strings.Split(e.Example, "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	fmt.Fprintf(w, "\nFix:\n\n%s\n", e.Fix)
+}
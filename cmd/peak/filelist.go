@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readFileList reads the paths listed by --files: from standard input for "-",
+// otherwise from the named file. Paths are separated by NUL bytes if the list has
+// any, as written by git diff -z and find -print0, and by newlines otherwise.
+func readFileList(name string) ([]string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file list: %w", err)
+	}
+
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+	var paths []string
+	for _, entry := range bytes.Split(data, sep) {
+		if path := strings.TrimSpace(string(entry)); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// selectSources returns the sources among peakFiles that listed names, relative to
+// the working directory or absolute. Entries that are not .peak files, such as the
+// other files of a git diff, are ignored, and so are deleted ones; other .peak files
+// that are not project sources, such as those outside the source directory, are logged.
+func selectSources(peakFiles, listed []string) []string {
+	sources := make(map[string]bool, len(peakFiles))
+	for _, path := range peakFiles {
+		sources[filepath.Clean(path)] = true
+	}
+
+	var selected []string
+	seen := make(map[string]bool)
+	for _, entry := range listed {
+		if !strings.HasSuffix(entry, peakExtension) {
+			continue
+		}
+		path, err := filepath.Abs(entry)
+		if err != nil || !sources[path] {
+			if _, statErr := os.Stat(entry); os.IsNotExist(statErr) {
+				logger.Debug("listed file does not exist; skipped", "file", entry)
+			} else {
+				logger.Warn("listed file is not a source of this project; skipped", "file", entry)
+			}
+			continue
+		}
+		if !seen[path] {
+			seen[path] = true
+			selected = append(selected, path)
+		}
+	}
+	return selected
+}
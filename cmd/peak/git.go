@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+// runGit runs a git command in dir and returns its standard output
+func runGit(dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return output, nil
+}
+
+// gitIndex is a read-only view of the files staged in a git repository's index.
+// Paths passed to its methods are absolute paths in the working tree.
+type gitIndex struct {
+	dir     string            // Directory the index was opened from (absolute)
+	prefix  string            // dir relative to the repository root, slash-separated ("" at the root)
+	entries map[string]string // Repository-relative path to staged object id
+}
+
+// openGitIndex reads the index of the repository containing dir
+func openGitIndex(dir string) (*gitIndex, error) {
+	prefix, err := runGit(dir, nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not inside a git repository: %w", dir, err)
+	}
+
+	// ls-files -s prints "<mode> <object> <stage>\t<path>", NUL-terminated with -z.
+	// --full-name keeps paths relative to the repository root.
+	output, err := runGit(dir, nil, "ls-files", "-s", "-z", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	index := &gitIndex{
+		dir:     dir,
+		prefix:  strings.TrimSpace(string(prefix)),
+		entries: make(map[string]string),
+	}
+	for _, record := range strings.Split(string(output), "\x00") {
+		info, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(info)
+		// Skip unmerged entries (stage != 0); they have no single staged content
+		if len(fields) != 3 || fields[2] != "0" {
+			continue
+		}
+		index.entries[name] = fields[1]
+	}
+	return index, nil
+}
+
+// key returns the repository-relative path for an absolute working tree path,
+// or false if the path is outside the repository
+func (g *gitIndex) key(absPath string) (string, bool) {
+	rel, err := filepath.Rel(g.dir, absPath)
+	if err != nil {
+		return "", false
+	}
+	name := path.Clean(path.Join(g.prefix, filepath.ToSlash(rel)))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// has reports whether absPath is staged
+func (g *gitIndex) has(absPath string) bool {
+	name, ok := g.key(absPath)
+	if !ok {
+		return false
+	}
+	_, ok = g.entries[name]
+	return ok
+}
+
+// peakFiles returns the staged .peak files under root, skipping hidden directories
+func (g *gitIndex) peakFiles(cfg *config.Config) ([]string, error) {
+	root := cfg.SourceDir
+	rootKey, ok := g.key(root)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is outside the git repository", root)
+	}
+
+	var files []string
+	for name := range g.entries {
+		rel := name
+		if rootKey != "." {
+			if !strings.HasPrefix(name, rootKey+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(name, rootKey+"/")
+		}
+		if !strings.HasSuffix(rel, peakExtension) || inExcludedDir(cfg, rel) {
+			continue
+		}
+		files = append(files, filepath.Join(root, filepath.FromSlash(rel)))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// inExcludedDir reports whether any directory of rel, a slash-separated path relative
+// to cfg.SourceDir, is one that cfg excludes
+func inExcludedDir(cfg *config.Config, rel string) bool {
+	dir := cfg.SourceDir
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		if cfg.IsExcludedDir(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// contents returns the staged content of each path that is in the index,
+// reading all blobs in a single git cat-file process
+func (g *gitIndex) contents(paths []string) (map[string]string, error) {
+	var request bytes.Buffer
+	var staged []string
+	for _, p := range paths {
+		name, ok := g.key(p)
+		if !ok {
+			continue
+		}
+		if object, ok := g.entries[name]; ok {
+			request.WriteString(object + "\n")
+			staged = append(staged, p)
+		}
+	}
+
+	result := make(map[string]string, len(staged))
+	if len(staged) == 0 {
+		return result, nil
+	}
+
+	output, err := runGit(g.dir, &request, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each blob is "<object> <type> <size>\n<content>\n"
+	reader := bufio.NewReader(bytes.NewReader(output))
+	for _, p := range staged {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: unexpected end of output")
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("git cat-file: cannot read %s: %s", p, strings.TrimSpace(header))
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: invalid header %q", strings.TrimSpace(header))
+		}
+		content := make([]byte, size+1) // Content plus trailing newline
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, fmt.Errorf("git cat-file: truncated content for %s", p)
+		}
+		result[p] = string(content[:size])
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// classFiles indexes existing .cls files by lowercase class name (Apex class
+// names are case-insensitive), so generated classes can be checked against them
+type classFiles map[string][]string
+
+// findClassFiles collects the .cls files under roots, skipping hidden directories.
+// Roots that do not exist yet, such as an output directory before the first build, are ignored,
+// and so are subdirectories that cannot be read, which compilation reports (PEAK208).
+func findClassFiles(roots ...string) (classFiles, error) {
+	classes := make(classFiles)
+	seen := make(map[string]bool)
+
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if path != root && info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != root {
+				return filepath.SkipDir
+			}
+			if info.IsDir() || !strings.HasSuffix(path, apexExtension) || seen[path] {
+				return nil
+			}
+			seen[path] = true // The output directory may be inside the source directory
+			name := strings.ToLower(strings.TrimSuffix(info.Name(), apexExtension))
+			classes[name] = append(classes[name], path)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error finding .cls files: %w", err)
+		}
+	}
+	return classes, nil
+}
+
+// conflict returns a diagnostic if result would overwrite a class that Peak did not
+// generate, unless cfg allows overwriting it, or one that manifest shows was edited by
+// hand, unless forced, or if result, a generated class, would duplicate a class Peak
+// did not generate; it returns nil if result is safe to write. For the output of a
+// source, cfg.HandWritten decides: an error, a warning that keeps the hand-written
+// class, or no diagnostic.
+func (c classFiles) conflict(cfg *config.Config, manifest *outputManifest, result transpiler.FileResult) *diagnostic.Diagnostic {
+	name := strings.TrimSuffix(filepath.Base(result.OutputPath), apexExtension)
+	source := result.OriginalPath
+	if source == "" {
+		source = result.TemplatePath
+	}
+	for _, path := range c[strings.ToLower(name)] {
+		overwrite := filepath.Clean(path) == filepath.Clean(result.OutputPath)
+		if !overwrite && result.OriginalPath != "" || overwrite && cfg.Force {
+			continue // Source outputs are only checked for overwriting
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue // Removed since the scan
+		}
+		text := strings.ReplaceAll(string(content), "\r\n", "\n")
+		if transpiler.IsGenerated(text) {
+			if overwrite && text != result.Content && manifest.edited(path, text) {
+				return &diagnostic.Diagnostic{
+					Severity: diagnostic.SeverityError,
+					Code:     diagnostic.CodeEditedOutput,
+					File:     source,
+					Message: fmt.Sprintf("%s was edited by hand since Peak generated it; move the change into %s, then pass --force or delete %s to regenerate it",
+						filepath.Base(path), filepath.Base(source), path),
+					Notes: []diagnostic.Note{{File: path, Message: "edited file is here"}},
+				}
+			}
+			continue
+		}
+		if overwrite && cfg.MayOverwrite(name) {
+			continue
+		}
+
+		// Outputs of Peak versions that did not write headers are only recognizable by their content
+		if overwrite && text == transpiler.StripProvenance(result.Content) {
+			continue
+		}
+
+		if overwrite && result.OriginalPath != "" {
+			switch cfg.HandWritten {
+			case config.HandWrittenOverwrite:
+				continue
+			case config.HandWrittenSkip:
+				return &diagnostic.Diagnostic{
+					Severity: diagnostic.SeverityWarning,
+					Code:     diagnostic.CodeKeptHandWritten,
+					File:     source,
+					Message:  fmt.Sprintf("kept hand-written class %s; the source was not compiled to it (handWrittenClasses is %s)", path, config.HandWrittenSkip),
+					Notes:    []diagnostic.Note{{File: path, Message: "hand-written class " + name + " is here"}},
+				}
+			}
+		}
+
+		action, fix := "duplicate", "rename or remove one of them"
+		if overwrite {
+			action = "overwrite"
+			fix += fmt.Sprintf(", or replace it with --force or by listing %s in allowOverwrite", name)
+			if result.OriginalPath != "" {
+				fix += ", or set handWrittenClasses to skip or overwrite"
+			}
+		}
+		class := fmt.Sprintf("concrete class %s (%s)", name, result.Instantiation)
+		switch {
+		case result.OriginalPath != "":
+			class = fmt.Sprintf("class %s", name)
+		case result.Instantiation == "":
+			class = fmt.Sprintf("class %s (generated from %s)", name, filepath.Base(result.TemplatePath))
+		}
+		return &diagnostic.Diagnostic{
+			Severity: diagnostic.SeverityError,
+			Code:     diagnostic.CodeHandWritten,
+			File:     source,
+			Message:  fmt.Sprintf("%s would %s hand-written class %s; %s", class, action, path, fix),
+			Notes:    []diagnostic.Note{{File: path, Message: "hand-written class " + name + " is here"}},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// outputState remembers, between watch mode rebuilds, what each output on disk was
+// generated from, so a rebuild only regenerates the outputs whose inputs changed: an
+// edited source, the sources that use an edited template, and the template's concrete
+// classes. It is only used by one build at a time.
+type outputState struct {
+	config       string                           // Hash of the configuration the outputs were generated with
+	fingerprints transpiler.Fingerprints          // Inputs of each output on disk, by output path
+	results      map[string]transpiler.FileResult // Outputs on disk as the builds that wrote them recorded them
+	hashes       map[string]string                // Content hashes of the outputs on disk
+}
+
+// newOutputState creates a state in which every output is regenerated
+func newOutputState() *outputState {
+	return &outputState{
+		fingerprints: make(transpiler.Fingerprints),
+		results:      make(map[string]transpiler.FileResult),
+		hashes:       make(map[string]string),
+	}
+}
+
+// previous returns the fingerprints of the outputs a build with cfg can skip: those
+// still on disk. A changed configuration can change any output, so it discards them all.
+func (s *outputState) previous(cfg *config.Config) transpiler.Fingerprints {
+	data, err := json.Marshal(cfg)
+	if err != nil || hashContent(string(data)) != s.config {
+		s.config = ""
+		if err == nil {
+			s.config = hashContent(string(data))
+		}
+		clear(s.fingerprints)
+		clear(s.results)
+		clear(s.hashes)
+		return nil
+	}
+
+	previous := make(transpiler.Fingerprints, len(s.fingerprints))
+	for path, fingerprint := range s.fingerprints {
+		if _, err := os.Stat(path); err == nil {
+			previous[path] = fingerprint
+		}
+	}
+	return previous
+}
+
+// unchanged returns the output at path as recorded by the build that wrote it, and its
+// content hash, for a rebuild that skipped it
+func (s *outputState) unchanged(path string) (transpiler.FileResult, string, bool) {
+	result, ok := s.results[path]
+	return result, s.hashes[path], ok
+}
+
+// forget drops what is recorded for the output at path, whose write failed
+func (s *outputState) forget(path string) {
+	delete(s.fingerprints, path)
+	delete(s.results, path)
+	delete(s.hashes, path)
+}
+
+// update records the outputs build wrote, with fingerprints from the transpiler that
+// produced them. Outputs it did not write keep what is recorded for them, since their
+// files are as an earlier build left them.
+func (s *outputState) update(build *buildResult, fingerprints transpiler.Fingerprints) {
+	for _, result := range build.outputs {
+		fingerprint, ok := fingerprints[result.OutputPath]
+		if !ok {
+			continue // Not transpiler output, such as PeakRegistry.cls
+		}
+		s.fingerprints[result.OutputPath] = fingerprint
+		s.results[result.OutputPath] = result
+		s.hashes[result.OutputPath] = build.outputHashes[result.OutputPath]
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+func TestWatchSession_Incremental(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Stack.peak":   "public class Stack<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> queue;\n    private Stack<String> stack;\n}",
+		"Other.peak":   "public class Other {\n    private Stack<Integer> stack;\n}",
+	}
+	const marker = "// Left by an earlier build\n"
+
+	tests := []struct {
+		name        string
+		change      map[string]string
+		regenerated []string
+		outputs     []string
+	}{
+		{
+			name:    "no change",
+			outputs: []string{"Example.cls", "Other.cls", "QueueInteger.cls", "StackInteger.cls", "StackString.cls"},
+		},
+		{
+			name:        "template",
+			change:      map[string]string{"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n    private Integer size;\n}"},
+			regenerated: []string{"Example.cls", "QueueInteger.cls"},
+			outputs:     []string{"Example.cls", "Other.cls", "QueueInteger.cls", "StackInteger.cls", "StackString.cls"},
+		},
+		{
+			name:        "usage added",
+			change:      map[string]string{"Other.peak": "public class Other {\n    private Stack<Integer> stack;\n    private Queue<Long> queue;\n}"},
+			regenerated: []string{"Other.cls", "QueueLong.cls"},
+			outputs:     []string{"Example.cls", "Other.cls", "QueueInteger.cls", "QueueLong.cls", "StackInteger.cls", "StackString.cls"},
+		},
+		{
+			name:        "usage removed",
+			change:      map[string]string{"Other.peak": "public class Other {\n    private Stack<String> stack;\n}"},
+			regenerated: []string{"Other.cls"},
+			outputs:     []string{"Example.cls", "Other.cls", "QueueInteger.cls", "StackString.cls"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeProject(t, dir, files)
+			// --force lets the rebuild replace the outputs marked below
+			session := &watchSession{dir: dir, flags: config.CLIFlags{Force: true}, cache: newSourceCache(), state: newOutputState(), started: time.Now()}
+			if err := session.build(); err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+
+			// Mark every output, so those the rebuild skips keep the mark
+			for path := range session.outputs {
+				writeProject(t, dir, map[string]string{filepath.Base(path): readFile(t, path) + marker})
+			}
+			writeProject(t, dir, tt.change)
+			if err := session.build(); err != nil {
+				t.Fatalf("rebuild failed: %v", err)
+			}
+
+			var outputs, regenerated []string
+			for path := range session.outputs {
+				outputs = append(outputs, filepath.Base(path))
+				if !strings.HasSuffix(readFile(t, path), marker) {
+					regenerated = append(regenerated, filepath.Base(path))
+				}
+			}
+			sort.Strings(outputs)
+			sort.Strings(regenerated)
+			if !reflect.DeepEqual(outputs, tt.outputs) {
+				t.Errorf("expected outputs %v, got %v", tt.outputs, outputs)
+			}
+			if !reflect.DeepEqual(regenerated, tt.regenerated) {
+				t.Errorf("expected %v to be regenerated, got %v", tt.regenerated, regenerated)
+			}
+		})
+	}
+}
+
+func TestOutputState_Previous(t *testing.T) {
+	dir := t.TempDir()
+	writeProject(t, dir, map[string]string{"Kept.cls": "kept"})
+	kept, removed := filepath.Join(dir, "Kept.cls"), filepath.Join(dir, "Removed.cls")
+
+	cfg := &config.Config{SourceDir: dir}
+	state := newOutputState()
+	if previous := state.previous(cfg); previous != nil {
+		t.Fatalf("expected nothing to skip in a new state, got %v", previous)
+	}
+	state.fingerprints[kept] = "a"
+	state.fingerprints[removed] = "b"
+	if previous := state.previous(cfg); len(previous) != 1 || previous[kept] != "a" {
+		t.Errorf("expected only the output on disk to be skippable, got %v", previous)
+	}
+
+	// A changed configuration can change any output
+	if previous := state.previous(&config.Config{SourceDir: dir, OutDir: filepath.Join(dir, "classes")}); previous != nil || len(state.fingerprints) != 0 {
+		t.Errorf("expected a new configuration to discard the state, got %v", previous)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lockFile     = ".peak.lock"           // Written to the output directory while a build writes to it
+	lockInterval = 100 * time.Millisecond // Delay between attempts to take the lock
+)
+
+var lockTimeout = 30 * time.Second // How long a build waits for another one to finish; shortened by tests
+
+// acquireBuildLock takes the lock on dir, the directory a build writes to, so a
+// manual run and a watcher never interleave their writes. If another run holds it,
+// acquireBuildLock waits up to lockTimeout for that run to finish. The returned
+// function releases the lock.
+func acquireBuildLock(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, lockFile)
+	deadline := time.Now().Add(lockTimeout)
+	waiting := false
+	for {
+		release, err := tryLock(path)
+		if err != nil || release != nil {
+			return release, err
+		}
+		holder := lockHolder(path)
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("another peak run (%s) is still writing outputs; gave up waiting after %s%s", holder, lockTimeout, staleLockHint(path))
+		}
+		if !waiting {
+			logger.Info("Waiting for another peak run to finish", "holder", holder, "lock", path)
+			waiting = true
+		}
+		time.Sleep(lockInterval)
+	}
+}
+
+// writeLockHolder records the current process in the lock file f, for messages of
+// runs waiting for it
+func writeLockHolder(f *os.File) {
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+}
+
+// lockHolder describes the run holding the lock at path, as recorded by writeLockHolder
+func lockHolder(path string) string {
+	content, err := os.ReadFile(path)
+	if pid := strings.TrimSpace(string(content)); err == nil && pid != "" {
+		return "pid " + pid
+	}
+	return "unknown process"
+}
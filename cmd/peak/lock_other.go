@@ -0,0 +1,32 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock takes the lock at path without waiting by creating the file, which fails
+// if it exists. It returns a nil release function if another process holds the
+// lock. Releasing the lock removes the file.
+func tryLock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, filePermission)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	writeLockHolder(f)
+	return func() {
+		f.Close()
+		os.Remove(path)
+	}, nil
+}
+
+// staleLockHint is appended to lock timeout errors: a run that crashed leaves its
+// lock file behind
+func staleLockHint(path string) string {
+	return "; if that run is no longer active, delete " + path
+}
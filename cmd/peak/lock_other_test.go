@@ -0,0 +1,31 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireBuildLock_Stale(t *testing.T) {
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 3 * lockInterval
+
+	// A run that crashed leaves its lock file, which only the user can tell is stale
+	dir := t.TempDir()
+	path := filepath.Join(dir, lockFile)
+	if err := os.WriteFile(path, []byte("999999\n"), filePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := acquireBuildLock(dir)
+	if release != nil || err == nil {
+		t.Fatal("expected the run to give up on the lock")
+	}
+	if !strings.Contains(err.Error(), "pid 999999") || !strings.Contains(err.Error(), "delete "+path) {
+		t.Errorf("expected the error to name the holder and the lock file, got %v", err)
+	}
+}
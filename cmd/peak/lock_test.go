@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireBuildLock_Waits(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "classes")
+	release, err := acquireBuildLock(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(dir, lockFile)
+	if holder := lockHolder(path); holder != "pid "+strconv.Itoa(os.Getpid()) {
+		t.Errorf("expected the lock to name this process, got %s", holder)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		second, err := acquireBuildLock(dir)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the second run to wait while the lock is held")
+	case <-time.After(3 * lockInterval):
+	}
+	release()
+
+	select {
+	case second := <-acquired:
+		if second == nil {
+			t.Fatal("expected the second run to take the lock")
+		}
+		second()
+	case <-time.After(lockTimeout):
+		t.Fatal("expected the second run to take the lock once it was released")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+}
+
+func TestAcquireBuildLock_Timeout(t *testing.T) {
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 3 * lockInterval
+
+	dir := t.TempDir()
+	release, err := acquireBuildLock(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	second, err := acquireBuildLock(dir)
+	if second != nil || err == nil {
+		t.Fatal("expected the second run to give up while the lock is held")
+	}
+	if pid := "pid " + strconv.Itoa(os.Getpid()); !strings.Contains(err.Error(), pid) || !strings.Contains(err.Error(), "gave up waiting") {
+		t.Errorf("expected the error to name the holder %s, got %v", pid, err)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes an advisory lock on the file at path without waiting. It returns a
+// nil release function if another process holds the lock. The operating system
+// releases the lock if the process dies, so a crashed run never blocks later ones.
+// Releasing the lock removes the file, so none is left in the project.
+func tryLock(path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, filePermission)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		// The previous holder may have removed the file between our open and lock;
+		// the lock is then on a file nobody else sees, so start over
+		locked, err := f.Stat()
+		current, statErr := os.Stat(path)
+		if err != nil || statErr != nil || !os.SameFile(locked, current) {
+			f.Close()
+			continue
+		}
+		writeLockHolder(f)
+		return func() {
+			os.Remove(path) // Before unlocking, so waiting runs lock a new file
+			syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			f.Close()
+		}, nil
+	}
+}
+
+// staleLockHint is appended to lock timeout errors; locks cannot go stale here
+func staleLockHint(path string) string {
+	return ""
+}
@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireBuildLock_Stale(t *testing.T) {
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 3 * lockInterval
+
+	// A run that crashed leaves its lock file, but no lock on it
+	dir := t.TempDir()
+	path := filepath.Join(dir, lockFile)
+	if err := os.WriteFile(path, []byte("999999\n"), filePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := acquireBuildLock(dir)
+	if err != nil {
+		t.Fatalf("expected a stale lock to be taken over, got %v", err)
+	}
+	if holder := lockHolder(path); holder == "pid 999999" {
+		t.Errorf("expected the lock to name this process, got %s", holder)
+	}
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+// Log formats selectable with --log-format
+const (
+	logFormatText = "text" // Plain messages, as Peak has always printed them (default)
+	logFormatJSON = "json" // One JSON object per record, for log collectors
+)
+
+// logger receives everything Peak reports besides diagnostics and the output table:
+// fatal errors, warnings about side outputs, watch events and debug details.
+// Until setupLogging runs, it writes plain messages to stderr.
+var logger = slog.New(newHumanHandler(os.Stderr, slog.LevelInfo))
+
+// setupLogging configures logger from the --log-level, --log-format and --log-file
+// flags. --verbose lowers the default level to debug. The returned function closes
+// the log file, if any.
+func setupLogging(flags config.CLIFlags) (func(), error) {
+	level := slog.LevelInfo
+	if flags.Verbose {
+		level = slog.LevelDebug
+	}
+	if flags.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(flags.LogLevel)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", flags.LogLevel)
+		}
+	}
+
+	var w io.Writer = os.Stderr
+	closeLog := func() {}
+	if flags.LogFile != "" {
+		f, err := os.OpenFile(flags.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePermission)
+		if err != nil {
+			return nil, fmt.Errorf("could not open log file: %w", err)
+		}
+		w = f
+		closeLog = func() { f.Close() }
+	}
+
+	switch flags.LogFormat {
+	case "", logFormatText:
+		handler := newHumanHandler(w, level)
+		handler.timestamps = flags.Watch || flags.LogFile != ""
+		logger = slog.New(handler)
+	case logFormatJSON:
+		logger = slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+	default:
+		closeLog()
+		return nil, fmt.Errorf("unknown log format %q (expected text or json)", flags.LogFormat)
+	}
+	return closeLog, nil
+}
+
+// humanHandler is a slog.Handler that writes each record on one line as a plain
+// message, prefixed with "Error:" for errors and "WARNING" for warnings, followed
+// by its attributes as key=value pairs
+type humanHandler struct {
+	w          io.Writer
+	mu         *sync.Mutex // Shared by handlers derived with WithAttrs and WithGroup
+	level      slog.Leveler
+	timestamps bool   // Prefix records with the time, e.g. [15:04:05] in watch mode
+	attrs      string // Preformatted attributes added with WithAttrs
+	group      string // Key prefix from WithGroup, e.g. "build."
+}
+
+// newHumanHandler creates a handler writing records at level or above to w
+func newHumanHandler(w io.Writer, level slog.Leveler) *humanHandler {
+	return &humanHandler{w: w, mu: &sync.Mutex{}, level: level}
+}
+
+// Enabled reports whether records at level are written
+func (h *humanHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes a record
+func (h *humanHandler) Handle(_ context.Context, r slog.Record) error {
+	var b bytes.Buffer
+	if h.timestamps && !r.Time.IsZero() {
+		fmt.Fprintf(&b, "[%s] ", r.Time.Format(timeFormat))
+	}
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("WARNING ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("DEBUG ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.group, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b.Bytes())
+	return err
+}
+
+// WithAttrs returns a handler that writes attrs with every record
+func (h *humanHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b bytes.Buffer
+	for _, a := range attrs {
+		writeAttr(&b, h.group, a)
+	}
+	derived := *h
+	derived.attrs += b.String()
+	return &derived
+}
+
+// WithGroup returns a handler that qualifies the keys of later attributes with name
+func (h *humanHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	derived := *h
+	derived.group += name + "."
+	return &derived
+}
+
+// writeAttr appends " key=value" to b, quoting values that contain spaces
+func writeAttr(b *bytes.Buffer, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		prefix := group
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			writeAttr(b, prefix, member)
+		}
+		return
+	}
+
+	value := a.Value.String()
+	if a.Value.Kind() == slog.KindDuration {
+		value = a.Value.Duration().Round(time.Microsecond).String()
+	}
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", group, a.Key, value)
+}
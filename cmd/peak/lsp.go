@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/lsp"
+)
+
+// runLsp serves the project in the directory args name, or the current directory,
+// to an editor over the Language Server Protocol on stdin and stdout
+func runLsp(args []string) error {
+	dir := "."
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			printUsage()
+			return nil
+		}
+		if arg == "--stdio" {
+			continue // Passed by editors that launch servers generically; stdio is the only transport
+		}
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("unknown flag %s", arg)
+		}
+		if dir != "." {
+			return fmt.Errorf("too many arguments")
+		}
+		dir = arg
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// stdout carries the protocol, so logs go to stderr only
+	logger.Info("Peak language server started", "directory", root)
+	return lsp.NewServer(os.Stdin, os.Stdout, func(overlay map[string]string) (*lsp.Snapshot, error) {
+		return lspBuild(root, overlay)
+	}).Run()
+}
+
+// lspBuild transpiles the project in root in memory, with the text of open documents
+// in overlay in place of their files on disk. Configuration is reloaded on every
+// build, so edits to peakconfig.json apply without restarting the server.
+func lspBuild(root string, overlay map[string]string) (*lsp.Snapshot, error) {
+	cfg, err := config.LoadConfig(root, config.CLIFlags{})
+	if err != nil {
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+
+	snap := overlayTree{overlay: overlay, limit: cfg.MaxFileSize}
+	peakFiles, err := snap.peakFiles(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error finding .peak files: %w", err)
+	}
+	files, err := snap.contents(peakFiles)
+	if err != nil {
+		return nil, err
+	}
+	results, tr, err := transpileProject(cfg, files, snapshotReader(snap))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &lsp.Snapshot{Root: root, Results: results, Templates: tr.Templates()}
+	for _, d := range tr.Warnings() {
+		snapshot.Diagnostics = append(snapshot.Diagnostics, promoteWarning(cfg, d))
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			snapshot.Diagnostics = append(snapshot.Diagnostics, diagnostic.FromError(result.OriginalPath, result.Error))
+		}
+	}
+	return snapshot, nil
+}
+
+// overlayTree reads files from disk, except for documents open in the editor, whose
+// unsaved text is read instead
+type overlayTree struct {
+	overlay map[string]string // Text by absolute path
+	limit   int64             // Maximum size of a file read from disk (cfg.MaxFileSize, 0 = no limit)
+}
+
+func (t overlayTree) peakFiles(cfg *config.Config) ([]string, error) {
+	paths, err := findPeakFiles(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Open documents that have not been saved yet
+	found := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		found[path] = true
+	}
+	for path := range t.overlay {
+		rel, err := filepath.Rel(cfg.SourceDir, path)
+		if found[path] || err != nil || strings.HasPrefix(rel, "..") || filepath.Ext(path) != peakExtension {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (t overlayTree) contents(paths []string) (map[string]string, error) {
+	var onDisk []string
+	contents := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if text, ok := t.overlay[path]; ok {
+			contents[path] = text
+		} else {
+			onDisk = append(onDisk, path)
+		}
+	}
+	files, err := readFiles(onDisk, t.limit, true)
+	if err != nil {
+		return nil, err
+	}
+	for path, content := range files {
+		contents[path] = content
+	}
+	return contents, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverlayTreeContents(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "Small.peak")
+	large := filepath.Join(dir, "Large.peak")
+	open := filepath.Join(dir, "Open.peak")
+	for path, content := range map[string]string{
+		small: "public class Small {}",
+		large: "public class Large {" + strings.Repeat(" ", 100) + "}",
+		open:  "public class Open {}",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree := overlayTree{overlay: map[string]string{open: "public class Open { Integer edited; }"}, limit: 64}
+	files, err := tree.contents([]string{small, open, filepath.Join(dir, "Missing.peak")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files[small] != "public class Small {}" || files[open] != "public class Open { Integer edited; }" || len(files) != 2 {
+		t.Errorf("expected the file on disk and the unsaved text, got %v", files)
+	}
+
+	var tooLarge *sourceTooLargeError
+	if _, err := tree.contents([]string{large}); !errors.As(err, &tooLarge) {
+		t.Errorf("expected a file above the limit to be rejected, got %v", err)
+	}
+}
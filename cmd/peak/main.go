@@ -4,106 +4,368 @@
 //   - Compile mode: transpile all .peak files in a directory once
 //   - Watch mode: continuously monitor and recompile on changes
 //
+// It also provides helper commands:
+//   - verify (or check): check sources and generated outputs without writing anything
+//   - audit: list generated outputs that no source produces any more
+//   - clean: delete generated outputs that no source produces any more
+//   - stats: report how the project uses each template
+//   - upgrade: regenerate outputs of older Peak versions and report what changed
+//   - resolve-stack: rewrite Apex stack traces to point at .peak sources
+//   - explain: describe a diagnostic code
+//   - lsp: serve diagnostics, navigation and completion to editors
+//
 // Usage:
 //
 //	peak [directory] [--watch]
+//	peak watch [directory] [--exec <command>]
+//	peak verify [directory] [--staged] [--diff]
+//	peak --verify [directory] [--diff]
+//	peak audit [directory]
+//	peak clean [directory]
+//	peak stats [directory]
+//	peak upgrade [directory] [--diff]
+//	peak resolve-stack [directory] < trace.txt
+//	peak explain [code]
+//	peak lsp [directory]
 package main
 
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
 )
 
 func main() {
 	args := os.Args[1:]
-	watchMode := false
-	rootDir := ""
-	outDir := ""
-	apiVersion := ""
+
+	// Dispatch helper commands that take their own arguments
+	if len(args) > 0 && (args[0] == "resolve-stack" || args[0] == "explain" || args[0] == "--explain" || args[0] == "lsp") {
+		run := runResolveStack
+		switch args[0] {
+		case "explain", "--explain":
+			run = runExplain
+		case "lsp":
+			run = runLsp
+		}
+		if err := run(args[1:]); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Commands that share the compile flags
+	command := ""
+	if len(args) > 0 && (args[0] == "verify" || args[0] == "check" || args[0] == "audit" || args[0] == "clean" || args[0] == "stats" || args[0] == "upgrade" || args[0] == "watch") {
+		command = args[0]
+		args = args[1:]
+	}
+	if command == "check" {
+		command = "verify" // check is another name for verify
+	}
+
+	dir, flags := parseArgs(args)
+	if command == "watch" {
+		command, flags.Watch = "", true
+	}
+	if flags.Format == formatJSON && (command != "" || flags.Verify) {
+		usageError("--format json only applies to compiling and --watch, not to verify, audit, clean, stats or upgrade")
+	}
+	if flags.Format == formatSARIF && (command != "" || flags.Verify || flags.Watch) {
+		usageError("--format sarif only applies to compiling, not to --watch, verify, audit, clean, stats or upgrade")
+	}
+	if (flags.Format == formatJSON || flags.Format == formatSARIF) && flags.Events != "" {
+		usageError("--format %s and --events both write to stdout; use one of them", flags.Format)
+	}
+	if flags.Prune && (command != "" || flags.Verify || flags.Files != "") {
+		usageError("--prune only applies to compiling and --watch, not to --files, verify, audit, clean, stats or upgrade")
+	}
+	if flags.Files != "" && (command != "" || flags.Verify || flags.Watch) {
+		usageError("--files only applies to compiling, not to verify, audit, stats, upgrade or --watch")
+	}
+	if flags.Exec != "" && (command != "" || flags.Verify || !flags.Watch) {
+		usageError("--exec only applies to --watch")
+	}
+	if flags.Deploy && (command != "" || flags.Verify) {
+		usageError("--deploy only applies to compiling and --watch, not to verify, audit, clean, stats or upgrade")
+	}
+	if flags.TargetOrg != "" && !flags.Deploy {
+		usageError("--target-org only applies to --deploy")
+	}
+
+	closeLog, err := setupLogging(flags)
+	if err != nil {
+		usageError("%v", err)
+	}
+	defer closeLog()
+
+	stopProfiling, err := startProfiling(flags.CPUProfile, flags.MemProfile)
+	if err != nil {
+		logger.Error(err.Error())
+		closeLog()
+		os.Exit(1)
+	}
+
+	// Run in verify, audit, clean, stats, upgrade, watch or compile mode
+	switch {
+	case command == "verify" || flags.Verify:
+		err = runVerify(dir, flags)
+	case command == "audit":
+		err = runAudit(dir, flags)
+	case command == "clean":
+		err = runClean(dir, flags)
+	case command == "stats":
+		err = runStats(dir, flags)
+	case command == "upgrade":
+		err = runUpgrade(dir, flags)
+	case flags.Watch:
+		err = runWatch(dir, flags)
+	default:
+		err = runFolder(dir, flags)
+	}
+	stopProfiling()
+
+	if err != nil {
+		logger.Error(err.Error())
+		closeLog()
+		os.Exit(1)
+	}
+}
+
+// usageError reports invalid arguments, prints usage and exits
+func usageError(format string, args ...any) {
+	logger.Error(fmt.Sprintf(format, args...))
+	fmt.Fprintln(os.Stderr)
+	printUsage()
+	os.Exit(1)
+}
+
+// parseArgs parses [directory] and option flags, exiting with usage on invalid input.
+func parseArgs(args []string) (string, config.CLIFlags) {
+	flags := config.CLIFlags{Format: formatText}
 	dir := "."
 
-	// Parse arguments: [directory] [--watch] [--root-dir <dir>] [--out-dir <dir>] [--api-version <version>] [--help]
+	// value returns the argument following flag i, exiting if it is missing
+	value := func(i int, kind string) string {
+		if i+1 >= len(args) {
+			usageError("%s requires a %s argument", args[i], kind)
+		}
+		return args[i+1]
+	}
+
+	// Parse arguments: [directory] [--watch] [--verbose] [--root-dir <dir>] [--out-dir <dir>] [--api-version <version>] [--report <path>] [--metrics <path>] [--format <format>] [--source-map] [--package <zip>] [--registry] [--tooling] [--doc-comments] [--dynamic-types] [--factories] [--holder-classes] [--max-classes <n>] [--max-errors <n>] [--define <symbol>] [--self-check] [--sfdx] [--force] [--prune] [--fail-on-warning] [--low-memory] [--cache-dir <dir>] [--cpuprofile <file>] [--memprofile <file>] [--log-level <level>] [--log-format <format>] [--log-file <path>] [--staged] [--verify|--check] [--diff] [--files <path>] [--events <format>] [--exec <command>] [--deploy] [--target-org <org>] [--version] [--help]
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		if arg == "--help" || arg == "-h" {
 			printUsage()
 			os.Exit(0)
+		} else if arg == "--version" {
+			fmt.Println("peak", versionLabel(peakVersion()))
+			os.Exit(0)
 		} else if arg == "--watch" || arg == "-w" {
-			watchMode = true
+			flags.Watch = true
+		} else if arg == "--verbose" || arg == "-v" {
+			flags.Verbose = true
 		} else if arg == "--root-dir" || arg == "-r" {
-			if i+1 >= len(args) {
-				fmt.Fprintf(os.Stderr, "Error: %s requires a directory argument\n\n", arg)
-				printUsage()
-				os.Exit(1)
-			}
+			flags.RootDir = value(i, "directory")
 			i++
-			rootDir = args[i]
 		} else if arg == "--out-dir" || arg == "-o" {
-			if i+1 >= len(args) {
-				fmt.Fprintf(os.Stderr, "Error: %s requires a directory argument\n\n", arg)
-				printUsage()
-				os.Exit(1)
-			}
+			flags.OutDir = value(i, "directory")
 			i++
-			outDir = args[i]
 		} else if arg == "--api-version" || arg == "-a" {
-			if i+1 >= len(args) {
-				fmt.Fprintf(os.Stderr, "Error: %s requires a version argument\n\n", arg)
-				printUsage()
-				os.Exit(1)
+			flags.ApiVersion = value(i, "version")
+			i++
+		} else if arg == "--report" {
+			flags.ReportPath = value(i, "path")
+			i++
+		} else if arg == "--metrics" {
+			flags.MetricsPath = value(i, "path")
+			i++
+		} else if arg == "--format" || arg == "-f" {
+			flags.Format = value(i, "format")
+			i++
+			if !isValidFormat(flags.Format) {
+				usageError("unknown format %q (expected text, plain, json or sarif)", flags.Format)
 			}
+		} else if arg == "--source-map" {
+			flags.SourceMap = true
+		} else if arg == "--package" {
+			flags.Package = value(i, "path")
+			i++
+		} else if arg == "--registry" {
+			flags.Registry = true
+		} else if arg == "--tooling" {
+			flags.Tooling = true
+		} else if arg == "--doc-comments" {
+			flags.DocComments = true
+		} else if arg == "--dynamic-types" {
+			flags.DynamicTypes = true
+		} else if arg == "--factories" {
+			flags.Factories = true
+		} else if arg == "--holder-classes" {
+			flags.HolderClasses = true
+		} else if arg == "--max-classes" {
+			n, err := strconv.Atoi(value(i, "count"))
+			if err != nil || n <= 0 {
+				usageError("--max-classes requires a positive number, got %q", args[i+1])
+			}
+			flags.MaxClasses = n
+			i++
+		} else if arg == "--max-errors" {
+			n, err := strconv.Atoi(value(i, "count"))
+			if err != nil || n <= 0 {
+				usageError("--max-errors requires a positive number, got %q", args[i+1])
+			}
+			flags.MaxErrors = n
+			i++
+		} else if arg == "--define" || arg == "-D" {
+			symbol := value(i, "symbol")
+			if !config.IsSymbol(symbol) {
+				usageError("--define requires a name such as TEST, got %q", symbol)
+			}
+			flags.Define = append(flags.Define, symbol)
+			i++
+		} else if arg == "--self-check" {
+			flags.SelfCheck = true
+		} else if arg == "--sfdx" {
+			flags.Sfdx = true
+		} else if arg == "--force" {
+			flags.Force = true
+		} else if arg == "--fail-on-warning" {
+			flags.FailOnWarning = true
+		} else if arg == "--prune" {
+			flags.Prune = true
+		} else if arg == "--low-memory" {
+			flags.LowMemory = true
+		} else if arg == "--cache-dir" {
+			flags.CacheDir = value(i, "directory")
+			i++
+		} else if arg == "--cpuprofile" {
+			flags.CPUProfile = value(i, "file")
+			i++
+		} else if arg == "--memprofile" {
+			flags.MemProfile = value(i, "file")
+			i++
+		} else if arg == "--log-level" {
+			flags.LogLevel = value(i, "level")
+			i++
+		} else if arg == "--log-format" {
+			flags.LogFormat = value(i, "format")
+			i++
+		} else if arg == "--log-file" {
+			flags.LogFile = value(i, "path")
+			i++
+		} else if arg == "--staged" {
+			flags.Staged = true
+		} else if arg == "--verify" || arg == "--check" {
+			flags.Verify = true
+		} else if arg == "--diff" {
+			flags.Diff = true
+		} else if arg == "--events" {
+			flags.Events = value(i, "format")
+			i++
+			if flags.Events != eventsNDJSON {
+				usageError("unknown event format %q (expected ndjson)", flags.Events)
+			}
+		} else if arg == "--exec" {
+			flags.Exec = value(i, "command")
+			i++
+		} else if arg == "--deploy" {
+			flags.Deploy = true
+		} else if arg == "--target-org" {
+			flags.TargetOrg = value(i, "org")
+			i++
+		} else if arg == "--files" {
+			flags.Files = value(i, "path")
 			i++
-			apiVersion = args[i]
 		} else if !strings.HasPrefix(arg, "-") {
 			if dir == "." {
 				// First non-flag argument is the directory
 				dir = arg
 			} else {
 				// Too many arguments
-				fmt.Fprintf(os.Stderr, "Error: too many arguments\n\n")
-				printUsage()
-				os.Exit(1)
+				usageError("too many arguments")
 			}
 		} else {
-			fmt.Fprintf(os.Stderr, "Error: unknown flag %s\n\n", arg)
-			printUsage()
-			os.Exit(1)
+			usageError("unknown flag %s", arg)
 		}
 	}
 
-	// Run in watch or compile mode
-	var err error
-	if watchMode {
-		err = runWatch(dir, rootDir, outDir, apiVersion)
-	} else {
-		err = runFolder(dir, rootDir, outDir, apiVersion)
-	}
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+	return dir, flags
 }
 
 func printUsage() {
-	// ANSI color codes
-	const (
-		blue     = "\033[34m"
-		boldBlue = "\033[1;34m"
-		green    = "\033[32m"
-		reset    = "\033[0m"
-	)
+	// Colored like diagnostics; an invalid PEAK_COLORS is reported once a command runs
+	t, _ := resolveTheme("", nil)
+	blue, boldBlue, green, reset := t.path, t.count, t.success, t.reset
 
 	fmt.Fprintf(os.Stderr, "Peak to Apex Transpiler\n\n")
 	fmt.Fprintf(os.Stderr, "%sUSAGE%s\n", boldBlue, reset)
-	fmt.Fprintf(os.Stderr, "  %s$ %speak%s [directory] [options]\n\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s [directory] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s watch [directory] [--exec <command>] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s verify [directory] [--staged] [--diff] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s audit [directory] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s clean [directory] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s stats [directory] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s upgrade [directory] [--diff] [options]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s resolve-stack [directory] < trace.txt\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s explain [code]\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s lsp [directory]\n\n", green, reset, reset)
 	fmt.Fprintf(os.Stderr, "%sOPTIONS%s\n", boldBlue, reset)
 	fmt.Fprintf(os.Stderr, "  %s--help, -h%s                   Display this help message\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--version%s                    Print the Peak version\n", blue, reset)
 	fmt.Fprintf(os.Stderr, "  %s--watch, -w%s                  Watch for changes and recompile\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--exec%s <command>             With --watch, run <command> after each successful rebuild\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--deploy%s                     Deploy generated classes with sf after a successful build (changed ones with --watch)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--target-org%s <org>           With --deploy, deploy to <org> instead of the sf default org\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--verbose, -v%s                Print every file as it is generated, with timings, instead of a summary table\n", blue, reset)
 	fmt.Fprintf(os.Stderr, "  %s--root-dir, -r%s <dir>         Root directory for preserving structure (overrides config)\n", blue, reset)
 	fmt.Fprintf(os.Stderr, "  %s--out-dir, -o%s <dir>          Output directory (overrides config file)\n", blue, reset)
-	fmt.Fprintf(os.Stderr, "  %s--api-version, -a%s <version>  Salesforce API version for .cls-meta.xml (default: 65.0)\n\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--api-version, -a%s <version>  Salesforce API version for .cls-meta.xml (default: sfdx-project.json, else 65.0)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--sfdx%s                       Write outputs to the classes directory of the default SFDX package directory\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--report%s <path>              Write a JSON build report (for CI artifacts)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--metrics%s <path>             Write build metrics as JSON, or a Prometheus textfile if <path> ends in .prom\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--format, -f%s <format>        Output format: text (default), plain (single-line, uncolored), json (build report on stdout) or sarif (SARIF log on stdout)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--events%s <format>            Stream build events to stdout as they happen: ndjson (one JSON object per line)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--source-map%s                 Write .peak.map sidecars for stack trace resolution\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--package%s <zip>              Package generated classes into an MDAPI zip with package.xml\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--registry%s                   Generate PeakRegistry.cls mapping generic expressions to classes\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--tooling%s                    Write .peak-tooling.json for IDE navigation\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--doc-comments%s               Rewrite generic references such as @see Queue<Integer> in doc comments\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--dynamic-types%s              Rewrite Type.forName('Queue<Integer>') and JSON.deserialize type strings\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--factories%s                  Generate a factory class such as QueueFactory for each template\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--holder-classes%s             Generate instantiations as inner classes such as Queues.Integer_\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--max-classes%s <n>            Warn when a run would generate more than <n> concrete classes\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--max-errors%s <n>             Print the first <n> errors and count the rest\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--define, -D%s <symbol>        Define <symbol> for // peak:if sections (repeatable)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--self-check%s                 Re-parse generated files to catch substitution bugs before writing them\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--files%s <path>               Compile only the .peak files listed in <path>, or on stdin for -\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--force%s                      Overwrite .cls files that Peak did not generate\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--prune%s                      After a successful build, delete generated .cls files no source produces any more\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--fail-on-warning%s            Report every warning as an error, so warnings fail the build\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--low-memory%s                 Read sources on demand for very large projects\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--cache-dir%s <dir>            Cache parsed templates in <dir> to speed up cold starts\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--cpuprofile%s <file>          Write a CPU profile (go tool pprof) for performance reports\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--memprofile%s <file>          Write a heap profile on exit\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--log-level%s <level>          Log level: debug, info (default; debug with --verbose), warn or error\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--log-format%s <format>        Log format: text (default) or json\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %s--log-file%s <path>            Append log messages to <path> instead of stderr\n\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "%sCOMMANDS%s\n", boldBlue, reset)
+	fmt.Fprintf(os.Stderr, "  %swatch%s [directory]             Same as --watch\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %sverify%s [directory]            Fail on errors or stale outputs without writing files (alias: check)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "    %s--staged%s                   Check staged .peak files and outputs in the git index (pre-commit)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "    %s--diff%s                     Print a unified diff of every stale output\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "    %s--verify%s                   Same as the verify command, e.g. peak --verify --diff src/ (alias: --check)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %saudit%s [directory]             List generated .cls files that no source produces any more\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %sclean%s [directory]             Delete generated .cls files that no source produces any more\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %sstats%s [directory]             Report instantiations, users, generated lines and unused type parameters of each template\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %supgrade%s [directory]           Regenerate outputs of older Peak versions and list what changed (--diff to show it)\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %sresolve-stack%s [directory]     Rewrite an Apex stack trace on stdin to .peak locations\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %sexplain%s [code]                Describe a diagnostic code such as PEAK101, or list all codes\n", blue, reset)
+	fmt.Fprintf(os.Stderr, "  %slsp%s [directory]               Run a language server for editors on stdin and stdout\n\n", blue, reset)
 	fmt.Fprintf(os.Stderr, "%sEXAMPLES%s\n", boldBlue, reset)
 	fmt.Fprintf(os.Stderr, "  %s$ %speak%s                                        # Compile current directory\n", green, reset, reset)
 	fmt.Fprintf(os.Stderr, "  %s$ %speak%s examples/                              # Compile specific directory\n", green, reset, reset)
@@ -111,9 +373,14 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --out-dir build/ src/                  # Output to build/\n", green, reset, reset)
 	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --root-dir . --out-dir build/ src/     # Preserve structure from root\n", green, reset, reset)
 	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --api-version 64.0 src/                # Use API version 64.0\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --report peak-report.json src/         # Write a CI build report\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --format plain src/                    # Problem-matcher friendly output\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --package dist/peak.zip src/           # Build a deployable MDAPI zip\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --verify --diff src/                   # Fail in CI if committed outputs are stale\n", green, reset, reset)
+	fmt.Fprintf(os.Stderr, "  %s$ %sgit diff --name-only -z | peak --files -%s    # Compile changed sources only\n", green, reset, reset)
 	fmt.Fprintf(os.Stderr, "  %s$ %speak%s --watch --out-dir dist/                # Watch and output to dist/\n\n", green, reset, reset)
 	fmt.Fprintf(os.Stderr, "%sCONFIGURATION%s\n", boldBlue, reset)
 	fmt.Fprintf(os.Stderr, "  Config file: peakconfig.json in source directory\n")
 	fmt.Fprintf(os.Stderr, "  Default: Output .cls files co-located with source .peak files\n")
-	fmt.Fprintf(os.Stderr, "  Default API version: 65.0\n")
+	fmt.Fprintf(os.Stderr, "  Default API version: sourceApiVersion from sfdx-project.json, else 65.0\n")
 }
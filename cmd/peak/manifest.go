@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const (
+	manifestFile    = ".peak-manifest.json" // Written to the output directory
+	manifestVersion = 1                     // Bumped whenever the schema changes incompatibly
+)
+
+// outputManifest records the content hash of every output Peak wrote under dir, so
+// generated files edited by hand since can be told apart from Peak's own output, and
+// the project that wrote it, since projects may share an output directory
+type outputManifest struct {
+	dir     string
+	project string            // Source directory of the project building, relative to dir
+	Version int               `json:"version"`
+	Outputs map[string]string `json:"outputs"`          // Slash path relative to dir to content hash
+	Owners  map[string]string `json:"owners,omitempty"` // Slash path relative to dir to the source directory of the project that wrote it, relative to dir
+	Names   map[string]string `json:"names,omitempty"`  // Shortened class name to the instantiation it was generated for
+}
+
+// loadManifest reads the manifest of dir for the project in sourceDir. A missing or
+// unreadable manifest, or one written by a different Peak version, is empty: hand
+// edits go undetected until the next build records the outputs.
+func loadManifest(dir, sourceDir string) *outputManifest {
+	project := "."
+	if rel, err := filepath.Rel(dir, sourceDir); err == nil {
+		project = filepath.ToSlash(rel)
+	}
+	m := &outputManifest{dir: dir, project: project, Version: manifestVersion, Outputs: make(map[string]string), Owners: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m
+	}
+	var file outputManifest
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != manifestVersion || file.Outputs == nil {
+		return m
+	}
+	m.Outputs = file.Outputs
+	if file.Owners != nil {
+		m.Owners = file.Owners
+	}
+	m.Names = file.Names
+	return m
+}
+
+// key returns the manifest key of path, or "" if path is outside the manifest's directory
+func (m *outputManifest) key(path string) string {
+	rel, err := filepath.Rel(m.dir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// edited reports whether content, the current content of the output at path with
+// LF line endings, differs from what Peak last wrote there
+func (m *outputManifest) edited(path, content string) bool {
+	hash, ok := m.Outputs[m.key(path)]
+	return ok && hash != hashContent(content)
+}
+
+// owns reports whether the output at path was last written by this project. Entries
+// of manifests written before owners were recorded belong to no project.
+func (m *outputManifest) owns(path string) bool {
+	key := m.key(path)
+	_, ok := m.Outputs[key]
+	return ok && m.Owners[key] == m.project
+}
+
+// save records the outputs of build and writes the manifest. Entries of outputs not
+// written by this build are kept as long as their files exist, so an output skipped
+// because of an error is still checked next time. The shortened class names are
+// those of build, when it planned its outputs.
+func (m *outputManifest) save(build *buildResult) error {
+	for key := range m.Outputs {
+		if _, err := os.Stat(filepath.Join(m.dir, filepath.FromSlash(key))); err != nil {
+			delete(m.Outputs, key)
+			delete(m.Owners, key)
+		}
+	}
+	for path, hash := range build.outputHashes {
+		if key := m.key(path); key != "" {
+			m.Outputs[key] = hash
+			m.Owners[key] = m.project
+		}
+	}
+	if build.classNames != nil {
+		m.Names = build.classNames
+	}
+
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false) // Keep the angle brackets of instantiations readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	path := filepath.Join(m.dir, manifestFile)
+	tmp := path + ".tmp" // Builds hold the output directory lock, so no other run writes it
+	if err := os.WriteFile(tmp, data.Bytes(), filePermission); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]string
+	}{
+		{"current version", `{"version": 1, "outputs": {"A.cls": "abc"}}`, map[string]string{"A.cls": "abc"}},
+		{"other version", `{"version": 2, "outputs": {"A.cls": "abc"}}`, map[string]string{}},
+		{"no version", `{"outputs": {"A.cls": "abc"}}`, map[string]string{}},
+		{"malformed", `{"version": 1, "outputs": `, map[string]string{}},
+		{"no outputs", `{"version": 1}`, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeProject(t, dir, map[string]string{manifestFile: tt.content})
+			m := loadManifest(dir, dir)
+			if !reflect.DeepEqual(m.Outputs, tt.expected) || m.Version != manifestVersion {
+				t.Errorf("expected outputs %v at version %d, got %v at version %d", tt.expected, manifestVersion, m.Outputs, m.Version)
+			}
+		})
+	}
+
+	empty := t.TempDir()
+	if m := loadManifest(empty, empty); len(m.Outputs) != 0 {
+		t.Errorf("expected a missing manifest to be empty, got %v", m.Outputs)
+	}
+}
+
+func TestOutputManifest_Save(t *testing.T) {
+	dir := t.TempDir()
+	writeProject(t, dir, map[string]string{"Kept.cls": "kept", "sub/Written.cls": "written"})
+	m := loadManifest(dir, dir)
+	m.Outputs["Kept.cls"] = hashContent("kept")       // Skipped by the build, still on disk
+	m.Outputs["Removed.cls"] = hashContent("removed") // Deleted since the last build
+
+	written := filepath.Join(dir, "sub", "Written.cls")
+	outside := filepath.Join(filepath.Dir(dir), "Outside.cls")
+	build := &buildResult{outputHashes: map[string]string{written: hashContent("written"), outside: hashContent("outside")}}
+	if err := m.save(build); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"Kept.cls": hashContent("kept"), "sub/Written.cls": hashContent("written")}
+	if loaded := loadManifest(dir, dir); !reflect.DeepEqual(loaded.Outputs, expected) {
+		t.Errorf("expected outputs %v, got %v", expected, loaded.Outputs)
+	}
+	if !m.edited(written, "edited") || m.edited(written, "written") || m.edited(outside, "edited") {
+		t.Error("expected only a changed tracked output to be edited")
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestFile+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("expected no temporary file to be left, got %v", err)
+	}
+}
+
+func TestCompileDirectory_EditedOutputs(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> queue;\n}",
+	}
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir, output string)
+		edited bool
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, dir, output string) {},
+		},
+		{
+			name: "edited",
+			change: func(t *testing.T, dir, output string) {
+				writeProject(t, dir, map[string]string{output: readFile(t, filepath.Join(dir, output)) + "// Hand edit\n"})
+			},
+			edited: true,
+		},
+		{
+			name: "crlf line endings",
+			change: func(t *testing.T, dir, output string) {
+				content := readFile(t, filepath.Join(dir, output))
+				writeProject(t, dir, map[string]string{output: strings.ReplaceAll(content, "\n", "\r\n")})
+			},
+		},
+		{
+			name: "edited after a failed build",
+			change: func(t *testing.T, dir, output string) {
+				// The failed build skips the output but keeps its entry, so the edit is still caught
+				writeProject(t, dir, map[string]string{"Queue.peak": "public class Queue<T> {\n    private List<T> items\n"})
+				if err := compileDirectory(dir, config.CLIFlags{}, nil, &buildResult{}); err == nil {
+					t.Fatal("expected the build to fail")
+				}
+				writeProject(t, dir, map[string]string{
+					"Queue.peak": files["Queue.peak"],
+					output:       readFile(t, filepath.Join(dir, output)) + "// Hand edit\n",
+				})
+			},
+			edited: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeProject(t, dir, files)
+			if err := compileDirectory(dir, config.CLIFlags{}, nil, &buildResult{}); err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+			tt.change(t, dir, "QueueInteger.cls")
+
+			build := &buildResult{}
+			err := compileDirectory(dir, config.CLIFlags{}, nil, build)
+			var codes []string
+			for _, d := range build.diagnostics {
+				codes = append(codes, d.Code)
+			}
+			if tt.edited && (err == nil || !reflect.DeepEqual(codes, []string{diagnostic.CodeEditedOutput})) {
+				t.Errorf("expected %s, got %v (%v)", diagnostic.CodeEditedOutput, codes, err)
+			} else if !tt.edited && err != nil {
+				t.Errorf("unexpected error: %v (%v)", err, codes)
+			}
+
+			if err := compileDirectory(dir, config.CLIFlags{Force: true}, nil, &buildResult{}); err != nil {
+				t.Errorf("expected --force to regenerate the output, got %v", err)
+			}
+		})
+	}
+}
+
+// readFile returns the content of the file at path
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+const metricsVersion = 1 // Bumped whenever the metrics schema changes incompatibly
+
+// buildMetrics is the schema written by --metrics, for dashboards tracking
+// transpiler performance over time. Durations are in seconds.
+type buildMetrics struct {
+	Version       int                `json:"version"`
+	Timestamp     int64              `json:"timestamp"` // Unix time the build finished
+	Success       bool               `json:"success"`
+	Duration      float64            `json:"durationSeconds"`
+	Phases        map[string]float64 `json:"phaseSeconds"` // See metricsPhases
+	Files         metricsFiles       `json:"files"`
+	TemplateCache metricsCache       `json:"templateCache"`
+	Errors        int                `json:"errors"`
+	Warnings      int                `json:"warnings"`
+}
+
+type metricsFiles struct {
+	Inputs    int `json:"inputs"`
+	Templates int `json:"templates"`
+	Outputs   int `json:"outputs"`
+	Generated int `json:"generated"` // Outputs generated from templates: concrete, holder and factory classes
+}
+
+type metricsCache struct {
+	Hits    int     `json:"hits"`
+	Misses  int     `json:"misses"`
+	HitRate float64 `json:"hitRate"` // 0 when no template cache is used
+}
+
+// metricsPhases are the phases of a build in order: reading sources, the
+// transpiler's phases, and writing outputs
+var metricsPhases = []string{"read", "templates", "usages", "sources", "generate", "write"}
+
+// newBuildMetrics assembles metrics from the results of a compilation
+func newBuildMetrics(build *buildResult) *buildMetrics {
+	m := &buildMetrics{
+		Version:   metricsVersion,
+		Timestamp: build.startTime.Add(build.elapsed).Unix(),
+		Duration:  build.elapsed.Seconds(),
+		Phases: map[string]float64{
+			"read":      build.readTime.Seconds(),
+			"templates": build.stats.Templates.Seconds(),
+			"usages":    build.stats.Usages.Seconds(),
+			"sources":   build.stats.Sources.Seconds(),
+			"generate":  build.stats.Generate.Seconds(),
+			"write":     build.writeTime.Seconds(),
+		},
+		Files: metricsFiles{
+			Inputs:    len(build.inputs),
+			Templates: len(build.templates),
+			Outputs:   len(build.outputs),
+		},
+		TemplateCache: metricsCache{Hits: build.stats.CacheHits, Misses: build.stats.CacheMisses},
+		Errors:        diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityError),
+		Warnings:      diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityWarning),
+	}
+	m.Success = m.Errors == 0
+	for _, output := range build.outputs {
+		if output.TemplatePath != "" {
+			m.Files.Generated++
+		}
+	}
+	if lookups := m.TemplateCache.Hits + m.TemplateCache.Misses; lookups > 0 {
+		m.TemplateCache.HitRate = float64(m.TemplateCache.Hits) / float64(lookups)
+	}
+	return m
+}
+
+// prometheus formats m in the Prometheus text exposition format, for the
+// node_exporter textfile collector
+func (m *buildMetrics) prometheus() string {
+	var b strings.Builder
+	gauge := func(name, help string, samples ...string) {
+		fmt.Fprintf(&b, "# HELP peak_%s %s\n# TYPE peak_%s gauge\n", name, help, name)
+		for _, sample := range samples {
+			fmt.Fprintf(&b, "peak_%s%s\n", name, sample)
+		}
+	}
+	value := func(v any) string { return fmt.Sprintf(" %v", v) }
+	labeled := func(label, name string, v any) string { return fmt.Sprintf("{%s=%q} %v", label, name, v) }
+
+	success := 0
+	if m.Success {
+		success = 1
+	}
+	gauge("build_success", "Whether the last build had no errors.", value(success))
+	gauge("build_timestamp_seconds", "Unix time the last build finished.", value(m.Timestamp))
+	gauge("build_duration_seconds", "Duration of the last build.", value(m.Duration))
+	phases := make([]string, len(metricsPhases))
+	for i, phase := range metricsPhases {
+		phases[i] = labeled("phase", phase, m.Phases[phase])
+	}
+	gauge("build_phase_duration_seconds", "Duration of each phase of the last build.", phases...)
+	gauge("build_files", "Files read and written by the last build.",
+		labeled("kind", "inputs", m.Files.Inputs),
+		labeled("kind", "templates", m.Files.Templates),
+		labeled("kind", "outputs", m.Files.Outputs))
+	gauge("build_generated_classes", "Classes generated from templates by the last build.", value(m.Files.Generated))
+	gauge("build_diagnostics", "Diagnostics reported by the last build.",
+		labeled("severity", "error", m.Errors),
+		labeled("severity", "warning", m.Warnings))
+	gauge("template_cache_lookups", "Template cache lookups in the last build.",
+		labeled("result", "hit", m.TemplateCache.Hits),
+		labeled("result", "miss", m.TemplateCache.Misses))
+	gauge("template_cache_hit_ratio", "Share of template cache lookups that hit in the last build.", value(m.TemplateCache.HitRate))
+	return b.String()
+}
+
+// writeMetrics writes the build metrics to path, in the Prometheus textfile format
+// if path ends in .prom and as JSON otherwise. The file is replaced atomically, so
+// collectors polling it during watch mode rebuilds never read a partial file.
+func writeMetrics(path string, build *buildResult) error {
+	m := newBuildMetrics(build)
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".prom") {
+		data = []byte(m.prometheus())
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(m, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, time.Now().UnixNano())
+	if err := os.WriteFile(tmp, data, filePermission); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
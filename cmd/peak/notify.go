@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+const (
+	notifyTimeout        = 5 * time.Second // Webhooks must not stall watch mode
+	notifyMaxDiagnostics = 10              // Diagnostics included in a notification
+)
+
+// lastBuildStatus is the status of the previous build in this process (empty before
+// the first build), used to detect failures and recoveries in watch mode
+var lastBuildStatus string
+
+// notifyPayload is the JSON body posted to the webhook. Text makes the payload
+// render directly in Slack incoming webhooks; other receivers can use the
+// structured fields.
+type notifyPayload struct {
+	Text           string                  `json:"text"`
+	Status         string                  `json:"status"`                   // "success" or "failure"
+	PreviousStatus string                  `json:"previousStatus,omitempty"` // Empty for the first build
+	Project        string                  `json:"project"`                  // Source directory name
+	DurationMs     int64                   `json:"durationMs"`
+	Stats          reportStats             `json:"stats"`
+	Diagnostics    []diagnostic.Diagnostic `json:"diagnostics"` // First few diagnostics
+}
+
+// notifyBuild posts the build result to the configured webhook if the trigger matches.
+// buildErr is the error returned by the compilation, if any.
+func notifyBuild(cfg *config.Config, build *buildResult, buildErr error) error {
+	report := newBuildReport(cfg, build)
+	if buildErr != nil {
+		report.Status = "failure"
+	}
+
+	previous := lastBuildStatus
+	lastBuildStatus = report.Status
+	if !shouldNotify(cfg.Notify.On, previous, report.Status) {
+		return nil
+	}
+
+	diagnostics := report.Diagnostics
+	if len(diagnostics) > notifyMaxDiagnostics {
+		diagnostics = diagnostics[:notifyMaxDiagnostics]
+	}
+
+	payload := notifyPayload{
+		Text:           notifyText(filepath.Base(cfg.SourceDir), previous, report),
+		Status:         report.Status,
+		PreviousStatus: previous,
+		Project:        filepath.Base(cfg.SourceDir),
+		DurationMs:     report.DurationMs,
+		Stats:          report.Stats,
+		Diagnostics:    diagnostics,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(cfg.Notify.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// shouldNotify reports whether a build with status current, following a build
+// with status previous, triggers a notification
+func shouldNotify(on, previous, current string) bool {
+	switch on {
+	case config.NotifyFailure:
+		return current == "failure" || previous == "failure"
+	case config.NotifyChange:
+		if previous == "" {
+			return current == "failure"
+		}
+		return current != previous
+	default:
+		return true
+	}
+}
+
+// notifyText is a one-line human-readable summary of the build
+func notifyText(project, previous string, report *buildReport) string {
+	switch {
+	case report.Status == "failure":
+		return fmt.Sprintf("✗ Peak build failed in %s: %d error(s), %d warning(s)", project, report.Stats.Errors, report.Stats.Warnings)
+	case previous == "failure":
+		return fmt.Sprintf("✓ Peak build recovered in %s: %d file(s) generated", project, report.Stats.Generated)
+	default:
+		return fmt.Sprintf("✓ Peak build succeeded in %s: %d file(s) generated", project, report.Stats.Generated)
+	}
+}
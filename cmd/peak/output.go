@@ -0,0 +1,389 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// Output formats selectable with --format
+const (
+	formatText  = "text"  // Colored, human-oriented output with source context (default)
+	formatPlain = "plain" // Uncolored, single-line diagnostics for editor problem matchers
+	formatJSON  = "json"  // A JSON build report per build on stdout, and no other output there
+	formatSARIF = "sarif" // A SARIF log of the diagnostics on stdout, for CI code scanning
+)
+
+// printer renders compilation progress and diagnostics.
+// In plain format the theme is empty, so the same format strings
+// produce uncolored output.
+type printer struct {
+	theme
+	format    string
+	w         io.Writer
+	verbose   bool                // Print a line for every file as it is processed
+	maxErrors int                 // Errors printed by flushDiagnostics before the rest are summarized (0 = unlimited)
+	pending   []pendingDiagnostic // Diagnostics not yet printed, see flushDiagnostics
+	timings   []fileTiming        // Time spent on every file printed so far (verbose only)
+	events    *eventStream        // --events stream, which gets every file and diagnostic as it happens (nil = none)
+}
+
+// fileTiming is the total time spent on a file, for finding outliers
+type fileTiming struct {
+	path  string
+	total time.Duration
+}
+
+const (
+	outlierFactor  = 5                     // Files taking this many times the median time are outliers
+	outlierMinimum = 10 * time.Millisecond // Files faster than this are never outliers
+	maxOutliers    = 10                    // Outliers listed at the end of a verbose run
+)
+
+// pendingDiagnostic is a diagnostic with the error it was created from, if any
+type pendingDiagnostic struct {
+	d   diagnostic.Diagnostic
+	err error
+}
+
+// newPrinter creates a printer writing to stderr in the given format
+func newPrinter(format string) *printer {
+	p := &printer{format: format, w: os.Stderr}
+	switch format {
+	case formatJSON, formatSARIF:
+		p.w = io.Discard // The build report or SARIF log carries the diagnostics, see printReport
+	case formatText:
+		p.theme, _ = resolveTheme("", nil) // Until setTheme applies the project's, which reports errors
+	}
+	return p
+}
+
+// setTheme switches to the theme configured for the project; plain format stays uncolored
+func (p *printer) setTheme(name string, colors map[string]string) error {
+	t, err := resolveTheme(name, colors)
+	if err != nil {
+		return err
+	}
+	if p.format == formatText {
+		p.theme = t
+	}
+	return nil
+}
+
+// isValidFormat reports whether format is a supported --format value
+func isValidFormat(format string) bool {
+	return format == formatText || format == formatPlain || format == formatJSON || format == formatSARIF
+}
+
+// diagnostic records a diagnostic for printing. err is the original error, used in
+// text format to show source context for parse errors; it may be nil.
+// Diagnostics are printed together by flushDiagnostics, so that output does not
+// depend on the order in which files were processed.
+func (p *printer) diagnostic(d diagnostic.Diagnostic, err error) {
+	p.events.diagnostic(d)
+	p.pending = append(p.pending, pendingDiagnostic{d: d, err: err})
+}
+
+// flushDiagnostics prints the recorded diagnostics sorted by file, line and column.
+// In text format each file gets a header; plain format keeps one line per diagnostic.
+// Errors beyond maxErrors are left out and counted in a final "... and N more" line;
+// warnings are always printed.
+func (p *printer) flushDiagnostics() {
+	pending := p.pending
+	p.pending = nil
+	sort.SliceStable(pending, func(i, j int) bool {
+		return diagnostic.Less(pending[i].d, pending[j].d)
+	})
+	pending, hidden := limitErrors(pending, p.maxErrors)
+
+	for i, pd := range pending {
+		if p.format == formatPlain {
+			fmt.Fprintln(p.w, plainDiagnostic(pd.d))
+			continue
+		}
+		if i == 0 || pd.d.File != pending[i-1].d.File {
+			p.fileHeader(pending[i:])
+		}
+		p.printDiagnostic(pd.d, pd.err)
+	}
+	if hidden > 0 {
+		fmt.Fprintf(p.w, "\n%s... and %d more error(s) (see --max-errors)%s\n", p.muted, hidden, p.reset)
+	}
+}
+
+// limitErrors keeps the first limit errors of pending and all of its warnings, and
+// returns them with the number of errors left out. A limit of 0 keeps everything.
+func limitErrors(pending []pendingDiagnostic, limit int) ([]pendingDiagnostic, int) {
+	if limit <= 0 {
+		return pending, 0
+	}
+	var kept []pendingDiagnostic
+	errorCount, hidden := 0, 0
+	for _, pd := range pending {
+		if pd.d.Severity != diagnostic.SeverityWarning {
+			if errorCount == limit {
+				hidden++
+				continue
+			}
+			errorCount++
+		}
+		kept = append(kept, pd)
+	}
+	return kept, hidden
+}
+
+// fileHeader prints the name of the file the leading diagnostics belong to, with counts
+func (p *printer) fileHeader(pending []pendingDiagnostic) {
+	var errorCount, warningCount int
+	for _, pd := range pending {
+		if pd.d.File != pending[0].d.File {
+			break
+		}
+		if pd.d.Severity == diagnostic.SeverityWarning {
+			warningCount++
+		} else {
+			errorCount++
+		}
+	}
+
+	var counts []string
+	if errorCount > 0 {
+		counts = append(counts, fmt.Sprintf("%d error(s)", errorCount))
+	}
+	if warningCount > 0 {
+		counts = append(counts, fmt.Sprintf("%d warning(s)", warningCount))
+	}
+	fmt.Fprintf(p.w, "\n%s%s%s %s(%s)%s\n", p.count, pending[0].d.File, p.reset, p.muted, strings.Join(counts, ", "), p.reset)
+}
+
+// printDiagnostic prints a single diagnostic in text format, below its file header
+func (p *printer) printDiagnostic(d diagnostic.Diagnostic, err error) {
+	var parseErr *parser.ParseError
+	if err != nil && errors.As(err, &parseErr) && parseErr.Source != "" {
+		fmt.Fprint(p.w, parseErr.FormatError())
+		p.printNotes(d.Notes)
+		return
+	}
+
+	label, color := "ERROR", p.error
+	if d.Severity == diagnostic.SeverityWarning {
+		label, color = "WARNING", p.warn
+	}
+	if d.Code != "" {
+		label += " " + d.Code
+	}
+	location := ""
+	switch {
+	case d.Line > 0 && d.Column > 0:
+		location = fmt.Sprintf(" at %d:%d", d.Line, d.Column)
+	case d.Line > 0:
+		location = fmt.Sprintf(" at %d", d.Line) // Line only, as for problems found in generated output
+	}
+	fmt.Fprintf(p.w, "  %s%s%s%s: %s\n",
+		color, label, p.reset,
+		location, d.Message)
+	p.printNotes(d.Notes)
+}
+
+// printNotes prints the related locations of a diagnostic, indented below it
+func (p *printer) printNotes(notes []diagnostic.Note) {
+	for _, note := range notes {
+		fmt.Fprintf(p.w, "    %snote:%s %s: %s\n", p.muted, p.reset, noteLocation(note), note.Message)
+	}
+}
+
+// noteLocation formats the location of a note as file, file:line or file:line:col
+func noteLocation(note diagnostic.Note) string {
+	switch {
+	case note.Line > 0 && note.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", note.File, note.Line, note.Column)
+	case note.Line > 0:
+		return fmt.Sprintf("%s:%d", note.File, note.Line)
+	}
+	return note.File
+}
+
+// plainDiagnostic formats d as "file:line:col: severity: code: message", omitting the code if there is none.
+// Missing locations are reported as line 1, column 1 so problem matchers
+// still attribute the diagnostic to the file. Each note follows on its own line
+// as "file:line:col: note: message".
+func plainDiagnostic(d diagnostic.Diagnostic) string {
+	var b strings.Builder
+	b.WriteString(plainLocation(d.File, d.Line, d.Column))
+	if d.Code != "" {
+		fmt.Fprintf(&b, ": %s: %s: %s", d.Severity, d.Code, d.Message)
+	} else {
+		fmt.Fprintf(&b, ": %s: %s", d.Severity, d.Message)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(&b, "\n%s: note: %s", plainLocation(note.File, note.Line, note.Column), note.Message)
+	}
+	return b.String()
+}
+
+// plainLocation formats a location as "file:line:col", reporting a missing line or column as 1
+func plainLocation(file string, line, column int) string {
+	if line == 0 {
+		line = 1
+	}
+	if column == 0 {
+		column = 1
+	}
+	return fmt.Sprintf("%s:%d:%d", file, line, column)
+}
+
+// skippedTemplate reports a template file that produces no output of its own, with
+// the time spent parsing it (verbose only)
+func (p *printer) skippedTemplate(path string, timings transpiler.Timings) {
+	p.events.fileDone(transpiler.FileResult{OriginalPath: path, IsTemplate: true}, timings.Parse)
+	if !p.verbose {
+		return
+	}
+	fmt.Fprintf(p.w, "%sSkipped template:%s %s %s(parse %v)%s\n", p.warn, p.reset, path,
+		p.muted, timings.Parse.Round(time.Microsecond), p.reset)
+	p.timings = append(p.timings, fileTiming{path: path, total: timings.Parse})
+}
+
+// generated reports a written output file with the time spent parsing, transpiling
+// and writing it, or that the file was up to date and not written (verbose only; the
+// table summarizes outputs otherwise)
+func (p *printer) generated(result transpiler.FileResult, write time.Duration, upToDate bool) {
+	p.events.fileDone(result, result.Timings.Parse+result.Timings.Transpile+write)
+	if !p.verbose {
+		return
+	}
+	durations := fmt.Sprintf("transpile %v, write %v",
+		result.Timings.Transpile.Round(time.Microsecond), write.Round(time.Microsecond))
+	label, concreteLabel := "Generated:", "Generated concrete class:"
+	if upToDate {
+		label, concreteLabel = "Up to date:", "Up to date concrete class:"
+	}
+	if result.OriginalPath != "" {
+		durations = fmt.Sprintf("parse %v, %s", result.Timings.Parse.Round(time.Microsecond), durations)
+		fmt.Fprintf(p.w, "%s%s%s %s%s%s -> %s%s%s %s(%s)%s\n",
+			p.success, label, p.reset,
+			p.muted, result.OriginalPath, p.reset,
+			p.path, result.OutputPath, p.reset,
+			p.muted, durations, p.reset)
+		p.timings = append(p.timings, fileTiming{path: result.OriginalPath, total: result.Timings.Parse + result.Timings.Transpile + write})
+	} else {
+		fmt.Fprintf(p.w, "%s%s%s %s%s%s %s(%s)%s\n",
+			p.success, concreteLabel, p.reset,
+			p.path, result.OutputPath, p.reset,
+			p.muted, durations, p.reset)
+		p.timings = append(p.timings, fileTiming{path: result.OutputPath, total: result.Timings.Transpile + write})
+	}
+}
+
+// outliers lists the files that took more than outlierFactor times the median time
+// and at least outlierMinimum, slowest first (verbose only)
+func (p *printer) outliers() {
+	if !p.verbose || len(p.timings) == 0 {
+		return
+	}
+	totals := make([]time.Duration, len(p.timings))
+	for i, timing := range p.timings {
+		totals[i] = timing.total
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+	threshold := max(totals[len(totals)/2]*outlierFactor, outlierMinimum)
+
+	var slow []fileTiming
+	for _, timing := range p.timings {
+		if timing.total >= threshold {
+			slow = append(slow, timing)
+		}
+	}
+	if len(slow) == 0 {
+		return
+	}
+	sort.SliceStable(slow, func(i, j int) bool { return slow[i].total > slow[j].total })
+
+	fmt.Fprintf(p.w, "\n%sSlow files%s %s(median %v):%s\n",
+		p.warn, p.reset, p.muted, totals[len(totals)/2].Round(time.Microsecond), p.reset)
+	for i, timing := range slow {
+		if i == maxOutliers {
+			fmt.Fprintf(p.w, "  %s... and %d more%s\n", p.muted, len(slow)-i, p.reset)
+			break
+		}
+		fmt.Fprintf(p.w, "  %s%v%s  %s%s%s\n", p.warn, timing.total.Round(time.Microsecond), p.reset, p.path, timing.path, p.reset)
+	}
+}
+
+// packaged reports a written MDAPI package
+func (p *printer) packaged(path string, classes int) {
+	fmt.Fprintf(p.w, "%sPackaged:%s %d class(es) -> %s%s%s\n",
+		p.success, p.reset, classes,
+		p.path, path, p.reset)
+}
+
+// removed reports a deleted orphaned output
+func (p *printer) removed(path string) {
+	fmt.Fprintf(p.w, "%sRemoved:%s %s%s%s\n", p.warn, p.reset, p.path, path, p.reset)
+}
+
+// summary prints the final line of a compilation. upToDate of the generated files
+// were not written since their content did not change.
+func (p *printer) summary(generatedFiles, upToDate, skippedTemplates, errorCount int, elapsed time.Duration) {
+	p.flushDiagnostics()
+	fmt.Fprintf(p.w, "\n")
+
+	unchanged := ""
+	if upToDate > 0 {
+		unchanged = fmt.Sprintf("%s%d%s up to date, ", p.count, upToDate, p.reset)
+	}
+	if errorCount > 0 {
+		fmt.Fprintf(p.w, "%s✗%s Compiled %s%d%s file(s) (%sskipped %s%d%s template(s)) with %s%d error(s)%s in %s%v%s\n",
+			p.error, p.reset,
+			p.count, generatedFiles, p.reset,
+			unchanged, p.warn, skippedTemplates, p.reset,
+			p.error, errorCount, p.reset,
+			p.muted, elapsed.Round(time.Millisecond), p.reset)
+		return
+	}
+
+	fmt.Fprintf(p.w, "%s✓%s Compiled %s%d%s file(s) (%sskipped %s%d%s template(s)) in %s%v%s\n",
+		p.success, p.reset,
+		p.count, generatedFiles, p.reset,
+		unchanged, p.warn, skippedTemplates, p.reset,
+		p.muted, elapsed.Round(time.Millisecond), p.reset)
+}
+
+// audited prints the final line of an audit
+func (p *printer) audited(generatedFiles, orphans int, elapsed time.Duration) {
+	p.flushDiagnostics()
+	fmt.Fprintf(p.w, "\n")
+
+	if orphans > 0 {
+		fmt.Fprintf(p.w, "%s✗%s Found %s%d orphaned output(s)%s among %s%d%s generated file(s) in %s%v%s\n",
+			p.error, p.reset,
+			p.error, orphans, p.reset,
+			p.count, generatedFiles, p.reset,
+			p.muted, elapsed.Round(time.Millisecond), p.reset)
+		return
+	}
+
+	fmt.Fprintf(p.w, "%s✓%s No orphaned outputs among %s%d%s generated file(s) in %s%v%s\n",
+		p.success, p.reset,
+		p.count, generatedFiles, p.reset,
+		p.muted, elapsed.Round(time.Millisecond), p.reset)
+}
+
+// cleaned prints the final line of peak clean
+func (p *printer) cleaned(generatedFiles, removed int, elapsed time.Duration) {
+	p.flushDiagnostics()
+	fmt.Fprintf(p.w, "\n")
+	fmt.Fprintf(p.w, "%s✓%s Removed %s%d%s orphaned output(s) among %s%d%s generated file(s) in %s%v%s\n",
+		p.success, p.reset,
+		p.count, removed, p.reset,
+		p.count, generatedFiles, p.reset,
+		p.muted, elapsed.Round(time.Millisecond), p.reset)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/mdapi"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// writePackage packages the generated classes into an MDAPI zip at path.
+// Class bodies are read back from the written outputs one at a time.
+func writePackage(path string, cfg *config.Config, outputs []transpiler.FileResult) error {
+	classPaths := make(map[string]string, len(outputs))
+	names := make([]string, 0, len(outputs))
+	for _, result := range outputs {
+		name := strings.TrimSuffix(filepath.Base(result.OutputPath), apexExtension)
+		classPaths[name] = result.OutputPath
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pw, err := mdapi.NewWriter(f, cfg.ApiVersion, names)
+	if err != nil {
+		return err
+	}
+	meta := cfg.GenerateMetaXML()
+	for _, name := range names {
+		body, err := os.ReadFile(classPaths[name])
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", classPaths[name], err)
+		}
+		if err := pw.Add(mdapi.Class{Name: name, Body: string(body), Meta: meta}); err != nil {
+			return err
+		}
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
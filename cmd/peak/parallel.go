@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ioConcurrency bounds the number of files read or written at once. File I/O is
+// independent per file, and on network filesystems latency rather than bandwidth
+// dominates, so a modest fan-out helps without exhausting file descriptors.
+const ioConcurrency = 16
+
+// forEachParallel calls fn for every index in [0, n) with at most ioConcurrency
+// calls in flight. It waits for all calls and returns the error with the lowest
+// index, so failures are reported deterministically.
+func forEachParallel(n int, fn func(i int) error) error {
+	for _, err := range runParallel(n, fn) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runParallel calls fn like forEachParallel, but returns the error of every call,
+// indexed like the calls, so callers can report all failures rather than the first
+func runParallel(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, ioConcurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// readFiles reads paths concurrently, failing on files above limit bytes (0 = no limit).
+// Paths that do not exist are omitted when skipMissing is set, and reported as errors otherwise.
+func readFiles(paths []string, limit int64, skipMissing bool) (map[string]string, error) {
+	contents := make([]string, len(paths))
+	found := make([]bool, len(paths))
+
+	err := forEachParallel(len(paths), func(i int) error {
+		content, err := readSource(paths[i], limit)
+		if err != nil {
+			if skipMissing && os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("error reading %s: %w", paths[i], err)
+		}
+		contents[i], found[i] = content, true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, len(paths))
+	for i, path := range paths {
+		if found[i] {
+			files[path] = contents[i]
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/sourcemap"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// runClean deletes generated .cls files that no current source produces any more,
+// the orphans peak audit lists, along with their -meta.xml and source maps
+func runClean(dir string, flags config.CLIFlags) error {
+	startTime := time.Now()
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return; the summary prints them otherwise
+
+	cfg, err := config.LoadConfig(dir, flags)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+
+	peakFiles, err := findPeakFiles(cfg, nil)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory '%s' does not exist\n\nTip: Check the directory path and try again", cfg.SourceDir)
+		}
+		return fmt.Errorf("error finding .peak files: %w", err)
+	}
+	files, err := readFiles(peakFiles, cfg.MaxFileSize, false)
+	if err != nil {
+		return err
+	}
+	results, _, err := transpileProject(cfg, files, nil)
+	if err != nil {
+		return err
+	}
+
+	// Without a complete set of outputs, live classes would be deleted
+	var errorCount int
+	var outputs []transpiler.FileResult
+	for _, result := range results {
+		if result.Error != nil {
+			errorCount++
+			out.diagnostic(diagnostic.FromError(result.OriginalPath, result.Error), result.Error)
+			continue
+		}
+		if !result.IsTemplate {
+			outputs = append(outputs, result)
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("clean needs sources that compile: %d compilation error(s)", errorCount)
+	}
+
+	release, err := acquireBuildLock(cfg.OutputRoot())
+	if err != nil {
+		return fmt.Errorf("error locking %s: %w", cfg.OutputRoot(), err)
+	}
+	defer release()
+
+	manifest := loadManifest(cfg.OutputRoot(), cfg.SourceDir)
+	generated, removed, err := pruneOutputs(cfg, manifest, outputs, out)
+	if err != nil {
+		return err
+	}
+	if err := manifest.save(&buildResult{}); err != nil {
+		logger.Warn("could not write output manifest", "path", filepath.Join(manifest.dir, manifestFile), "error", err)
+	}
+	out.cleaned(generated, removed, time.Since(startTime))
+	return nil
+}
+
+// pruneOutputs deletes the generated .cls files that are not among outputs, the
+// complete outputs of a build, with their -meta.xml and .peak.map sidecars. Only files
+// that manifest records as written by this project are deleted; files without a
+// provenance header, files of other projects or unknown to the manifest, and files
+// edited by hand since Peak wrote them are reported and kept. It returns the number
+// of generated files found and deleted.
+func pruneOutputs(cfg *config.Config, manifest *outputManifest, outputs []transpiler.FileResult, out *printer) (int, int, error) {
+	expected := make(map[string]bool, len(outputs))
+	for _, result := range outputs {
+		expected[filepath.Clean(result.OutputPath)] = true
+	}
+	generated, err := findGeneratedFiles(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	removed := 0
+	for _, g := range generated {
+		if expected[g.path] {
+			continue
+		}
+		content, err := os.ReadFile(g.path)
+		if err != nil {
+			continue // Removed since the scan
+		}
+		text := strings.ReplaceAll(string(content), "\r\n", "\n")
+		reason := ""
+		switch {
+		case !g.marked:
+			reason = "it has no Peak header, so it may have been replaced by a hand-written class"
+		case !manifest.owns(g.path):
+			reason = fmt.Sprintf("%s does not record it as written by this project, so it may belong to another project sharing the output directory", manifestFile)
+		case manifest.edited(g.path, text):
+			reason = "it was edited by hand since Peak wrote it"
+		}
+		if reason != "" {
+			out.diagnostic(diagnostic.Diagnostic{
+				Severity: diagnostic.SeverityWarning,
+				Code:     diagnostic.CodeOrphanedOutput,
+				File:     g.path,
+				Message:  fmt.Sprintf("no current source produces this file, but %s; delete it yourself if it is no longer needed", reason),
+			}, nil)
+			continue
+		}
+
+		for _, path := range []string{g.path, g.path + "-meta.xml", sourcemap.PathFor(g.path)} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return len(generated), removed, fmt.Errorf("error deleting %s: %w", path, err)
+			}
+		}
+		removed++
+		out.removed(g.path)
+	}
+	return len(generated), removed, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+func TestPruneOutputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		prune func(dir string) error
+	}{
+		{"clean", func(dir string) error { return runClean(dir, config.CLIFlags{}) }},
+		{"prune", func(dir string) error {
+			return compileDirectory(dir, config.CLIFlags{Prune: true}, nil, &buildResult{})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeProject(t, dir, map[string]string{
+				"Queue.peak":             "public class Queue<T> {\n    private List<T> items;\n}",
+				"Example.peak":           "public class Example {\n    private Queue<Integer> a;\n    private Queue<String> b;\n    private Queue<Boolean> c;\n}",
+				"Hand.cls":               "public class Hand { }",
+				"Hand.cls-meta.xml":      "<ApexClass/>",
+				"QueueDate.cls":          "public class QueueDate { }", // Hand-written, named like an output
+				"QueueDate.cls-meta.xml": "<ApexClass/>",
+			})
+			if err := compileDirectory(dir, config.CLIFlags{}, nil, &buildResult{}); err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+
+			// Queue<String> and Queue<Boolean> are no longer used; QueueBoolean.cls was edited
+			edited := filepath.Join(dir, "QueueBoolean.cls")
+			writeProject(t, dir, map[string]string{
+				"Example.peak":     "public class Example {\n    private Queue<Integer> a;\n}",
+				"QueueBoolean.cls": readFile(t, edited) + "// Hand edit\n",
+			})
+			if err := tt.prune(dir); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, name := range []string{"QueueString.cls", "QueueString.cls-meta.xml"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("expected orphaned %s to be deleted, got %v", name, err)
+				}
+			}
+			for _, name := range []string{
+				"Example.cls", "QueueInteger.cls", "QueueInteger.cls-meta.xml", // Live outputs
+				"QueueBoolean.cls", "QueueBoolean.cls-meta.xml", // Edited by hand
+				"Hand.cls", "Hand.cls-meta.xml", "QueueDate.cls", "QueueDate.cls-meta.xml", // Hand-written
+				"Queue.peak", "Example.peak",
+			} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Errorf("expected %s to be kept, got %v", name, err)
+				}
+			}
+
+			manifest := loadManifest(dir, dir)
+			if _, ok := manifest.Outputs["QueueString.cls"]; ok {
+				t.Error("expected the deleted output to be dropped from the manifest")
+			}
+			if _, ok := manifest.Outputs["QueueBoolean.cls"]; !ok {
+				t.Error("expected the kept output to stay in the manifest")
+			}
+		})
+	}
+}
+
+func TestPruneOutputs_SharedOutDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		prune func(dir string) error
+	}{
+		{"clean", func(dir string) error { return runClean(dir, config.CLIFlags{}) }},
+		{"prune", func(dir string) error {
+			return compileDirectory(dir, config.CLIFlags{Prune: true}, nil, &buildResult{})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Two projects writing to one output directory
+			root := t.TempDir()
+			outDir := `{"compilerOptions": {"outDir": "../classes"}}`
+			writeProject(t, root, map[string]string{
+				"a/peakconfig.json": outDir,
+				"a/Queue.peak":      "public class Queue<T> {\n    private List<T> items;\n}",
+				"a/Example.peak":    "public class Example {\n    private Queue<Integer> a;\n    private Queue<String> b;\n}",
+				"b/peakconfig.json": outDir,
+				"b/Stack.peak":      "public class Stack<T> {\n    private List<T> items;\n}",
+				"b/Other.peak":      "public class Other {\n    private Stack<Integer> stack;\n}",
+			})
+			for _, project := range []string{"a", "b"} {
+				if err := compileDirectory(filepath.Join(root, project), config.CLIFlags{}, nil, &buildResult{}); err != nil {
+					t.Fatalf("build of %s failed: %v", project, err)
+				}
+			}
+
+			// Queue<String> is no longer used; the outputs of b are not orphans of a
+			writeProject(t, root, map[string]string{"a/Example.peak": "public class Example {\n    private Queue<Integer> a;\n}"})
+			if err := tt.prune(filepath.Join(root, "a")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			classes := filepath.Join(root, "classes")
+			for _, name := range []string{"QueueString.cls", "QueueString.cls-meta.xml"} {
+				if _, err := os.Stat(filepath.Join(classes, name)); !os.IsNotExist(err) {
+					t.Errorf("expected orphaned %s to be deleted, got %v", name, err)
+				}
+			}
+			for _, name := range []string{
+				"Example.cls", "QueueInteger.cls", // Live outputs of a
+				"Other.cls", "Other.cls-meta.xml", "StackInteger.cls", "StackInteger.cls-meta.xml", // Outputs of b
+			} {
+				if _, err := os.Stat(filepath.Join(classes, name)); err != nil {
+					t.Errorf("expected %s to be kept, got %v", name, err)
+				}
+			}
+
+			manifest := loadManifest(classes, filepath.Join(root, "b"))
+			for _, name := range []string{"Other.cls", "StackInteger.cls"} {
+				if !manifest.owns(filepath.Join(classes, name)) {
+					t.Errorf("expected the manifest to record %s as written by b", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRunClean_CompilationErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeProject(t, dir, map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> a;\n}",
+	})
+	if err := compileDirectory(dir, config.CLIFlags{}, nil, &buildResult{}); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	// The outputs of a broken source would look orphaned
+	writeProject(t, dir, map[string]string{"Example.peak": "public class Example {\n    private Queue<Integer, String> a;\n}"})
+	if err := runClean(dir, config.CLIFlags{}); err == nil {
+		t.Fatal("expected clean to refuse sources with errors")
+	}
+	if err := compileDirectory(dir, config.CLIFlags{Prune: true}, nil, &buildResult{}); err == nil {
+		t.Fatal("expected the build to fail")
+	}
+	for _, name := range []string{"Example.cls", "QueueInteger.cls"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be kept, got %v", name, err)
+		}
+	}
+}
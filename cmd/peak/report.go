@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+const reportVersion = 1 // Bumped whenever the report schema changes incompatibly
+
+// buildReport is the machine-readable summary written by --report and printed by
+// --format json.
+// All paths are relative to the source directory so reports from different
+// CI runners can be diffed directly.
+type buildReport struct {
+	Version      int                     `json:"version"`
+	Status       string                  `json:"status"` // "success" or "failure"
+	DurationMs   int64                   `json:"durationMs"`
+	ConfigDigest string                  `json:"configDigest"`
+	Inputs       []reportInput           `json:"inputs"`
+	Outputs      []reportOutput          `json:"outputs"`
+	Diagnostics  []diagnostic.Diagnostic `json:"diagnostics"`
+	Stats        reportStats             `json:"stats"`
+	Error        string                  `json:"error,omitempty"` // Why the build failed, with --format json
+}
+
+type reportInput struct {
+	Path       string `json:"path"`
+	SHA256     string `json:"sha256"`
+	IsTemplate bool   `json:"isTemplate,omitempty"`
+}
+
+type reportOutput struct {
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"` // Empty for concrete classes generated from templates
+	SHA256 string `json:"sha256"`
+}
+
+type reportStats struct {
+	Inputs    int `json:"inputs"`
+	Templates int `json:"templates"`
+	Generated int `json:"generated"`
+	UpToDate  int `json:"upToDate"` // Generated files that already had their content and were not written
+	Errors    int `json:"errors"`
+	Warnings  int `json:"warnings"`
+}
+
+// newBuildReport assembles a report from the results of a compilation
+func newBuildReport(cfg *config.Config, build *buildResult) *buildReport {
+	relative := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		if rel, err := filepath.Rel(cfg.SourceDir, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	templates := make(map[string]bool, len(build.templates))
+	for _, path := range build.templates {
+		templates[path] = true
+	}
+
+	report := &buildReport{
+		Version:      reportVersion,
+		Status:       "success",
+		DurationMs:   build.elapsed.Milliseconds(),
+		ConfigDigest: cfg.Digest(),
+		Inputs:       make([]reportInput, 0, len(build.inputs)),
+		Outputs:      make([]reportOutput, 0, len(build.outputs)),
+		Diagnostics:  make([]diagnostic.Diagnostic, 0, len(build.diagnostics)),
+	}
+
+	for path, hash := range build.inputs {
+		report.Inputs = append(report.Inputs, reportInput{
+			Path:       relative(path),
+			SHA256:     hash,
+			IsTemplate: templates[path],
+		})
+	}
+	sort.Slice(report.Inputs, func(i, j int) bool {
+		return report.Inputs[i].Path < report.Inputs[j].Path
+	})
+
+	for _, output := range build.outputs {
+		report.Outputs = append(report.Outputs, reportOutput{
+			Path:   relative(output.OutputPath),
+			Source: relative(output.OriginalPath),
+			SHA256: build.outputHashes[output.OutputPath],
+		})
+	}
+	sort.Slice(report.Outputs, func(i, j int) bool {
+		return report.Outputs[i].Path < report.Outputs[j].Path
+	})
+
+	for _, d := range build.diagnostics {
+		d.File = relative(d.File)
+		if len(d.Notes) > 0 {
+			d.Notes = append([]diagnostic.Note(nil), d.Notes...)
+			for i := range d.Notes {
+				d.Notes[i].File = relative(d.Notes[i].File)
+			}
+		}
+		report.Diagnostics = append(report.Diagnostics, d)
+	}
+	diagnostic.Sort(report.Diagnostics)
+
+	report.Stats = reportStats{
+		Inputs:    len(build.inputs),
+		Templates: len(build.templates),
+		Generated: len(build.outputs),
+		UpToDate:  build.unchanged + build.upToDate,
+		Errors:    diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityError),
+		Warnings:  diagnostic.CountBySeverity(build.diagnostics, diagnostic.SeverityWarning),
+	}
+	if report.Stats.Errors > 0 {
+		report.Status = "failure"
+	}
+
+	return report
+}
+
+// writeReport writes the JSON build report to path
+func writeReport(path string, cfg *config.Config, build *buildResult) error {
+	data, err := json.MarshalIndent(newBuildReport(cfg, build), "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, append(data, '\n'), filePermission)
+}
+
+// printReport writes the build report of a build of dir to stdout as a single line of
+// JSON, for --format json. err is the error the build returned; a build that failed
+// before compiling, such as for an invalid peakconfig.json, is reported with it and
+// no diagnostics.
+func printReport(dir string, cfg *config.Config, build *buildResult, err error) {
+	if cfg == nil {
+		cfg = &config.Config{SourceDir: dir}
+	}
+	if build.elapsed == 0 {
+		build.elapsed = time.Since(build.startTime)
+	}
+	report := newBuildReport(cfg, build)
+	if err != nil {
+		report.Status = "failure"
+		report.Error = err.Error()
+	}
+	data, marshalErr := json.Marshal(report)
+	if marshalErr != nil {
+		logger.Error("could not write build report", "error", marshalErr)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+}
+
+// printSarif writes the diagnostics of a build of dir to stdout as a SARIF 2.1.0 log,
+// for --format sarif. Paths are relative to the working directory, normally the root
+// of the checkout in CI, where code scanning resolves them. err is the error the build
+// returned; a build that failed before compiling is reported as an unsuccessful run.
+func printSarif(build *buildResult, err error) {
+	wd, _ := os.Getwd()
+	relative := func(path string) string {
+		if path == "" || wd == "" {
+			return path
+		}
+		abs, absErr := filepath.Abs(path)
+		if absErr != nil {
+			return path
+		}
+		if rel, relErr := filepath.Rel(wd, abs); relErr == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+		return abs
+	}
+
+	diags := make([]diagnostic.Diagnostic, 0, len(build.diagnostics))
+	for _, d := range build.diagnostics {
+		d.File = relative(d.File)
+		if len(d.Notes) > 0 {
+			d.Notes = append([]diagnostic.Note(nil), d.Notes...)
+			for i := range d.Notes {
+				d.Notes[i].File = relative(d.Notes[i].File)
+			}
+		}
+		diags = append(diags, d)
+	}
+	failure := ""
+	if err != nil && diagnostic.CountBySeverity(diags, diagnostic.SeverityError) == 0 {
+		failure = err.Error()
+	}
+	data, marshalErr := json.MarshalIndent(diagnostic.NewSARIFLog(diags, peakVersion(), failure), "", "  ")
+	if marshalErr != nil {
+		logger.Error("could not write SARIF log", "error", marshalErr)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+}
+
+// hashContent returns the hex-encoded SHA-256 of content
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+// writeProject writes files, by path relative to dir, creating their directories
+func writeProject(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), filePermission); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	queue := "public class Queue<T> {\n    private List<T> items;\n}"
+	tests := []struct {
+		name      string
+		files     map[string]string
+		status    string
+		inputs    []string
+		outputs   []string
+		errors    int
+		templates []string
+	}{
+		{
+			name: "success",
+			files: map[string]string{
+				"Queue.peak":   queue,
+				"Example.peak": "public class Example {\n    private Queue<Integer> queue;\n}",
+			},
+			status:    "success",
+			inputs:    []string{"Example.peak", "Queue.peak"},
+			outputs:   []string{"Example.cls", "QueueInteger.cls"},
+			templates: []string{"Queue.peak"},
+		},
+		{
+			name: "out dir",
+			files: map[string]string{
+				"peakconfig.json": `{"compilerOptions": {"outDir": "classes", "instantiate": {"classes": {"Queue": ["String"]}}}}`,
+				"Queue.peak":      queue,
+			},
+			status:    "success",
+			inputs:    []string{"Queue.peak"},
+			outputs:   []string{"classes/QueueString.cls"},
+			templates: []string{"Queue.peak"},
+		},
+		{
+			name: "failure",
+			files: map[string]string{
+				"Queue.peak":   queue,
+				"Example.peak": "public class Example {\n    private Queue<Integer, String> queue;\n}",
+			},
+			status: "failure",
+			inputs: []string{"Example.peak", "Queue.peak"},
+			errors: 1,
+		},
+	}
+
+	digests := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The same project built in two directories, as on two CI runners
+			var reports [2][]byte
+			for i := range reports {
+				dir := t.TempDir()
+				writeProject(t, dir, tt.files)
+				reportPath := filepath.Join(t.TempDir(), "report.json")
+				err := compileDirectory(dir, config.CLIFlags{ReportPath: reportPath}, nil, &buildResult{})
+				if (err != nil) != (tt.status == "failure") {
+					t.Fatalf("unexpected build error: %v", err)
+				}
+				data, err := os.ReadFile(reportPath)
+				if err != nil {
+					t.Fatalf("report not written: %v", err)
+				}
+				reports[i] = data
+
+				cfg, err := config.LoadConfig(dir, config.CLIFlags{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var report buildReport
+				if err := json.Unmarshal(data, &report); err != nil {
+					t.Fatalf("invalid report: %v", err)
+				}
+				if report.ConfigDigest != cfg.Digest() || !strings.HasPrefix(report.ConfigDigest, "sha256:") {
+					t.Errorf("expected config digest %s, got %s", cfg.Digest(), report.ConfigDigest)
+				}
+			}
+
+			var schema map[string]json.RawMessage
+			if err := json.Unmarshal(reports[0], &schema); err != nil {
+				t.Fatalf("invalid report: %v", err)
+			}
+			var keys []string
+			for key := range schema {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			expectedKeys := []string{"configDigest", "diagnostics", "durationMs", "inputs", "outputs", "stats", "status", "version"}
+			if !reflect.DeepEqual(keys, expectedKeys) {
+				t.Errorf("expected keys %v, got %v", expectedKeys, keys)
+			}
+
+			var first, second buildReport
+			if err := json.Unmarshal(reports[0], &first); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(reports[1], &second); err != nil {
+				t.Fatal(err)
+			}
+			if first.Version != reportVersion || first.Status != tt.status {
+				t.Errorf("expected version %d and status %s, got %d and %s", reportVersion, tt.status, first.Version, first.Status)
+			}
+			digests[tt.name] = first.ConfigDigest
+			var inputs, outputs, templates []string
+			for _, input := range first.Inputs {
+				inputs = append(inputs, input.Path)
+				if input.IsTemplate {
+					templates = append(templates, input.Path)
+				}
+				if len(input.SHA256) != 64 {
+					t.Errorf("unexpected input %+v", input)
+				}
+			}
+			for _, output := range first.Outputs {
+				outputs = append(outputs, output.Path)
+				if len(output.SHA256) != 64 {
+					t.Errorf("unexpected output %+v", output)
+				}
+			}
+			if !reflect.DeepEqual(inputs, tt.inputs) || !reflect.DeepEqual(outputs, tt.outputs) {
+				t.Errorf("expected inputs %v and outputs %v, got %v and %v", tt.inputs, tt.outputs, inputs, outputs)
+			}
+			if !reflect.DeepEqual(templates, tt.templates) || first.Stats.Templates != len(tt.templates) {
+				t.Errorf("expected templates %v, got %v and stats %+v", tt.templates, templates, first.Stats)
+			}
+			if first.Stats.Errors != tt.errors || first.Stats.Inputs != len(tt.inputs) || first.Stats.Generated != len(tt.outputs) {
+				t.Errorf("expected %d errors, got stats %+v and diagnostics %v", tt.errors, first.Stats, first.Diagnostics)
+			}
+
+			// Only the duration may differ between runs
+			first.DurationMs, second.DurationMs = 0, 0
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("expected the same report from both runs, got\n%+v\n%+v", first, second)
+			}
+		})
+	}
+	if digests["out dir"] == digests["success"] || digests["failure"] != digests["success"] {
+		t.Errorf("expected the digest to change with the configuration only, got %v", digests)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/sourcemap"
+)
+
+// runResolveStack reads an Apex stack trace from stdin and prints it with frames
+// in generated classes rewritten to point at their .peak sources.
+// Source maps are discovered recursively in dir (default: current directory).
+func runResolveStack(args []string) error {
+	dir := "."
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			printUsage()
+			return nil
+		}
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("unknown flag %s", arg)
+		}
+		if dir != "." {
+			return fmt.Errorf("too many arguments")
+		}
+		dir = arg
+	}
+
+	maps, err := loadSourceMaps(dir)
+	if err != nil {
+		return err
+	}
+	if len(maps) == 0 {
+		return fmt.Errorf("no %s files found in '%s'\n\nTip: Compile with --source-map to generate them", sourcemap.Extension, dir)
+	}
+
+	trace, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("error reading stack trace: %w", err)
+	}
+
+	cwd, _ := os.Getwd()
+	fmt.Print(sourcemap.RewriteStackTrace(string(trace), maps, cwd))
+	return nil
+}
+
+// loadSourceMaps finds and loads all source maps under root, keyed by class name
+func loadSourceMaps(root string) (map[string]*sourcemap.Map, error) {
+	maps := make(map[string]*sourcemap.Map)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden directories
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != root {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && strings.HasSuffix(path, sourcemap.Extension) {
+			m, err := sourcemap.Load(path)
+			if err != nil {
+				return err
+			}
+			maps[m.Class] = m
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("directory '%s' does not exist", root)
+		}
+		return nil, err
+	}
+
+	return maps, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// largeSourceSize is the size above which a source gets a warning. Hand-written
+// Peak files are rarely this big; usually a generated file was renamed to .peak.
+const largeSourceSize = 1 << 20
+
+// sourceTooLargeError reports a file above the configured size limit
+type sourceTooLargeError struct {
+	path  string
+	limit int64
+}
+
+func (e *sourceTooLargeError) Error() string {
+	return fmt.Sprintf("%s exceeds the maximum source size of %s", e.path, formatSize(e.limit))
+}
+
+// readSource reads a file into a string in chunks, failing once more than limit
+// bytes have been read (0 = no limit). Copying straight into a pre-sized
+// strings.Builder avoids holding a []byte and a string copy of the file at once.
+func readSource(path string, limit int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	if info, err := f.Stat(); err == nil && (limit == 0 || info.Size() <= limit) {
+		b.Grow(int(info.Size()))
+	}
+
+	var r io.Reader = f
+	if limit > 0 {
+		// Read one byte past the limit to detect files that grew since they were checked
+		r = io.LimitReader(f, limit+1)
+	}
+	n, err := io.Copy(&b, r)
+	if err != nil {
+		return "", err
+	}
+	if limit > 0 && n > limit {
+		return "", &sourceTooLargeError{path: path, limit: limit}
+	}
+	return b.String(), nil
+}
+
+// checkSourceSizes warns about unusually large sources and rejects those above
+// the configured limit before anything is read, so a single oversized file
+// cannot exhaust memory or stall watch mode. It returns the paths to compile.
+func checkSourceSizes(cfg *config.Config, paths []string, build *buildResult, out *printer) []string {
+	accepted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			// Let the read report it
+			accepted = append(accepted, path)
+			continue
+		}
+
+		size := info.Size()
+		switch {
+		case size > cfg.MaxFileSize:
+			d := diagnostic.Diagnostic{
+				Severity: diagnostic.SeverityError,
+				Code:     diagnostic.CodeSourceTooLarge,
+				File:     path,
+				Message: fmt.Sprintf("file is %s, above the maximum source size of %s; skipped (raise maxFileSize in peakconfig.json to compile it)",
+					formatSize(size), formatSize(cfg.MaxFileSize)),
+			}
+			build.diagnostics = append(build.diagnostics, d)
+			out.diagnostic(d, nil)
+			continue
+		case size > largeSourceSize:
+			d := diagnostic.Diagnostic{
+				Severity: diagnostic.SeverityWarning,
+				Code:     diagnostic.CodeLargeSource,
+				File:     path,
+				Message:  fmt.Sprintf("file is %s; unusually large sources slow down compilation", formatSize(size)),
+			}
+			d = promoteWarning(cfg, d)
+			build.diagnostics = append(build.diagnostics, d)
+			out.diagnostic(d, nil)
+		}
+		accepted = append(accepted, path)
+	}
+	return accepted
+}
+
+// formatSize formats a byte count for messages
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// racyWindow is how recently a file may have been modified before its cached
+// content is distrusted. Filesystems with coarse timestamps can record an edit
+// made right after a read with the same modification time as the read content.
+const racyWindow = 2 * time.Second
+
+// sourceCache keeps source contents between watch mode rebuilds, keyed by path
+// and validated by modification time and size, so only changed files are re-read.
+// It is safe for concurrent use.
+type sourceCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedSource
+}
+
+type cachedSource struct {
+	modTime time.Time
+	size    int64
+	readAt  time.Time
+	content string
+	hash    string
+}
+
+// newSourceCache creates an empty cache
+func newSourceCache() *sourceCache {
+	return &sourceCache{entries: make(map[string]cachedSource)}
+}
+
+// read returns the content and content hash of path, reading it from disk only
+// if it changed since it was cached. limit is passed to readSource.
+func (c *sourceCache) read(path string, limit int64) (string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) &&
+		entry.readAt.Sub(entry.modTime) > racyWindow {
+		return entry.content, entry.hash, nil
+	}
+
+	readAt := time.Now()
+	content, err := readSource(path, limit)
+	if err != nil {
+		return "", "", err
+	}
+	entry = cachedSource{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		readAt:  readAt,
+		content: content,
+		hash:    hashContent(content),
+	}
+
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.mu.Unlock()
+	return entry.content, entry.hash, nil
+}
+
+// size returns the number of cached sources
+func (c *sourceCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// retain drops entries for files that are no longer part of the build
+func (c *sourceCache) retain(paths []string) {
+	keep := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		keep[path] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path := range c.entries {
+		if !keep[path] {
+			delete(c.entries, path)
+		}
+	}
+}
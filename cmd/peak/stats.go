@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// runStats reports how the project uses each template: its instantiations, the files
+// that use it, the lines generated from it and the type parameters it never mentions,
+// so maintainers of shared templates can judge the impact of a breaking change.
+// Sources are transpiled in memory; nothing is written.
+func runStats(dir string, flags config.CLIFlags) error {
+	startTime := time.Now()
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return
+
+	cfg, err := config.LoadConfig(dir, flags)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+
+	peakFiles, err := findPeakFiles(cfg, nil)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory '%s' does not exist\n\nTip: Check the directory path and try again", cfg.SourceDir)
+		}
+		return fmt.Errorf("error finding .peak files: %w", err)
+	}
+	files, err := readFiles(peakFiles, cfg.MaxFileSize, false)
+	if err != nil {
+		return err
+	}
+
+	results, tr, err := transpileProject(cfg, files, nil)
+	if err != nil {
+		return err
+	}
+
+	// Sources that do not compile would leave out usages
+	var errorCount int
+	for _, result := range results {
+		if result.Error != nil {
+			errorCount++
+			out.diagnostic(diagnostic.FromError(result.OriginalPath, result.Error), result.Error)
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("stats needs sources that compile: %d compilation error(s)", errorCount)
+	}
+
+	usage := tr.Usage()
+	out.templateStats(cfg.SourceDir, usage)
+	fmt.Fprintf(out.w, "\n%s%d template(s) in %v%s\n", out.muted, len(usage), time.Since(startTime).Round(time.Millisecond), out.reset)
+	return nil
+}
+
+// templateStats prints a block per template, with paths relative to sourceDir
+func (p *printer) templateStats(sourceDir string, usage []transpiler.TemplateUsage) {
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(sourceDir, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	for i, u := range usage {
+		if i > 0 {
+			fmt.Fprintln(p.w)
+		}
+		name := fmt.Sprintf("%s<%s>", u.Name, strings.Join(u.TypeParams, ", "))
+		fmt.Fprintf(p.w, "%s%s%s %s(%s:%d)%s\n", p.warn, name, p.reset, p.muted, relative(u.Path), u.Line, p.reset)
+
+		instantiations := "none"
+		if len(u.Instantiations) > 0 {
+			instantiations = strings.Join(u.Instantiations, ", ")
+		}
+		fmt.Fprintf(p.w, "  instantiations   %s%d%s  %s\n", p.count, len(u.Instantiations), p.reset, instantiations)
+
+		users := make([]string, len(u.Users))
+		for i, user := range u.Users {
+			users[i] = p.path + relative(user) + p.reset
+		}
+		if len(users) == 0 {
+			users = []string{"none"}
+		}
+		fmt.Fprintf(p.w, "  used by          %s%d%s  %s\n", p.count, len(u.Users), p.reset, strings.Join(users, ", "))
+		fmt.Fprintf(p.w, "  generated lines  %s%d%s\n", p.count, u.GeneratedLines, p.reset)
+
+		if len(u.UnusedTypeParams) > 0 {
+			fmt.Fprintf(p.w, "  %sunused type parameters: %s%s\n", p.warn, strings.Join(u.UnusedTypeParams, ", "), p.reset)
+		}
+	}
+}
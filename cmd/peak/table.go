@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// tableRow is one generated class in the end-of-run table
+type tableRow struct {
+	from   string // Template (with its count) or source file; empty when continuing a group
+	class  string
+	output string
+}
+
+// outputTable prints an aligned table of what the run produced: each template
+// with the concrete classes generated from it, then each transpiled source file,
+// with output paths relative to sourceDir. Nothing is printed when the run produced
+// no outputs, e.g. because of errors in peakconfig.json.
+func (p *printer) outputTable(sourceDir string, templates []transpiler.TemplateInfo, outputs []transpiler.FileResult) {
+	if len(outputs) == 0 {
+		return
+	}
+	rows, classTemplates, concrete, sources := buildTableRows(sourceDir, templates, outputs)
+
+	header := tableRow{from: "From", class: "Class", output: "Output"}
+	fromWidth, classWidth := utf8.RuneCountInString(header.from), utf8.RuneCountInString(header.class)
+	for _, row := range rows {
+		fromWidth = max(fromWidth, utf8.RuneCountInString(row.from))
+		classWidth = max(classWidth, utf8.RuneCountInString(row.class))
+	}
+	pad := func(s string, width int) string {
+		return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+	}
+
+	fmt.Fprintf(p.w, "\n%s%s  %s  %s%s\n", p.muted, pad(header.from, fromWidth), pad(header.class, classWidth), header.output, p.reset)
+	for _, row := range rows {
+		fmt.Fprintf(p.w, "%s%s%s  %s  %s%s%s\n",
+			p.warn, pad(row.from, fromWidth), p.reset,
+			pad(row.class, classWidth),
+			p.path, row.output, p.reset)
+	}
+	fmt.Fprintf(p.w, "%s%d template(s) -> %d concrete class(es), %d source file(s) transpiled%s\n",
+		p.muted, classTemplates, concrete, sources, p.reset)
+}
+
+// buildTableRows groups outputs for outputTable: concrete classes under their
+// template (templates without instantiations are listed too), then source files,
+// then anything else such as the registry. It also returns the counts for the footer.
+func buildTableRows(sourceDir string, templates []transpiler.TemplateInfo, outputs []transpiler.FileResult) (rows []tableRow, classTemplates, concrete, sources int) {
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(sourceDir, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+	className := func(output string) string {
+		return strings.TrimSuffix(filepath.Base(output), apexExtension)
+	}
+
+	// Concrete classes by template, as rows without the template column
+	byTemplate := make(map[string][]tableRow)
+	addConcrete := func(instantiation, class, output string) {
+		name, _, _ := strings.Cut(instantiation, "<")
+		name = strings.TrimSpace(name)
+		byTemplate[name] = append(byTemplate[name], tableRow{class: class, output: relative(output)})
+	}
+	var fromSources, other []transpiler.FileResult
+	for _, output := range outputs {
+		switch {
+		case output.Instantiation != "":
+			addConcrete(output.Instantiation, className(output.OutputPath), output.OutputPath)
+		case len(output.Members) > 0:
+			// A holder class: list its inner classes under the template
+			for instantiation, class := range output.Members {
+				addConcrete(instantiation, class, output.OutputPath)
+			}
+		case output.OriginalPath != "":
+			fromSources = append(fromSources, output)
+		default:
+			other = append(other, output)
+		}
+	}
+
+	var classDefs []transpiler.TemplateInfo
+	for _, t := range templates {
+		if !t.IsMethod {
+			classDefs = append(classDefs, t)
+		}
+	}
+	sort.Slice(classDefs, func(i, j int) bool { return classDefs[i].Name < classDefs[j].Name })
+
+	for _, t := range classDefs {
+		generated := byTemplate[t.Name]
+		sort.Slice(generated, func(i, j int) bool {
+			if generated[i].output != generated[j].output {
+				return generated[i].output < generated[j].output
+			}
+			return generated[i].class < generated[j].class
+		})
+
+		from := fmt.Sprintf("%s<%s> (%d)", t.Name, strings.Join(t.TypeParams, ", "), len(generated))
+		if len(generated) == 0 {
+			rows = append(rows, tableRow{from: from, class: "-", output: "-"})
+		}
+		for i, row := range generated {
+			if i == 0 {
+				row.from = from
+			}
+			rows = append(rows, row)
+		}
+		classTemplates++
+		concrete += len(generated)
+	}
+
+	sort.Slice(fromSources, func(i, j int) bool { return fromSources[i].OriginalPath < fromSources[j].OriginalPath })
+	for _, output := range fromSources {
+		rows = append(rows, tableRow{from: relative(output.OriginalPath), class: className(output.OutputPath), output: relative(output.OutputPath)})
+	}
+	sources = len(fromSources)
+
+	for _, output := range other {
+		rows = append(rows, tableRow{from: "(generated)", class: className(output.OutputPath), output: relative(output.OutputPath)})
+	}
+	return rows, classTemplates, concrete, sources
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Color presets selectable with the theme config option or PEAK_THEME
+const (
+	themeDefault      = "default"
+	themeHighContrast = "high-contrast"
+	themeNone         = "none"
+)
+
+// theme holds the ANSI escape sequence used for each kind of output.
+// The zero theme produces uncolored output.
+type theme struct {
+	path    string // Source and output paths
+	count   string // File names in headers and counts in the summary
+	success string // Generated files and successful builds
+	warn    string // Warnings and skipped templates
+	error   string // Errors and failed builds
+	muted   string // Secondary details such as timings
+	reset   string
+}
+
+// themes are the built-in presets. high-contrast avoids relying on red versus
+// green and on dim gray, which are hard to tell apart or read on some terminals.
+var themes = map[string]theme{
+	themeDefault: {
+		path: sgr("34"), count: sgr("1;34"), success: sgr("32"), warn: sgr("33"),
+		error: sgr("31"), muted: sgr("90"), reset: sgr("0"),
+	},
+	themeHighContrast: {
+		path: sgr("1;36"), count: sgr("1;4"), success: sgr("1;34"), warn: sgr("1;33"),
+		error: sgr("1;35"), muted: sgr("0"), reset: sgr("0"),
+	},
+	themeNone: {},
+}
+
+// sgr returns the escape sequence for ANSI SGR parameters such as "1;34"
+func sgr(params string) string {
+	return "\033[" + params + "m"
+}
+
+// resolveTheme builds the theme of output to stderr from configuration and the
+// environment. PEAK_THEME overrides the configured preset, and NO_COLOR
+// (https://no-color.org) or stderr not being a terminal disables colors unless
+// PEAK_THEME is set. PEAK_COLORS overrides individual roles on top of the configured
+// colors, in the form "error=1;35:path=36".
+func resolveTheme(name string, colors map[string]string) (theme, error) {
+	if env := os.Getenv("PEAK_THEME"); env != "" {
+		name = env
+	} else if os.Getenv("NO_COLOR") != "" || !isTerminal(os.Stderr) {
+		name = themeNone
+	}
+	if name == "" {
+		name = themeDefault
+	}
+	t, ok := themes[name]
+	if !ok {
+		return theme{}, fmt.Errorf("unknown color theme %q (expected %s, %s or %s)", name, themeDefault, themeHighContrast, themeNone)
+	}
+	if name == themeNone {
+		// Overrides would reintroduce escape sequences the user asked to avoid
+		return t, nil
+	}
+
+	overrides := make(map[string]string, len(colors))
+	for role, params := range colors {
+		overrides[role] = params
+	}
+	if env := os.Getenv("PEAK_COLORS"); env != "" {
+		for _, entry := range strings.Split(env, ":") {
+			role, params, ok := strings.Cut(entry, "=")
+			if !ok {
+				return theme{}, fmt.Errorf("invalid PEAK_COLORS entry %q (expected role=parameters)", entry)
+			}
+			overrides[strings.TrimSpace(role)] = strings.TrimSpace(params)
+		}
+	}
+
+	// Apply in a fixed order so the first invalid entry reported does not vary
+	roles := make([]string, 0, len(overrides))
+	for role := range overrides {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if err := t.set(role, overrides[role]); err != nil {
+			return theme{}, err
+		}
+	}
+	return t, nil
+}
+
+// isTerminal reports whether f is a terminal, rather than a pipe or file where escape
+// sequences would show up as text
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// set overrides the color of a role with ANSI SGR parameters
+func (t *theme) set(role, params string) error {
+	if params == "" || strings.Trim(params, "0123456789;") != "" {
+		return fmt.Errorf("invalid color %q for %s (expected ANSI SGR parameters such as \"1;34\")", params, role)
+	}
+	var field *string
+	switch role {
+	case "path":
+		field = &t.path
+	case "count":
+		field = &t.count
+	case "success":
+		field = &t.success
+	case "warn":
+		field = &t.warn
+	case "error":
+		field = &t.error
+	case "muted":
+		field = &t.muted
+	default:
+		return fmt.Errorf("unknown color role %q (expected path, count, success, warn, error or muted)", role)
+	}
+	*field = sgr(params)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+const (
+	toolingFile    = ".peak-tooling.json" // Written to the source directory
+	toolingVersion = 1                    // Bumped whenever the schema changes incompatibly
+)
+
+// toolingData is the schema of .peak-tooling.json, consumed by IDE plugins to
+// navigate between .peak sources and generated classes. All paths are relative
+// to the directory containing the file and use forward slashes.
+type toolingData struct {
+	Version   int               `json:"version"`
+	Templates []toolingTemplate `json:"templates"`
+	Outputs   []toolingOutput   `json:"outputs"`
+}
+
+type toolingTemplate struct {
+	Name       string   `json:"name"` // "Queue", or "Repository.get" for generic methods
+	Kind       string   `json:"kind"` // "class" or "method"
+	Path       string   `json:"path"`
+	Line       int      `json:"line"`
+	TypeParams []string `json:"typeParams"`
+}
+
+type toolingOutput struct {
+	Path          string `json:"path"`
+	Source        string `json:"source,omitempty"`        // .peak file the class was generated from
+	Template      string `json:"template,omitempty"`      // Template name, for concrete classes
+	Instantiation string `json:"instantiation,omitempty"` // e.g. "Queue<Integer>", for concrete classes
+}
+
+// writeTooling writes .peak-tooling.json to the source directory
+func writeTooling(cfg *config.Config, build *buildResult) error {
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(cfg.SourceDir, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	data := toolingData{
+		Version:   toolingVersion,
+		Templates: make([]toolingTemplate, 0, len(build.templateDefs)),
+		Outputs:   make([]toolingOutput, 0, len(build.outputs)),
+	}
+
+	for _, def := range build.templateDefs {
+		kind := "class"
+		if def.IsMethod {
+			kind = "method"
+		}
+		data.Templates = append(data.Templates, toolingTemplate{
+			Name:       def.Name,
+			Kind:       kind,
+			Path:       relative(def.Path),
+			Line:       def.Line,
+			TypeParams: def.TypeParams,
+		})
+	}
+
+	for _, result := range build.outputs {
+		output := toolingOutput{Path: relative(result.OutputPath)}
+		switch {
+		case result.OriginalPath != "":
+			output.Source = relative(result.OriginalPath)
+		case result.TemplatePath != "":
+			output.Source = relative(result.TemplatePath)
+			output.Template, _, _ = strings.Cut(result.Instantiation, "<")
+			output.Instantiation = result.Instantiation
+		}
+		data.Outputs = append(data.Outputs, output)
+	}
+	sort.Slice(data.Outputs, func(i, j int) bool { return data.Outputs[i].Path < data.Outputs[j].Path })
+
+	// Keep generic expressions readable: no \u003c escapes for < and >
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cfg.SourceDir, toolingFile), buf.Bytes(), filePermission)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// outputChange is a generated output that an upgrade regenerates
+type outputChange struct {
+	path     string
+	from     string // Peak version named by the existing output, "" if none
+	previous string // Existing content, "" for a new output
+	content  string // Content the sources produce now
+	missing  bool   // No output exists yet
+}
+
+// runUpgrade regenerates every output whose content this Peak version would change,
+// such as outputs of older versions, which name them in their provenance header, and
+// outputs of templates changed since the last build. It then reports what changed in
+// each, so upgrading Peak across a large project is a single command. Outputs are
+// written by a regular build, which keeps its checks for hand-written and edited files.
+func runUpgrade(dir string, flags config.CLIFlags) error {
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return
+
+	cfg, err := config.LoadConfig(dir, flags)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+
+	peakFiles, err := findPeakFiles(cfg, nil)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory '%s' does not exist\n\nTip: Check the directory path and try again", cfg.SourceDir)
+		}
+		return fmt.Errorf("error finding .peak files: %w", err)
+	}
+	files, err := readFiles(peakFiles, cfg.MaxFileSize, false)
+	if err != nil {
+		return err
+	}
+
+	results, _, err := transpileProject(cfg, files, nil)
+	if err != nil {
+		return err
+	}
+
+	// A partial build would leave the outputs of failing sources behind
+	var errorCount int
+	for _, result := range results {
+		if result.Error != nil {
+			errorCount++
+			out.diagnostic(diagnostic.FromError(result.OriginalPath, result.Error), result.Error)
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("upgrade needs sources that compile: %d compilation error(s)", errorCount)
+	}
+
+	changes, outputs, err := findChangedOutputs(results)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(out.w, "%s✓%s All %s%d%s output(s) are up to date with Peak %s\n",
+			out.success, out.reset, out.count, outputs, out.reset, versionLabel(peakVersion()))
+		return nil
+	}
+
+	if err := runFolder(dir, flags); err != nil {
+		return err
+	}
+	out.upgraded(cfg.SourceDir, changes, flags.Diff)
+	return nil
+}
+
+// findChangedOutputs compares the outputs in results with the files on disk, in
+// path order, and returns the ones that would change along with the number of
+// outputs. Hand-written files are left to the build's handWrittenClasses policy.
+func findChangedOutputs(results []transpiler.FileResult) ([]outputChange, int, error) {
+	var changes []outputChange
+	outputs := 0
+	for _, result := range results {
+		if result.Error != nil || result.IsTemplate || result.OutputPath == "" {
+			continue
+		}
+		outputs++
+		data, err := os.ReadFile(result.OutputPath)
+		if os.IsNotExist(err) {
+			changes = append(changes, outputChange{path: result.OutputPath, content: result.Content, missing: true})
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading %s: %w", result.OutputPath, err)
+		}
+		// Line endings are ignored, like verify does
+		previous := strings.ReplaceAll(string(data), "\r\n", "\n")
+		if !transpiler.IsGenerated(previous) || previous == result.Content {
+			continue
+		}
+		changes = append(changes, outputChange{
+			path:     result.OutputPath,
+			from:     transpiler.GeneratedVersion(previous),
+			previous: previous,
+			content:  result.Content,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+	return changes, outputs, nil
+}
+
+// versionLabel names a Peak version for reports
+func versionLabel(v string) string {
+	if v == "" {
+		return "(development build)"
+	}
+	return v
+}
+
+// upgraded prints what an upgrade changed: a line per output, with the version it
+// came from and the lines added and removed, and with showDiff a unified diff of each
+func (p *printer) upgraded(sourceDir string, changes []outputChange, showDiff bool) {
+	current := peakVersion()
+	fmt.Fprintf(p.w, "\nUpgraded %s%d%s output(s) to Peak %s\n", p.count, len(changes), p.reset, versionLabel(current))
+	for _, c := range changes {
+		path := c.path
+		if rel, err := filepath.Rel(sourceDir, c.path); err == nil {
+			path = filepath.ToSlash(rel)
+		}
+
+		var reason, lines string
+		switch {
+		case c.missing:
+			reason = "new"
+		case c.from != current:
+			from := c.from
+			if from == "" {
+				from = "unversioned"
+			}
+			reason = fmt.Sprintf("%s -> %s", from, versionLabel(current))
+		default:
+			reason = "sources changed"
+		}
+		if !c.missing {
+			var added, removed int
+			for _, op := range diffLines(splitLines(c.previous), splitLines(c.content)) {
+				switch op.kind {
+				case '+':
+					added++
+				case '-':
+					removed++
+				}
+			}
+			lines = fmt.Sprintf(" %s+%d%s %s-%d%s", p.success, added, p.reset, p.error, removed, p.reset)
+		}
+		fmt.Fprintf(p.w, "  %s%s%s %s%s%s%s\n", p.path, path, p.reset, p.muted, reason, p.reset, lines)
+	}
+
+	if showDiff {
+		for _, c := range changes {
+			if !c.missing {
+				p.printDiff(c.path, c.previous, c.content)
+			}
+		}
+	}
+}
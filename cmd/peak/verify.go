@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// snapshot is a read-only view of project files: the working tree, or the git index
+type snapshot interface {
+	// peakFiles returns the .peak files under cfg.SourceDir, outside excluded directories
+	peakFiles(cfg *config.Config) ([]string, error)
+	// contents returns the content of each path that exists; missing paths are omitted
+	contents(paths []string) (map[string]string, error)
+}
+
+// workingTree reads files from disk
+type workingTree struct{}
+
+func (workingTree) peakFiles(cfg *config.Config) ([]string, error) {
+	return findPeakFiles(cfg, nil)
+}
+
+func (workingTree) contents(paths []string) (map[string]string, error) {
+	return readFiles(paths, 0, true)
+}
+
+// snapshotReader returns a function that reads a single file from snap, such as a
+// peak:include snippet
+func snapshotReader(snap snapshot) func(string) (string, error) {
+	return func(path string) (string, error) {
+		contents, err := snap.contents([]string{path})
+		if err != nil {
+			return "", err
+		}
+		content, ok := contents[path]
+		if !ok {
+			return "", os.ErrNotExist
+		}
+		return content, nil
+	}
+}
+
+// staleOutput is a generated file whose checked-in content does not match
+// what the current sources produce
+type staleOutput struct {
+	path    string
+	missing bool   // Output does not exist at all
+	actual  string // Checked-in content, for --diff
+}
+
+// runVerify transpiles sources in memory and fails on compilation errors or on
+// generated outputs that do not match, without writing anything.
+// With --staged, sources and outputs are read from the git index, for use in pre-commit hooks.
+// With --diff, a unified diff of every stale output follows the diagnostics.
+func runVerify(dir string, flags config.CLIFlags) error {
+	startTime := time.Now()
+	out := newPrinter(flags.Format)
+	defer out.flushDiagnostics() // In case of an early return; the summary prints them otherwise
+
+	// The configuration is staged along with the sources it builds
+	var snap snapshot = workingTree{}
+	var index *gitIndex
+	readFile := os.ReadFile
+	if flags.Staged {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("invalid source directory: %w", err)
+		}
+		if index, err = openGitIndex(absDir); err != nil {
+			return err
+		}
+		snap = index
+		read := snapshotReader(index)
+		readFile = func(path string) ([]byte, error) {
+			content, err := read(path)
+			return []byte(content), err
+		}
+	}
+
+	cfg, err := config.LoadConfigWith(dir, flags, readFile)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	out.maxErrors = cfg.MaxErrors
+	if err := out.setTheme(cfg.Theme, cfg.Colors); err != nil {
+		return err
+	}
+
+	peakFiles, err := snap.peakFiles(cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory '%s' does not exist\n\nTip: Check the directory path and try again", cfg.SourceDir)
+		}
+		return fmt.Errorf("error finding .peak files: %w", err)
+	}
+	if len(peakFiles) == 0 {
+		// Nothing to check, e.g. a commit that does not touch Peak sources
+		return nil
+	}
+
+	files, err := snap.contents(peakFiles)
+	if err != nil {
+		return err
+	}
+
+	results, tr, err := transpileProject(cfg, files, snapshotReader(snap))
+	if err != nil {
+		return err
+	}
+	// Collect expected outputs, reporting compilation errors
+	var errorCount, skippedTemplates int
+	for _, d := range tr.Warnings() {
+		d = promoteWarning(cfg, d)
+		if d.Severity == diagnostic.SeverityError {
+			errorCount++
+		}
+		out.diagnostic(d, nil)
+	}
+	expected := make(map[string]string)
+	var sourceOutputs []string
+	for _, result := range results {
+		if result.Error != nil {
+			errorCount++
+			out.diagnostic(diagnostic.FromError(result.OriginalPath, result.Error), result.Error)
+			continue
+		}
+		if result.IsTemplate {
+			skippedTemplates++
+			continue
+		}
+		expected[result.OutputPath] = result.Content
+		expected[result.OutputPath+"-meta.xml"] = cfg.GenerateMetaXML()
+		if result.OriginalPath != "" {
+			sourceOutputs = append(sourceOutputs, result.OutputPath)
+		}
+	}
+	if cfg.HandWritten == config.HandWrittenSkip {
+		if err := dropHandWritten(snap, expected, sourceOutputs); err != nil {
+			return err
+		}
+	}
+
+	stale, err := findStaleOutputs(snap, expected)
+	if err != nil {
+		return err
+	}
+
+	// Outputs that were never staged only matter if the project commits generated code
+	if index != nil && !tracksAny(index, expected) {
+		stale = nil
+	}
+
+	for _, s := range stale {
+		code, reason := diagnostic.CodeStaleOutput, "generated output is out of date"
+		if s.missing {
+			code, reason = diagnostic.CodeMissingOutput, "generated output is missing"
+		}
+		out.diagnostic(diagnostic.Diagnostic{
+			Severity: diagnostic.SeverityError,
+			Code:     code,
+			File:     s.path,
+			Message:  reason + " (run peak to regenerate)",
+		}, nil)
+	}
+	if flags.Diff {
+		out.flushDiagnostics()
+		for _, s := range stale {
+			if !s.missing {
+				out.printDiff(s.path, s.actual, expected[s.path])
+			}
+		}
+	}
+
+	out.summary(len(expected)/2, 0, skippedTemplates, errorCount+len(stale), time.Since(startTime))
+	if errorCount > 0 {
+		return fmt.Errorf("verification failed: %d compilation error(s)", errorCount)
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("verification failed: %d stale output(s)", len(stale))
+	}
+	return nil
+}
+
+// dropHandWritten removes from expected the outputs of sources whose path holds a
+// hand-written class in snap, which a build keeps when handWrittenClasses is skip
+func dropHandWritten(snap snapshot, expected map[string]string, sourceOutputs []string) error {
+	actual, err := snap.contents(sourceOutputs)
+	if err != nil {
+		return err
+	}
+	for path, content := range actual {
+		if !transpiler.IsGenerated(strings.ReplaceAll(content, "\r\n", "\n")) {
+			delete(expected, path)
+			delete(expected, path+"-meta.xml")
+		}
+	}
+	return nil
+}
+
+// findStaleOutputs compares expected outputs against the snapshot, in path order
+func findStaleOutputs(snap snapshot, expected map[string]string) ([]staleOutput, error) {
+	paths := make([]string, 0, len(expected))
+	for path := range expected {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	actual, err := snap.contents(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []staleOutput
+	for _, path := range paths {
+		content, ok := actual[path]
+		if !ok {
+			stale = append(stale, staleOutput{path: path, missing: true})
+		} else if strings.ReplaceAll(content, "\r\n", "\n") != expected[path] {
+			// Line endings are ignored: git may check outputs out with CRLF on Windows
+			stale = append(stale, staleOutput{path: path, actual: content})
+		}
+	}
+	return stale, nil
+}
+
+// tracksAny reports whether any of the expected outputs is staged
+func tracksAny(index *gitIndex, expected map[string]string) bool {
+	for path := range expected {
+		if index.has(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+// gitRepo creates a git repository in a temporary directory with a built project
+// committed, and returns the directory and a function running git in it
+func gitRepo(t *testing.T, files map[string]string) (string, func(args ...string)) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-c", "user.name=Peak", "-c", "user.email=peak@example.com", "-c", "core.autocrlf=false"}, args...)
+		if _, err := runGit(dir, nil, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	writeProject(t, dir, files)
+	if err := compileDirectory(dir, config.CLIFlags{}, nil, &buildResult{}); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	git("add", "-A")
+	git("commit", "-q", "-m", "Initial")
+	return dir, git
+}
+
+func TestRunVerify_Staged(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> queue;\n}",
+	}
+	build := func(t *testing.T, dir string) {
+		if err := compileDirectory(dir, config.CLIFlags{}, nil, &buildResult{}); err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		change     func(t *testing.T, dir string, git func(args ...string))
+		stagedErr  string // Expected error of verify --staged ("" = passes)
+		workingErr string // Expected error of verify on the working tree
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, dir string, git func(args ...string)) {},
+		},
+		{
+			name: "unstaged edit",
+			change: func(t *testing.T, dir string, git func(args ...string)) {
+				writeProject(t, dir, map[string]string{"Example.peak": "public class Example {\n    private Queue<String> queue;\n}"})
+			},
+			workingErr: "3 stale output(s)", // Example.cls, QueueString.cls and its -meta.xml
+		},
+		{
+			name: "staged edit",
+			change: func(t *testing.T, dir string, git func(args ...string)) {
+				writeProject(t, dir, map[string]string{"Example.peak": "public class Example {\n    private Queue<String> queue;\n}"})
+				git("add", "Example.peak")
+				writeProject(t, dir, map[string]string{"Example.peak": files["Example.peak"]})
+			},
+			stagedErr: "3 stale output(s)",
+		},
+		{
+			name: "staged deletion",
+			change: func(t *testing.T, dir string, git func(args ...string)) {
+				git("rm", "-q", "--cached", "QueueInteger.cls")
+			},
+			stagedErr: "1 stale output(s)",
+		},
+		{
+			name: "staged deletion of a source",
+			change: func(t *testing.T, dir string, git func(args ...string)) {
+				// Outputs of a source deleted from the index are orphans for peak clean, not stale
+				git("rm", "-q", "--cached", "Example.peak")
+				writeProject(t, dir, map[string]string{"Example.peak": "public class Example {\n    private Queue<Boolean> queue;\n}"})
+			},
+			workingErr: "3 stale output(s)",
+		},
+		{
+			name: "staged rename",
+			change: func(t *testing.T, dir string, git func(args ...string)) {
+				git("mv", "Example.peak", "Sample.peak")
+				writeProject(t, dir, map[string]string{"Sample.peak": "public class Sample {\n    private Queue<Integer> queue;\n}"})
+				git("add", "Sample.peak")
+				build(t, dir) // Sample.cls is written but not staged
+			},
+			stagedErr: "2 stale output(s)",
+		},
+		{
+			name: "staged rename with its outputs",
+			change: func(t *testing.T, dir string, git func(args ...string)) {
+				git("mv", "Example.peak", "Sample.peak")
+				writeProject(t, dir, map[string]string{"Sample.peak": "public class Sample {\n    private Queue<Integer> queue;\n}"})
+				build(t, dir)
+				git("add", "-A")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, git := gitRepo(t, files)
+			tt.change(t, dir, git)
+
+			for _, staged := range []bool{true, false} {
+				expected := tt.workingErr
+				if staged {
+					expected = tt.stagedErr
+				}
+				err := runVerify(dir, config.CLIFlags{Staged: staged})
+				if expected == "" && err != nil {
+					t.Errorf("expected verify (staged %v) to pass, got %v", staged, err)
+				} else if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+					t.Errorf("expected verify (staged %v) to fail with %q, got %v", staged, expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunVerify_StagedConfig(t *testing.T) {
+	dir, git := gitRepo(t, map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> queue;\n}",
+	})
+
+	// The staged configuration changes the API version in every -meta.xml
+	writeProject(t, dir, map[string]string{"peakconfig.json": `{"compilerOptions": {"apiVersion": "50.0"}}`})
+	git("add", "peakconfig.json")
+	if err := os.Remove(filepath.Join(dir, "peakconfig.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runVerify(dir, config.CLIFlags{}); err != nil {
+		t.Errorf("expected verify to pass with the working tree configuration, got %v", err)
+	}
+	err := runVerify(dir, config.CLIFlags{Staged: true})
+	if err == nil || !strings.Contains(err.Error(), "2 stale output(s)") { // Example.cls-meta.xml and QueueInteger.cls-meta.xml
+		t.Errorf("expected verify --staged to use the staged configuration, got %v", err)
+	}
+}
+
+func TestGitIndexContents(t *testing.T) {
+	dir, git := gitRepo(t, map[string]string{
+		"Example.peak": "public class Example { }",
+		"src/Old.peak": "public class Old { }",
+	})
+	git("mv", "src/Old.peak", "src/New.peak")
+	if err := os.WriteFile(filepath.Join(dir, "Example.peak"), []byte("public class Example { Integer unstaged; }"), filePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := openGitIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(dir, config.CLIFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := index.peakFiles(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(cfg.SourceDir, "Example.peak"), filepath.Join(cfg.SourceDir, "src", "New.peak")}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected staged sources %v, got %v", expected, paths)
+	}
+
+	contents, err := index.contents(append(paths, filepath.Join(cfg.SourceDir, "src", "Old.peak")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 2 || contents[expected[0]] != "public class Example { }" || contents[expected[1]] != "public class Old { }" {
+		t.Errorf("expected the staged contents, got %v", contents)
+	}
+}
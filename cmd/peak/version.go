@@ -0,0 +1,34 @@
+package main
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// version is the Peak release, set when building a release with
+// -ldflags "-X main.version=v1.4.0". Without it, the module version that go install
+// records is used.
+var version string
+
+// pseudoVersion matches the versions Go gives untagged commits, such as
+// v0.0.0-20250101120000-abcdef123456
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}`)
+
+// peakVersion returns the release of this binary, such as "v1.4.0", or "" for
+// development builds. Generated files name it in their provenance header, so only
+// releases do: builds of untagged or modified commits would change every output.
+func peakVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	v := info.Main.Version
+	if v == "" || v == "(devel)" || strings.Contains(v, "+") || pseudoVersion.MatchString(v) {
+		return ""
+	}
+	return v
+}
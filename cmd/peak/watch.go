@@ -6,43 +6,100 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/ipavlic/peak/pkg/config"
 )
 
 const (
-	debounceDuration = 500 * time.Millisecond // Debounce delay for file changes
-	timeFormat       = "15:04:05"             // Time format for change detection messages
+	debounceDuration  = 500 * time.Millisecond // Debounce delay for file changes
+	timeFormat        = "15:04:05"             // Time format for change detection messages
+	rewatchInterval   = 2 * time.Second        // Delay between attempts to re-establish a failed watch
+	heartbeatInterval = 10 * time.Minute       // Interval of the debug heartbeat in watch mode
 )
 
+// watchSession is the state of a watch mode run, shared by its rebuilds
+type watchSession struct {
+	dir     string
+	flags   config.CLIFlags
+	cfg     *config.Config // Configuration at start, for the directories to watch
+	cache   *sourceCache   // Sources are cached between rebuilds so only changed files are re-read
+	state   *outputState   // What each output was generated from, so only affected outputs are regenerated
+	started time.Time
+	mu      sync.Mutex        // Serializes builds, so a slow build and the next one never write the same files
+	builds  int               // Builds run so far, guarded by mu
+	outputs map[string]string // Output hashes of the last successful build, for --exec, guarded by mu
+}
+
+// build compiles the watched directory, then runs the --exec command and deploys
+// the changed classes with --deploy if the build succeeded. Both run before the next
+// build starts. A failed deploy is reported; it does not stop watching.
+func (s *watchSession) build() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.builds++
+	build := &buildResult{keepLines: s.flags.Deploy, state: s.state}
+	if err := compileDirectory(s.dir, s.flags, s.cache, build); err != nil {
+		return err
+	}
+	changed := changedOutputs(build, s.outputs)
+	s.outputs = build.outputHashes
+	if s.flags.Exec != "" {
+		runExec(s.flags.Exec, s.builds, changed)
+	}
+	if s.flags.Deploy {
+		if err := runDeploy(s.dir, s.flags, build, changed); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+	return nil
+}
+
+// heartbeat logs that the session is alive, with the figures that show whether a
+// long session grows: builds, cached sources and heap size. It is logged at debug
+// level, so it shows with --verbose.
+func (s *watchSession) heartbeat() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.mu.Lock()
+	builds := s.builds
+	s.mu.Unlock()
+	logger.Debug("still watching", "dir", s.dir, "uptime", time.Since(s.started).Round(time.Second),
+		"builds", builds, "cachedSources", s.cache.size(), "heapBytes", mem.HeapAlloc)
+}
+
 // runWatch starts file watching mode for the specified directory.
-// It performs an initial compilation, then watches for .peak file changes
-// and recompiles automatically with a 500ms debounce delay.
+// It performs an initial compilation, then watches for .peak and .peakpart file changes
+// in it and its subdirectories, except excluded ones, and recompiles automatically
+// with a 500ms debounce delay. A watch that fails, or whose directory is removed, is
+// re-established, followed by a rebuild.
 // Gracefully handles Ctrl+C (SIGINT) and SIGTERM signals.
-func runWatch(dir string, rootDir string, outDir string, apiVersion string) error {
+func runWatch(dir string, flags config.CLIFlags) error {
 	if err := validateDirectory(dir); err != nil {
 		return err
 	}
 
-	fmt.Fprintf(os.Stderr, "Watching directory: %s\n", dir)
-	fmt.Fprintf(os.Stderr, "Press Ctrl+C to stop\n\n")
+	logger.Info("Watching directory (press Ctrl+C to stop)", "dir", dir)
+
+	session := &watchSession{dir: dir, flags: flags, cfg: watchConfig(dir, flags), cache: newSourceCache(), state: newOutputState(), started: time.Now()}
 
 	// Initial compilation
-	if err := compileDirectory(dir, rootDir, outDir, apiVersion); err != nil {
-		fmt.Fprintf(os.Stderr, "Initial compilation failed: %v\n", err)
+	if err := session.build(); err != nil {
+		logger.Error("Initial compilation failed", "error", err)
 	}
 
-	watcher, ctx, cancel, err := setupWatcher(dir)
+	watcher, ctx, cancel, err := setupWatcher(session.cfg)
 	if err != nil {
 		return err
 	}
-	defer watcher.Close()
 	defer cancel()
 
-	return watchLoop(ctx, watcher, dir, rootDir, outDir, apiVersion)
+	return watchLoop(ctx, watcher, session)
 }
 
 // validateDirectory checks if the directory exists
@@ -53,16 +110,28 @@ func validateDirectory(dir string) error {
 	return nil
 }
 
-// setupWatcher creates and configures the file watcher with signal handling
-func setupWatcher(dir string) (*fsnotify.Watcher, context.Context, context.CancelFunc, error) {
-	watcher, err := fsnotify.NewWatcher()
+// watchConfig loads the configuration that decides which directories are watched. If
+// it cannot be loaded, the initial build reports why, and the default exclusions apply.
+func watchConfig(dir string, flags config.CLIFlags) *config.Config {
+	if cfg, err := config.LoadConfig(dir, flags); err == nil {
+		return cfg
+	}
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to create watcher: %w", err)
+		absDir = dir
+	}
+	cfg := &config.Config{SourceDir: absDir, Exclude: make(map[string]bool)}
+	for _, name := range config.DefaultExclude {
+		cfg.Exclude[name] = true
 	}
+	return cfg
+}
 
-	if err := watcher.Add(dir); err != nil {
-		watcher.Close()
-		return nil, nil, nil, fmt.Errorf("failed to watch directory: %w", err)
+// setupWatcher creates and configures the file watcher with signal handling
+func setupWatcher(cfg *config.Config) (*fsnotify.Watcher, context.Context, context.CancelFunc, error) {
+	watcher, err := newWatcher(cfg)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -72,7 +141,7 @@ func setupWatcher(dir string) (*fsnotify.Watcher, context.Context, context.Cance
 
 	go func() {
 		<-sigChan
-		fmt.Fprintf(os.Stderr, "\nReceived interrupt signal, shutting down...\n")
+		logger.Info("Received interrupt signal, shutting down")
 		signal.Stop(sigChan)
 		cancel()
 	}()
@@ -80,9 +149,92 @@ func setupWatcher(dir string) (*fsnotify.Watcher, context.Context, context.Cance
 	return watcher, ctx, cancel, nil
 }
 
-// watchLoop runs the main event loop for file watching
-func watchLoop(ctx context.Context, watcher *fsnotify.Watcher, dir string, rootDir string, outDir string, apiVersion string) error {
+// newWatcher creates a file watcher for cfg.SourceDir and its subdirectories
+func newWatcher(cfg *config.Config) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	if err := watchTree(watcher, cfg, cfg.SourceDir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch directory: %w", err)
+	}
+	return watcher, nil
+}
+
+// watchTree adds root and the directories below it to watcher, skipping the ones
+// cfg excludes, so tooling caches such as node_modules do not use up watches.
+// Subdirectories that cannot be watched are logged and skipped.
+func watchTree(watcher *fsnotify.Watcher, cfg *config.Config, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			return nil
+		}
+		if err == nil && cfg.IsExcludedDir(path) {
+			return filepath.SkipDir
+		}
+		if err == nil {
+			err = watcher.Add(path)
+		}
+		if err != nil {
+			if path == root {
+				return err
+			}
+			logger.Warn("could not watch directory", "dir", path, "error", err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+}
+
+// rewatch replaces a failed watcher, retrying every rewatchInterval until dir can be
+// watched again, for example once a removed directory is recreated. It returns nil
+// if ctx is cancelled first.
+func rewatch(ctx context.Context, cfg *config.Config) *fsnotify.Watcher {
+	dir := cfg.SourceDir
+	for {
+		watcher, err := newWatcher(cfg)
+		if err == nil {
+			logger.Info("Watch re-established", "dir", dir)
+			return watcher
+		}
+		logger.Warn("could not re-establish watch, retrying", "dir", dir, "error", err, "interval", rewatchInterval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(rewatchInterval):
+		}
+	}
+}
+
+// watchLoop runs the main event loop for file watching. It closes watcher, or the
+// watcher that replaced it, when it returns.
+func watchLoop(ctx context.Context, watcher *fsnotify.Watcher, session *watchSession) error {
 	var debounceTimer *time.Timer
+	defer func() {
+		if watcher != nil {
+			watcher.Close()
+		}
+	}()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// restart replaces the watcher after it failed, then rebuilds, since changes
+	// made while nothing was watching were missed
+	restart := func() bool {
+		if debounceTimer != nil {
+			debounceTimer.Stop() // Superseded by the rebuild below
+		}
+		watcher.Close()
+		if watcher = rewatch(ctx, session.cfg); watcher == nil {
+			return false
+		}
+		debounceTimer = scheduleBuild(ctx, session, debounceTimer, "Rebuilding after watch was re-established")
+		return true
+	}
 
 	for {
 		select {
@@ -96,29 +248,76 @@ func watchLoop(ctx context.Context, watcher *fsnotify.Watcher, dir string, rootD
 			if !ok {
 				return nil
 			}
-			debounceTimer = handleFileEvent(ctx, event, dir, rootDir, outDir, apiVersion, debounceTimer)
+			if isWatchedDirGone(event, session.cfg.SourceDir) {
+				logger.Warn("Watched directory was removed or renamed", "dir", session.dir)
+				if !restart() {
+					return nil
+				}
+				continue
+			}
+			if isNewDir(event, session.cfg) {
+				// Watch it, and build in case it arrived with sources in it
+				if err := watchTree(watcher, session.cfg, event.Name); err != nil {
+					logger.Warn("could not watch directory", "dir", event.Name, "error", err)
+				}
+				debounceTimer = scheduleBuild(ctx, session, debounceTimer, "Directory added", "dir", filepath.Base(event.Name))
+				continue
+			}
+			debounceTimer = handleFileEvent(ctx, event, session, debounceTimer)
 
 		case err, ok := <-watcher.Errors:
 			if !ok {
 				return nil
 			}
-			fmt.Fprintf(os.Stderr, "Watch error: %v\n", err)
+			logger.Error("Watch error", "error", err)
+			if !restart() {
+				return nil
+			}
+
+		case <-heartbeat.C:
+			session.heartbeat()
 		}
 	}
 }
 
+// isWatchedDirGone reports whether event is the removal or renaming of the watched
+// directory itself, which silently ends its watch
+func isWatchedDirGone(event fsnotify.Event, dir string) bool {
+	return filepath.Clean(event.Name) == filepath.Clean(dir) &&
+		(event.Op.Has(fsnotify.Remove) || event.Op.Has(fsnotify.Rename))
+}
+
+// isNewDir reports whether event is the creation of a directory that is watched
+// unless cfg excludes it
+func isNewDir(event fsnotify.Event, cfg *config.Config) bool {
+	if !event.Op.Has(fsnotify.Create) {
+		return false
+	}
+	info, err := os.Stat(event.Name)
+	return err == nil && info.IsDir() && !cfg.IsExcludedDir(event.Name)
+}
+
 // handleFileEvent processes file system events and triggers recompilation
-func handleFileEvent(ctx context.Context, event fsnotify.Event, dir string, rootDir string, outDir string, apiVersion string, debounceTimer *time.Timer) *time.Timer {
-	// Only respond to .peak file changes
-	if !strings.HasSuffix(event.Name, peakExtension) {
+func handleFileEvent(ctx context.Context, event fsnotify.Event, session *watchSession, debounceTimer *time.Timer) *time.Timer {
+	// Only respond to changes to .peak files and the snippets they include
+	if !strings.HasSuffix(event.Name, peakExtension) && !strings.HasSuffix(event.Name, snippetExtension) {
 		return debounceTimer
 	}
 
-	// Handle write and create events
-	if event.Op&fsnotify.Write != fsnotify.Write && event.Op&fsnotify.Create != fsnotify.Create {
+	// Handle writes, creates, and removals. Editors that save by replacing the file
+	// (write a temp file, then rename it over the original) produce Rename/Remove and
+	// Create events instead of Write, notably on Windows; the debounce coalesces them.
+	if !event.Op.Has(fsnotify.Write) && !event.Op.Has(fsnotify.Create) &&
+		!event.Op.Has(fsnotify.Remove) && !event.Op.Has(fsnotify.Rename) {
 		return debounceTimer
 	}
 
+	return scheduleBuild(ctx, session, debounceTimer, "Change detected", "file", filepath.Base(event.Name))
+}
+
+// scheduleBuild rebuilds after debounceDuration, replacing the pending rebuild of
+// debounceTimer, and logs msg with args when the rebuild starts
+func scheduleBuild(ctx context.Context, session *watchSession, debounceTimer *time.Timer, msg string, args ...any) *time.Timer {
 	// Reset debounce timer
 	if debounceTimer != nil {
 		debounceTimer.Stop()
@@ -129,10 +328,9 @@ func handleFileEvent(ctx context.Context, event fsnotify.Event, dir string, root
 		case <-ctx.Done():
 			return
 		default:
-			fmt.Fprintf(os.Stderr, "\n[%s] Change detected: %s\n",
-				time.Now().Format(timeFormat), filepath.Base(event.Name))
-			if err := compileDirectory(dir, rootDir, outDir, apiVersion); err != nil {
-				fmt.Fprintf(os.Stderr, "Compilation failed: %v\n", err)
+			logger.Info(msg, args...)
+			if err := session.build(); err != nil {
+				logger.Error("Compilation failed", "error", err)
 			}
 		}
 	})
@@ -7,13 +7,33 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
 )
 
-// Instantiate holds structured instantiation configuration
+// DefaultApiVersion is used when neither config, CLI flags, nor sfdx-project.json set an API version
+const DefaultApiVersion = "65.0"
+
+// DefaultMaxFileSize is the largest source file compiled unless maxFileSize is configured
+const DefaultMaxFileSize = 16 << 20
+
+// sfdxProjectFile is the Salesforce DX project definition file
+const sfdxProjectFile = "sfdx-project.json"
+
+// Instantiate holds structured instantiation configuration.
+// The shorthand form, a list of class instantiations such as ["Queue<Integer>"],
+// is accepted too and converted to Classes when decoding.
 type Instantiate struct {
 	// Classes maps template class names to type arguments
 	// Example: {"Queue": ["Integer", "String"], "Optional": ["Double"]}
@@ -22,6 +42,136 @@ type Instantiate struct {
 	// Methods maps "ClassName.methodName" to type arguments
 	// Example: {"SObjectCollection.groupBy": ["String", "Decimal", "Boolean"]}
 	Methods map[string][]string `json:"methods,omitempty"`
+
+	// positions locates entries in the config file, see Position
+	positions map[string]position
+
+	// aliases maps the position keys of Classes entries converted from the
+	// shorthand form to the position keys of the list elements they came from
+	aliases map[string]string
+}
+
+// UnmarshalJSON decodes either the structured form or the shorthand list form
+func (i *Instantiate) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+		type structured Instantiate // Without this method, to avoid recursion
+		return json.Unmarshal(data, (*structured)(i))
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("instantiate must be an object or a list of instantiations such as \"Queue<Integer>\": %w", err)
+	}
+
+	// Split "Dict<String, Integer>" into the template and its type arguments. Entries
+	// without type arguments are kept as they are, so the transpiler reports them
+	// together with every other invalid instantiation.
+	i.Classes = make(map[string][]string)
+	i.aliases = make(map[string]string)
+	for index, entry := range list {
+		name, typeArgs, _ := strings.Cut(entry, "<")
+		name = strings.TrimSpace(name)
+		typeArgs = strings.TrimSuffix(strings.TrimSpace(typeArgs), ">")
+
+		element := positionKey(instantiatePath, strconv.Itoa(index))
+		if _, seen := i.Classes[name]; !seen {
+			i.aliases[positionKey(instantiatePath, "classes", name)] = element
+		}
+		i.aliases[positionKey(instantiatePath, "classes", name, strconv.Itoa(len(i.Classes[name])))] = element
+		i.Classes[name] = append(i.Classes[name], typeArgs)
+	}
+	return nil
+}
+
+// Notification triggers for Notify.On
+const (
+	NotifyAlways  = "always"  // Every build
+	NotifyFailure = "failure" // Failed builds, and the first successful build after a failure
+	NotifyChange  = "change"  // Only when the build status changes
+)
+
+// Notify configures build result webhooks
+type Notify struct {
+	// Webhook is the URL to POST build results to. Environment variables
+	// such as $PEAK_WEBHOOK_URL are expanded, so secrets can stay out of the config file.
+	Webhook string `json:"webhook"`
+
+	// On selects which builds trigger a notification: "always" (default), "failure" or "change"
+	On string `json:"on,omitempty"`
+}
+
+// Class limit severities
+const (
+	LimitWarning = "warning" // Report exceeding the limit and generate anyway
+	LimitError   = "error"   // Fail the build without generating concrete classes
+)
+
+// ClassLimit caps the number of concrete classes a single run may generate,
+// so that runaway nesting is noticed before it floods the org with classes
+type ClassLimit struct {
+	// Max is the largest number of concrete classes generated without a diagnostic
+	Max int `json:"max"`
+
+	// Severity of exceeding Max: "warning" (default) or "error"
+	Severity string `json:"severity,omitempty"`
+}
+
+// Policies for a .peak source whose output would replace a hand-written .cls file of
+// the same name, as when a class is being migrated to Peak
+const (
+	HandWrittenError     = "error"     // Report the conflict and write nothing for the source
+	HandWrittenSkip      = "skip"      // Keep the hand-written class and warn
+	HandWrittenOverwrite = "overwrite" // Replace the hand-written class
+)
+
+// Policies for concrete class names longer than the 40 characters Apex allows, as
+// generated for deeply nested instantiations
+const (
+	LongClassNamesError = "error" // Report the instantiation and generate nothing
+	LongClassNamesHash  = "hash"  // Shorten the name to a prefix and a hash of the instantiation
+)
+
+// classNameChars are the characters of Apex class names, letters first
+const classNameChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_"
+
+// Styles of the nested type arguments in concrete class names
+const (
+	NestedJoin  = "join"  // Separate nested type arguments like the others: Queue_List_Integer
+	NestedCamel = "camel" // Run nested type arguments together: Queue_ListInteger
+)
+
+// ClassNaming is a team's pattern for concrete class names, which otherwise run the
+// template name and its type arguments together, e.g. DictStringInteger
+type ClassNaming struct {
+	// Prefix starts every name, such as a namespace-like "acme_"
+	Prefix string `json:"prefix,omitempty"`
+
+	// Suffix ends every name, such as "Gen"
+	Suffix string `json:"suffix,omitempty"`
+
+	// Separator goes between the template name and each type argument, such as "_"
+	Separator string `json:"separator,omitempty"`
+
+	// Nested is the style of generic type arguments: "join" (default) or "camel"
+	Nested string `json:"nested,omitempty"`
+}
+
+// TargetSfdx is the target that writes generated classes to the classes directory
+// of the default package directory of the enclosing Salesforce DX project
+const TargetSfdx = "sfdx"
+
+// Visibility sets the access modifiers of generated code, which otherwise copies
+// those of its template
+type Visibility struct {
+	// Classes is the access modifier of concrete classes: "public" or "global"
+	Classes string `json:"classes,omitempty"`
+
+	// Methods is the access modifier of concrete methods generated from generic
+	// methods: "public", "global", "protected" or "private"
+	Methods string `json:"methods,omitempty"`
+
+	// TestVisible annotates concrete methods with @TestVisible
+	TestVisible bool `json:"testVisible,omitempty"`
 }
 
 // CompilerOptions contains compiler-specific configuration options
@@ -35,16 +185,166 @@ type CompilerOptions struct {
 	OutDir string `json:"outDir,omitempty"`
 
 	// ApiVersion is the Salesforce API version for generated .cls-meta.xml files
-	// Default: "65.0"
+	// Default: sourceApiVersion from sfdx-project.json, otherwise "65.0"
 	ApiVersion string `json:"apiVersion,omitempty"`
 
+	// Target is the project layout outputs are written for. "sfdx" sets the default
+	// OutDir to main/default/classes in the default package directory of the
+	// enclosing sfdx-project.json (default: none)
+	Target string `json:"target,omitempty"`
+
 	// Verbose enables detailed logging (default: false)
 	Verbose bool `json:"verbose,omitempty"`
 
 	// Instantiate provides structured instantiation for classes and methods
 	Instantiate *Instantiate `json:"instantiate,omitempty"`
+
+	// SourceMap writes a .peak.map sidecar next to each generated class (default: false)
+	SourceMap bool `json:"sourceMap,omitempty"`
+
+	// Package is the path of an MDAPI zip to package generated classes into,
+	// relative to the source directory (empty = no package)
+	Package string `json:"package,omitempty"`
+
+	// Registry generates PeakRegistry.cls mapping generic expressions to generated classes (default: false)
+	Registry bool `json:"registry,omitempty"`
+
+	// Tooling writes .peak-tooling.json describing templates and outputs for IDE plugins (default: false)
+	Tooling bool `json:"tooling,omitempty"`
+
+	// DocComments rewrites generic expressions inside /** */ doc comments, e.g. ApexDoc
+	// "@see Queue<Integer>", to the generated class names (default: false)
+	DocComments bool `json:"docComments,omitempty"`
+
+	// DynamicTypes rewrites string literals naming a generic type in Type.forName and
+	// JSON.deserialize calls, e.g. Type.forName('Queue<Integer>'), to the generated class name (default: false)
+	DynamicTypes bool `json:"dynamicTypes,omitempty"`
+
+	// Factories generates a factory class per instantiated template, e.g. QueueFactory
+	// with newIntegerQueue(), as an entry point that tests can replace (default: false)
+	Factories bool `json:"factories,omitempty"`
+
+	// HolderClasses generates the concrete classes of each template as inner classes of
+	// one holder class, e.g. Queues.Integer_ instead of QueueInteger (default: false)
+	HolderClasses bool `json:"holderClasses,omitempty"`
+
+	// LowMemory streams sources and outputs instead of holding the whole project
+	// in memory, at the cost of reading each source up to three times (default: false)
+	LowMemory bool `json:"lowMemory,omitempty"`
+
+	// MaxFileSize is the largest source file, in bytes, that will be compiled (default: 16 MiB)
+	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+
+	// MaxErrors is the number of errors printed before the rest are summarized
+	// as "... and N more error(s)" (default: 0, unlimited)
+	MaxErrors int `json:"maxErrors,omitempty"`
+
+	// Notify posts build results to a webhook (e.g. a Slack incoming webhook)
+	Notify *Notify `json:"notify,omitempty"`
+
+	// ClassLimit reports runs that would generate more concrete classes than its maximum
+	ClassLimit *ClassLimit `json:"classLimit,omitempty"`
+
+	// SelfCheck re-parses every generated file to confirm that substitution left no
+	// template usages or type parameters behind (default: false)
+	SelfCheck bool `json:"selfCheck,omitempty"`
+
+	// CacheDir is a directory, relative to the source directory, for caching parsed
+	// templates between runs (empty = no cache)
+	CacheDir string `json:"cacheDir,omitempty"`
+
+	// Theme selects the color preset for terminal output: "default", "high-contrast" or "none"
+	Theme string `json:"theme,omitempty"`
+
+	// Colors overrides individual theme colors with ANSI SGR parameters, keyed by role
+	// Example: {"error": "1;35", "path": "36"}
+	Colors map[string]string `json:"colors,omitempty"`
+
+	// WarningsAsErrors lists warning codes that fail the build like errors, so
+	// strictness can be raised one rule at a time
+	// Example: ["PEAK106", "PEAK202"]
+	WarningsAsErrors []string `json:"warningsAsErrors,omitempty"`
+
+	// Symbols are the names defined for "// peak:if" sections; sections for other
+	// names are stripped from the output
+	// Example: ["TEST", "DEBUG"]
+	Symbols []string `json:"symbols,omitempty"`
+
+	// Defines sets constants for ${NAME} placeholders, overriding "// peak:define"
+	// lines in sources, so shared templates can be tuned per project
+	// Example: {"MAX_SIZE": "200"}
+	Defines map[string]string `json:"defines,omitempty"`
+
+	// OutputDirs writes the classes generated from the named templates to another
+	// directory, relative to outDir (or the source directory without one), overriding
+	// @PeakOutputDir annotations
+	// Example: {"Fixture": "test"}
+	OutputDirs map[string]string `json:"outputDirs,omitempty"`
+
+	// TestClasses marks templates, by name, and single instantiations as test-only,
+	// like an @IsTest annotation on the template: their concrete classes are declared
+	// @IsTest and written to TestDir
+	// Example: ["Fixture", "Queue<Account>"]
+	TestClasses []string `json:"testClasses,omitempty"`
+
+	// TestDir is the directory that the classes generated from test-only templates
+	// and instantiations are written to, relative to outDir (or the source directory
+	// without one), so test scaffolding stays out of production packages
+	// Example: "test/classes"
+	TestDir string `json:"testDir,omitempty"`
+
+	// Visibility sets the access modifiers of concrete classes and methods, which
+	// @PeakVisibility annotations override per template and method
+	Visibility *Visibility `json:"visibility,omitempty"`
+
+	// ManagedPackage builds for a managed package: the concrete classes of templates
+	// marked with @PeakPackageApi, and their public members, are declared global
+	ManagedPackage bool `json:"managedPackage,omitempty"`
+
+	// PackageApi lists the templates that belong to the package's API, each of which
+	// must be marked with @PeakPackageApi
+	// Example: ["Queue", "Dict"]
+	PackageApi []string `json:"packageApi,omitempty"`
+
+	// AllowOverwrite lists classes that Peak may overwrite although their .cls files
+	// lack its "Generated by Peak" header, such as hand-written classes being
+	// replaced by a template; other such files are never overwritten without --force
+	// Example: ["AccountQueue"]
+	AllowOverwrite []string `json:"allowOverwrite,omitempty"`
+
+	// HandWrittenClasses decides what happens when the output of a .peak source would
+	// replace a hand-written .cls file: "error" (default), "skip" or "overwrite".
+	// Classes generated from templates are not affected.
+	HandWrittenClasses string `json:"handWrittenClasses,omitempty"`
+
+	// LongClassNames decides what happens to concrete class names longer than the 40
+	// characters Apex allows: "error" (default) or "hash", which shortens them to
+	// their first characters and a hash of the instantiation, e.g. DictStringQueueListWrapperAccou_1f3a9c2e
+	LongClassNames string `json:"longClassNames,omitempty"`
+
+	// ClassNames is the naming pattern of concrete classes generated as top-level classes
+	// Example: {"prefix": "acme_", "separator": "_"} names Dict<String, Integer> acme_Dict_String_Integer
+	ClassNames *ClassNaming `json:"classNames,omitempty"`
+
+	// Exclude lists directories skipped when scanning for sources and watching, in
+	// addition to hidden directories and DefaultExclude: a name skips directories of
+	// that name anywhere, a path with a slash one directory relative to the source
+	// directory, and a name prefixed with ! scans a default again
+	// Example: ["vendor", "force-app/main/legacy", "!build"]
+	Exclude []string `json:"exclude,omitempty"`
+
+	// BuiltInGenerics lists generic types passed through unchanged, such as hand-written
+	// classes, in addition to the Apex system generics of parser.DefaultBuiltInGenerics;
+	// names may be qualified, and a name prefixed with ! expands a default again
+	// Example: ["Pair<K, V>", "Outer.Holder<T>", "!Iterator"]
+	BuiltInGenerics []string `json:"builtInGenerics,omitempty"`
 }
 
+// DefaultExclude are the directories skipped when scanning for sources besides hidden
+// directories such as .sfdx and .sf: package manager and build tool output that holds
+// no .peak sources but can dwarf the project
+var DefaultExclude = []string{"node_modules", "bower_components", "build", "dist", "target", "coverage"}
+
 // ConfigFile represents the structure of peak.config.json
 type ConfigFile struct {
 	CompilerOptions CompilerOptions `json:"compilerOptions,omitempty"`
@@ -52,27 +352,109 @@ type ConfigFile struct {
 
 // Config represents the runtime configuration for the transpiler
 type Config struct {
-	RootDir     string       // Root directory for structure preservation (absolute path, empty = use SourceDir)
-	SourceDir   string       // Directory to compile (from CLI or current dir)
-	OutDir      string       // Output directory (absolute path, empty = co-located)
-	ApiVersion  string       // Salesforce API version for .cls-meta.xml files (default: "65.0")
-	Watch       bool         // Watch mode enabled
-	Verbose     bool         // Enable verbose logging
-	Instantiate *Instantiate // Structured instantiation for classes and methods
+	RootDir       string            // Root directory for structure preservation (absolute path, empty = use SourceDir)
+	SourceDir     string            // Directory to compile (from CLI or current dir)
+	OutDir        string            // Output directory (absolute path, empty = co-located)
+	ApiVersion    string            // Salesforce API version for .cls-meta.xml files (default: from sfdx-project.json, then "65.0")
+	Watch         bool              // Watch mode enabled
+	Verbose       bool              // Enable verbose logging
+	Instantiate   *Instantiate      // Structured instantiation for classes and methods
+	SfdxProject   string            // Path to the enclosing sfdx-project.json (empty = not an SFDX project)
+	Target        string            // Project layout outputs are written for: "sfdx" or empty
+	ReportPath    string            // Path for the CI summary report (empty = no report)
+	MetricsPath   string            // Path for build metrics, Prometheus textfile if it ends in .prom (empty = none)
+	Format        string            // Output format: "text" (default), "plain", "json" or "sarif"
+	SourceMap     bool              // Write .peak.map sidecars for generated classes
+	PackagePath   string            // MDAPI zip to package generated classes into (absolute path, empty = none)
+	Registry      bool              // Generate PeakRegistry.cls
+	Tooling       bool              // Write .peak-tooling.json for IDE plugins
+	DocComments   bool              // Rewrite generic expressions in doc comments
+	DynamicTypes  bool              // Rewrite generic type names in Type.forName and JSON.deserialize strings
+	Factories     bool              // Generate a factory class per instantiated template
+	HolderClasses bool              // Generate concrete classes as inner classes of a holder per template
+	Notify        *Notify           // Build result webhook (nil = disabled)
+	ClassLimit    *ClassLimit       // Concrete class count limit (nil = unlimited)
+	SelfCheck     bool              // Re-parse generated files before writing them
+	Force         bool              // Overwrite .cls files that lack a Peak header
+	Prune         bool              // Delete generated .cls files that no source produces any more after a build
+	LowMemory     bool              // Read sources on demand instead of all up front
+	MaxFileSize   int64             // Largest source file compiled, in bytes
+	MaxErrors     int               // Errors printed before the rest are summarized (0 = unlimited)
+	CacheDir      string            // Directory for the parsed template cache (absolute path, empty = no cache)
+	Theme         string            // Color preset for terminal output (empty = default)
+	Colors        map[string]string // Per-role ANSI SGR overrides of the theme
+
+	WarningsAsErrors map[string]bool   // Warning codes reported as errors, upper case
+	FailOnWarning    bool              // Report every warning as an error
+	Symbols          []string          // Names defined for peak:if sections, from config and --define
+	Defines          map[string]string // Constants for ${NAME} placeholders
+	OutputDirs       map[string]string // Output directories of templates' generated classes, relative to OutDir or SourceDir
+	TestClasses      []string          // Templates and instantiations whose classes are test-only, besides @IsTest templates
+	TestDir          string            // Output directory of test-only classes, relative to OutDir or SourceDir (empty = unchanged)
+	Visibility       *Visibility       // Access modifiers of generated classes and methods (nil = copied from templates)
+	ManagedPackage   bool              // Make @PeakPackageApi templates and their public members global
+	PackageApi       []string          // Templates that must carry @PeakPackageApi
+	AllowOverwrite   map[string]bool   // Classes that may be overwritten without a Peak header, lowercased
+	HandWritten      string            // Policy for source outputs that would replace hand-written classes
+	LongClassNames   string            // Policy for concrete class names longer than Apex allows
+	ClassNaming      *ClassNaming      // Naming pattern of concrete classes (nil = run the names together)
+	Exclude          map[string]bool   // Directory names and slash paths relative to SourceDir skipped by scans besides OutDir, see IsExcludedDir
+	BuiltInGenerics  map[string]int    // Generic types passed through unchanged, with their number of type arguments
 }
 
 // CLIFlags represents command-line flags
 type CLIFlags struct {
-	RootDir    string
-	OutDir     string
-	ApiVersion string
-	Watch      bool
-	Verbose    bool
+	RootDir       string
+	OutDir        string
+	ApiVersion    string
+	Sfdx          bool // Same as target "sfdx"
+	Watch         bool
+	Verbose       bool
+	ReportPath    string
+	MetricsPath   string
+	Format        string
+	SourceMap     bool
+	Staged        bool // verify: read sources and outputs from the git index
+	Verify        bool // CLI only: run verify instead of compiling, as --verify
+	Diff          bool // verify: print a unified diff of every stale output
+	Package       string
+	Registry      bool
+	Tooling       bool
+	DocComments   bool
+	DynamicTypes  bool
+	Factories     bool
+	HolderClasses bool
+	MaxClasses    int // Overrides classLimit.max, keeping its severity
+	MaxErrors     int
+	SelfCheck     bool
+	Force         bool // Overwrite .cls files that lack a Peak header
+	Prune         bool // Delete orphaned generated .cls files after a successful build
+	FailOnWarning bool // Report every warning as an error
+	LowMemory     bool
+	CacheDir      string
+	CPUProfile    string   // CLI only: write a CPU profile to this file
+	MemProfile    string   // CLI only: write a heap profile to this file
+	LogLevel      string   // CLI only: debug, info, warn or error (default: info, debug with Verbose)
+	LogFormat     string   // CLI only: text or json
+	LogFile       string   // CLI only: append log records to this file instead of stderr
+	Define        []string // Symbols for peak:if sections, added to the configured ones
+	Files         string   // CLI only: list of the sources to compile, or - for stdin (empty = all)
+	Events        string   // CLI only: format of the event stream on stdout, "ndjson" (empty = none)
+	Exec          string   // CLI only: shell command to run after each successful watch rebuild
+	Deploy        bool     // CLI only: deploy generated classes with sf project deploy start after a successful build
+	TargetOrg     string   // CLI only: org alias or username to deploy to (empty = the sf default org)
 }
 
 // LoadConfig loads configuration for a specific source directory.
 // Priority: CLI flags > Config file > Defaults
 func LoadConfig(sourceDir string, flags CLIFlags) (*Config, error) {
+	return LoadConfigWith(sourceDir, flags, os.ReadFile)
+}
+
+// LoadConfigWith is LoadConfig reading peakconfig.json with readFile, such as from
+// the git index instead of the working tree. readFile reports a missing file with an
+// error matching fs.ErrNotExist.
+func LoadConfigWith(sourceDir string, flags CLIFlags, readFile func(path string) ([]byte, error)) (*Config, error) {
 	// Convert source directory to absolute path
 	absSourceDir, err := filepath.Abs(sourceDir)
 	if err != nil {
@@ -81,19 +463,33 @@ func LoadConfig(sourceDir string, flags CLIFlags) (*Config, error) {
 
 	// Start with defaults (backwards compatible behavior)
 	config := &Config{
-		RootDir:    "",      // Empty = use SourceDir for relative paths
-		SourceDir:  absSourceDir,
-		OutDir:     "",      // Empty = co-located with source
-		ApiVersion: "65.0",  // Default Salesforce API version
-		Watch:      false,
-		Verbose:    false,
+		RootDir:         "", // Empty = use SourceDir for relative paths
+		SourceDir:       absSourceDir,
+		OutDir:          "", // Empty = co-located with source
+		ApiVersion:      "", // Empty = detect, see below
+		Watch:           false,
+		Verbose:         false,
+		MaxFileSize:     DefaultMaxFileSize,
+		HandWritten:     HandWrittenError,
+		LongClassNames:  LongClassNamesError,
+		Exclude:         make(map[string]bool),
+		BuiltInGenerics: make(map[string]int),
+	}
+	for _, dir := range DefaultExclude {
+		config.Exclude[dir] = true
+	}
+	for name, arity := range parser.DefaultBuiltInGenerics {
+		config.BuiltInGenerics[name] = arity
 	}
 
 	// Try to load config file from source directory (optional)
-	if configFile := findConfigFile(absSourceDir); configFile != "" {
-		if err := loadConfigFile(configFile, config); err != nil {
+	configFile := filepath.Join(absSourceDir, "peakconfig.json")
+	if data, err := readFile(configFile); err == nil {
+		if err := parseConfigFile(data, config); err != nil {
 			return nil, fmt.Errorf("error loading config file %s: %w", configFile, err)
 		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error loading config file %s: failed to read config file: %w", configFile, err)
 	}
 
 	// Override with CLI flags (highest priority)
@@ -106,12 +502,92 @@ func LoadConfig(sourceDir string, flags CLIFlags) (*Config, error) {
 	if flags.ApiVersion != "" {
 		config.ApiVersion = flags.ApiVersion
 	}
+	if flags.Package != "" {
+		config.PackagePath = flags.Package
+	}
+	if flags.CacheDir != "" {
+		config.CacheDir = flags.CacheDir
+	}
+
+	// Fall back to the project's API version so generated metadata matches the
+	// rest of the project, then to the default
+	config.SfdxProject = findSfdxProject(absSourceDir)
+	if config.ApiVersion == "" && config.SfdxProject != "" {
+		version, err := readSourceApiVersion(config.SfdxProject)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", config.SfdxProject, err)
+		}
+		config.ApiVersion = version
+	}
+	if config.ApiVersion == "" {
+		config.ApiVersion = DefaultApiVersion
+	}
+
+	// An SFDX target writes outputs where sf deploys classes from, unless outDir says otherwise
+	if flags.Sfdx {
+		config.Target = TargetSfdx
+	}
+	if config.Target == TargetSfdx && config.OutDir == "" {
+		if config.SfdxProject == "" {
+			return nil, fmt.Errorf("target %q needs an %s in %s or a parent directory", TargetSfdx, sfdxProjectFile, absSourceDir)
+		}
+		dir, err := readDefaultPackageDir(config.SfdxProject)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", config.SfdxProject, err)
+		}
+		config.OutDir = filepath.Join(filepath.Dir(config.SfdxProject), filepath.FromSlash(dir), "main", "default", "classes")
+	}
+
 	if flags.Watch {
 		config.Watch = true
 	}
 	if flags.Verbose {
 		config.Verbose = true
 	}
+	if flags.SourceMap {
+		config.SourceMap = true
+	}
+	if flags.Registry {
+		config.Registry = true
+	}
+	if flags.Tooling {
+		config.Tooling = true
+	}
+	if flags.DocComments {
+		config.DocComments = true
+	}
+	if flags.DynamicTypes {
+		config.DynamicTypes = true
+	}
+	if flags.Factories {
+		config.Factories = true
+	}
+	if flags.HolderClasses {
+		config.HolderClasses = true
+	}
+	if flags.SelfCheck {
+		config.SelfCheck = true
+	}
+	if flags.MaxClasses > 0 {
+		limit := ClassLimit{Max: flags.MaxClasses, Severity: LimitWarning}
+		if config.ClassLimit != nil {
+			limit.Severity = config.ClassLimit.Severity
+		}
+		config.ClassLimit = &limit
+	}
+	if flags.LowMemory {
+		config.LowMemory = true
+	}
+	config.Force = flags.Force
+	config.Prune = flags.Prune
+	config.FailOnWarning = flags.FailOnWarning
+	if flags.MaxErrors > 0 {
+		config.MaxErrors = flags.MaxErrors
+	}
+	config.Symbols = append(config.Symbols, flags.Define...)
+	config.ReportPath = flags.ReportPath
+	config.MetricsPath = flags.MetricsPath
+	config.Format = flags.Format
 
 	// Normalize root directory to absolute path
 	if config.RootDir != "" {
@@ -131,26 +607,96 @@ func LoadConfig(sourceDir string, flags CLIFlags) (*Config, error) {
 		config.OutDir = filepath.Clean(config.OutDir)
 	}
 
+	// Normalize package path to absolute path
+	if config.PackagePath != "" {
+		// If PackagePath is relative, make it relative to source directory
+		if !filepath.IsAbs(config.PackagePath) {
+			config.PackagePath = filepath.Join(absSourceDir, config.PackagePath)
+		}
+		config.PackagePath = filepath.Clean(config.PackagePath)
+	}
+
+	// Normalize cache directory to absolute path
+	if config.CacheDir != "" {
+		// If CacheDir is relative, make it relative to source directory
+		if !filepath.IsAbs(config.CacheDir) {
+			config.CacheDir = filepath.Join(absSourceDir, config.CacheDir)
+		}
+		config.CacheDir = filepath.Clean(config.CacheDir)
+	}
+
 	return config, nil
 }
 
-// findConfigFile looks for peakconfig.json in the specified directory only.
-// Returns empty string if no config file is found.
-func findConfigFile(dir string) string {
-	path := filepath.Join(dir, "peakconfig.json")
-	if _, err := os.Stat(path); err == nil {
-		return path
+// findSfdxProject looks for sfdx-project.json in dir and its parent directories.
+// Returns empty string if dir is not inside an SFDX project.
+func findSfdxProject(dir string) string {
+	for {
+		path := filepath.Join(dir, sfdxProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readSourceApiVersion returns the sourceApiVersion declared in an sfdx-project.json.
+// Returns empty string if the project does not declare one.
+func readSourceApiVersion(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
 	}
-	return "" // No config file found
+
+	var project struct {
+		SourceApiVersion string `json:"sourceApiVersion"`
+	}
+	if err := json.Unmarshal(data, &project); err != nil {
+		return "", fmt.Errorf("failed to parse project file: %w", err)
+	}
+	return project.SourceApiVersion, nil
 }
 
-// loadConfigFile reads and parses a JSON config file
-func loadConfigFile(path string, config *Config) error {
+// readDefaultPackageDir returns the path of the default package directory declared
+// in an sfdx-project.json, relative to the project, or of the first one if none is
+// marked as the default
+func readDefaultPackageDir(path string) (string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		return "", err
+	}
+
+	var project struct {
+		PackageDirectories []struct {
+			Path    string `json:"path"`
+			Default bool   `json:"default"`
+		} `json:"packageDirectories"`
+	}
+	if err := json.Unmarshal(data, &project); err != nil {
+		return "", fmt.Errorf("failed to parse project file: %w", err)
+	}
+	if len(project.PackageDirectories) == 0 {
+		return "", fmt.Errorf("no packageDirectories declared")
 	}
+	dir := project.PackageDirectories[0].Path
+	for _, pkg := range project.PackageDirectories {
+		if pkg.Default {
+			dir = pkg.Path
+			break
+		}
+	}
+	if dir == "" || filepath.IsAbs(dir) {
+		return "", fmt.Errorf("invalid package directory path %q", dir)
+	}
+	return dir, nil
+}
 
+// parseConfigFile parses the contents of a JSON config file into config
+func parseConfigFile(data []byte, config *Config) error {
 	var configFile ConfigFile
 	if err := json.Unmarshal(data, &configFile); err != nil {
 		return fmt.Errorf("failed to parse config file: %w", err)
@@ -169,6 +715,181 @@ func loadConfigFile(path string, config *Config) error {
 	}
 	config.Verbose = opts.Verbose
 	config.Instantiate = opts.Instantiate
+	if config.Instantiate != nil {
+		config.Instantiate.positions = locateValues(data)
+	}
+	config.SourceMap = opts.SourceMap
+	config.Registry = opts.Registry
+	config.Tooling = opts.Tooling
+	config.DocComments = opts.DocComments
+	config.DynamicTypes = opts.DynamicTypes
+	config.Factories = opts.Factories
+	config.HolderClasses = opts.HolderClasses
+	config.SelfCheck = opts.SelfCheck
+	config.LowMemory = opts.LowMemory
+	if opts.MaxFileSize > 0 {
+		config.MaxFileSize = opts.MaxFileSize
+	}
+	if opts.MaxErrors < 0 {
+		return fmt.Errorf("invalid maxErrors %d (expected a positive number, or 0 for no limit)", opts.MaxErrors)
+	}
+	config.MaxErrors = opts.MaxErrors
+
+	if opts.Notify != nil {
+		notify := *opts.Notify
+		notify.Webhook = os.ExpandEnv(notify.Webhook)
+		if notify.On == "" {
+			notify.On = NotifyAlways
+		}
+		if notify.On != NotifyAlways && notify.On != NotifyFailure && notify.On != NotifyChange {
+			return fmt.Errorf("invalid notify.on %q (expected %s, %s or %s)", notify.On, NotifyAlways, NotifyFailure, NotifyChange)
+		}
+		// An unset environment variable disables notifications rather than failing the build
+		if notify.Webhook != "" {
+			config.Notify = &notify
+		}
+	}
+	if opts.ClassLimit != nil {
+		limit := *opts.ClassLimit
+		if limit.Severity == "" {
+			limit.Severity = LimitWarning
+		}
+		if limit.Severity != LimitWarning && limit.Severity != LimitError {
+			return fmt.Errorf("invalid classLimit.severity %q (expected %s or %s)", limit.Severity, LimitWarning, LimitError)
+		}
+		if limit.Max <= 0 {
+			return fmt.Errorf("invalid classLimit.max %d (expected a positive number)", limit.Max)
+		}
+		config.ClassLimit = &limit
+	}
+	if opts.Package != "" {
+		config.PackagePath = opts.Package
+	}
+	if opts.CacheDir != "" {
+		config.CacheDir = opts.CacheDir
+	}
+	config.Theme = opts.Theme
+	config.Colors = opts.Colors
+	for _, code := range opts.WarningsAsErrors {
+		normalized := strings.ToUpper(strings.TrimSpace(code))
+		if len(normalized) != len("PEAK000") || !strings.HasPrefix(normalized, "PEAK") || strings.Trim(normalized[4:], "0123456789") != "" {
+			return fmt.Errorf("invalid code %q in warningsAsErrors (expected a code such as PEAK106)", code)
+		}
+		if config.WarningsAsErrors == nil {
+			config.WarningsAsErrors = make(map[string]bool)
+		}
+		config.WarningsAsErrors[normalized] = true
+	}
+	for _, symbol := range opts.Symbols {
+		if !IsSymbol(symbol) {
+			return fmt.Errorf("invalid symbol %q in symbols (expected a name such as TEST)", symbol)
+		}
+		config.Symbols = append(config.Symbols, symbol)
+	}
+	for name, value := range opts.Defines {
+		if !IsSymbol(name) {
+			return fmt.Errorf("invalid constant name %q in defines (expected a name such as MAX_SIZE)", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for %s in defines (values cannot contain line breaks)", name)
+		}
+	}
+	config.Defines = opts.Defines
+	for name, dir := range opts.OutputDirs {
+		if !IsSymbol(name) {
+			return fmt.Errorf("invalid template name %q in outputDirs (expected a class name such as Fixture)", name)
+		}
+		if strings.TrimSpace(dir) == "" {
+			return fmt.Errorf("invalid directory for %s in outputDirs (expected a path such as \"test\")", name)
+		}
+	}
+	config.OutputDirs = opts.OutputDirs
+	for _, entry := range opts.TestClasses {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("invalid entry %q in testClasses (expected a template such as Fixture or an instantiation such as Queue<Account>)", entry)
+		}
+	}
+	config.TestClasses = opts.TestClasses
+	if opts.TestDir != "" && strings.TrimSpace(opts.TestDir) == "" {
+		return fmt.Errorf("invalid testDir %q (expected a path such as \"test\")", opts.TestDir)
+	}
+	config.TestDir = opts.TestDir
+	if opts.Visibility != nil {
+		visibility := *opts.Visibility
+		visibility.Classes = strings.ToLower(visibility.Classes)
+		visibility.Methods = strings.ToLower(visibility.Methods)
+		if visibility.Classes != "" && visibility.Classes != "public" && visibility.Classes != "global" {
+			return fmt.Errorf("invalid visibility.classes %q (expected public or global)", opts.Visibility.Classes)
+		}
+		switch visibility.Methods {
+		case "", "public", "global", "protected", "private":
+		default:
+			return fmt.Errorf("invalid visibility.methods %q (expected public, global, protected or private)", opts.Visibility.Methods)
+		}
+		config.Visibility = &visibility
+	}
+	config.ManagedPackage = opts.ManagedPackage
+	for _, name := range opts.PackageApi {
+		if !IsSymbol(name) {
+			return fmt.Errorf("invalid template name %q in packageApi (expected a class name such as Queue)", name)
+		}
+	}
+	config.PackageApi = opts.PackageApi
+	for _, name := range opts.AllowOverwrite {
+		if !IsSymbol(name) {
+			return fmt.Errorf("invalid class name %q in allowOverwrite (expected a class name such as AccountQueue)", name)
+		}
+		if config.AllowOverwrite == nil {
+			config.AllowOverwrite = make(map[string]bool)
+		}
+		config.AllowOverwrite[strings.ToLower(name)] = true
+	}
+	switch opts.Target {
+	case "", TargetSfdx:
+		config.Target = opts.Target
+	default:
+		return fmt.Errorf("invalid target %q (expected %s)", opts.Target, TargetSfdx)
+	}
+	switch opts.HandWrittenClasses {
+	case "":
+	case HandWrittenError, HandWrittenSkip, HandWrittenOverwrite:
+		config.HandWritten = opts.HandWrittenClasses
+	default:
+		return fmt.Errorf("invalid handWrittenClasses %q (expected %s, %s or %s)", opts.HandWrittenClasses, HandWrittenError, HandWrittenSkip, HandWrittenOverwrite)
+	}
+	switch opts.LongClassNames {
+	case "":
+	case LongClassNamesError, LongClassNamesHash:
+		config.LongClassNames = opts.LongClassNames
+	default:
+		return fmt.Errorf("invalid longClassNames %q (expected %s or %s)", opts.LongClassNames, LongClassNamesError, LongClassNamesHash)
+	}
+	if opts.ClassNames != nil {
+		naming := *opts.ClassNames
+		if err := validateClassNaming(&naming); err != nil {
+			return err
+		}
+		config.ClassNaming = &naming
+	}
+	for _, entry := range opts.Exclude {
+		dir := strings.Trim(filepath.ToSlash(strings.TrimPrefix(entry, "!")), "/")
+		if dir == "" || dir == "." || filepath.IsAbs(entry) || strings.HasPrefix(dir, "../") || dir == ".." {
+			return fmt.Errorf("invalid exclude entry %q (expected a directory name or a path relative to the source directory)", entry)
+		}
+		if strings.HasPrefix(entry, "!") {
+			if strings.Contains(dir, "/") {
+				return fmt.Errorf("invalid exclude entry %q (only names in the default list can be scanned again with !)", entry)
+			}
+			delete(config.Exclude, dir)
+			continue
+		}
+		config.Exclude[dir] = true
+	}
+	for _, entry := range opts.BuiltInGenerics {
+		if err := addBuiltInGeneric(config.BuiltInGenerics, entry); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -205,6 +926,57 @@ func (c *Config) ResolveOutputPath(sourcePath string, outputExtension string) (s
 	return filepath.Join(outputDir, name+outputExtension), nil
 }
 
+// IsExcludedDir reports whether the directory at path is skipped when scanning for
+// sources and watching: a hidden directory, OutDir, so generated files and anything
+// copied next to them are never read as sources, or one that DefaultExclude or
+// exclude lists by name or by its path relative to SourceDir. SourceDir itself never is.
+func (c *Config) IsExcludedDir(path string) bool {
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(c.SourceDir, path)
+	if err == nil && rel == "." {
+		return false
+	}
+	if c.OutDir != "" && filepath.Clean(path) == c.OutDir {
+		return true
+	}
+	if strings.HasPrefix(name, ".") || c.Exclude[name] {
+		return true
+	}
+	return err == nil && c.Exclude[filepath.ToSlash(rel)]
+}
+
+// OutputRoot returns the directory that outputs are written under: OutDir, or
+// SourceDir when outputs are co-located with their sources
+func (c *Config) OutputRoot() string {
+	if c.OutDir != "" {
+		return c.OutDir
+	}
+	return c.SourceDir
+}
+
+// IsSymbol reports whether name can be defined for peak:if sections or as a constant:
+// a letter or underscore followed by letters, digits and underscores
+func IsSymbol(name string) bool {
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// IsWarningAsError reports whether warnings with code are reported as errors: all of
+// them with --fail-on-warning, or those listed in warningsAsErrors
+func (c *Config) IsWarningAsError(code string) bool {
+	return c.FailOnWarning || c.WarningsAsErrors[code]
+}
+
+// MayOverwrite reports whether the .cls file of class may be overwritten although it
+// lacks a Peak header: with --force, or if allowOverwrite lists it
+func (c *Config) MayOverwrite(class string) bool {
+	return c.Force || c.AllowOverwrite[strings.ToLower(class)]
+}
+
 // GenerateMetaXML generates the content for a .cls-meta.xml file
 func (c *Config) GenerateMetaXML() string {
 	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
@@ -214,3 +986,123 @@ func (c *Config) GenerateMetaXML() string {
 </ApexClass>
 `, c.ApiVersion)
 }
+
+// Digest returns a stable fingerprint of the options that affect generated output.
+// Paths are made relative to the source directory so the digest does not change
+// between machines that check out the project in different locations.
+func (c *Config) Digest() string {
+	relative := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		if rel, err := filepath.Rel(c.SourceDir, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	// encoding/json sorts map keys, so the encoding is deterministic
+	data, _ := json.Marshal(struct {
+		RootDir     string            `json:"rootDir"`
+		OutDir      string            `json:"outDir"`
+		ApiVersion  string            `json:"apiVersion"`
+		Instantiate *Instantiate      `json:"instantiate"`
+		Symbols     []string          `json:"symbols,omitempty"`
+		Defines     map[string]string `json:"defines,omitempty"`
+		OutputDirs  map[string]string `json:"outputDirs,omitempty"`
+		TestClasses []string          `json:"testClasses,omitempty"`
+		TestDir     string            `json:"testDir,omitempty"`
+		Visibility  *Visibility       `json:"visibility,omitempty"`
+		Managed     bool              `json:"managedPackage,omitempty"`
+	}{
+		RootDir:     relative(c.RootDir),
+		OutDir:      relative(c.OutDir),
+		ApiVersion:  c.ApiVersion,
+		Instantiate: c.Instantiate,
+		Symbols:     c.Symbols,
+		Defines:     c.Defines,
+		OutputDirs:  c.OutputDirs,
+		TestClasses: c.TestClasses,
+		TestDir:     c.TestDir,
+		Visibility:  c.Visibility,
+		Managed:     c.ManagedPackage,
+	})
+
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// addBuiltInGeneric adds entry, a generic type with its type parameters such as
+// Database.Batchable<T>, to builtIns, or removes the default it names after a !.
+// Apex type names are case-insensitive, so an entry replaces any spelling of its name.
+func addBuiltInGeneric(builtIns map[string]int, entry string) error {
+	if name, ok := strings.CutPrefix(entry, "!"); ok {
+		for builtIn := range parser.DefaultBuiltInGenerics {
+			if strings.EqualFold(builtIn, name) {
+				deleteFold(builtIns, name)
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid builtInGenerics entry %q (only names in the default list can be expanded again with !)", entry)
+	}
+
+	name, params, ok := strings.Cut(strings.TrimSuffix(strings.TrimSpace(entry), ">"), "<")
+	invalid := !ok || !strings.HasSuffix(strings.TrimSpace(entry), ">")
+	for _, part := range strings.Split(name, ".") {
+		invalid = invalid || !isIdentifier(part)
+	}
+	typeParams := strings.Split(params, ",")
+	for _, param := range typeParams {
+		invalid = invalid || !isIdentifier(strings.TrimSpace(param))
+	}
+	if invalid {
+		return fmt.Errorf("invalid builtInGenerics entry %q (expected a type name with its type parameters, e.g. Pair<K, V>)", entry)
+	}
+
+	deleteFold(builtIns, name)
+	builtIns[name] = len(typeParams)
+	return nil
+}
+
+// deleteFold deletes name from builtIns in any casing
+func deleteFold(builtIns map[string]int, name string) {
+	for builtIn := range builtIns {
+		if strings.EqualFold(builtIn, name) {
+			delete(builtIns, builtIn)
+		}
+	}
+}
+
+// isIdentifier reports whether s is an Apex identifier: a letter followed by letters,
+// digits and underscores
+func isIdentifier(s string) bool {
+	return s != "" && strings.ContainsAny(s[:1], classNameChars[:52]) && strings.Trim(s, classNameChars) == ""
+}
+
+// validateClassNaming checks that naming only produces valid Apex class names, which
+// consist of letters, digits and single underscores, start with a letter and do not
+// end with an underscore, and fills in its defaults
+func validateClassNaming(naming *ClassNaming) error {
+	if naming.Nested == "" {
+		naming.Nested = NestedJoin
+	}
+	if naming.Nested != NestedJoin && naming.Nested != NestedCamel {
+		return fmt.Errorf("invalid classNames.nested %q (expected %s or %s)", naming.Nested, NestedJoin, NestedCamel)
+	}
+	for _, part := range []struct{ name, value string }{
+		{"prefix", naming.Prefix},
+		{"suffix", naming.Suffix},
+		{"separator", naming.Separator},
+	} {
+		if strings.Trim(part.value, classNameChars) != "" || strings.Contains(part.value, "__") {
+			return fmt.Errorf("invalid classNames.%s %q (expected letters, digits and single underscores)", part.name, part.value)
+		}
+	}
+	if naming.Prefix != "" && !strings.ContainsAny(naming.Prefix[:1], classNameChars[:52]) {
+		return fmt.Errorf("invalid classNames.prefix %q (class names must start with a letter)", naming.Prefix)
+	}
+	if strings.HasSuffix(naming.Suffix, "_") {
+		return fmt.Errorf("invalid classNames.suffix %q (class names cannot end with an underscore)", naming.Suffix)
+	}
+	return nil
+}
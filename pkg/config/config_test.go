@@ -0,0 +1,773 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// writeFile creates a file (and its parent directories) for a test
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig_DefaultApiVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := LoadConfig(dir, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ApiVersion != DefaultApiVersion {
+		t.Errorf("expected default API version %s, got %s", DefaultApiVersion, cfg.ApiVersion)
+	}
+}
+
+func TestLoadConfig_ApiVersionFromSfdxProject(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sfdx-project.json"), `{"sourceApiVersion": "62.0"}`)
+	src := filepath.Join(root, "force-app", "peak")
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(src, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ApiVersion != "62.0" {
+		t.Errorf("expected API version from sfdx-project.json, got %s", cfg.ApiVersion)
+	}
+	if cfg.SfdxProject != filepath.Join(root, "sfdx-project.json") {
+		t.Errorf("unexpected SfdxProject: %s", cfg.SfdxProject)
+	}
+}
+
+func TestLoadConfig_ApiVersionPriority(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sfdx-project.json"), `{"sourceApiVersion": "62.0"}`)
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"apiVersion": "63.0"}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ApiVersion != "63.0" {
+		t.Errorf("config file should override sfdx-project.json, got %s", cfg.ApiVersion)
+	}
+
+	cfg, err = LoadConfig(root, CLIFlags{ApiVersion: "64.0"})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ApiVersion != "64.0" {
+		t.Errorf("CLI flag should override everything, got %s", cfg.ApiVersion)
+	}
+}
+
+func TestLoadConfig_SfdxProjectWithoutApiVersion(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sfdx-project.json"), `{"packageDirectories": [{"path": "force-app", "default": true}]}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ApiVersion != DefaultApiVersion {
+		t.Errorf("expected default API version, got %s", cfg.ApiVersion)
+	}
+}
+
+func TestLoadConfig_SfdxTarget(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sfdx-project.json"), `{"packageDirectories": [{"path": "unpackaged"}, {"path": "force-app", "default": true}]}`)
+	src := filepath.Join(root, "peak")
+	writeFile(t, filepath.Join(src, "peakconfig.json"), `{"compilerOptions": {"target": "sfdx"}}`)
+
+	cfg, err := LoadConfig(src, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := filepath.Join(root, "force-app", "main", "default", "classes"); cfg.OutDir != want {
+		t.Errorf("expected OutDir %s, got %s", want, cfg.OutDir)
+	}
+
+	// An explicit output directory wins
+	if cfg, err = LoadConfig(src, CLIFlags{OutDir: "out"}); err != nil || cfg.OutDir != filepath.Join(src, "out") {
+		t.Errorf("expected the --out-dir, got %v (%v)", cfg, err)
+	}
+
+	writeFile(t, filepath.Join(src, "peakconfig.json"), `{"compilerOptions": {"target": "mdapi"}}`)
+	if _, err := LoadConfig(src, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "target") {
+		t.Errorf("expected an error for an unknown target, got %v", err)
+	}
+
+	other := t.TempDir()
+	if _, err := LoadConfig(other, CLIFlags{Sfdx: true}); err == nil || !strings.Contains(err.Error(), "sfdx-project.json") {
+		t.Errorf("expected an error without sfdx-project.json, got %v", err)
+	}
+}
+
+func TestLoadConfig_InvalidSfdxProject(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sfdx-project.json"), `{not json`)
+
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil {
+		t.Error("expected error for invalid sfdx-project.json")
+	}
+}
+
+func TestLoadConfig_PackagePath(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"package": "dist/classes.zip"}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := filepath.Join(root, "dist", "classes.zip"); cfg.PackagePath != want {
+		t.Errorf("expected package path %s, got %s", want, cfg.PackagePath)
+	}
+
+	cfg, err = LoadConfig(root, CLIFlags{Package: "release.zip"})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := filepath.Join(root, "release.zip"); cfg.PackagePath != want {
+		t.Errorf("CLI flag should override config, got %s", cfg.PackagePath)
+	}
+}
+
+func TestLoadConfig_CacheDir(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"cacheDir": ".peak-cache"}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := filepath.Join(root, ".peak-cache"); cfg.CacheDir != want {
+		t.Errorf("expected cache dir %s, got %s", want, cfg.CacheDir)
+	}
+
+	cfg, err = LoadConfig(root, CLIFlags{CacheDir: "/tmp/peak-cache"})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := filepath.Clean("/tmp/peak-cache"); cfg.CacheDir != want {
+		t.Errorf("CLI flag should override config, got %s", cfg.CacheDir)
+	}
+}
+
+func TestLoadConfig_Notify(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("PEAK_TEST_WEBHOOK", "https://hooks.example.com/abc")
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"notify": {"webhook": "$PEAK_TEST_WEBHOOK"}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Notify == nil {
+		t.Fatal("expected notify config")
+	}
+	if cfg.Notify.Webhook != "https://hooks.example.com/abc" {
+		t.Errorf("expected expanded webhook, got %s", cfg.Notify.Webhook)
+	}
+	if cfg.Notify.On != NotifyAlways {
+		t.Errorf("expected default trigger %s, got %s", NotifyAlways, cfg.Notify.On)
+	}
+}
+
+func TestLoadConfig_NotifyUnsetWebhook(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"notify": {"webhook": "$PEAK_TEST_UNSET_WEBHOOK"}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Notify != nil {
+		t.Errorf("expected notifications disabled, got %+v", cfg.Notify)
+	}
+}
+
+func TestLoadConfig_ClassLimit(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"classLimit": {"max": 500, "severity": "error"}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ClassLimit == nil || cfg.ClassLimit.Max != 500 || cfg.ClassLimit.Severity != LimitError {
+		t.Errorf("unexpected class limit %+v", cfg.ClassLimit)
+	}
+
+	// The flag overrides the maximum but keeps the configured severity
+	cfg, err = LoadConfig(root, CLIFlags{MaxClasses: 50})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ClassLimit == nil || cfg.ClassLimit.Max != 50 || cfg.ClassLimit.Severity != LimitError {
+		t.Errorf("unexpected class limit %+v", cfg.ClassLimit)
+	}
+
+	// Without a config file, the flag warns
+	cfg, err = LoadConfig(t.TempDir(), CLIFlags{MaxClasses: 50})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ClassLimit == nil || cfg.ClassLimit.Severity != LimitWarning {
+		t.Errorf("unexpected class limit %+v", cfg.ClassLimit)
+	}
+}
+
+func TestLoadConfig_ClassLimitInvalid(t *testing.T) {
+	for _, limit := range []string{`{"max": 10, "severity": "fatal"}`, `{"max": 0}`} {
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"classLimit": `+limit+`}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "classLimit") {
+			t.Errorf("expected a classLimit error for %s, got %v", limit, err)
+		}
+	}
+}
+
+func TestLoadConfig_NotifyInvalidTrigger(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"notify": {"webhook": "https://x", "on": "sometimes"}}}`)
+
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil {
+		t.Error("expected error for invalid notify.on")
+	}
+}
+
+func TestResolveOutputPath_PreservesStructure(t *testing.T) {
+	root := t.TempDir()
+	cfg, err := LoadConfig(root, CLIFlags{OutDir: "build"})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	got, err := cfg.ResolveOutputPath(filepath.Join(root, "utils", "Queue.peak"), ".cls")
+	if err != nil {
+		t.Fatalf("ResolveOutputPath failed: %v", err)
+	}
+	if want := filepath.Join(root, "build", "utils", "Queue.cls"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestLoadConfig_MaxFileSize(t *testing.T) {
+	root := t.TempDir()
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.MaxFileSize != DefaultMaxFileSize {
+		t.Errorf("expected default max file size, got %d", cfg.MaxFileSize)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"maxFileSize": 1024}}`)
+	cfg, err = LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.MaxFileSize != 1024 {
+		t.Errorf("expected configured max file size, got %d", cfg.MaxFileSize)
+	}
+}
+
+func TestLoadConfig_MaxErrors(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"maxErrors": 20}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.MaxErrors != 20 {
+		t.Errorf("expected configured max errors, got %d", cfg.MaxErrors)
+	}
+
+	// The flag overrides the config file
+	cfg, err = LoadConfig(root, CLIFlags{MaxErrors: 5})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.MaxErrors != 5 {
+		t.Errorf("expected max errors from the flag, got %d", cfg.MaxErrors)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"maxErrors": -1}}`)
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "maxErrors") {
+		t.Errorf("expected an error for a negative maxErrors, got %v", err)
+	}
+}
+
+func TestLoadConfig_WarningsAsErrors(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"warningsAsErrors": ["PEAK106", " peak202 "]}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	for code, expected := range map[string]bool{"PEAK106": true, "PEAK202": true, "PEAK107": false} {
+		if got := cfg.IsWarningAsError(code); got != expected {
+			t.Errorf("IsWarningAsError(%s) = %v, expected %v", code, got, expected)
+		}
+	}
+
+	for _, invalid := range []string{`"unused"`, `"PEAK1"`, `"PEAKabc"`} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"warningsAsErrors": [`+invalid+`]}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "warningsAsErrors") {
+			t.Errorf("expected an error for %s, got %v", invalid, err)
+		}
+	}
+
+	os.Remove(filepath.Join(root, "peakconfig.json"))
+	cfg, err = LoadConfig(root, CLIFlags{FailOnWarning: true})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.IsWarningAsError("PEAK107") {
+		t.Error("expected --fail-on-warning to report every warning as an error")
+	}
+}
+
+func TestLoadConfig_Symbols(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"symbols": ["TEST", "debug_2"]}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{Define: []string{"CI"}})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := []string{"TEST", "debug_2", "CI"}; !reflect.DeepEqual(cfg.Symbols, want) {
+		t.Errorf("expected symbols %v, got %v", want, cfg.Symbols)
+	}
+
+	for _, invalid := range []string{`""`, `"2FA"`, `"A.B"`, `"!TEST"`} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"symbols": [`+invalid+`]}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "symbols") {
+			t.Errorf("expected an error for %s, got %v", invalid, err)
+		}
+	}
+}
+
+func TestLoadConfig_Defines(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"defines": {"MAX_SIZE": "200"}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Defines["MAX_SIZE"] != "200" {
+		t.Errorf("expected MAX_SIZE 200, got %v", cfg.Defines)
+	}
+
+	for _, invalid := range []string{`{"2X": "1"}`, `{"A.B": "1"}`, `{"MAX": "1\n2"}`} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"defines": `+invalid+`}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "defines") {
+			t.Errorf("expected an error for %s, got %v", invalid, err)
+		}
+	}
+}
+
+func TestOutputRoot(t *testing.T) {
+	if root := (&Config{SourceDir: "/src"}).OutputRoot(); root != "/src" {
+		t.Errorf("expected co-located outputs under the source directory, got %s", root)
+	}
+	if root := (&Config{SourceDir: "/src", OutDir: "/out"}).OutputRoot(); root != "/out" {
+		t.Errorf("expected outputs under outDir, got %s", root)
+	}
+}
+
+func TestLoadConfig_OutputDirs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"outputDirs": {"Fixture": "classes/test"}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.OutputDirs["Fixture"] != "classes/test" {
+		t.Errorf("expected Fixture in classes/test, got %v", cfg.OutputDirs)
+	}
+
+	for _, invalid := range []string{`{"Fixture<T>": "test"}`, `{"Fixture": ""}`, `{"Fixture": "  "}`} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"outputDirs": `+invalid+`}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "outputDirs") {
+			t.Errorf("expected an error for %s, got %v", invalid, err)
+		}
+	}
+}
+
+func TestLoadConfig_TestClasses(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"testClasses": ["Fixture", "Queue<Account>"], "testDir": "test/classes"}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.TestClasses) != 2 || cfg.TestClasses[1] != "Queue<Account>" {
+		t.Errorf("expected Fixture and Queue<Account>, got %v", cfg.TestClasses)
+	}
+	if cfg.TestDir != "test/classes" {
+		t.Errorf("expected testDir test/classes, got %q", cfg.TestDir)
+	}
+
+	for _, invalid := range []string{`"testClasses": [""]`, `"testDir": " "`} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {`+invalid+`}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "test") {
+			t.Errorf("expected an error for %s, got %v", invalid, err)
+		}
+	}
+}
+
+func TestLoadConfig_Visibility(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"visibility": {"classes": "Global", "methods": "private", "testVisible": true}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	expected := Visibility{Classes: "global", Methods: "private", TestVisible: true}
+	if cfg.Visibility == nil || *cfg.Visibility != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg.Visibility)
+	}
+
+	for _, invalid := range []string{`{"classes": "private"}`, `{"methods": "internal"}`} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"visibility": `+invalid+`}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "visibility") {
+			t.Errorf("expected an error for %s, got %v", invalid, err)
+		}
+	}
+}
+
+func TestLoadConfig_PackageApi(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"managedPackage": true, "packageApi": ["Queue"]}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.ManagedPackage || len(cfg.PackageApi) != 1 || cfg.PackageApi[0] != "Queue" {
+		t.Errorf("expected a managed package with Queue as API, got %v and %v", cfg.ManagedPackage, cfg.PackageApi)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"packageApi": ["Queue<T>"]}}`)
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "packageApi") {
+		t.Errorf("expected an error for a type expression, got %v", err)
+	}
+}
+
+func TestLoadConfig_AllowOverwrite(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"allowOverwrite": ["AccountQueue"]}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.MayOverwrite("accountqueue") || cfg.MayOverwrite("ContactQueue") {
+		t.Errorf("expected only AccountQueue to be overwritable, got %v", cfg.AllowOverwrite)
+	}
+	if cfg, err = LoadConfig(root, CLIFlags{Force: true}); err != nil || !cfg.MayOverwrite("ContactQueue") {
+		t.Errorf("expected --force to allow overwriting any class, got %v", err)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"allowOverwrite": ["classes/AccountQueue.cls"]}}`)
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "allowOverwrite") {
+		t.Errorf("expected an error for a path, got %v", err)
+	}
+}
+
+func TestLoadConfig_Exclude(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"exclude": ["vendor", "force-app/main/legacy/", "!build"]}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	tests := []struct {
+		path     string
+		excluded bool
+	}{
+		{root, false},
+		{filepath.Join(root, ".sfdx"), true},
+		{filepath.Join(root, "force-app", ".sf"), true},
+		{filepath.Join(root, "node_modules"), true},
+		{filepath.Join(root, "lib", "vendor"), true},
+		{filepath.Join(root, "force-app", "main", "legacy"), true},
+		{filepath.Join(root, "legacy"), false},
+		{filepath.Join(root, "build"), false},
+		{filepath.Join(root, "force-app"), false},
+	}
+	for _, tt := range tests {
+		if got := cfg.IsExcludedDir(tt.path); got != tt.excluded {
+			t.Errorf("IsExcludedDir(%q) = %v, want %v", tt.path, got, tt.excluded)
+		}
+	}
+
+	for _, entry := range []string{"../outside", "!force-app/build", ""} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"exclude": ["`+entry+`"]}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "exclude") {
+			t.Errorf("expected an error for %q, got %v", entry, err)
+		}
+	}
+}
+
+func TestIsExcludedDir_OutDir(t *testing.T) {
+	root := t.TempDir()
+	cfg, err := LoadConfig(root, CLIFlags{OutDir: "generated"})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.IsExcludedDir(filepath.Join(root, "generated")) {
+		t.Error("expected the output directory to be excluded")
+	}
+	if cfg.IsExcludedDir(filepath.Join(root, "src", "generated")) {
+		t.Error("expected a directory with the output directory's name elsewhere to be scanned")
+	}
+
+	// An output directory above the sources must not exclude them
+	cfg, err = LoadConfig(filepath.Join(root, "src"), CLIFlags{OutDir: ".."})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.IsExcludedDir(cfg.SourceDir) {
+		t.Error("expected the source directory to be scanned")
+	}
+}
+
+func TestLoadConfig_HandWrittenClasses(t *testing.T) {
+	root := t.TempDir()
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.HandWritten != HandWrittenError {
+		t.Errorf("expected %q by default, got %q", HandWrittenError, cfg.HandWritten)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"handWrittenClasses": "skip"}}`)
+	if cfg, err = LoadConfig(root, CLIFlags{}); err != nil || cfg.HandWritten != HandWrittenSkip {
+		t.Errorf("expected %q, got %v (%v)", HandWrittenSkip, cfg, err)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"handWrittenClasses": "ignore"}}`)
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "handWrittenClasses") {
+		t.Errorf("expected an error for an unknown policy, got %v", err)
+	}
+}
+
+func TestLoadConfig_LongClassNames(t *testing.T) {
+	root := t.TempDir()
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.LongClassNames != LongClassNamesError {
+		t.Errorf("expected %q by default, got %q", LongClassNamesError, cfg.LongClassNames)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"longClassNames": "hash"}}`)
+	if cfg, err = LoadConfig(root, CLIFlags{}); err != nil || cfg.LongClassNames != LongClassNamesHash {
+		t.Errorf("expected %q, got %v (%v)", LongClassNamesHash, cfg, err)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"longClassNames": "truncate"}}`)
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "longClassNames") {
+		t.Errorf("expected an error for an unknown policy, got %v", err)
+	}
+}
+
+func TestLoadConfig_ClassNames(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"classNames": {"prefix": "acme_", "separator": "_"}}}`)
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	expected := ClassNaming{Prefix: "acme_", Separator: "_", Nested: NestedJoin}
+	if cfg.ClassNaming == nil || *cfg.ClassNaming != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg.ClassNaming)
+	}
+
+	invalid := map[string]string{
+		`{"prefix": "1acme"}`:  "classNames.prefix",
+		`{"prefix": "acme-"}`:  "classNames.prefix",
+		`{"separator": "__"}`:  "classNames.separator",
+		`{"suffix": "Gen_"}`:   "classNames.suffix",
+		`{"nested": "pascal"}`: "classNames.nested",
+	}
+	for naming, field := range invalid {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"classNames": `+naming+`}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("expected an error about %s for %s, got %v", field, naming, err)
+		}
+	}
+}
+
+func TestLoadConfig_BuiltInGenerics(t *testing.T) {
+	root := t.TempDir()
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.BuiltInGenerics, parser.DefaultBuiltInGenerics) {
+		t.Errorf("expected the defaults, got %v", cfg.BuiltInGenerics)
+	}
+
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"builtInGenerics": ["Schedule<T>", "pair<K, V>", "Pair<K, V>", "!comparator", "!DATABASE.batchable"]}}`)
+	if cfg, err = LoadConfig(root, CLIFlags{}); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	expected := map[string]int{"List": 1, "Set": 1, "Map": 2, "Iterable": 1, "Iterator": 1, "Schedule": 1, "Pair": 2}
+	if !reflect.DeepEqual(cfg.BuiltInGenerics, expected) {
+		t.Errorf("expected %v, got %v", expected, cfg.BuiltInGenerics)
+	}
+
+	for _, entry := range []string{"Iterable", "Iterable<>", "1Pair<K>", "Pair<K, V", "!Pair", "Outer..Inner<T>"} {
+		writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"builtInGenerics": ["`+entry+`"]}}`)
+		if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "builtInGenerics") {
+			t.Errorf("expected an error for %q, got %v", entry, err)
+		}
+	}
+}
+
+func TestLoadConfig_Theme(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"theme": "high-contrast", "colors": {"error": "1;35"}}}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Theme != "high-contrast" {
+		t.Errorf("expected configured theme, got %q", cfg.Theme)
+	}
+	if cfg.Colors["error"] != "1;35" {
+		t.Errorf("expected configured error color, got %v", cfg.Colors)
+	}
+}
+
+func TestLoadConfig_InstantiatePositions(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{
+  "compilerOptions": {
+    "instantiate": {
+      "classes": {
+        "Queue": ["Integer", "String"]
+      },
+      "methods": {
+        "Repository.get": [
+          "Account"
+        ]
+      }
+    }
+  }
+}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		section, key string
+		index        int
+		line, column int
+	}{
+		{"classes", "Queue", -1, 5, 9},
+		{"classes", "Queue", 0, 5, 19},
+		{"classes", "Queue", 1, 5, 30},
+		{"methods", "Repository.get", -1, 8, 9},
+		{"methods", "Repository.get", 0, 9, 11},
+		{"methods", "Missing", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		line, column := cfg.Instantiate.Position(tt.section, tt.key, tt.index)
+		if line != tt.line || column != tt.column {
+			t.Errorf("Position(%s, %s, %d) = %d:%d, expected %d:%d", tt.section, tt.key, tt.index, line, column, tt.line, tt.column)
+		}
+	}
+
+	// Configurations built in code have no positions
+	var spec Instantiate
+	if line, column := spec.Position("classes", "Queue", 0); line != 0 || column != 0 {
+		t.Errorf("expected no position, got %d:%d", line, column)
+	}
+}
+
+func TestLoadConfig_InstantiateShorthand(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{
+  "compilerOptions": {
+    "instantiate": [
+      "Queue<Integer>",
+      "Dict<String, Queue<Integer>>",
+      "Queue<String>"
+    ]
+  }
+}`)
+
+	cfg, err := LoadConfig(root, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	expected := map[string][]string{
+		"Queue": {"Integer", "String"},
+		"Dict":  {"String, Queue<Integer>"},
+	}
+	if !reflect.DeepEqual(cfg.Instantiate.Classes, expected) {
+		t.Errorf("expected classes %v, got %v", expected, cfg.Instantiate.Classes)
+	}
+
+	// Positions refer to the list elements
+	if line, column := cfg.Instantiate.Position("classes", "Queue", 1); line != 6 || column != 7 {
+		t.Errorf("expected Queue<String> at 6:7, got %d:%d", line, column)
+	}
+	if line, column := cfg.Instantiate.Position("classes", "Dict", -1); line != 5 || column != 7 {
+		t.Errorf("expected Dict at 5:7, got %d:%d", line, column)
+	}
+
+	// Both forms describe the same output
+	structured := t.TempDir()
+	writeFile(t, filepath.Join(structured, "peakconfig.json"), `{"compilerOptions": {"instantiate": {"classes": {"Queue": ["Integer", "String"], "Dict": ["String, Queue<Integer>"]}}}}`)
+	other, err := LoadConfig(structured, CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Digest() != other.Digest() {
+		t.Error("expected the shorthand and structured forms to have the same digest")
+	}
+}
+
+func TestLoadConfig_InstantiateInvalid(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peakconfig.json"), `{"compilerOptions": {"instantiate": [1, 2]}}`)
+
+	if _, err := LoadConfig(root, CLIFlags{}); err == nil || !strings.Contains(err.Error(), "list of instantiations") {
+		t.Errorf("expected an error describing the accepted forms, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// position is a 1-based line and column in the config file
+type position struct {
+	line, column int
+}
+
+// instantiatePath is the path to the instantiate options, see positionKey
+const instantiatePath = "compilerOptions\x00instantiate"
+
+// Position returns the line and column in peakconfig.json of an instantiate entry:
+// the type arguments at index for key in section ("classes" or "methods"), or the
+// key itself when index is -1. It returns 0, 0 when the position is unknown, for
+// example when the configuration was not loaded from a file.
+func (i *Instantiate) Position(section, key string, index int) (line, column int) {
+	path := []string{instantiatePath, section, key}
+	if index >= 0 {
+		path = append(path, strconv.Itoa(index))
+	}
+	lookup := positionKey(path...)
+	if alias, ok := i.aliases[lookup]; ok {
+		lookup = alias
+	}
+	pos := i.positions[lookup]
+	return pos.line, pos.column
+}
+
+// positionKey joins JSON path elements with a separator that cannot occur in
+// config keys such as "Repository.get"
+func positionKey(path ...string) string {
+	return strings.Join(path, "\x00")
+}
+
+// locateValues returns the position of every object key and array element in a
+// JSON document, keyed by path from the top level (see positionKey). Errors end the
+// walk early, so the result is partial for invalid documents; callers report those
+// errors when decoding the document itself.
+func locateValues(data []byte) map[string]position {
+	positions := make(map[string]position)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	child := func(path, name string) string {
+		if path == "" {
+			return name
+		}
+		return positionKey(path, name)
+	}
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				start := tokenStart(data, dec.InputOffset())
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				member := child(path, key.(string))
+				positions[member] = offsetPosition(data, start)
+				if err := walk(member); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				element := child(path, strconv.Itoa(i))
+				positions[element] = offsetPosition(data, tokenStart(data, dec.InputOffset()))
+				if err := walk(element); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+		return nil
+	}
+
+	_ = walk("")
+	return positions
+}
+
+// tokenStart skips the whitespace and separators that the decoder has not yet
+// consumed at offset, returning the offset of the next token
+func tokenStart(data []byte, offset int64) int {
+	i := int(offset)
+	for i < len(data) && strings.IndexByte(" \t\r\n,:", data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// offsetPosition converts a byte offset into a line and column
+func offsetPosition(data []byte, offset int) position {
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(before, '\n')
+	return position{line: line, column: column}
+}
@@ -0,0 +1,380 @@
+package diagnostic
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// Diagnostic codes. Codes are stable: once released, a code keeps its meaning
+// and is never reused. PEAK0xx are parse errors (defined in the parser),
+// PEAK1xx transpiler errors, and PEAK2xx problems with files on disk.
+const (
+	CodeSyntax             = parser.CodeSyntax
+	CodeInvalidTypeParam   = parser.CodeInvalidTypeParam
+	CodeDuplicateTypeParam = parser.CodeDuplicateTypeParam
+	CodeShiftInTypeParams  = parser.CodeShiftInTypeParams
+
+	CodeUndefinedTemplate      = "PEAK101" // Config instantiates a template that does not exist
+	CodeUndefinedMethod        = "PEAK102" // Config instantiates a generic method that does not exist
+	CodeInvalidInstantiation   = "PEAK103" // Config instantiation is not a valid generic expression
+	CodeOutputCollision        = "PEAK104" // Two outputs map to the same file
+	CodeOutputPath             = "PEAK105" // Output path cannot be derived from the source path
+	CodeRedundantInstantiation = "PEAK106" // Warning: config instantiation is also used in source
+	CodeUnusedForcedTemplate   = "PEAK107" // Warning: config instantiates a template no other source uses
+	CodeInvalidComparable      = "PEAK108" // @PeakComparable names a missing field or one that cannot be ordered
+	CodeTooManyClasses         = "PEAK109" // Run would generate more concrete classes than classLimit.max
+	CodeHolderUnsupported      = "PEAK110" // Template cannot be generated as inner classes of a holder class
+	CodeMalformedOutput        = "PEAK111" // Generated file failed the structural check
+	CodeSelfCheck              = "PEAK112" // --self-check: re-parsing a generated file found a substitution problem
+	CodeTypeArgCount           = "PEAK113" // Source uses a template with the wrong number of type arguments
+	CodeConditional            = "PEAK114" // Malformed peak:if, peak:else or peak:endif section
+	CodeInclude                = "PEAK115" // peak:include names a snippet that cannot be read or includes itself
+	CodeConstant               = "PEAK116" // Malformed peak:define, or ${NAME} placeholder in code names no constant
+	CodeInvalidOutputDir       = "PEAK117" // @PeakOutputDir does not name a relative directory
+	CodeInvalidVisibility      = "PEAK118" // @PeakVisibility names no valid access modifier
+	CodePackageApi             = "PEAK119" // packageApi template lacks @PeakPackageApi, or it names no public member
+	CodeClassFile              = "PEAK120" // Source does not declare exactly one top-level class named after its file
+	CodeLargeClass             = "PEAK121" // Warning: generated class approaches the Apex class size limit
+	CodeRecursiveInstantiation = "PEAK122" // Template instantiates itself with ever growing type arguments
+	CodeAmbiguousMethodCall    = "PEAK123" // Generic method call matches the generic methods of several classes
+	CodeUnusedTemplate         = "PEAK124" // Warning: class template is never instantiated
+	CodeUnusedMethodTemplate   = "PEAK125" // Warning: generic method is never instantiated
+	CodeClassNameTooLong       = "PEAK126" // Concrete class name is longer than the 40 characters Apex allows
+
+	CodeSourceTooLarge  = "PEAK201" // Source above maxFileSize, skipped
+	CodeLargeSource     = "PEAK202" // Source above 1 MiB
+	CodeWriteFailed     = "PEAK203" // Output could not be written
+	CodeStaleOutput     = "PEAK204" // verify: output differs from what sources produce
+	CodeMissingOutput   = "PEAK205" // verify: output does not exist
+	CodeHandWritten     = "PEAK206" // Generated class would overwrite or duplicate a hand-written one
+	CodeOrphanedOutput  = "PEAK207" // audit, clean and --prune: generated file that no source produces any more
+	CodeReadFailed      = "PEAK208" // Source or source directory could not be read, skipped
+	CodeEditedOutput    = "PEAK209" // Generated file was edited by hand since Peak wrote it
+	CodeKeptHandWritten = "PEAK210" // Warning: source skipped to keep a hand-written class (handWrittenClasses: skip)
+	CodeDeployFailed    = "PEAK211" // --deploy: the org rejected a generated class
+)
+
+// Explanation is the long-form documentation of a diagnostic code, printed by `peak explain`
+type Explanation struct {
+	Code        string
+	Title       string
+	Description string
+	Example     string
+	Fix         string
+}
+
+var explanations = []Explanation{
+	{
+		Code:        CodeSyntax,
+		Title:       "malformed generic syntax",
+		Description: "A generic expression or type parameter list could not be parsed, for example because a '>' or ',' is missing or a type name is empty.",
+		Example:     "public class Queue<T U> { }\nprivate Dict<String,> items;",
+		Fix:         "Separate type parameters and type arguments with commas and close every '<' with '>'.",
+	},
+	{
+		Code:        CodeInvalidTypeParam,
+		Title:       "invalid type parameter name",
+		Description: "Type parameters must be a single letter. Longer names would be indistinguishable from real Apex types when Peak substitutes them.",
+		Example:     "public class Queue<Item> { }",
+		Fix:         "Rename the parameter to a single letter, e.g. Queue<T>.",
+	},
+	{
+		Code:        CodeDuplicateTypeParam,
+		Title:       "duplicate type parameter",
+		Description: "The same type parameter is declared more than once in a template's parameter list.",
+		Example:     "public class Pair<T, T> { }",
+		Fix:         "Give each type parameter a distinct letter, e.g. Pair<K, V>.",
+	},
+	{
+		Code:        CodeShiftInTypeParams,
+		Title:       "'<<' or '>>' in type parameters",
+		Description: "A template's type parameter list may not contain '<<' or '>>'; type parameters cannot themselves be generic.",
+		Example:     "public class Queue<<T>> { }",
+		Fix:         "Declare plain parameters, e.g. Queue<T>, and use generic types as type arguments instead.",
+	},
+	{
+		Code:        CodeUndefinedTemplate,
+		Title:       "instantiation of an undefined template",
+		Description: "A class listed under instantiate.classes in peakconfig.json has no matching template in the project.",
+		Example:     "\"instantiate\": { \"classes\": { \"Qeue\": [\"Integer\"] } }",
+		Fix:         "Correct the template name, which the error suggests when a template has a similar name, or remove the entry if the template was deleted.",
+	},
+	{
+		Code:        CodeUndefinedMethod,
+		Title:       "instantiation of an undefined generic method",
+		Description: "A method listed under instantiate.methods in peakconfig.json has no matching generic method. Keys have the form ClassName.methodName.",
+		Example:     "\"instantiate\": { \"methods\": { \"Repository.fetch\": [\"Account\"] } }",
+		Fix:         "Use the class and method name of an existing generic method, e.g. Repository.get; the error suggests one with a similar name.",
+	},
+	{
+		Code:        CodeInvalidInstantiation,
+		Title:       "invalid instantiation in config",
+		Description: "Type arguments listed in peakconfig.json are not valid for the template or generic method: they do not parse as type names, there are too many or too few of them, or a generic type argument is neither a template nor List, Set or Map. The error points at the entry in peakconfig.json.",
+		Example:     "\"instantiate\": { \"classes\": { \"Dict\": [\"String,\"], \"Queue\": [\"Stack<Integer>\"] } }",
+		Fix:         "List one complete type per type parameter, e.g. \"String, Integer\" for Dict<K, V>. Namespaced types such as Schema.Account and nested generics such as List<Queue<Integer>> are allowed.",
+	},
+	{
+		Code:        CodeOutputCollision,
+		Title:       "output collision",
+		Description: "Two outputs would be written to the same file. File names are compared case-insensitively, because Salesforce class names and Windows and macOS file systems are case-insensitive.",
+		Example:     "Queue<Integer> generates QueueInteger.cls, which collides with a source file QueueInteger.peak.",
+		Fix:         "Rename one of the sources or templates so the generated class names differ.",
+	},
+	{
+		Code:        CodeOutputPath,
+		Title:       "output path cannot be resolved",
+		Description: "The output path of a source could not be computed from rootDir and outDir, for example because the source is on a different drive than rootDir on Windows.",
+		Example:     "rootDir is D:\\project while the source is C:\\work\\Queue.peak",
+		Fix:         "Keep sources under rootDir, or remove rootDir from peakconfig.json.",
+	},
+	{
+		Code:        CodeRedundantInstantiation,
+		Title:       "redundant instantiation in config",
+		Description: "A class instantiation listed under instantiate.classes in peakconfig.json is also used in a .peak source, so it would be generated without the entry. This is a warning.",
+		Example:     "\"instantiate\": { \"classes\": { \"Queue\": [\"Integer\"] } } while QueueExample.peak declares Queue<Integer>",
+		Fix:         "Remove the type arguments from the entry, and the entry itself once it is empty.",
+	},
+	{
+		Code:        CodeUnusedForcedTemplate,
+		Title:       "instantiation of a template no source uses",
+		Description: "instantiate.classes lists a template that no other .peak file references. This is a warning: forced instantiations are how plain Apex code gets concrete classes, but entries often outlive the code that needed them.",
+		Example:     "\"instantiate\": { \"classes\": { \"Optional\": [\"Double\"] } } while no .peak file uses Optional",
+		Fix:         "Remove the entry if no Apex code references the generated classes any more.",
+	},
+	{
+		Code:        CodeInvalidComparable,
+		Title:       "invalid @PeakComparable field",
+		Description: "A template annotated with @PeakComparable names a field that is not declared in the template, names no fields at all, or names a field whose type in a concrete class cannot be ordered, such as a List, Map, Set, Blob, Object or SObject. Fields of other non-primitive types are compared with their own compareTo method, so those types must implement Comparable.",
+		Example:     "Ranked.peak: @PeakComparable field 'items' of Ranked<Integer> has type List<Integer>, which cannot be ordered",
+		Fix:         "Name fields declared in the template whose types are primitives or implement Comparable, or stop using the instantiation.",
+	},
+	{
+		Code:        CodeTooManyClasses,
+		Title:       "too many generated classes",
+		Description: "The run would generate more concrete classes than classLimit.max in peakconfig.json (or --max-classes) allows. The message counts the classes per template and names the most deeply nested instantiation, since runaway counts usually come from templates that instantiate themselves with ever deeper type arguments. With severity \"warning\" the classes are generated anyway; with \"error\" nothing is generated.",
+		Example:     "Queue.peak: run would generate 612 concrete classes, more than the limit of 500 (Queue 420, Dict 150, Pair 42); deepest nesting: Queue<Queue<Queue<Integer>>>",
+		Fix:         "Remove the usages or instantiate.classes entries that multiply instantiations, or raise classLimit.max if the classes are all needed.",
+	},
+	{
+		Code:        CodeHolderUnsupported,
+		Title:       "template cannot be generated into a holder class",
+		Description: "With holder classes enabled, the concrete classes of a template are generated as inner classes of one holder class. Apex does not allow inner classes to declare classes, interfaces or enums of their own, or static fields, methods and initializer blocks, so a template that declares any cannot be generated this way. Neither can a @PeakDto template, whose generated fromJson methods are static.",
+		Example:     "public class Tree<T> {\n    public class Node { public T value; }\n    public static Integer count = 0;\n}",
+		Fix:         "Move the inner types and static members out of the template into their own classes or templates, or turn holder classes off.",
+	},
+	{
+		Code:        CodeMalformedOutput,
+		Title:       "malformed generated output",
+		Description: "Every generated file is checked before it is written: outside comments and strings, its parentheses, braces and brackets must balance, the first class, interface or enum it declares must be named after the file, no generic usage of a template may remain, and in concrete classes no type parameter of the template may remain. A file that fails the check is not written, because Salesforce would reject it on deploy. The error points at the source line that produced the problem, when known.",
+		Example:     "Queue.peak:12: generated QueueInteger.cls is malformed: type parameter T was not substituted",
+		Fix:         "Look for unusual syntax at the reported line, such as a type parameter inside an annotation or a brace in a construct Peak does not parse, and rewrite it. If the source is valid Apex, report the problem as a Peak bug.",
+	},
+	{
+		Code:        CodeSelfCheck,
+		Title:       "generated output failed the self-check",
+		Description: "With selfCheck in peakconfig.json (or --self-check), every generated file that passes the structural check of PEAK111 is parsed again with the Peak parser. The file must parse, must not declare a template, must not pass a type parameter of its template as a type argument, and must not use a generic type, other than List, Set and Map, that the source or template it was generated from does not use. A failure means a substitution went wrong, and the file is not written.",
+		Example:     "Queue.peak:7: generated QueueInteger.cls failed the self-check: type parameter T remains in Iterable<T>",
+		Fix:         "Look for unusual syntax at the reported line and rewrite it. If the source is valid Apex, report the problem as a Peak bug, with the template and instantiation.",
+	},
+	{
+		Code:        CodeTypeArgCount,
+		Title:       "wrong number of type arguments",
+		Description: "A source uses a template with more or fewer type arguments than the template declares type parameters, so no concrete class can be generated for it. The error is reported at the usage, with a note pointing at the template's declaration.",
+		Example:     "public class Queue<T> { }\nprivate Queue<Integer, String> q; // Queue takes 1 type argument",
+		Fix:         "Pass one type argument per type parameter of the template, or add the missing type parameters to the template.",
+	},
+	{
+		Code:        CodeConditional,
+		Title:       "malformed conditional section",
+		Description: "A \"// peak:if SYMBOL\" section is not closed by \"// peak:endif\", a peak:else or peak:endif has no matching peak:if, a section has more than one peak:else, or peak:if does not name a single symbol. Peak cannot tell which lines to keep, so the file is not compiled.",
+		Example:     "// peak:if TEST\npublic void reset() { }\n// missing: peak:endif",
+		Fix:         "Close every peak:if with peak:endif, use at most one peak:else per section, and name one symbol, optionally negated, as in \"// peak:if !TEST\".",
+	},
+	{
+		Code:        CodeInclude,
+		Title:       "unresolved include",
+		Description: "A \"// peak:include path\" directive names a snippet that does not exist or cannot be read, or snippets include each other in a cycle, directly or through other snippets. Paths are resolved relative to the directory of the file containing the directive.",
+		Example:     "// peak:include ../shared/Assertions.peakpart   (no such file)",
+		Fix:         "Correct the path, relative to the including file, or break the cycle between snippets.",
+	},
+	{
+		Code:        CodeConstant,
+		Title:       "undefined constant",
+		Description: "A ${NAME} placeholder in code names a constant that is neither defined by a \"// peak:define NAME value\" line in the same file nor in the defines config option, or a peak:define line lacks a name or value or repeats a name. Placeholders in strings and comments are left as they are when undefined.",
+		Example:     "public class Buffer<T> {\n    private static final Integer MAX = ${MAX_SIZE}; // MAX_SIZE is not defined\n}",
+		Fix:         "Add \"// peak:define MAX_SIZE 200\" to the file, or \"defines\": {\"MAX_SIZE\": \"200\"} to peakconfig.json.",
+	},
+	{
+		Code:        CodeInvalidOutputDir,
+		Title:       "invalid output directory",
+		Description: "A template's @PeakOutputDir annotation must have a single quoted argument naming a directory relative to the output root: the outDir config option when set, otherwise the source directory.",
+		Example:     "@PeakOutputDir(test)\npublic class Fixture<T> {\n}",
+		Fix:         "Quote the directory, as in @PeakOutputDir('test'), or set the directory with the outputDirs config option instead.",
+	},
+	{
+		Code:        CodeInvalidVisibility,
+		Title:       "invalid visibility",
+		Description: "A @PeakVisibility annotation must name one access modifier for the generated code: public or global on a template, and public, global, protected or private on a generic method, which may also add TestVisible. Top-level classes cannot be private or protected in Apex.",
+		Example:     "@PeakVisibility(private)\npublic class Fixture<T> {\n}",
+		Fix:         "Use @PeakVisibility(public) or @PeakVisibility(global) on templates, and e.g. @PeakVisibility(private, TestVisible) on generic methods.",
+	},
+	{
+		Code:        CodePackageApi,
+		Title:       "package API mismatch",
+		Description: "A template listed in the packageApi config option must be marked with @PeakPackageApi, so that its concrete classes are made global in managed package builds, and every member that @PeakPackageApi names must be a public member declared in the template.",
+		Example:     "// peakconfig.json lists \"packageApi\": [\"Queue\"]\npublic class Queue<T> {\n    public void push(T item) {}\n}",
+		Fix:         "Add @PeakPackageApi, or @PeakPackageApi(push) to expose only some members, to the template, or remove it from packageApi.",
+	},
+	{
+		Code:        CodeClassFile,
+		Title:       "class does not match its file",
+		Description: "Salesforce requires every .cls file to declare exactly one top-level class, interface or enum, named after the file regardless of case, and rejects the deploy otherwise. Each source that is not a template is checked before it is transpiled, since its output keeps its file name.",
+		Example:     "// AccountService.peak\npublic class AccountHelper {\n}",
+		Fix:         "Rename the class or the file so that they match, and move any other top-level types into files of their own or inside the class.",
+	},
+	{
+		Code:        CodeLargeClass,
+		Title:       "generated class near the size limit",
+		Description: "Salesforce rejects Apex classes of more than 1,000,000 characters. A class generated from a template is reported from 800,000 characters, which a large template instantiated with long nested type names can reach, and so can a holder class holding many instantiations. The warning names the generated file and its size.",
+		Example:     "Report.peak: generated ReportMapStringListAccount.cls has 850000 characters, which approaches the Apex limit of 1000000 per class",
+		Fix:         "Split the template into smaller templates, write a specialized class for the largest instantiations, or turn off holder classes so each instantiation becomes a class of its own.",
+	},
+	{
+		Code:        CodeRecursiveInstantiation,
+		Title:       "recursive instantiation",
+		Description: "Instantiating a template also instantiates the templates it extends or uses with its type parameters, such as Queue<Integer> for Stack<Integer> when Stack<T> extends Queue<T>. A template that uses itself, directly or through other templates, with a type argument built from its own type parameter would need an endless chain of concrete classes, so the chain is cut off after 16 templates.",
+		Example:     "public class Node<T> {\n    private Node<List<T>> children;\n}",
+		Fix:         "Use the template with its own type parameters, as in Node<T>, or with a fixed type argument, as in Node<Object>.",
+	},
+	{
+		Code:        CodeAmbiguousMethodCall,
+		Title:       "ambiguous generic method call",
+		Description: "A call with type arguments, such as repo.get<Account>('key'), is rewritten to the concrete method, here getAccount, which is generated in the class that declares the generic method. Peak does not know the type of repo, so when several classes declare a generic method of that name, it cannot tell which one to instantiate.",
+		Example:     "Account a = repo.get<Account>('key'); // Repository.get and Cache.get are both generic",
+		Fix:         "Qualify a static call with its class, as in Repository.get<Account>('key'), or call the concrete method and request it with a directive: // peak:instantiate Repository.get<Account>",
+	},
+	{
+		Code:        CodeUnusedTemplate,
+		Title:       "template never instantiated",
+		Description: "No source, instantiate.classes entry or peak:instantiate directive instantiates the template, so no concrete class is generated from it. The template may be left over from a refactoring, or its users may have a typo in its name.",
+		Example:     "public class Pair<K, V> { } // No source uses Pair<...>",
+		Fix:         "Use the template with type arguments, list its instantiations in instantiate.classes if only hand-written Apex uses them, or delete the template.",
+	},
+	{
+		Code:        CodeUnusedMethodTemplate,
+		Title:       "generic method never instantiated",
+		Description: "No call with type arguments, instantiate.methods entry or peak:instantiate directive instantiates the generic method, so no concrete method is generated from it and the generic declaration is left out of the class.",
+		Example:     "public class Repository {\n    public <T> T get(String key) { ... } // Never called as get<Account>(...)\n}",
+		Fix:         "Call the method with type arguments, request its instantiations with a directive such as // peak:instantiate Repository.get<Account> or in instantiate.methods, or delete the method.",
+	},
+	{
+		Code:        CodeClassNameTooLong,
+		Title:       "class name too long",
+		Description: "Apex class names have at most 40 characters. The name of a concrete class joins the template name and its type arguments, so deeply nested instantiations exceed it, and Salesforce would reject the class. With holder classes, the limit applies to the inner class names.",
+		Example:     "private Dict<String, Queue<List<WrapperAccount>>> index; // DictStringQueueListWrapperAccount... is too long",
+		Fix:         "Use shorter template or type names, or set longClassNames to hash in peakconfig.json, which shortens long names to a prefix and a hash of the instantiation and records each one in .peak-manifest.json.",
+	},
+	{
+		Code:        CodeSourceTooLarge,
+		Title:       "source file too large",
+		Description: "A .peak file is larger than maxFileSize (16 MiB by default) and was skipped without being read.",
+		Example:     "Generated.peak: file is 40.0 MiB, above the maximum source size of 16.0 MiB",
+		Fix:         "Check whether the file should be a .peak file at all; if it should, raise maxFileSize in peakconfig.json.",
+	},
+	{
+		Code:        CodeLargeSource,
+		Title:       "unusually large source file",
+		Description: "A .peak file is larger than 1 MiB. This is a warning: the file is compiled, but hand-written sources are rarely this big, so it is often a generated file renamed by mistake.",
+		Example:     "Data.peak: file is 2.0 MiB; unusually large sources slow down compilation",
+		Fix:         "Rename the file back to .cls if it does not use generics.",
+	},
+	{
+		Code:        CodeWriteFailed,
+		Title:       "output could not be written",
+		Description: "Writing a generated file failed, for example because of permissions or a directory in the way. Other outputs are still written.",
+		Example:     "QueueInteger.cls: error writing QueueInteger.cls: permission denied",
+		Fix:         "Make the output directory writable and remove anything occupying the output path.",
+	},
+	{
+		Code:        CodeStaleOutput,
+		Title:       "generated output is out of date",
+		Description: "peak verify found a generated file whose content differs from what the current sources produce.",
+		Example:     "QueueInteger.cls: generated output is out of date (run peak to regenerate)",
+		Fix:         "Run peak to regenerate the outputs and commit them along with the sources.",
+	},
+	{
+		Code:        CodeMissingOutput,
+		Title:       "generated output is missing",
+		Description: "peak verify expected a generated file that does not exist (or, with --staged, is not staged).",
+		Example:     "QueueInteger.cls: generated output is missing (run peak to regenerate)",
+		Fix:         "Run peak to regenerate the outputs and add them to the commit.",
+	},
+	{
+		Code:        CodeHandWritten,
+		Title:       "generated class conflicts with a hand-written class",
+		Description: "A concrete class generated from a template has the same name as a .cls file that Peak did not generate: writing it would overwrite the file, or declare the class twice. The output of a .peak source is reported too if it would overwrite such a file. Peak recognizes its own outputs by the header comment it puts on the first line, and leaves the hand-written file alone.",
+		Example:     "Queue.peak: concrete class QueueInteger (Queue<Integer>) would overwrite hand-written class classes/QueueInteger.cls",
+		Fix:         "Rename or remove one of the classes. If the file is output from a Peak version that did not write header comments, delete it and run peak again. To overwrite it on purpose, list the class in allowOverwrite or pass --force.",
+	},
+	{
+		Code:        CodeOrphanedOutput,
+		Title:       "orphaned generated output",
+		Description: "peak audit found a .cls file that Peak generated (it has a provenance header, or a previous build listed it in .peak-tooling.json) but that no current source produces, typically a concrete class left behind after a template or instantiation was removed. Deploying it keeps dead code in the org.",
+		Example:     "QueueDate.cls: generated by Peak, but no current source produces it (delete it along with its -meta.xml)",
+		Fix:         "Delete the file and its -meta.xml, here and in the org, or restore the source that produced it. peak clean, or --prune on a build, deletes such files unless they lack the Peak header, are not recorded in .peak-manifest.json as written by the project, for example because another project shares the output directory, or were edited by hand, which it reports as warnings.",
+	},
+	{
+		Code:        CodeReadFailed,
+		Title:       "source could not be read",
+		Description: "Reading a .peak file, or listing a directory under the source directory, failed, for example because of permissions. The file or directory is skipped and the rest of the project is still compiled, but the build fails. Sources that use templates from a skipped file report them as undefined.",
+		Example:     "Queue.peak: file could not be read (permission denied); skipped",
+		Fix:         "Make the file or directory readable by the user running peak, or move it out of the source directory.",
+	},
+	{
+		Code:        CodeEditedOutput,
+		Title:       "generated file edited by hand",
+		Description: "A generated .cls file differs from what Peak last wrote there, according to the content hashes in .peak-manifest.json, so someone patched it by hand. Peak leaves the file alone instead of silently discarding the patch; every other output is still written.",
+		Example:     "Queue.peak: QueueInteger.cls was edited by hand since Peak generated it",
+		Fix:         "Move the change into the .peak source or template, then pass --force, or delete the file, to regenerate it.",
+	},
+	{
+		Code:        CodeKeptHandWritten,
+		Title:       "source skipped in favor of a hand-written class",
+		Description: "A .peak source and a hand-written .cls file of the same name both exist, as is common while classes are migrated to Peak, and handWrittenClasses is set to skip: the hand-written class is kept and the source produces no output. With the default, error, the same situation is reported as PEAK206.",
+		Example:     "AccountService.peak: kept hand-written class AccountService.cls; the source was not compiled to it (handWrittenClasses is skip)",
+		Fix:         "Finish the migration by deleting the hand-written class, or delete the .peak source if the hand-written class is the one to keep. To replace hand-written classes with their sources, set handWrittenClasses to overwrite.",
+	},
+	{
+		Code:        CodeDeployFailed,
+		Title:       "deploy failed",
+		Description: "With --deploy, the org rejected a class that sf project deploy start deployed, usually because it does not compile against the org's schema or code. The error is located at the .peak source or template line that produced the failing line, with a note pointing at the generated class.",
+		Example:     "Queue.peak:12: Invalid type: Acount (note: QueueInteger.cls:14: in Queue<Integer>, generated as QueueInteger)",
+		Fix:         "Fix the source or template line; for a template, check that the code is valid for every type argument it is instantiated with.",
+	},
+}
+
+// Explain returns the explanation for a code. Codes are matched case-insensitively,
+// and the PEAK prefix may be omitted.
+func Explain(code string) (Explanation, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !strings.HasPrefix(code, "PEAK") {
+		code = "PEAK" + code
+	}
+	for _, e := range explanations {
+		if e.Code == code {
+			return e, true
+		}
+	}
+	return Explanation{}, false
+}
+
+// Explanations returns every documented code, in code order
+func Explanations() []Explanation {
+	result := append([]Explanation(nil), explanations...)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
+	return result
+}
@@ -0,0 +1,188 @@
+// Package diagnostic provides a common representation for errors and warnings
+// reported by the Peak transpiler.
+//
+// Diagnostics are independent of how they are rendered: the CLI prints them
+// for humans, and machine-readable outputs (such as the CI report) serialize
+// them as JSON.
+package diagnostic
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// Severity classifies how serious a diagnostic is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single message about a source location
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code,omitempty"` // Stable identifier, e.g. PEAK101; see Explain
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Message  string   `json:"message"`
+
+	// StartColumn and EndColumn delimit the offending text on Line, end exclusive,
+	// e.g. a whole type parameter list; 0 if only Column is known
+	StartColumn int `json:"startColumn,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+
+	// Notes point at related locations, such as the template a usage refers to
+	Notes []Note `json:"notes,omitempty"`
+}
+
+// Note is a secondary location attached to a diagnostic, e.g. "template Queue<T> defined here"
+type Note struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// codedError attaches a diagnostic code to an error
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// WithCode returns err tagged with a diagnostic code, which FromError picks up
+func WithCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// positionedError locates an error in the file it is reported for
+type positionedError struct {
+	line, column int
+	err          error
+}
+
+func (e *positionedError) Error() string { return e.err.Error() }
+func (e *positionedError) Unwrap() error { return e.err }
+
+// At returns err located at line and column, which FromError picks up. Use it for
+// errors about files that are not parsed as Peak sources, such as peakconfig.json.
+// A line of 0 means the location is unknown, and err is returned unchanged.
+func At(line, column int, err error) error {
+	if line == 0 {
+		return err
+	}
+	return &positionedError{line: line, column: column, err: err}
+}
+
+// notedError attaches a related location to an error
+type notedError struct {
+	note Note
+	err  error
+}
+
+func (e *notedError) Error() string { return e.err.Error() }
+func (e *notedError) Unwrap() error { return e.err }
+
+// WithNote returns err with a note pointing at a related location in file, which
+// FromError picks up. A line of 0 means only the file is known.
+func WithNote(file string, line, column int, message string, err error) error {
+	return &notedError{note: Note{File: file, Line: line, Column: column, Message: message}, err: err}
+}
+
+// FromError converts an error reported for file into a diagnostic.
+// Errors located with At and parse errors keep their line and column information.
+// The code is taken from the outermost WithCode, falling back to the parse error's own code.
+// Notes added with WithNote are kept in order, outermost first.
+func FromError(file string, err error) Diagnostic {
+	d := fromError(file, err)
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if noted, ok := e.(*notedError); ok {
+			d.Notes = append(d.Notes, noted.note)
+		}
+	}
+	return d
+}
+
+// fromError converts err into a diagnostic without its notes
+func fromError(file string, err error) Diagnostic {
+	var code string
+	var coded *codedError
+	if errors.As(err, &coded) {
+		code = coded.code
+	}
+
+	var positioned *positionedError
+	if errors.As(err, &positioned) {
+		return Diagnostic{
+			Severity: SeverityError,
+			Code:     code,
+			File:     file,
+			Line:     positioned.line,
+			Column:   positioned.column,
+			Message:  err.Error(),
+		}
+	}
+
+	var parseErr *parser.ParseError
+	if errors.As(err, &parseErr) {
+		if parseErr.File != "" {
+			file = parseErr.File
+		}
+		if code == "" {
+			code = parseErr.Code
+		}
+		return Diagnostic{
+			Severity:    SeverityError,
+			Code:        code,
+			File:        file,
+			Line:        parseErr.Line,
+			Column:      parseErr.Column,
+			Message:     parseErr.Message,
+			StartColumn: parseErr.StartColumn,
+			EndColumn:   parseErr.EndColumn,
+		}
+	}
+
+	return Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		File:     file,
+		Message:  err.Error(),
+	}
+}
+
+// Less orders diagnostics by file, then by line and column. Diagnostics without
+// a location come first within their file.
+func Less(a, b Diagnostic) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// Sort orders diagnostics by Less, keeping the reported order of diagnostics at the same location
+func Sort(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		return Less(diags[i], diags[j])
+	})
+}
+
+// CountBySeverity returns the number of diagnostics with the given severity
+func CountBySeverity(diags []Diagnostic, severity Severity) int {
+	count := 0
+	for _, d := range diags {
+		if d.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
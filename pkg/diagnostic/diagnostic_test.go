@@ -0,0 +1,255 @@
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+func TestFromError_ParseError(t *testing.T) {
+	err := &parser.ParseError{
+		Message:     "duplicate type parameter 'T'",
+		Line:        3,
+		Column:      18,
+		StartColumn: 15,
+		EndColumn:   20,
+		File:        "Queue.peak",
+	}
+
+	d := FromError("other.peak", err)
+	if d.Severity != SeverityError {
+		t.Errorf("expected error severity, got %s", d.Severity)
+	}
+	if d.File != "Queue.peak" {
+		t.Errorf("expected file from parse error, got %s", d.File)
+	}
+	if d.Line != 3 || d.Column != 18 {
+		t.Errorf("expected 3:18, got %d:%d", d.Line, d.Column)
+	}
+	if d.StartColumn != 15 || d.EndColumn != 20 {
+		t.Errorf("expected the span 15-20, got %d-%d", d.StartColumn, d.EndColumn)
+	}
+	if d.Message != "duplicate type parameter 'T'" {
+		t.Errorf("unexpected message: %s", d.Message)
+	}
+}
+
+func TestFromError_WrappedParseError(t *testing.T) {
+	parseErr := &parser.ParseError{Message: "expected type name", Line: 1, Column: 7}
+	err := fmt.Errorf("invalid class instantiation: %w", parseErr)
+
+	d := FromError("peakconfig.json", err)
+	if d.File != "peakconfig.json" {
+		t.Errorf("expected fallback file, got %s", d.File)
+	}
+	if d.Line != 1 || d.Column != 7 {
+		t.Errorf("expected 1:7, got %d:%d", d.Line, d.Column)
+	}
+}
+
+func TestFromError_PlainError(t *testing.T) {
+	d := FromError("peakconfig.json", errors.New("class instantiation 'Foo' references undefined template"))
+	if d.File != "peakconfig.json" {
+		t.Errorf("expected peakconfig.json, got %s", d.File)
+	}
+	if d.Line != 0 || d.Column != 0 {
+		t.Errorf("expected no location, got %d:%d", d.Line, d.Column)
+	}
+	if d.Message != "class instantiation 'Foo' references undefined template" {
+		t.Errorf("unexpected message: %s", d.Message)
+	}
+}
+
+func TestCountBySeverity(t *testing.T) {
+	diags := []Diagnostic{
+		{Severity: SeverityError, Message: "a"},
+		{Severity: SeverityWarning, Message: "b"},
+		{Severity: SeverityError, Message: "c"},
+	}
+	if got := CountBySeverity(diags, SeverityError); got != 2 {
+		t.Errorf("expected 2 errors, got %d", got)
+	}
+	if got := CountBySeverity(diags, SeverityWarning); got != 1 {
+		t.Errorf("expected 1 warning, got %d", got)
+	}
+}
+
+func TestFromError_Codes(t *testing.T) {
+	parseErr := &parser.ParseError{Code: CodeDuplicateTypeParam, Message: "duplicate type parameter 'T'", Line: 1, Column: 20}
+	if d := FromError("Pair.peak", parseErr); d.Code != CodeDuplicateTypeParam {
+		t.Errorf("expected parse error code, got %q", d.Code)
+	}
+
+	// An explicit code takes precedence over the wrapped parse error's
+	wrapped := WithCode(CodeInvalidInstantiation, fmt.Errorf("invalid class instantiation: %w", parseErr))
+	if d := FromError("peakconfig.json", wrapped); d.Code != CodeInvalidInstantiation || d.Line != 1 {
+		t.Errorf("expected %s at line 1, got %q at line %d", CodeInvalidInstantiation, d.Code, d.Line)
+	}
+
+	plain := WithCode(CodeUndefinedTemplate, errors.New("class instantiation 'Foo' references undefined template"))
+	d := FromError("peakconfig.json", plain)
+	if d.Code != CodeUndefinedTemplate || d.Message != plain.Error() {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+}
+
+func TestFromError_At(t *testing.T) {
+	err := WithCode(CodeInvalidInstantiation, At(5, 19, errors.New("invalid class instantiation 'Queue<1>'")))
+	d := FromError("peakconfig.json", err)
+	if d.Code != CodeInvalidInstantiation || d.Line != 5 || d.Column != 19 || d.File != "peakconfig.json" {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+	if d.Message != "invalid class instantiation 'Queue<1>'" {
+		t.Errorf("unexpected message %q", d.Message)
+	}
+
+	// An unknown location leaves the error unlocated
+	plain := errors.New("no position")
+	if At(0, 0, plain) != plain {
+		t.Error("expected At with line 0 to return the error unchanged")
+	}
+}
+
+func TestFromError_Notes(t *testing.T) {
+	err := WithNote("Base.peak", 0, 0, "extended here",
+		WithCode(CodeTypeArgCount, At(2, 13, WithNote("Queue.peak", 1, 14, "template Queue<T> defined here", errors.New("wrong count")))))
+	d := FromError("Use.peak", err)
+	if d.Code != CodeTypeArgCount || d.Line != 2 || d.Column != 13 || d.Message != "wrong count" {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+	expected := []Note{
+		{File: "Base.peak", Message: "extended here"},
+		{File: "Queue.peak", Line: 1, Column: 14, Message: "template Queue<T> defined here"},
+	}
+	if !reflect.DeepEqual(d.Notes, expected) {
+		t.Errorf("expected notes %+v, got %+v", expected, d.Notes)
+	}
+
+	if d := FromError("Use.peak", errors.New("plain")); d.Notes != nil {
+		t.Errorf("expected no notes, got %+v", d.Notes)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	for _, code := range []string{"PEAK101", "peak101", "101"} {
+		e, ok := Explain(code)
+		if !ok || e.Code != CodeUndefinedTemplate {
+			t.Errorf("Explain(%q) = %+v, %v", code, e, ok)
+		}
+	}
+	if _, ok := Explain("PEAK999"); ok {
+		t.Error("expected unknown code to have no explanation")
+	}
+}
+
+func TestExplanations_Complete(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, e := range Explanations() {
+		if seen[e.Code] {
+			t.Errorf("duplicate explanation for %s", e.Code)
+		}
+		seen[e.Code] = true
+		if e.Title == "" || e.Description == "" || e.Fix == "" {
+			t.Errorf("incomplete explanation for %s", e.Code)
+		}
+	}
+
+	codes := []string{
+		CodeSyntax, CodeInvalidTypeParam, CodeDuplicateTypeParam, CodeShiftInTypeParams,
+		CodeUndefinedTemplate, CodeUndefinedMethod, CodeInvalidInstantiation, CodeOutputCollision, CodeOutputPath,
+		CodeRedundantInstantiation, CodeUnusedForcedTemplate, CodeInvalidComparable, CodeTooManyClasses, CodeHolderUnsupported,
+		CodeMalformedOutput, CodeSelfCheck, CodeTypeArgCount, CodeConditional, CodeInclude, CodeConstant, CodeInvalidOutputDir,
+		CodeInvalidVisibility, CodePackageApi, CodeClassFile, CodeLargeClass, CodeRecursiveInstantiation, CodeAmbiguousMethodCall,
+		CodeUnusedTemplate, CodeUnusedMethodTemplate, CodeClassNameTooLong,
+		CodeSourceTooLarge, CodeLargeSource, CodeWriteFailed, CodeStaleOutput, CodeMissingOutput,
+		CodeHandWritten, CodeOrphanedOutput, CodeReadFailed, CodeEditedOutput, CodeKeptHandWritten, CodeDeployFailed,
+	}
+	if len(seen) != len(codes) {
+		t.Errorf("expected %d explanations, one per code, got %d", len(codes), len(seen))
+	}
+	for _, code := range codes {
+		if !seen[code] {
+			t.Errorf("code %s has no explanation", code)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	diags := []Diagnostic{
+		{File: "b.peak", Line: 2, Column: 1, Message: "b2"},
+		{File: "a.peak", Line: 10, Column: 3, Message: "a10"},
+		{File: "b.peak", Line: 1, Column: 5, Message: "b1"},
+		{File: "a.peak", Line: 2, Column: 7, Message: "a2:7"},
+		{File: "a.peak", Message: "a-file"},
+		{File: "a.peak", Line: 2, Column: 1, Message: "a2:1"},
+		{File: "a.peak", Line: 2, Column: 1, Message: "a2:1 second"},
+	}
+
+	Sort(diags)
+
+	want := []string{"a-file", "a2:1", "a2:1 second", "a2:7", "a10", "b1", "b2"}
+	for i, d := range diags {
+		if d.Message != want[i] {
+			t.Errorf("position %d: expected %s, got %s", i, want[i], d.Message)
+		}
+	}
+}
+
+func TestNewSARIFLog(t *testing.T) {
+	diags := []Diagnostic{
+		{Severity: SeverityWarning, Code: CodeLargeSource, File: "src/Big.peak", Message: "large"},
+		{
+			Severity: SeverityError, Code: CodeTypeArgCount, File: "src/Use.peak", Line: 2, Column: 13, StartColumn: 10, EndColumn: 25,
+			Message: "wrong count", Notes: []Note{{File: "src/Queue.peak", Line: 1, Column: 14, Message: "template Queue<T> defined here"}},
+		},
+		{Severity: SeverityError, Code: CodeTypeArgCount, File: "/abs/My Dir/Other.peak", Line: 4, Column: 1, Message: "again"},
+	}
+
+	log := NewSARIFLog(diags, "1.2.3", "")
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	run := log.Runs[0]
+	if !run.Invocations[0].ExecutionSuccessful || run.Tool.Driver.Version != "1.2.3" {
+		t.Errorf("unexpected run: %+v", run)
+	}
+	if len(run.Tool.Driver.Rules) != 2 {
+		t.Fatalf("expected a rule per code, got %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(run.Results))
+	}
+
+	// Results are in diagnostic order
+	if r := run.Results[0]; r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "file:///abs/My%20Dir/Other.peak" || r.Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID != "" {
+		t.Errorf("unexpected absolute location: %+v", r.Locations)
+	}
+	big := run.Results[1]
+	if big.Level != "warning" || big.Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("expected a file-level warning, got %+v", big)
+	}
+	use := run.Results[2]
+	rule := run.Tool.Driver.Rules[*use.RuleIndex]
+	if rule.ID != CodeTypeArgCount || use.RuleID != CodeTypeArgCount || use.Level != "error" {
+		t.Errorf("unexpected rule %+v for %+v", rule, use)
+	}
+	location := use.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "src/Use.peak" || location.ArtifactLocation.URIBaseID != SARIFRootBase {
+		t.Errorf("unexpected artifact: %+v", location.ArtifactLocation)
+	}
+	if *location.Region != (SARIFRegion{StartLine: 2, StartColumn: 10, EndColumn: 25}) {
+		t.Errorf("unexpected region: %+v", *location.Region)
+	}
+	if len(use.RelatedLocations) != 1 || use.RelatedLocations[0].Message.Text != "template Queue<T> defined here" {
+		t.Errorf("expected the note as a related location, got %+v", use.RelatedLocations)
+	}
+
+	failed := NewSARIFLog(nil, "1.2.3", "invalid peakconfig.json")
+	invocation := failed.Runs[0].Invocations[0]
+	if invocation.ExecutionSuccessful || len(invocation.ToolExecutionNotifications) != 1 {
+		t.Errorf("expected a failed invocation, got %+v", invocation)
+	}
+}
@@ -0,0 +1,221 @@
+package diagnostic
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// SARIF 2.1.0 (Static Analysis Results Interchange Format) is what GitHub code
+// scanning and most CI systems read to annotate pull requests. Only the parts of
+// the format Peak fills in are modeled.
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+
+	// SARIFRootBase is the URI base id relative file paths are resolved against.
+	// Code scanning resolves it to the root of the checkout.
+	SARIFRootBase = "%SRCROOT%"
+)
+
+// SARIFLog is a SARIF log with a single run of Peak
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is the run of Peak that produced a log's results
+type SARIFRun struct {
+	Tool        SARIFTool         `json:"tool"`
+	Invocations []SARIFInvocation `json:"invocations"`
+	Results     []SARIFResult     `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule describes a diagnostic code, from its Explanation
+type SARIFRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SARIFMessage `json:"shortDescription"`
+	FullDescription  SARIFMessage `json:"fullDescription"`
+	Help             SARIFMessage `json:"help"`
+}
+
+// SARIFInvocation records whether the run completed; a run that failed before
+// compiling, e.g. on an invalid configuration, carries the reason as a notification
+type SARIFInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []SARIFNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type SARIFNotification struct {
+	Level   string       `json:"level"`
+	Message SARIFMessage `json:"message"`
+}
+
+// SARIFResult is a diagnostic
+type SARIFResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	RuleIndex        *int            `json:"ruleIndex,omitempty"`
+	Level            string          `json:"level"`
+	Message          SARIFMessage    `json:"message"`
+	Locations        []SARIFLocation `json:"locations,omitempty"`
+	RelatedLocations []SARIFLocation `json:"relatedLocations,omitempty"` // From Notes
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+	Message          *SARIFMessage         `json:"message,omitempty"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion          `json:"region,omitempty"`
+}
+
+type SARIFArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// SARIFRegion is a position on a line; EndColumn is exclusive, as in Diagnostic
+type SARIFRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// NewSARIFLog converts diags into a SARIF log of a run of Peak at toolVersion.
+// Relative file paths are given the SARIFRootBase base, so they should be relative
+// to the root of the repository; absolute paths become file URIs. Every code in
+// diags is described by a rule. failure, if not empty, is why the run did not
+// complete, and marks the invocation unsuccessful.
+func NewSARIFLog(diags []Diagnostic, toolVersion, failure string) *SARIFLog {
+	run := SARIFRun{
+		Tool: SARIFTool{Driver: SARIFDriver{
+			Name:           "peak",
+			Version:        toolVersion,
+			InformationURI: "https://github.com/ipavlic/peak",
+			Rules:          []SARIFRule{},
+		}},
+		Invocations: []SARIFInvocation{{ExecutionSuccessful: failure == ""}},
+		Results:     make([]SARIFResult, 0, len(diags)),
+	}
+	if failure != "" {
+		run.Invocations[0].ToolExecutionNotifications = []SARIFNotification{{
+			Level:   "error",
+			Message: SARIFMessage{Text: failure},
+		}}
+	}
+
+	sorted := append([]Diagnostic(nil), diags...)
+	Sort(sorted)
+	rules := make(map[string]int)
+	for _, d := range sorted {
+		result := SARIFResult{
+			RuleID:  d.Code,
+			Level:   sarifLevel(d.Severity),
+			Message: SARIFMessage{Text: d.Message},
+		}
+		if d.Code != "" {
+			index, ok := rules[d.Code]
+			if !ok {
+				index = len(run.Tool.Driver.Rules)
+				rules[d.Code] = index
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule(d.Code))
+			}
+			result.RuleIndex = &index
+		}
+		if d.File != "" {
+			column := d.Column
+			if d.StartColumn > 0 {
+				column = d.StartColumn
+			}
+			location := sarifLocation(d.File, d.Line, column)
+			if location.PhysicalLocation.Region != nil && d.EndColumn > column {
+				location.PhysicalLocation.Region.EndColumn = d.EndColumn
+			}
+			result.Locations = []SARIFLocation{location}
+		}
+		for i, note := range d.Notes {
+			if note.File == "" {
+				continue
+			}
+			location := sarifLocation(note.File, note.Line, note.Column)
+			location.ID = i + 1
+			location.Message = &SARIFMessage{Text: note.Message}
+			result.RelatedLocations = append(result.RelatedLocations, location)
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	return &SARIFLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []SARIFRun{run},
+	}
+}
+
+// sarifLevel maps a severity to a SARIF result level
+func sarifLevel(severity Severity) string {
+	if severity == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// sarifRule describes code from its explanation, or by its code alone if it has none
+func sarifRule(code string) SARIFRule {
+	rule := SARIFRule{
+		ID:               code,
+		ShortDescription: SARIFMessage{Text: code},
+		FullDescription:  SARIFMessage{Text: code},
+		Help:             SARIFMessage{Text: "Run `peak explain " + code + "` for details."},
+	}
+	if e, ok := Explain(code); ok {
+		rule.ShortDescription.Text = e.Title
+		rule.FullDescription.Text = e.Description
+		if e.Fix != "" {
+			rule.Help.Text = e.Fix
+		}
+	}
+	return rule
+}
+
+// sarifLocation returns the location of line and column in file; a location without
+// a line covers the whole file
+func sarifLocation(file string, line, column int) SARIFLocation {
+	artifact := SARIFArtifactLocation{}
+	if filepath.IsAbs(file) {
+		path := filepath.ToSlash(file)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path // Windows drive letter
+		}
+		artifact.URI = (&url.URL{Scheme: "file", Path: path}).String()
+	} else {
+		artifact.URI = (&url.URL{Path: filepath.ToSlash(file)}).String()
+		artifact.URIBaseID = SARIFRootBase
+	}
+
+	location := SARIFLocation{PhysicalLocation: SARIFPhysicalLocation{ArtifactLocation: artifact}}
+	if line > 0 {
+		location.PhysicalLocation.Region = &SARIFRegion{StartLine: line, StartColumn: column}
+	}
+	return location
+}
@@ -0,0 +1,472 @@
+// Package lsp serves Peak sources to editors over the Language Server Protocol.
+//
+// The server speaks JSON-RPC over stdio. It rebuilds the project whenever a document
+// is opened, changed, saved or closed, with the text of open documents in place of
+// their files on disk, and answers from the latest build: diagnostics, go-to-definition
+// from a generic usage to its template, hover showing the class a usage generates,
+// and completion of template names.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// maxHoverLines is how much of a generated class a hover shows
+const maxHoverLines = 40
+
+// Snapshot is what a build of the project produced
+type Snapshot struct {
+	Root        string                    // Directory that relative diagnostic paths, such as peakconfig.json, are in
+	Results     []transpiler.FileResult   // Outputs with their content, and errors
+	Templates   []transpiler.TemplateInfo // Class and method templates
+	Diagnostics []diagnostic.Diagnostic   // Errors and warnings
+}
+
+// BuildFunc builds the project with overlay, the text of open documents by path, in
+// place of their files on disk. It returns an error only if the project cannot be
+// built at all, such as for an invalid peakconfig.json.
+type BuildFunc func(overlay map[string]string) (*Snapshot, error)
+
+// Server is a language server for a Peak project
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	build     BuildFunc
+	docs      map[string]string // Text of open documents by path
+	snapshot  *Snapshot         // Latest successful build
+	published map[string]bool   // URIs that have diagnostics in the editor
+	shutdown  bool
+}
+
+// NewServer returns a server that reads messages from in, writes them to out and
+// builds the project with build
+func NewServer(in io.Reader, out io.Writer, build BuildFunc) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		build:     build,
+		docs:      make(map[string]string),
+		snapshot:  &Snapshot{},
+		published: make(map[string]bool),
+	}
+}
+
+// Run serves requests until the editor sends exit or closes the input
+func (s *Server) Run() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request or acts on a notification
+func (s *Server) handle(msg *message) error {
+	switch msg.Method {
+	case "initialize":
+		return s.reply(msg, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   map[string]any{"openClose": true, "change": 1, "save": true}, // Full text on change
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "peak"},
+		})
+	case "initialized":
+		return s.rebuild()
+	case "shutdown":
+		s.shutdown = true
+		return s.reply(msg, nil)
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument textDocumentItem `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil // A malformed notification cannot be answered
+		}
+		s.docs[URIToPath(params.TextDocument.URI)] = params.TextDocument.Text
+		return s.rebuild()
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   textDocumentIdentifier `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		s.docs[URIToPath(params.TextDocument.URI)] = params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.rebuild()
+	case "textDocument/didSave":
+		return s.rebuild()
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, URIToPath(params.TextDocument.URI))
+		return s.rebuild()
+
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.replyError(msg, codeInvalidParams, err.Error())
+		}
+		path := URIToPath(params.TextDocument.URI)
+		switch msg.Method {
+		case "textDocument/hover":
+			return s.reply(msg, s.hover(path, params.Position))
+		case "textDocument/definition":
+			return s.reply(msg, s.definition(path, params.Position))
+		default:
+			return s.reply(msg, s.completion())
+		}
+	}
+
+	if msg.ID != nil {
+		return s.replyError(msg, codeMethodNotFound, "unsupported method "+msg.Method)
+	}
+	return nil // Notifications the server does not handle, such as $/cancelRequest
+}
+
+// reply answers a request
+func (s *Server) reply(msg *message, result any) error {
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+// replyError answers a request with an error
+func (s *Server) replyError(msg *message, code int, text string) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: responseError{Code: code, Message: text}})
+}
+
+// notify sends a notification to the editor
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// rebuild builds the project with the open documents and publishes its diagnostics,
+// clearing those of files that no longer have any. A project that cannot be built
+// is reported as a message, keeping the previous build.
+func (s *Server) rebuild() error {
+	overlay := make(map[string]string, len(s.docs))
+	for path, text := range s.docs {
+		overlay[path] = text
+	}
+	snapshot, err := s.build(overlay)
+	if err != nil {
+		return s.notify("window/showMessage", map[string]any{"type": severityError, "message": "peak: " + err.Error()})
+	}
+	s.snapshot = snapshot
+
+	byURI := make(map[string][]Diagnostic)
+	for _, d := range snapshot.Diagnostics {
+		path := d.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(snapshot.Root, path)
+		}
+		uri := PathToURI(path)
+		byURI[uri] = append(byURI[uri], s.toDiagnostic(path, d))
+	}
+	for uri := range s.published {
+		if _, ok := byURI[uri]; !ok {
+			byURI[uri] = []Diagnostic{}
+		}
+	}
+
+	uris := make([]string, 0, len(byURI))
+	for uri := range byURI {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	s.published = make(map[string]bool)
+	for _, uri := range uris {
+		if len(byURI[uri]) > 0 {
+			s.published[uri] = true
+		}
+		if err := s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": byURI[uri]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toDiagnostic converts a Peak diagnostic in the file at path. Without a column it
+// covers the whole line, and without a span the word at its column.
+func (s *Server) toDiagnostic(path string, d diagnostic.Diagnostic) Diagnostic {
+	severity := severityError
+	if d.Severity == diagnostic.SeverityWarning {
+		severity = severityWarning
+	}
+	line := max(d.Line-1, 0)
+	text := lineText(s.text(path), line)
+	start, end := 0, len(text)
+	if d.Column > 0 {
+		start = min(d.Column-1, len(text))
+		end = wordEnd(text, start)
+		if d.StartColumn > 0 && d.EndColumn > d.StartColumn {
+			start, end = min(d.StartColumn-1, len(text)), min(d.EndColumn-1, len(text))
+		}
+	}
+	return Diagnostic{
+		Range: Range{
+			Start: Position{Line: line, Character: utf16Length(text[:start])},
+			End:   Position{Line: line, Character: utf16Length(text[:end])},
+		},
+		Severity: severity,
+		Code:     d.Code,
+		Source:   "peak",
+		Message:  d.Message,
+	}
+}
+
+// text returns the text of the document at path, from the editor if it is open
+func (s *Server) text(path string) string {
+	if text, ok := s.docs[path]; ok {
+		return text
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(string(data), "\r\n", "\n")
+}
+
+// definition returns the templates named by the identifier at pos: a class
+// template, or the generic methods of that name
+func (s *Server) definition(path string, pos Position) []Location {
+	name, _, _ := s.identifierAt(path, pos)
+	if name == "" {
+		return nil
+	}
+	locations := []Location{}
+	for _, template := range s.templates(name) {
+		line := max(template.Line-1, 0)
+		locations = append(locations, Location{
+			URI:   PathToURI(template.Path),
+			Range: Range{Start: Position{Line: line}, End: Position{Line: line}},
+		})
+	}
+	return locations
+}
+
+// templates returns the class template called name, or else the generic methods called
+// name, ignoring case like Apex
+func (s *Server) templates(name string) []transpiler.TemplateInfo {
+	var methods []transpiler.TemplateInfo
+	for _, template := range s.snapshot.Templates {
+		if !template.IsMethod && strings.EqualFold(template.Name, name) {
+			return []transpiler.TemplateInfo{template}
+		}
+		if template.IsMethod && len(template.Name) > len(name) && strings.EqualFold(template.Name[len(template.Name)-len(name)-1:], "."+name) {
+			methods = append(methods, template)
+		}
+	}
+	return methods
+}
+
+// hover describes the template named at pos, and with type arguments the class
+// they generate, as Queue<Integer> generating QueueInteger, with its first lines
+func (s *Server) hover(path string, pos Position) *Hover {
+	name, text, end := s.identifierAt(path, pos)
+	templates := s.templates(name)
+	if len(templates) == 0 {
+		return nil
+	}
+	template := templates[0]
+	declared := fmt.Sprintf("%s<%s>", template.Name, strings.Join(template.TypeParams, ", "))
+	location := fmt.Sprintf("%s:%d", filepath.Base(template.Path), template.Line)
+	kind := "template"
+	if template.IsMethod {
+		kind = "generic method"
+	}
+	value := fmt.Sprintf("%s `%s` (%s)", kind, declared, location)
+
+	if expr := typeArgsAt(text, end, template.Name); expr != nil && !template.IsMethod {
+		key := expr.String()
+		value = fmt.Sprintf("`%s` is not generated; %s", key, value)
+		for _, result := range s.snapshot.Results {
+			if result.Error != nil {
+				continue
+			}
+			if member, ok := memberFor(result.Members, key); ok {
+				value = fmt.Sprintf("`%s` generates `%s`, an inner class of `%s`\n\n%s", key, member, filepath.Base(result.OutputPath), value)
+				break
+			}
+			if strings.EqualFold(result.Instantiation, key) {
+				class := strings.TrimSuffix(filepath.Base(result.OutputPath), filepath.Ext(result.OutputPath))
+				value = fmt.Sprintf("`%s` generates `%s`\n\n```apex\n%s\n```", key, class, excerpt(result.Content, maxHoverLines))
+				break
+			}
+		}
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}}
+}
+
+// completion proposes the names of all templates
+func (s *Server) completion() []CompletionItem {
+	items := []CompletionItem{}
+	for _, template := range s.snapshot.Templates {
+		declared := fmt.Sprintf("%s<%s>", template.Name, strings.Join(template.TypeParams, ", "))
+		if template.IsMethod {
+			_, method, _ := strings.Cut(template.Name, ".")
+			items = append(items, CompletionItem{Label: method, Kind: completionMethod, Detail: declared, InsertText: method + "<"})
+			continue
+		}
+		items = append(items, CompletionItem{Label: template.Name, Kind: completionClass, Detail: declared, InsertText: template.Name + "<"})
+	}
+	return items
+}
+
+// identifierAt returns the identifier at pos in the document at path, the document's
+// text and the offset just past the identifier
+func (s *Server) identifierAt(path string, pos Position) (string, string, int) {
+	text := s.text(path)
+	offset := offsetOf(text, pos)
+	start, end := offset, offset
+	for start > 0 && isIdentifierByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentifierByte(text[end]) {
+		end++
+	}
+	return text[start:end], text, end
+}
+
+// memberFor returns the inner class generated for instantiation among members, which
+// are keyed by instantiation, in any casing
+func memberFor(members map[string]string, instantiation string) (string, bool) {
+	if member, ok := members[instantiation]; ok {
+		return member, true
+	}
+	for key, member := range members {
+		if strings.EqualFold(key, instantiation) {
+			return member, true
+		}
+	}
+	return "", false
+}
+
+// typeArgsAt parses the type arguments that follow name at offset i of text, as in
+// Queue<Integer>, or returns nil if there are none
+func typeArgsAt(text string, i int, name string) *parser.GenericExpr {
+	if i >= len(text) || text[i] != '<' {
+		return nil
+	}
+	depth := 0
+	for j := i; j < len(text) && text[j] != '\n'; j++ {
+		switch text[j] {
+		case '<':
+			depth++
+		case '>':
+			if depth--; depth == 0 {
+				args, err := parser.ParseTypeArguments(text[i+1 : j])
+				if err != nil {
+					return nil
+				}
+				return &parser.GenericExpr{BaseType: name, TypeArgs: args}
+			}
+		}
+	}
+	return nil
+}
+
+// offsetOf returns the byte offset of pos in text, whose characters LSP counts in
+// UTF-16 code units
+func offsetOf(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+	for units := 0; units < pos.Character && offset < len(text) && text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// lineText returns line of text, zero-based, without its line break
+func lineText(text string, line int) string {
+	for ; line > 0; line-- {
+		next := strings.IndexByte(text, '\n')
+		if next < 0 {
+			return ""
+		}
+		text = text[next+1:]
+	}
+	if end := strings.IndexByte(text, '\n'); end >= 0 {
+		return text[:end]
+	}
+	return text
+}
+
+// wordEnd returns the end of the identifier at start of text, or start+1 if there
+// is none, so that a diagnostic covers at least a character
+func wordEnd(text string, start int) int {
+	end := start
+	for end < len(text) && isIdentifierByte(text[end]) {
+		end++
+	}
+	if end == start && end < len(text) {
+		end++
+	}
+	return end
+}
+
+// utf16Length returns the length of s in UTF-16 code units
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// excerpt returns the first n lines of text, noting how many more there are
+func excerpt(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n// ... %d more line(s)", len(lines)-n)
+}
+
+// isIdentifierByte reports whether c can be part of an Apex identifier
+func isIdentifierByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
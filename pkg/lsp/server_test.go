@@ -0,0 +1,224 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// sent is a message the server wrote
+type sent struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// serve runs a server on requests, with sources in root as the files on disk, and
+// returns the messages it wrote
+func serve(t *testing.T, root string, sources map[string]string, requests ...map[string]any) []sent {
+	t.Helper()
+	build := func(overlay map[string]string) (*Snapshot, error) {
+		files := make(map[string]string)
+		for name, content := range sources {
+			files[filepath.Join(root, name)] = content
+		}
+		for path, text := range overlay {
+			files[path] = text
+		}
+		tr := transpiler.NewTranspiler(nil)
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			return nil, err
+		}
+		snapshot := &Snapshot{Root: root, Results: results, Templates: tr.Templates(), Diagnostics: tr.Warnings()}
+		for _, result := range results {
+			if result.Error != nil {
+				snapshot.Diagnostics = append(snapshot.Diagnostics, diagnostic.FromError(result.OriginalPath, result.Error))
+			}
+		}
+		return snapshot, nil
+	}
+
+	var in, out bytes.Buffer
+	requests = append(requests, map[string]any{"id": 99, "method": "shutdown"}, map[string]any{"method": "exit"})
+	for _, request := range requests {
+		request["jsonrpc"] = "2.0"
+		body, err := json.Marshal(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	if err := NewServer(&in, &out, build).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var messages []sent
+	r := bufio.NewReader(&out)
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			return messages
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		if err != nil {
+			t.Fatalf("invalid header %q", header)
+		}
+		_, _ = r.ReadString('\n')
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg sent
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("invalid message %s: %v", body, err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// result returns the result of the request with id
+func result(t *testing.T, messages []sent, id int) json.RawMessage {
+	t.Helper()
+	for _, msg := range messages {
+		if string(msg.ID) == strconv.Itoa(id) {
+			if msg.Error != nil {
+				t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+			}
+			return msg.Result
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+	return nil
+}
+
+func position(id int, method, uri string, line, character int) map[string]any {
+	return map[string]any{"id": id, "method": method, "params": map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}}
+}
+
+func TestServer(t *testing.T) {
+	root := t.TempDir()
+	sources := map[string]string{
+		"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n}",
+		"Repository.peak": "public class Repository {\n" +
+			"    public <T> T get(String key) {\n        return null;\n    }\n}",
+	}
+	example := filepath.Join(root, "Example.peak")
+	uri := PathToURI(example)
+	text := "public class Example {\n" +
+		"    Queue<Integer> numbers = new Queue<Integer>();\n" +
+		"    Account a = repo.get<Account>('a');\n" +
+		"}"
+
+	messages := serve(t, root, sources,
+		map[string]any{"id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"method": "initialized", "params": map[string]any{}},
+		map[string]any{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "peak", "version": 1, "text": text},
+		}},
+		position(2, "textDocument/definition", uri, 1, 6),
+		position(3, "textDocument/hover", uri, 1, 6),
+		position(4, "textDocument/definition", uri, 2, 22),
+		position(5, "textDocument/completion", uri, 1, 0),
+		map[string]any{"method": "textDocument/didChange", "params": map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []map[string]any{{"text": "public class Example {\n    Queue<Integer, String> m;\n}"}},
+		}},
+		map[string]any{"id": 6, "method": "textDocument/formatting", "params": map[string]any{}},
+	)
+
+	var capabilities struct {
+		Capabilities struct {
+			HoverProvider      bool `json:"hoverProvider"`
+			DefinitionProvider bool `json:"definitionProvider"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(result(t, messages, 1), &capabilities); err != nil || !capabilities.Capabilities.HoverProvider || !capabilities.Capabilities.DefinitionProvider {
+		t.Errorf("expected hover and definition capabilities, got %s", result(t, messages, 1))
+	}
+
+	var locations []Location
+	if err := json.Unmarshal(result(t, messages, 2), &locations); err != nil || len(locations) != 1 ||
+		locations[0].URI != PathToURI(filepath.Join(root, "Queue.peak")) || locations[0].Range.Start.Line != 0 {
+		t.Errorf("expected the definition of Queue at Queue.peak:1, got %s", result(t, messages, 2))
+	}
+	if err := json.Unmarshal(result(t, messages, 4), &locations); err != nil || len(locations) != 1 ||
+		locations[0].URI != PathToURI(filepath.Join(root, "Repository.peak")) || locations[0].Range.Start.Line != 1 {
+		t.Errorf("expected the definition of get at Repository.peak:2, got %s", result(t, messages, 4))
+	}
+
+	var hover Hover
+	if err := json.Unmarshal(result(t, messages, 3), &hover); err != nil ||
+		!strings.Contains(hover.Contents.Value, "`Queue<Integer>` generates `QueueInteger`") ||
+		!strings.Contains(hover.Contents.Value, "private List<Integer> items;") {
+		t.Errorf("expected hover with QueueInteger, got %s", result(t, messages, 3))
+	}
+
+	var items []CompletionItem
+	if err := json.Unmarshal(result(t, messages, 5), &items); err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]string)
+	for _, item := range items {
+		labels[item.Label] = item.Detail
+	}
+	if labels["Queue"] != "Queue<T>" || labels["get"] != "Repository.get<T>" {
+		t.Errorf("expected completions of Queue and get, got %s", result(t, messages, 5))
+	}
+
+	for _, msg := range messages {
+		if string(msg.ID) == "6" && (msg.Error == nil || msg.Error.Code != codeMethodNotFound) {
+			t.Errorf("expected an unsupported method error, got %+v", msg)
+		}
+	}
+
+	// The last diagnostics published for Example.peak are those of the changed text
+	var published struct {
+		URI         string       `json:"uri"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	for _, msg := range messages {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params struct {
+				URI string `json:"uri"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			if params.URI == uri {
+				_ = json.Unmarshal(msg.Params, &published)
+			}
+		}
+	}
+	if len(published.Diagnostics) != 1 {
+		t.Fatalf("expected a diagnostic for Example.peak, got %+v", published)
+	}
+	d := published.Diagnostics[0]
+	want := Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 9}}
+	if d.Range != want || d.Severity != severityError || d.Source != "peak" {
+		t.Errorf("expected an error at %+v, got %+v", want, d)
+	}
+}
+
+func TestPathToURI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "My Classes", "Queue.peak")
+	uri := PathToURI(path)
+	if !strings.HasPrefix(uri, "file:///") || strings.Contains(uri, " ") {
+		t.Errorf("expected an escaped file URI, got %s", uri)
+	}
+	if got := URIToPath(uri); got != path {
+		t.Errorf("expected %s, got %s", path, got)
+	}
+}
@@ -0,0 +1,134 @@
+// Package mdapi packages generated Apex classes in Metadata API (MDAPI) format.
+//
+// A package is a zip with package.xml at its root and one .cls / .cls-meta.xml
+// pair per class under classes/, as accepted by
+// `sf project deploy start --metadata-dir <zip> --single-package`.
+package mdapi
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Class is a single Apex class to package
+type Class struct {
+	Name string // Class name, without extension
+	Body string // .cls content
+	Meta string // .cls-meta.xml content
+}
+
+// zipTime is used for every entry so identical inputs produce identical archives
+var zipTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// PackageXML generates a package.xml manifest listing the given ApexClass members
+func PackageXML(apiVersion string, classNames []string) string {
+	names := append([]string(nil), classNames...)
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<Package xmlns="http://soap.sforce.com/2006/04/metadata">` + "\n")
+	b.WriteString("    <types>\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "        <members>%s</members>\n", name)
+	}
+	b.WriteString("        <name>ApexClass</name>\n")
+	b.WriteString("    </types>\n")
+	fmt.Fprintf(&b, "    <version>%s</version>\n", apiVersion)
+	b.WriteString("</Package>\n")
+	return b.String()
+}
+
+// WriteZip writes an MDAPI package containing classes to w.
+// Entries are sorted and timestamps fixed, so the archive is reproducible.
+func WriteZip(w io.Writer, apiVersion string, classes []Class) error {
+	sorted := append([]Class(nil), classes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	names := make([]string, len(sorted))
+	for i, class := range sorted {
+		names[i] = class.Name
+	}
+
+	pw, err := NewWriter(w, apiVersion, names)
+	if err != nil {
+		return err
+	}
+	for _, class := range sorted {
+		if err := pw.Add(class); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
+
+// Writer writes an MDAPI package one class at a time, so class bodies need
+// not be held in memory together
+type Writer struct {
+	zw    *zip.Writer
+	names map[string]bool // Declared classes not yet added
+}
+
+// NewWriter starts an MDAPI package declaring classNames in package.xml.
+// Every declared class must be added exactly once before Close.
+func NewWriter(w io.Writer, apiVersion string, classNames []string) (*Writer, error) {
+	names := make(map[string]bool, len(classNames))
+	for _, name := range classNames {
+		if names[name] {
+			return nil, fmt.Errorf("duplicate class %s", name)
+		}
+		names[name] = true
+	}
+
+	pw := &Writer{zw: zip.NewWriter(w), names: names}
+	if err := writeEntry(pw.zw, "package.xml", PackageXML(apiVersion, classNames)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Add writes a declared class and its meta file to the package
+func (pw *Writer) Add(class Class) error {
+	if !pw.names[class.Name] {
+		return fmt.Errorf("class %s is not declared in package.xml or was already added", class.Name)
+	}
+	delete(pw.names, class.Name)
+
+	if err := writeEntry(pw.zw, "classes/"+class.Name+".cls", class.Body); err != nil {
+		return err
+	}
+	return writeEntry(pw.zw, "classes/"+class.Name+".cls-meta.xml", class.Meta)
+}
+
+// Close finishes the archive. It fails if a declared class was never added.
+func (pw *Writer) Close() error {
+	if len(pw.names) > 0 {
+		missing := make([]string, 0, len(pw.names))
+		for name := range pw.names {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("classes declared but not added: %s", strings.Join(missing, ", "))
+	}
+	return pw.zw.Close()
+}
+
+// writeEntry adds a single file to the archive
+func writeEntry(zw *zip.Writer, name, content string) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: zipTime,
+	})
+	if err != nil {
+		return fmt.Errorf("error adding %s: %w", name, err)
+	}
+	if _, err := io.WriteString(fw, content); err != nil {
+		return fmt.Errorf("error adding %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package mdapi
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPackageXML(t *testing.T) {
+	got := PackageXML("65.0", []string{"QueueString", "QueueInteger"})
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<Package xmlns="http://soap.sforce.com/2006/04/metadata">
+    <types>
+        <members>QueueInteger</members>
+        <members>QueueString</members>
+        <name>ApexClass</name>
+    </types>
+    <version>65.0</version>
+</Package>
+`
+	if got != want {
+		t.Errorf("unexpected package.xml:\n%s", got)
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	classes := []Class{
+		{Name: "QueueString", Body: "public class QueueString {}", Meta: "<meta/>"},
+		{Name: "QueueInteger", Body: "public class QueueInteger {}", Meta: "<meta/>"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZip(&buf, "64.0", classes); err != nil {
+		t.Fatalf("WriteZip failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+
+	wantNames := []string{
+		"package.xml",
+		"classes/QueueInteger.cls",
+		"classes/QueueInteger.cls-meta.xml",
+		"classes/QueueString.cls",
+		"classes/QueueString.cls-meta.xml",
+	}
+	if len(zr.File) != len(wantNames) {
+		t.Fatalf("expected %d entries, got %d", len(wantNames), len(zr.File))
+	}
+	for i, f := range zr.File {
+		if f.Name != wantNames[i] {
+			t.Errorf("entry %d: expected %s, got %s", i, wantNames[i], f.Name)
+		}
+	}
+
+	rc, _ := zr.File[1].Open()
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "public class QueueInteger {}" {
+		t.Errorf("unexpected class body: %q", body)
+	}
+
+	rc, _ = zr.File[0].Open()
+	manifest, _ := io.ReadAll(rc)
+	rc.Close()
+	if !strings.Contains(string(manifest), "<version>64.0</version>") {
+		t.Errorf("package.xml missing API version:\n%s", manifest)
+	}
+}
+
+func TestWriteZip_Reproducible(t *testing.T) {
+	classes := []Class{{Name: "A", Body: "a", Meta: "m"}, {Name: "B", Body: "b", Meta: "m"}}
+	reversed := []Class{classes[1], classes[0]}
+
+	var first, second bytes.Buffer
+	if err := WriteZip(&first, "65.0", classes); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteZip(&second, "65.0", reversed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("expected identical archives regardless of input order")
+	}
+}
+
+func TestWriteZip_DuplicateClass(t *testing.T) {
+	classes := []Class{{Name: "A"}, {Name: "A"}}
+	if err := WriteZip(io.Discard, "65.0", classes); err == nil {
+		t.Error("expected error for duplicate class names")
+	}
+}
+
+func TestWriter_MissingClass(t *testing.T) {
+	pw, err := NewWriter(io.Discard, "65.0", []string{"A", "B"})
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if err := pw.Add(Class{Name: "A"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := pw.Add(Class{Name: "A"}); err == nil {
+		t.Error("expected error adding a class twice")
+	}
+	if err := pw.Close(); err == nil || !strings.Contains(err.Error(), "B") {
+		t.Errorf("expected error naming the missing class, got %v", err)
+	}
+}
@@ -0,0 +1,432 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+)
+
+// File is the outline of a source file: the types it declares, with their nested
+// types and methods. It covers the structure Peak works with rather than every Apex
+// statement, so method bodies, initializers and property accessors are not parsed.
+type File struct {
+	Types   []*TypeDecl   // Top-level type declarations, in source order
+	Methods []*MethodDecl // Generic methods outside any type declaration, as in a snippet
+}
+
+// TypeDecl is a class, interface or enum declaration
+type TypeDecl struct {
+	Keyword     string        // "class", "interface" or "enum", in lower case
+	Name        string        // e.g. "Queue"
+	TypeParams  []string      // e.g. ["K", "V"] for Dict<K, V>, or nil if it is not generic
+	Annotations []string      // Annotations before the declaration as written, e.g. ["@IsTest"]
+	Modifiers   string        // Everything between the annotations and the keyword, e.g. "public with sharing"
+	Supertypes  string        // e.g. "extends Base implements Comparable" (between the type parameters and the body)
+	Start       int           // Offset of the first modifier, or of the keyword without modifiers
+	BodyStart   int           // Offset of the body's '{', or End if there is no body
+	End         int           // Offset just past the body's '}', or the end of the input if it is not closed
+	Types       []*TypeDecl   // Nested type declarations, in source order
+	Methods     []*MethodDecl // Methods and constructors, in source order
+}
+
+// MethodDecl is a method or constructor declaration
+type MethodDecl struct {
+	Name        string   // e.g. "groupBy"
+	TypeParams  []string // e.g. ["K"] for public <K> Map<K, List<SObject>> groupBy(...), or nil if it is not generic
+	Annotations []string // Annotations before the declaration as written, e.g. ["@TestVisible"]
+	Modifiers   string   // e.g. "public static"
+	DocComment  string   // ApexDoc block before the declaration, e.g. "/** ... */", or empty
+	DocStart    int      // Offset of DocComment, or -1 without one
+	Start       int      // Offset of the first modifier, or of the type parameters or return type without modifiers
+	BodyStart   int      // Offset of the body's '{', or of the ';' of a method without a body
+	End         int      // Offset just past the body's '}' or the ';', or the end of the input if it is not closed
+}
+
+// methodModifiers are the keywords that can precede the type parameters of a generic method
+var methodModifiers = []string{"public", "private", "protected", "global", "static", "final", "override", "virtual", "abstract", "testmethod", "webservice"}
+
+// statementKeywords start statements and expressions rather than declarations, so
+// "return foo(x);" and "new Foo(x);" are not mistaken for methods
+var statementKeywords = []string{"new", "return", "throw", "if", "else", "for", "while", "do", "switch", "when", "try", "catch", "finally",
+	"insert", "update", "upsert", "delete", "undelete", "merge", "break", "continue", "instanceof"}
+
+// ParseFile outlines the input. A malformed type parameter list of a class or method
+// does not end the outline: the error is recorded, the declaration is left out and
+// outlining resumes at the next member declaration, so every such error is returned,
+// as a ParseErrors if there are several, along with the outline of everything else.
+func (p *Parser) ParseFile() (*File, error) {
+	originalPos := p.pos
+	defer func() { p.pos = originalPos }()
+
+	o := &outliner{p: p, all: Tokenize(p.input)}
+	for _, tok := range o.all {
+		if tok.Kind != TokenComment {
+			o.tokens = append(o.tokens, tok)
+		}
+	}
+	file := &File{}
+	o.members(0, len(o.tokens), "", &file.Types, &file.Methods)
+	return file, joinErrors(o.errs)
+}
+
+// outliner builds a File from the tokens of a parser's input. Type parameter lists
+// are parsed by the parser itself, for the locations of their errors.
+type outliner struct {
+	p      *Parser
+	all    []Token // Tokens of the input, comments included
+	tokens []Token // Tokens of the input without comments, which the outline is built from
+	errs   []*ParseError
+}
+
+// members outlines the declarations in tokens[i:end], the body of the type typeName,
+// or the whole input if typeName is empty. Tokens that start no declaration are
+// skipped one by one, so declarations are found wherever they start.
+func (o *outliner) members(i, end int, typeName string, types *[]*TypeDecl, methods *[]*MethodDecl) {
+	for i < end {
+		first := i
+		annotations, next := o.annotations(i, end)
+		i = next
+
+		keyword := i
+		for keyword < end && o.tokens[keyword].Kind == TokenIdentifier && !isTypeKeyword(o.tokens[keyword]) {
+			keyword++
+		}
+		if keyword < end && isTypeKeyword(o.tokens[keyword]) && (keyword == 0 || !o.tokens[keyword-1].IsPunct('.')) {
+			decl, next := o.typeDecl(annotations, i, keyword, end)
+			if decl != nil {
+				*types = append(*types, decl)
+			}
+			i = next
+			continue
+		}
+
+		if method, next := o.method(annotations, first, i, end, typeName); next > 0 {
+			if method != nil && (method.TypeParams != nil || typeName != "") {
+				*methods = append(*methods, method)
+			}
+			i = next
+			continue
+		}
+		if i == first {
+			i++
+		}
+	}
+}
+
+// annotations returns the annotations starting at tokens[i], such as @IsTest and
+// @JsonAccess(serializable='always'), as written, and the index after them
+func (o *outliner) annotations(i, end int) ([]string, int) {
+	var annotations []string
+	for i+1 < end && o.tokens[i].IsPunct('@') && o.tokens[i+1].Kind == TokenIdentifier {
+		start := o.tokens[i].Pos
+		i += 2
+		for i+1 < end && o.tokens[i].IsPunct('.') && o.tokens[i+1].Kind == TokenIdentifier {
+			i += 2
+		}
+		last := o.tokens[i-1].End()
+		if i < end && o.tokens[i].IsPunct('(') {
+			if close := o.matching(i, end, '(', ')'); close < end {
+				last, i = o.tokens[close].End(), close+1
+			}
+		}
+		annotations = append(annotations, o.p.input[start:last])
+	}
+	return annotations, i
+}
+
+// typeDecl outlines the declaration whose keyword is tokens[keyword], after the
+// modifiers starting at tokens[modifiers], and returns it, or nil if it is not a valid
+// declaration, and the index after it
+func (o *outliner) typeDecl(annotations []string, modifiers, keyword, end int) (*TypeDecl, int) {
+	if keyword+1 >= end || o.tokens[keyword+1].Kind != TokenIdentifier {
+		return nil, keyword + 1
+	}
+	if !validSharing(o.tokens[modifiers:keyword]) {
+		return nil, keyword + 2
+	}
+
+	decl := &TypeDecl{
+		Keyword:     strings.ToLower(o.tokens[keyword].Text),
+		Name:        o.tokens[keyword+1].Text,
+		Annotations: annotations,
+		Start:       o.tokens[modifiers].Pos,
+		Modifiers:   strings.TrimSpace(o.p.input[o.tokens[modifiers].Pos:o.tokens[keyword].Pos]),
+	}
+	i := keyword + 2
+	headerStart := o.tokens[keyword+1].End()
+	if i < end && o.tokens[i].IsPunct('<') {
+		if decl.Keyword != "class" {
+			// Type parameters of interfaces are taken as written; only templates are validated
+			close := o.matching(i, end, '<', '>')
+			for _, tok := range o.tokens[i:close] {
+				if tok.Kind == TokenIdentifier {
+					decl.TypeParams = append(decl.TypeParams, tok.Text)
+				}
+			}
+			i = min(close+1, end)
+			headerStart = o.tokens[i-1].End()
+		} else {
+			o.p.pos = o.tokens[i].Pos
+			params, err := o.p.parseTypeParameters()
+			if err != nil {
+				o.recordError(err)
+				return nil, o.skipDeclaration(i, end, decl.Name)
+			}
+			decl.TypeParams = params
+			headerStart = o.p.pos
+			i = min(tokenAt(o.tokens, o.p.pos), end)
+		}
+	}
+
+	// The body follows any extends and implements clauses
+	for i < end && !o.tokens[i].IsPunct('{') {
+		i++
+	}
+	if i == end {
+		decl.BodyStart, decl.End = o.offset(end), o.offset(end)
+		decl.Supertypes = strings.TrimSpace(o.p.input[headerStart:decl.End])
+		return decl, end
+	}
+	close := o.matching(i, end, '{', '}')
+	decl.BodyStart, decl.End = o.tokens[i].Pos, o.endOffset(close, end)
+	decl.Supertypes = strings.TrimSpace(o.p.input[headerStart:decl.BodyStart])
+	o.members(i+1, close, decl.Name, &decl.Types, &decl.Methods)
+	return decl, min(close+1, end)
+}
+
+// recordError records err, a *ParseError of a malformed type parameter list
+func (o *outliner) recordError(err error) {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		o.errs = append(o.errs, parseErr)
+	}
+}
+
+// skipDeclaration recovers from the malformed type parameter list at tokens[open] of
+// the class name and returns the index after the class. The class is left out of the
+// outline, but the members of its body are still outlined, for the errors in them.
+// Without a body, outlining resumes after the next '}' or ';', or at the next type
+// declaration.
+func (o *outliner) skipDeclaration(open, end int, name string) int {
+	i := open + 1
+	pos := o.tokens[open].Pos
+	if close := o.p.angleBracketsEnd(pos); close > pos && o.p.input[close-1] == '>' {
+		i = tokenAt(o.tokens, close)
+	}
+	for ; i < end; i++ {
+		switch tok := o.tokens[i]; {
+		case tok.IsPunct('{'):
+			close := o.matching(i, end, '{', '}')
+			var types []*TypeDecl
+			var methods []*MethodDecl
+			o.members(i+1, close, name, &types, &methods)
+			return min(close+1, end)
+		case tok.IsPunct('}'), tok.IsPunct(';'):
+			return i + 1
+		case isTypeKeyword(tok):
+			return i
+		}
+	}
+	return end
+}
+
+// skipMethod recovers from the malformed type parameter list at tokens[open] of a
+// method by returning the index after the method: past its body, or its ';' if it
+// has none
+func (o *outliner) skipMethod(open, end int) int {
+	for i := open + 1; i < end; i++ {
+		switch tok := o.tokens[i]; {
+		case tok.IsPunct('{'):
+			return min(o.matching(i, end, '{', '}')+1, end)
+		case tok.IsPunct(';'):
+			return i + 1
+		case tok.IsPunct('}'):
+			return i
+		}
+	}
+	return end
+}
+
+// method outlines the method declared at tokens[i], after the annotations starting at
+// tokens[first], and returns it and the index after it, or nil and 0 if no method
+// starts there. Generic methods need a modifier or an annotation before their type
+// parameters, as in "public <T> T get(String key)" or "@AuraEnabled <T> T get(...)",
+// and a body; other methods and the constructors of typeName are outlined in type
+// bodies only. A generic method with a malformed type parameter list is recorded as
+// an error and skipped, returning nil and the index after it.
+func (o *outliner) method(annotations []string, first, i, end int, typeName string) (*MethodDecl, int) {
+	j := i
+	for j < end && isMethodModifier(o.tokens[j]) {
+		j++
+	}
+	decl := &MethodDecl{Annotations: annotations, Start: o.offset(i), DocStart: -1}
+	if j > i {
+		decl.Modifiers = strings.TrimSpace(o.p.input[o.tokens[i].Pos:o.offset(j)])
+	}
+
+	name := j
+	switch {
+	case (j > i || annotations != nil) && j < end && o.tokens[j].IsPunct('<'):
+		o.p.pos = o.tokens[j].Pos
+		params, err := o.p.parseTypeParameters()
+		if err != nil {
+			o.recordError(err)
+			return nil, o.skipMethod(j, end)
+		}
+		decl.TypeParams = params
+		if name = min(tokenAt(o.tokens, o.p.pos), end); !o.isCall(name, end) {
+			name = o.skipType(name, end)
+		}
+	case typeName == "":
+		return nil, 0
+	case j < end && o.tokens[j].IsKeyword(typeName) && o.isCall(j, end):
+		// A constructor
+	case j < end && !isStatementKeyword(o.tokens[j]):
+		name = o.skipType(j, end)
+	default:
+		return nil, 0
+	}
+	if name < 0 || !o.isCall(name, end) {
+		return nil, 0
+	}
+	decl.Name = o.tokens[name].Text
+
+	close := o.matching(name+1, end, '(', ')')
+	switch body := close + 1; {
+	case body >= end:
+		return nil, 0
+	case o.tokens[body].IsPunct('{'):
+		bodyClose := o.matching(body, end, '{', '}')
+		decl.BodyStart, decl.End = o.tokens[body].Pos, o.endOffset(bodyClose, end)
+		decl.DocComment, decl.DocStart = o.docComment(first, decl.Start)
+		return decl, min(bodyClose+1, end)
+	case o.tokens[body].IsPunct(';') && decl.TypeParams == nil:
+		decl.BodyStart, decl.End = o.tokens[body].Pos, o.tokens[body].End()
+		decl.DocComment, decl.DocStart = o.docComment(first, decl.Start)
+		return decl, body + 1
+	}
+	return nil, 0
+}
+
+// isCall reports whether tokens[i] is an identifier followed by '(', like the name
+// of a method in its declaration
+func (o *outliner) isCall(i, end int) bool {
+	return i+1 < end && o.tokens[i].Kind == TokenIdentifier && o.tokens[i+1].IsPunct('(')
+}
+
+// skipType returns the index after the type starting at tokens[i], such as
+// Schema.Account, Map<K, List<SObject>> or String[], or -1 if no type starts there
+func (o *outliner) skipType(i, end int) int {
+	if i >= end || o.tokens[i].Kind != TokenIdentifier {
+		return -1
+	}
+	i++
+	for i+1 < end && o.tokens[i].IsPunct('.') && o.tokens[i+1].Kind == TokenIdentifier {
+		i += 2
+	}
+	if i < end && o.tokens[i].IsPunct('<') {
+		close := o.matching(i, end, '<', '>')
+		if close == end {
+			return -1
+		}
+		i = close + 1
+	}
+	for i+1 < end && o.tokens[i].IsPunct('[') && o.tokens[i+1].IsPunct(']') {
+		i += 2
+	}
+	return i
+}
+
+// docComment returns the /** */ comment just before the declaration at pos whose
+// annotations start at tokens[first], with only annotations in between, and its
+// offset, or "" and -1 if there is none
+func (o *outliner) docComment(first, pos int) (string, int) {
+	after := 0
+	if first > 0 {
+		after = o.tokens[first-1].End()
+	}
+	doc, docStart := "", -1
+	for i := tokenAt(o.all, after); i < len(o.all) && o.all[i].Pos < pos; i++ {
+		if tok := o.all[i]; tok.Kind == TokenComment {
+			doc, docStart = tok.Text, tok.Pos
+		}
+	}
+	if !strings.HasPrefix(doc, "/**") || !strings.HasSuffix(doc, "*/") {
+		return "", -1
+	}
+	return doc, docStart
+}
+
+// matching returns the index of the close token that matches the open token at
+// tokens[i], or end if it is not closed before tokens[end]
+func (o *outliner) matching(i, end int, open, close byte) int {
+	depth := 0
+	for ; i < end; i++ {
+		switch {
+		case o.tokens[i].IsPunct(open):
+			depth++
+		case o.tokens[i].IsPunct(close):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return end
+}
+
+// offset returns the offset of tokens[i], or the end of the input past the last token
+func (o *outliner) offset(i int) int {
+	if i < len(o.tokens) {
+		return o.tokens[i].Pos
+	}
+	return len(o.p.input)
+}
+
+// endOffset returns the offset just past the closing token tokens[close], or the end
+// of the input if it was not found before tokens[end]
+func (o *outliner) endOffset(close, end int) int {
+	if close < end {
+		return o.tokens[close].End()
+	}
+	return len(o.p.input)
+}
+
+// validSharing reports whether the sharing keywords among modifiers are well formed:
+// with, without and inherited are followed by sharing, and sharing follows one of them
+func validSharing(modifiers []Token) bool {
+	for i, tok := range modifiers {
+		isPrefix := tok.IsKeyword("with") || tok.IsKeyword("without") || tok.IsKeyword("inherited")
+		if isPrefix && (i+1 == len(modifiers) || !modifiers[i+1].IsKeyword("sharing")) {
+			return false
+		}
+		if tok.IsKeyword("sharing") && (i == 0 || !(modifiers[i-1].IsKeyword("with") || modifiers[i-1].IsKeyword("without") || modifiers[i-1].IsKeyword("inherited"))) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTypeKeyword reports whether tok is class, interface or enum
+func isTypeKeyword(tok Token) bool {
+	return tok.IsKeyword("class") || tok.IsKeyword("interface") || tok.IsKeyword("enum")
+}
+
+// isMethodModifier reports whether tok is one of methodModifiers
+func isMethodModifier(tok Token) bool {
+	for _, modifier := range methodModifiers {
+		if tok.IsKeyword(modifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStatementKeyword reports whether tok is one of statementKeywords
+func isStatementKeyword(tok Token) bool {
+	for _, keyword := range statementKeywords {
+		if tok.IsKeyword(keyword) {
+			return true
+		}
+	}
+	return false
+}
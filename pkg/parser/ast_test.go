@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	input := `/** Shapes. */
+@IsTest
+public with sharing class Shapes extends Base {
+    // class Fake<T> { in a comment
+    private String brace = '} class Fake<T> {';
+
+    public Shapes() { }
+
+    /** Area of a shape. */
+    @TestVisible
+    public static <T> Decimal area(T shape) {
+        if (shape != null) { return 1; }
+        return 0;
+    }
+
+    public abstract Map<String, List<Integer>> sizes();
+
+    public interface Shape { Decimal area(); }
+
+    private class Circle {
+        Decimal radius() { return 1; }
+    }
+
+    private enum Kind { ROUND, SQUARE }
+}`
+	file, err := NewParser(input).ParseFile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(file.Types) != 1 || len(file.Methods) != 0 {
+		t.Fatalf("expected 1 top-level type, got %d types and %d methods", len(file.Types), len(file.Methods))
+	}
+
+	shapes := file.Types[0]
+	if shapes.Keyword != "class" || shapes.Name != "Shapes" || shapes.TypeParams != nil {
+		t.Errorf("unexpected declaration %s %s%v", shapes.Keyword, shapes.Name, shapes.TypeParams)
+	}
+	if shapes.Modifiers != "public with sharing" || shapes.Supertypes != "extends Base" {
+		t.Errorf("unexpected modifiers %q or supertypes %q", shapes.Modifiers, shapes.Supertypes)
+	}
+	if !reflect.DeepEqual(shapes.Annotations, []string{"@IsTest"}) {
+		t.Errorf("expected [@IsTest], got %v", shapes.Annotations)
+	}
+	if shapes.Start != strings.Index(input, "public with") || shapes.End != len(input) {
+		t.Errorf("expected the declaration to span from its modifiers to the end, got %d-%d", shapes.Start, shapes.End)
+	}
+
+	var types []string
+	for _, decl := range shapes.Types {
+		types = append(types, decl.Keyword+" "+decl.Name)
+	}
+	if expected := []string{"interface Shape", "class Circle", "enum Kind"}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected nested types %v, got %v", expected, types)
+	}
+	if methods := shapes.Types[1].Methods; len(methods) != 1 || methods[0].Name != "radius" {
+		t.Errorf("expected the radius method in Circle, got %v", methods)
+	}
+
+	var methods []string
+	for _, method := range shapes.Methods {
+		methods = append(methods, method.Name)
+	}
+	if expected := []string{"Shapes", "area", "sizes"}; !reflect.DeepEqual(methods, expected) {
+		t.Fatalf("expected methods %v, got %v", expected, methods)
+	}
+
+	area := shapes.Methods[1]
+	if !reflect.DeepEqual(area.TypeParams, []string{"T"}) || area.Modifiers != "public static" {
+		t.Errorf("unexpected type parameters %v or modifiers %q", area.TypeParams, area.Modifiers)
+	}
+	if !reflect.DeepEqual(area.Annotations, []string{"@TestVisible"}) || area.DocComment != "/** Area of a shape. */" {
+		t.Errorf("unexpected annotations %v or doc comment %q", area.Annotations, area.DocComment)
+	}
+	if signature := input[area.Start:area.BodyStart]; signature != "public static <T> Decimal area(T shape) " {
+		t.Errorf("unexpected signature %q", signature)
+	}
+	if body := input[area.BodyStart:area.End]; !strings.HasPrefix(body, "{\n        if") || !strings.HasSuffix(body, "return 0;\n    }") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	sizes := shapes.Methods[2]
+	if input[sizes.BodyStart:sizes.End] != ";" || sizes.DocComment != "" {
+		t.Errorf("expected a method without a body or doc comment, got %q", input[sizes.BodyStart:sizes.End])
+	}
+}
+
+func TestParseFile_TypeBodies(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		expectedBody string
+	}{
+		{
+			name:         "nested braces",
+			input:        "class A { public void method() { if (true) { } } }",
+			expectedBody: "{ public void method() { if (true) { } } }",
+		},
+		{
+			name:         "no opening brace found",
+			input:        "class A no braces here",
+			expectedBody: "",
+		},
+		{
+			name:         "empty body",
+			input:        "class A {}",
+			expectedBody: "{}",
+		},
+		{
+			name:         "braces in strings and comments",
+			input:        "class A { String s = '}'; /* } */ // }\n} class B { }",
+			expectedBody: "{ String s = '}'; /* } */ // }\n}",
+		},
+		{
+			name:         "unclosed body",
+			input:        "class A { void m() {",
+			expectedBody: "{ void m() {",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := NewParser(tt.input).ParseFile()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(file.Types) == 0 {
+				t.Fatal("expected a type declaration")
+			}
+			decl := file.Types[0]
+			if body := tt.input[decl.BodyStart:decl.End]; body != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestParseFile_NotDeclarations(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"class literal", "Type t = Account.class;"},
+		{"keyword prefix", "myclass Foo { }"},
+		{"comment", "// class Foo { }"},
+		{"string", "String s = 'class Foo { }';"},
+		{"invalid sharing", "public foo sharing class Foo { }"},
+		{"statement", "class A { void m() { return compute(x); } }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := NewParser(tt.input).ParseFile()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, decl := range file.Types {
+				if decl.Name == "Foo" || len(decl.Methods) > 1 || len(decl.Methods) == 1 && decl.Methods[0].Name != "m" {
+					t.Errorf("unexpected declaration %s %s with methods %v", decl.Keyword, decl.Name, decl.Methods)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFile_Errors(t *testing.T) {
+	input := `public class Outer {
+    class Bad<TT> {
+        public <T, T> void m() { }
+    }
+    public <K> void good(K key) { }
+    class Worse<T U> { }
+    public <V W> void bad(V value) { }
+    class Good<T> { }
+}`
+	file, err := NewParser(input).ParseFile()
+	var errs ParseErrors
+	if !errors.As(err, &errs) || len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %v", err)
+	}
+	var codes []string
+	for _, e := range errs {
+		codes = append(codes, e.Code)
+	}
+	if expected := []string{CodeInvalidTypeParam, CodeDuplicateTypeParam, CodeSyntax, CodeSyntax}; !reflect.DeepEqual(codes, expected) {
+		t.Errorf("expected codes %v, got %v", expected, codes)
+	}
+
+	if len(file.Types) != 1 {
+		t.Fatalf("expected 1 type, got %v", file.Types)
+	}
+	outer := file.Types[0]
+	if len(outer.Types) != 1 || outer.Types[0].Name != "Good" {
+		t.Errorf("expected only the valid nested class to be outlined, got %v", outer.Types)
+	}
+	if len(outer.Methods) != 1 || outer.Methods[0].Name != "good" {
+		t.Errorf("expected only the valid method to be outlined, got %v", outer.Methods)
+	}
+}
+
+func TestParseFile_AnnotatedGenericMethods(t *testing.T) {
+	input := `public class Repository {
+    @AuraEnabled(cacheable=true) public static <T> T get(String key) { return null; }
+    @TestVisible
+    // Not public
+    <T> void put(String key, T value) { }
+    <T> void notAMethod(T value) { }
+}`
+	file, err := NewParser(input).ParseFile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(file.Types) != 1 {
+		t.Fatalf("expected 1 type, got %d", len(file.Types))
+	}
+
+	var annotations [][]string
+	for _, method := range file.Types[0].Methods {
+		if method.TypeParams != nil {
+			annotations = append(annotations, append([]string{method.Name}, method.Annotations...))
+		}
+	}
+	expected := [][]string{{"get", "@AuraEnabled(cacheable=true)"}, {"put", "@TestVisible"}}
+	if !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("expected generic methods with annotations %v, got %v", expected, annotations)
+	}
+}
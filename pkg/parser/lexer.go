@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind is the kind of a Token
+type TokenKind int
+
+const (
+	TokenIdentifier TokenKind = iota // A name or keyword, e.g. Queue or class
+	TokenNumber                      // A numeric literal, e.g. 42, 10L or 1.5
+	TokenString                      // A string literal with its quotes, e.g. 'it\'s'
+	TokenComment                     // A line or block comment, e.g. // note or /** doc */
+	TokenPunct                       // A single punctuation or operator character, e.g. < or {
+)
+
+// Token is a lexical token of Apex or Peak source. Whitespace separates tokens and
+// is not a token itself. Operators are split into single characters, so that the
+// '>>' closing Map<String, List<Integer>> is two tokens, as in Apex generics.
+type Token struct {
+	Kind TokenKind
+	Text string // The token as written
+	Pos  int    // Offset of the token's first byte in the input
+}
+
+// End returns the offset just past the token
+func (t Token) End() int {
+	return t.Pos + len(t.Text)
+}
+
+// IsKeyword reports whether the token is the identifier keyword, in any casing, as
+// Apex keywords are case-insensitive
+func (t Token) IsKeyword(keyword string) bool {
+	return t.Kind == TokenIdentifier && strings.EqualFold(t.Text, keyword)
+}
+
+// IsPunct reports whether the token is the punctuation character c
+func (t Token) IsPunct(c byte) bool {
+	return t.Kind == TokenPunct && len(t.Text) == 1 && t.Text[0] == c
+}
+
+// Tokenize splits input into tokens, in source order. It never fails: an unterminated
+// string literal ends at the end of its line, since Apex strings cannot span lines,
+// an unterminated block comment at the end of the input, and any other character is
+// a punctuation token.
+func Tokenize(input string) []Token {
+	var tokens []Token
+	for pos := 0; pos < len(input); {
+		r, size := utf8.DecodeRuneInString(input[pos:])
+		kind, end := TokenPunct, pos+size
+		switch {
+		case unicode.IsSpace(r):
+			pos = end
+			continue
+		case r == '/' && strings.HasPrefix(input[pos+1:], "/"):
+			kind, end = TokenComment, len(input)
+			if newline := strings.IndexByte(input[pos:], '\n'); newline >= 0 {
+				end = pos + newline
+			}
+		case r == '/' && strings.HasPrefix(input[pos+1:], "*"):
+			kind, end = TokenComment, len(input)
+			if close := strings.Index(input[pos+2:], "*/"); close >= 0 {
+				end = pos + 2 + close + 2
+			}
+		case r == '\'':
+			kind, end = TokenString, stringLiteralEnd(input, pos)
+		case unicode.IsLetter(r) || r == '_':
+			kind, end = TokenIdentifier, identifierEnd(input, end)
+		case unicode.IsDigit(r):
+			kind, end = TokenNumber, numberEnd(input, end)
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: input[pos:end], Pos: pos})
+		pos = end
+	}
+	return tokens
+}
+
+// stringLiteralEnd returns the offset just past the string literal whose opening quote
+// is at input[start], or the end of its line if it is unterminated
+func stringLiteralEnd(input string, start int) int {
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++ // Skip the escaped character, which may be a quote
+		case '\'':
+			return i + 1
+		case '\n':
+			// Stop at the newline so that an unbalanced quote does not swallow the
+			// rest of the input
+			return i
+		}
+	}
+	return len(input)
+}
+
+// identifierEnd returns the offset just past the letters, digits and underscores
+// starting at pos
+func identifierEnd(input string, pos int) int {
+	for pos < len(input) {
+		r, size := utf8.DecodeRuneInString(input[pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+// numberEnd returns the offset just past the numeric literal continuing at pos: digits,
+// suffixes such as the L of 10L, and a decimal point followed by a digit
+func numberEnd(input string, pos int) int {
+	for pos < len(input) {
+		if c := input[pos]; c == '.' && pos+1 < len(input) && input[pos+1] >= '0' && input[pos+1] <= '9' {
+			pos++
+			continue
+		}
+		end := identifierEnd(input, pos)
+		if end == pos {
+			break
+		}
+		pos = end
+	}
+	return pos
+}
+
+// tokenAt returns the index of the first of tokens that starts at or after pos
+func tokenAt(tokens []Token, pos int) int {
+	return sort.Search(len(tokens), func(i int) bool { return tokens[i].Pos >= pos })
+}
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Token
+	}{
+		{
+			name:  "declaration",
+			input: "class Queue<T> {",
+			expected: []Token{
+				{TokenIdentifier, "class", 0},
+				{TokenIdentifier, "Queue", 6},
+				{TokenPunct, "<", 11},
+				{TokenIdentifier, "T", 12},
+				{TokenPunct, ">", 13},
+				{TokenPunct, "{", 15},
+			},
+		},
+		{
+			name:  "nested closing brackets are separate tokens",
+			input: "Map<K, List<V>>",
+			expected: []Token{
+				{TokenIdentifier, "Map", 0},
+				{TokenPunct, "<", 3},
+				{TokenIdentifier, "K", 4},
+				{TokenPunct, ",", 5},
+				{TokenIdentifier, "List", 7},
+				{TokenPunct, "<", 11},
+				{TokenIdentifier, "V", 12},
+				{TokenPunct, ">", 13},
+				{TokenPunct, ">", 14},
+			},
+		},
+		{
+			name:  "single line comment",
+			input: "// this is a comment\ncode",
+			expected: []Token{
+				{TokenComment, "// this is a comment", 0},
+				{TokenIdentifier, "code", 21},
+			},
+		},
+		{
+			name:  "multi-line comment",
+			input: "/* this is\n a multi-line\n comment */code",
+			expected: []Token{
+				{TokenComment, "/* this is\n a multi-line\n comment */", 0},
+				{TokenIdentifier, "code", 36},
+			},
+		},
+		{
+			name:     "comment at end",
+			input:    "// comment at end",
+			expected: []Token{{TokenComment, "// comment at end", 0}},
+		},
+		{
+			name:     "unterminated block comment",
+			input:    "/** doc",
+			expected: []Token{{TokenComment, "/** doc", 0}},
+		},
+		{
+			name:  "string with escaped quote and brace",
+			input: `s = 'it\'s {';`,
+			expected: []Token{
+				{TokenIdentifier, "s", 0},
+				{TokenPunct, "=", 2},
+				{TokenString, `'it\'s {'`, 4},
+				{TokenPunct, ";", 13},
+			},
+		},
+		{
+			name:  "unterminated string ends at the line",
+			input: "'open\nclass",
+			expected: []Token{
+				{TokenString, "'open", 0},
+				{TokenIdentifier, "class", 6},
+			},
+		},
+		{
+			name:  "numbers",
+			input: "42 10L 1.5 x.y",
+			expected: []Token{
+				{TokenNumber, "42", 0},
+				{TokenNumber, "10L", 3},
+				{TokenNumber, "1.5", 7},
+				{TokenIdentifier, "x", 11},
+				{TokenPunct, ".", 12},
+				{TokenIdentifier, "y", 13},
+			},
+		},
+		{
+			name:  "keywords are whole identifiers",
+			input: "myclass class2 _class",
+			expected: []Token{
+				{TokenIdentifier, "myclass", 0},
+				{TokenIdentifier, "class2", 8},
+				{TokenIdentifier, "_class", 15},
+			},
+		},
+		{
+			name:     "empty input",
+			input:    "  \n\t",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.input)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Tokenize(%q) = %v, expected %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestToken_IsKeyword(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    Token
+		keyword  string
+		expected bool
+	}{
+		{"same casing", Token{TokenIdentifier, "class", 0}, "class", true},
+		{"other casing", Token{TokenIdentifier, "Class", 0}, "class", true},
+		{"prefix", Token{TokenIdentifier, "classes", 0}, "class", false},
+		{"string", Token{TokenString, "class", 0}, "class", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.token.IsKeyword(tt.keyword); got != tt.expected {
+				t.Errorf("IsKeyword(%q) = %v, expected %v", tt.keyword, got, tt.expected)
+			}
+		})
+	}
+}
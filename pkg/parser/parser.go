@@ -5,23 +5,43 @@
 // nested generics, multiple type parameters, and distinguishes generic syntax
 // from comparison operators.
 //
+// Source is split into tokens by Tokenize, so that comments and string literals
+// are never mistaken for code, and ParseFile outlines the tokens into a small tree
+// of type and method declarations, which the scans for generic classes and methods
+// walk. Type arguments and type parameter lists are parsed character by character,
+// for precise error locations.
+//
 // The parser uses minimal intervention: it only parses generic-related syntax
 // and leaves all other Apex code untouched.
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"unicode"
 )
 
+// Diagnostic codes for parse errors. They are stable identifiers that users can
+// search for; `peak explain <code>` describes each one.
+const (
+	CodeSyntax             = "PEAK001" // Malformed generic expression or type parameter list
+	CodeInvalidTypeParam   = "PEAK002" // Type parameter is not a single letter
+	CodeDuplicateTypeParam = "PEAK003" // Type parameter declared twice
+	CodeShiftInTypeParams  = "PEAK004" // '<<' or '>>' in a type parameter list
+)
+
 // ParseError represents a parsing error with location information
 type ParseError struct {
-	Message string
-	Line    int
-	Column  int
-	File    string
-	Source  string // The source line where the error occurred
+	Code        string // Diagnostic code, e.g. PEAK001
+	Message     string
+	Line        int
+	Column      int
+	StartColumn int // First column of the offending expression or type parameter list (0 = Column only)
+	EndColumn   int // Column just past the offending text, on the same line
+	File        string
+	Source      string // The source line where the error occurred
 }
 
 func (e *ParseError) Error() string {
@@ -31,34 +51,89 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
 }
 
+// codePrefix returns "CODE: " for errors with a code, or "" otherwise
+func (e *ParseError) codePrefix() string {
+	if e.Code == "" {
+		return ""
+	}
+	return e.Code + ": "
+}
+
 // FormatError returns a user-friendly formatted error with source context
 func (e *ParseError) FormatError() string {
 	var result strings.Builder
 
 	if e.File != "" {
-		result.WriteString(fmt.Sprintf("%s:%d:%d: error: %s\n", e.File, e.Line, e.Column, e.Message))
+		result.WriteString(fmt.Sprintf("%s:%d:%d: error: %s%s\n", e.File, e.Line, e.Column, e.codePrefix(), e.Message))
 	} else {
-		result.WriteString(fmt.Sprintf("line %d, column %d: error: %s\n", e.Line, e.Column, e.Message))
+		result.WriteString(fmt.Sprintf("line %d, column %d: error: %s%s\n", e.Line, e.Column, e.codePrefix(), e.Message))
 	}
 
 	if e.Source != "" {
 		result.WriteString(e.Source)
 		result.WriteString("\n")
 
-		// Add the pointer line with ^
-		for i := 0; i < e.Column-1; i++ {
-			if i < len(e.Source) && e.Source[i] == '\t' {
+		// Add the pointer line: ^ at the column, ~ under the rest of the span
+		end := max(e.EndColumn, e.Column+1)
+		for column := 1; column < end; column++ {
+			switch {
+			case column == e.Column:
+				result.WriteString("^")
+			case column >= e.StartColumn && column < e.EndColumn && e.StartColumn > 0:
+				result.WriteString("~")
+			case column-1 < len(e.Source) && e.Source[column-1] == '\t':
 				result.WriteString("\t")
-			} else {
+			default:
 				result.WriteString(" ")
 			}
 		}
-		result.WriteString("^\n")
+		result.WriteString("\n")
 	}
 
 	return result.String()
 }
 
+// ParseErrors are all the errors found in one pass over a file, in source order.
+// errors.As finds the first of them.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// SplitErrors returns the errors in err one by one: each error of a ParseErrors, or
+// err itself otherwise
+func SplitErrors(err error) []error {
+	var all ParseErrors
+	if errors.As(err, &all) && len(all) > 1 {
+		return all.Unwrap()
+	}
+	return []error{err}
+}
+
+// joinErrors returns errs as a single error: nil, the one *ParseError or ParseErrors
+func joinErrors(errs []*ParseError) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return ParseErrors(errs)
+}
+
 // GenericExpr represents a parsed generic expression
 type GenericExpr struct {
 	BaseType string        // e.g., "Foo"
@@ -68,30 +143,38 @@ type GenericExpr struct {
 
 // GenericClassDef represents a generic class definition
 type GenericClassDef struct {
-	ClassName  string   // e.g., "Queue"
-	TypeParams []string // e.g., ["T"]
-	Modifiers  string   // e.g., "public with sharing" (everything before "class")
-	Body       string   // The class body with generic type parameters
-	StartPos   int      // Start position in source
-	EndPos     int      // End position in source
+	ClassName   string   // e.g., "Queue"
+	TypeParams  []string // e.g., ["T"]
+	Modifiers   string   // e.g., "public with sharing" (everything before "class")
+	Annotations []string // Annotations before the class as written, e.g., ["@JsonAccess(serializable='always')"]
+	Supertypes  string   // e.g., "extends Base implements Comparable" (between the type parameters and the body)
+	Body        string   // The class body with generic type parameters
+	StartPos    int      // Start position in source
+	EndPos      int      // End position in source
+	BodyLine    int      // Line of the body's opening brace in source (1-based)
 }
 
 // GenericMethodDef represents a generic method definition
 type GenericMethodDef struct {
-	ClassName  string   // e.g., "SObjectCollection"
-	MethodName string   // e.g., "groupBy"
-	TypeParams []string // e.g., ["K"]
-	Signature  string   // Method signature without body (e.g., "public <K> Map<K, List<SObject>> groupBy(String apiFieldName)")
-	Body       string   // Method body with generic type parameters
-	StartPos   int      // Start position in source (beginning of method)
-	EndPos     int      // End position in source (end of method)
+	ClassName   string   // e.g., "SObjectCollection"
+	MethodName  string   // e.g., "groupBy"
+	TypeParams  []string // e.g., ["K"]
+	Signature   string   // Method signature without body (e.g., "public <K> Map<K, List<SObject>> groupBy(String apiFieldName)")
+	Body        string   // Method body with generic type parameters
+	StartPos    int      // Start position in source (beginning of method)
+	EndPos      int      // End position in source (end of method)
+	Line        int      // Line where the method starts in source (1-based)
+	DocComment  string   // ApexDoc block before the method, e.g. "/** ... */", or empty
+	DocLine     int      // Line where DocComment starts in source (1-based), 0 without one
+	Annotations []string // Annotations before the method as written, e.g., ["@TestVisible"]
 }
 
 // Parser handles the parsing of Peak source code
 type Parser struct {
 	input    string
 	pos      int
-	fileName string // Optional file name for better error messages
+	fileName string         // Optional file name for better error messages
+	builtIns map[string]int // Generic types passed through, by lower case name (nil = DefaultBuiltInGenerics)
 }
 
 // NewParser creates a new parser for the given input string.
@@ -106,6 +189,16 @@ func (p *Parser) SetFileName(fileName string) {
 	p.fileName = fileName
 }
 
+// SetBuiltInGenerics sets the generic types FindGenerics passes through, by name, with
+// their number of type arguments, instead of DefaultBuiltInGenerics. Names may be
+// qualified, as in Database.Batchable, and match in any casing.
+func (p *Parser) SetBuiltInGenerics(builtIns map[string]int) {
+	p.builtIns = make(map[string]int, len(builtIns))
+	for name, arity := range builtIns {
+		p.builtIns[strings.ToLower(name)] = arity
+	}
+}
+
 // getLineAndColumn calculates the line and column number for the current position
 func (p *Parser) getLineAndColumn(pos int) (line int, column int) {
 	line = 1
@@ -140,12 +233,55 @@ func (p *Parser) getSourceLine(pos int) string {
 	return p.input[start:end]
 }
 
-// createError creates a ParseError at the current position
-func (p *Parser) createError(pos int, message string) *ParseError {
+// withSpan extends err to cover the input from start up to end, on the line of the
+// error, so the whole offending expression is underlined. Errors on other lines
+// and errors that are not ParseErrors are returned unchanged.
+func (p *Parser) withSpan(err error, start, end int) error {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+	if strings.IndexByte(p.input[start:end], '\n') >= 0 || p.getSourceLine(start) != parseErr.Source {
+		return err
+	}
+	lineStart := strings.LastIndexByte(p.input[:start], '\n') + 1
+	parseErr.StartColumn = min(start-lineStart+1, parseErr.Column)
+	parseErr.EndColumn = max(end-lineStart+1, parseErr.Column+1)
+	return parseErr
+}
+
+// angleBracketsEnd returns the position just past the '>' that closes the '<' at open,
+// or, if it is not closed on the same line, the end of the text that follows it
+// up to the end of the line or the start of a body or statement
+func (p *Parser) angleBracketsEnd(open int) int {
+	depth := 0
+	end := open
+	for i := open; i < len(p.input); i++ {
+		switch c := p.input[i]; c {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '\n', '\r', '{', '}', ';', '(', ')':
+			return end
+		}
+		if !unicode.IsSpace(rune(p.input[i])) {
+			end = i + 1
+		}
+	}
+	return end
+}
+
+// createError creates a ParseError with the given code at the current position
+func (p *Parser) createError(pos int, code, message string) *ParseError {
 	line, column := p.getLineAndColumn(pos)
 	source := p.getSourceLine(pos)
 
 	return &ParseError{
+		Code:    code,
 		Message: message,
 		Line:    line,
 		Column:  column,
@@ -186,54 +322,6 @@ func (p *Parser) skipWhitespace() {
 	}
 }
 
-// skipComments skips both single-line (//) and multi-line (/* */) comments
-func (p *Parser) skipComments() {
-	for p.pos < len(p.input) {
-		// Check for single-line comment
-		if p.current() == '/' && p.peek(1) == '/' {
-			// Skip until end of line
-			p.advance(2)
-			for p.pos < len(p.input) && p.current() != '\n' {
-				p.advance(1)
-			}
-			if p.pos < len(p.input) && p.current() == '\n' {
-				p.advance(1)
-			}
-			continue
-		}
-
-		// Check for multi-line comment
-		if p.current() == '/' && p.peek(1) == '*' {
-			// Skip until we find */
-			p.advance(2)
-			for p.pos < len(p.input)-1 {
-				if p.current() == '*' && p.peek(1) == '/' {
-					p.advance(2)
-					break
-				}
-				p.advance(1)
-			}
-			continue
-		}
-
-		// No more comments
-		break
-	}
-}
-
-// skipWhitespaceAndComments skips both whitespace and comments
-func (p *Parser) skipWhitespaceAndComments() {
-	for {
-		start := p.pos
-		p.skipWhitespace()
-		p.skipComments()
-		// If position didn't change, we're done
-		if p.pos == start {
-			break
-		}
-	}
-}
-
 // parseIdentifier parses an identifier (alphanumeric + underscore)
 func (p *Parser) parseIdentifier() string {
 	start := p.pos
@@ -247,11 +335,37 @@ func (p *Parser) parseIdentifier() string {
 	return p.input[start:p.pos]
 }
 
+// parseQualifiedIdentifier parses an identifier optionally qualified by a namespace
+// or outer class, e.g. "Schema.Account" or "Outer.Inner"
+func (p *Parser) parseQualifiedIdentifier() string {
+	start := p.pos
+	p.parseIdentifier()
+	for p.pos > start && p.current() == '.' && (unicode.IsLetter(rune(p.peek(1))) || p.peek(1) == '_') {
+		p.advance(1) // skip '.'
+		p.parseIdentifier()
+	}
+	return p.input[start:p.pos]
+}
+
 // ParseGeneric parses a generic expression like "Foo<Integer>" or "Map<String, List<Integer>>".
 // This function is called when we encounter a '<' after an identifier.
 //
 // It recursively handles nested generics and validates syntax.
 func (p *Parser) ParseGeneric(baseType string) (*GenericExpr, error) {
+	open := p.pos
+	start := strings.LastIndex(p.input[:open], baseType)
+	if baseType == "" || start < 0 {
+		start = open
+	}
+	expr, err := p.parseGeneric(baseType)
+	if err != nil {
+		return nil, p.withSpan(err, start, p.angleBracketsEnd(open))
+	}
+	return expr, nil
+}
+
+// parseGeneric parses the type arguments of a generic expression, see ParseGeneric
+func (p *Parser) parseGeneric(baseType string) (*GenericExpr, error) {
 	expr := &GenericExpr{
 		BaseType: baseType,
 		TypeArgs: []GenericExpr{},
@@ -260,7 +374,7 @@ func (p *Parser) ParseGeneric(baseType string) (*GenericExpr, error) {
 
 	// We expect to be at '<'
 	if p.current() != '<' {
-		return nil, p.createError(p.pos, "expected '<'")
+		return nil, p.createError(p.pos, CodeSyntax, "expected '<'")
 	}
 	p.advance(1) // skip '<'
 
@@ -285,7 +399,7 @@ func (p *Parser) ParseGeneric(baseType string) (*GenericExpr, error) {
 			p.advance(1) // skip ','
 			continue
 		} else {
-			return nil, p.createError(p.pos, fmt.Sprintf("expected '>' or ',', got '%c'", p.current()))
+			return nil, p.createError(p.pos, CodeSyntax, fmt.Sprintf("expected '>' or ',', got '%c'", p.current()))
 		}
 	}
 
@@ -294,109 +408,198 @@ func (p *Parser) ParseGeneric(baseType string) (*GenericExpr, error) {
 
 // parseTypeArgument parses a single type argument, which could be:
 //   - A simple type like "Integer"
+//   - A namespaced type like "Schema.Account"
 //   - A nested generic like "List<String>"
+//   - An array like "Account[]", which is normalized to "List<Account>"
 //
 // This method enables recursive parsing of nested generic structures.
 func (p *Parser) parseTypeArgument() (*GenericExpr, error) {
 	p.skipWhitespace()
 
 	// Parse the base type name
-	typeName := p.parseIdentifier()
+	typeName := p.parseQualifiedIdentifier()
 	if typeName == "" {
-		return nil, p.createError(p.pos, "expected type name")
+		return nil, p.createError(p.pos, CodeSyntax, "expected type name")
 	}
 
 	p.skipWhitespace()
 
 	// Check if this is a generic type (followed by '<')
-	if p.current() == '<' {
-		return p.ParseGeneric(typeName)
-	}
-
-	// Simple type
-	return &GenericExpr{
+	arg := &GenericExpr{
 		BaseType: typeName,
 		TypeArgs: []GenericExpr{},
 		IsSimple: true,
-	}, nil
+	}
+	if p.current() == '<' {
+		var err error
+		if arg, err = p.ParseGeneric(typeName); err != nil {
+			return nil, err
+		}
+	}
+
+	// Array suffixes, as in Account[] or Account[][]: Apex arrays are lists, so
+	// Queue<Account[]> is the same instantiation as Queue<List<Account>>
+	for p.skipArraySuffix() {
+		arg = &GenericExpr{
+			BaseType: "List",
+			TypeArgs: []GenericExpr{*arg},
+			IsSimple: false,
+		}
+	}
+	return arg, nil
+}
+
+// skipArraySuffix skips "[]", optionally preceded by or containing whitespace, and
+// reports whether it was there; otherwise the position does not move
+func (p *Parser) skipArraySuffix() bool {
+	start := p.pos
+	p.skipWhitespace()
+	if p.current() == '[' {
+		p.advance(1)
+		p.skipWhitespace()
+		if p.current() == ']' {
+			p.advance(1)
+			return true
+		}
+	}
+	p.pos = start
+	return false
 }
 
 // FindGenerics scans through the input and finds all generic expressions.
 // It returns a map from original expression text to parsed GenericExpr.
-// Built-in Apex generic types (List, Set, Map) are excluded.
-// Comments (both // and /* */) are skipped.
+// Built-in generic types (DefaultBuiltInGenerics, unless set) are excluded.
+// Comments and string literals are skipped.
 func (p *Parser) FindGenerics() (map[string]*GenericExpr, error) {
 	generics := make(map[string]*GenericExpr)
 
-	for p.pos < len(p.input) {
-		// Skip whitespace and comments
-		p.skipWhitespaceAndComments()
-
-		// Check if we've reached the end
-		if p.pos >= len(p.input) {
-			break
+	tokens := Tokenize(p.input)
+	for i := tokenAt(tokens, p.pos); i+1 < len(tokens); i++ {
+		// An identifier followed by '<', with at most whitespace in between
+		tok := tokens[i]
+		if tok.Kind != TokenIdentifier || !tokens[i+1].IsPunct('<') || strings.TrimSpace(p.input[tok.End():tokens[i+1].Pos]) != "" {
+			continue
 		}
 
-		// Skip until we find an identifier
-		if !unicode.IsLetter(rune(p.current())) && p.current() != '_' {
-			p.advance(1)
+		// It's not a comparison operator such as a <= b or a < b
+		p.pos = tokens[i+1].Pos
+		if p.peek(1) == '=' || unicode.IsSpace(rune(p.peek(1))) {
 			continue
 		}
 
-		// Parse identifier
-		start := p.pos
-		identifier := p.parseIdentifier()
+		expr, err := p.ParseGeneric(tok.Text)
+		if err != nil {
+			// Not a valid generic, continue after the identifier
+			continue
+		}
 
-		// Check if followed by '<'
-		p.skipWhitespace()
-		if p.current() == '<' {
-			// This might be a generic expression
-			// We need to check it's not a comparison operator
-			if p.peek(1) != '=' && !unicode.IsSpace(rune(p.peek(1))) {
-				// Try to parse as generic
-				savedPos := p.pos
-				expr, err := p.ParseGeneric(identifier)
-				if err != nil {
-					// Not a valid generic, restore position and continue
-					p.pos = savedPos + 1
-					continue
-				}
-
-				// Skip built-in Apex generic types (List, Set, Map)
-				if !isBuiltInGeneric(expr.BaseType) {
-					// Successfully parsed a generic
-					originalText := p.input[start:p.pos]
-					generics[originalText] = expr
-
-					// Also collect all nested generics (excluding built-ins)
-					collectNestedGenerics(expr, generics)
-				}
-			}
+		// Skip built-in generic types (List, Set, Map, Iterable, ...), but
+		// not the templates in their type arguments, as in List<Queue<Integer>>.
+		// Qualified built-ins match by their full name, as in Database.Batchable.
+		qualified := p.input[tokens[qualifiedStart(tokens, i)].Pos:tok.End()]
+		if !p.isBuiltInGeneric(expr.BaseType) && !p.isBuiltInGeneric(qualified) {
+			generics[p.input[tok.Pos:p.pos]] = expr
 		}
+
+		// Also collect all nested generics (excluding built-ins)
+		p.collectNestedGenerics(expr, generics)
+
+		// Continue after the expression
+		i = tokenAt(tokens, p.pos) - 1
 	}
 
+	p.pos = len(p.input)
 	return generics, nil
 }
 
-// isBuiltInGeneric reports whether typeName is a built-in Apex generic type.
-func isBuiltInGeneric(typeName string) bool {
-	switch typeName {
-	case "List", "Set", "Map":
-		return true
-	default:
-		return false
+// DefaultBuiltInGenerics maps the generic types of the Apex system library, which
+// FindGenerics passes through, to their number of type arguments. Comparator<T> is the
+// interface that List.sort takes, Iterable<T> and Iterator<T> those of custom
+// iterators, and Database.Batchable<T> that of batch Apex.
+var DefaultBuiltInGenerics = map[string]int{
+	"List":               1,
+	"Set":                1,
+	"Map":                2,
+	"Comparator":         1,
+	"Iterable":           1,
+	"Iterator":           1,
+	"Database.Batchable": 1,
+}
+
+// defaultBuiltIns is DefaultBuiltInGenerics by lower case name
+var defaultBuiltIns = func() map[string]int {
+	builtIns := make(map[string]int, len(DefaultBuiltInGenerics))
+	for name, arity := range DefaultBuiltInGenerics {
+		builtIns[strings.ToLower(name)] = arity
+	}
+	return builtIns
+}()
+
+// isBuiltInGeneric reports whether typeName is a built-in generic type, in any
+// casing, as Apex type names are case-insensitive.
+func (p *Parser) isBuiltInGeneric(typeName string) bool {
+	_, ok := p.BuiltInArity(typeName)
+	return ok
+}
+
+// BuiltInArity returns the number of type arguments a built-in generic type takes,
+// and false if typeName is not a built-in generic type
+func (p *Parser) BuiltInArity(typeName string) (int, bool) {
+	builtIns := p.builtIns
+	if builtIns == nil {
+		builtIns = defaultBuiltIns
+	}
+	arity, ok := builtIns[strings.ToLower(typeName)]
+	return arity, ok
+}
+
+// qualifiedStart returns the index of the first token of the qualified name that
+// ends with the identifier tokens[i], as that of Database in Database.Batchable, or i
+// if it is not qualified
+func qualifiedStart(tokens []Token, i int) int {
+	for i > 1 && tokens[i-1].IsPunct('.') && tokens[i-2].Kind == TokenIdentifier &&
+		tokens[i-1].Pos == tokens[i-2].End() && tokens[i].Pos == tokens[i-1].End() {
+		i -= 2
+	}
+	return i
+}
+
+// ParseTypeArguments parses a comma-separated list of type arguments as written
+// between the angle brackets of a generic expression, e.g. "String, List<Integer>".
+// The whole input must be a type argument list. Errors carry no location, since
+// type arguments parsed this way do not come from a source file.
+func ParseTypeArguments(input string) ([]GenericExpr, error) {
+	p := NewParser("<" + input + ">")
+	expr, err := p.ParseGeneric("")
+	if err == nil {
+		p.skipWhitespace()
+		if p.pos < len(p.input) {
+			err = p.createError(p.pos, CodeSyntax, fmt.Sprintf("unexpected '%c' after type arguments", p.current()))
+		}
 	}
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			return nil, errors.New(parseErr.Message)
+		}
+		return nil, err
+	}
+	return expr.TypeArgs, nil
 }
 
-// collectNestedGenerics recursively collects all nested generic expressions
-func collectNestedGenerics(expr *GenericExpr, generics map[string]*GenericExpr) {
+// collectNestedGenerics recursively collects all nested generic expressions, looking
+// into built-in types as well, as in Map<String, List<Queue<Integer>>>
+func (p *Parser) collectNestedGenerics(expr *GenericExpr, generics map[string]*GenericExpr) {
 	for _, typeArg := range expr.TypeArgs {
-		if !typeArg.IsSimple && !isBuiltInGeneric(typeArg.BaseType) {
+		if typeArg.IsSimple {
+			continue
+		}
+		if !p.isBuiltInGeneric(typeArg.BaseType) {
 			// This is a nested generic and not a built-in type
 			generics[typeArg.String()] = &typeArg
-			// Recursively collect from this one too
-			collectNestedGenerics(&typeArg, generics)
 		}
+		// Recursively collect from this one too
+		p.collectNestedGenerics(&typeArg, generics)
 	}
 }
 
@@ -411,7 +614,8 @@ func GenerateConcreteClassName(expr *GenericExpr) string {
 
 	for _, typeArg := range expr.TypeArgs {
 		if typeArg.IsSimple {
-			parts = append(parts, typeArg.BaseType)
+			// Namespaced types contribute all their parts: Schema.Account → SchemaAccount
+			parts = append(parts, strings.ReplaceAll(typeArg.BaseType, ".", ""))
 		} else {
 			parts = append(parts, GenerateConcreteClassName(&typeArg))
 		}
@@ -429,7 +633,16 @@ func GenerateConcreteMethodName(methodName string, typeArgs []string) string {
 	}
 
 	parts := []string{methodName}
-	parts = append(parts, typeArgs...)
+	for _, typeArg := range typeArgs {
+		// Drop punctuation from namespaced and generic type arguments, as in class names:
+		// Map<String, Integer> → MapStringInteger
+		parts = append(parts, strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+				return r
+			}
+			return -1
+		}, typeArg))
+	}
 	return strings.Join(parts, "")
 }
 
@@ -447,187 +660,66 @@ func (g *GenericExpr) String() string {
 	return fmt.Sprintf("%s<%s>", g.BaseType, strings.Join(args, ", "))
 }
 
-// FindGenericClassDefinitions scans for generic class definitions.
-// It finds patterns like "class Queue<T>" or "class Dict<K, V>".
+// FindGenericClassDefinitions finds the generic class definitions in the outline
+// of the input, such as "class Queue<T>" or "class Dict<K, V>", including nested
+// ones, but not classes nested in generic classes.
 // Returns a map from class name to GenericClassDef.
-// Comments (both // and /* */) are skipped.
+// A malformed type parameter list does not end the scan: the error is recorded,
+// the declaration is skipped and scanning goes on, so every error in the input is
+// returned, as a ParseErrors if there are several. Input with errors yields no
+// definitions.
 func (p *Parser) FindGenericClassDefinitions() (map[string]*GenericClassDef, error) {
-	definitions := make(map[string]*GenericClassDef)
-
-	// Reset parser position
-	originalPos := p.pos
-	p.pos = 0
-
-	var prevIdentifier string
-	var modifierStart int = -1 // Track where modifiers start
-	for p.pos < len(p.input) {
-		// Skip whitespace and comments
-		p.skipWhitespaceAndComments()
-
-		// Check if we've reached the end
-		if p.pos >= len(p.input) {
-			break
-		}
-
-		// Skip until we find an identifier
-		if !unicode.IsLetter(rune(p.current())) && p.current() != '_' {
-			p.advance(1)
-			prevIdentifier = "" // Reset on non-identifier
-			modifierStart = -1  // Reset modifier tracking
-			continue
-		}
-
-		// Mark the start of potential modifiers (if not already marked)
-		if modifierStart == -1 {
-			modifierStart = p.pos
-		}
+	file, err := p.ParseFile()
+	if err != nil {
+		return nil, err
+	}
 
-		// Parse the identifier
-		identifier := p.parseIdentifier()
-
-		// Reject standalone "sharing" keyword without valid prefix
-		if identifier == "sharing" {
-			validSharingPrefix := prevIdentifier == "with" || prevIdentifier == "without" || prevIdentifier == "inherited"
-			if !validSharingPrefix {
-				// Invalid: "sharing" must be preceded by with/without/inherited
-				// Skip until we find something other than whitespace/class
-				p.skipWhitespace()
-				// Skip past "class" if present to avoid detecting this as valid
-				if p.matchKeyword("class") {
-					p.pos += 5
-				}
-				prevIdentifier = ""
-				modifierStart = -1
+	definitions := make(map[string]*GenericClassDef)
+	var collect func(types []*TypeDecl)
+	collect = func(types []*TypeDecl) {
+		for _, decl := range types {
+			if decl.Keyword != "class" || decl.TypeParams == nil {
+				collect(decl.Types)
 				continue
 			}
-		}
-
-		// Handle sharing keywords if present (with/without/inherited sharing)
-		if identifier == "with" || identifier == "without" || identifier == "inherited" {
-			p.skipWhitespace()
-			nextWord := p.parseIdentifier()
-			if nextWord != "sharing" {
-				// Invalid: must be followed by "sharing"
-				// If next word is "class", skip past it to avoid detecting this as valid
-				if nextWord == "class" {
-					// Already consumed "class", just skip past the class name and type params
-					p.skipWhitespace()
-					p.parseIdentifier() // skip class name
-				}
-				prevIdentifier = ""
-				modifierStart = -1
-				continue
+			bodyLine, _ := p.getLineAndColumn(decl.BodyStart)
+			definitions[decl.Name] = &GenericClassDef{
+				ClassName:   decl.Name,
+				TypeParams:  decl.TypeParams,
+				Modifiers:   decl.Modifiers,
+				Annotations: decl.Annotations,
+				Supertypes:  decl.Supertypes,
+				Body:        p.input[decl.BodyStart:decl.End],
+				StartPos:    decl.Start,
+				EndPos:      decl.End,
+				BodyLine:    bodyLine,
 			}
-			// Valid sharing pattern found, now look for "class"
-			p.skipWhitespace()
-			identifier = p.parseIdentifier()
-			prevIdentifier = "" // Reset since we've consumed the sharing keywords
-		}
-
-		// Check if this identifier is "class"
-		if identifier != "class" {
-			prevIdentifier = identifier
-			continue
-		}
-
-		// Found "class" keyword - extract modifiers before it
-		classKeywordEnd := p.pos
-		classKeywordStart := classKeywordEnd - len("class")
-
-		// Extract modifiers (everything from modifierStart to just before "class")
-		modifiers := ""
-		if modifierStart >= 0 && modifierStart < classKeywordStart {
-			modifiers = strings.TrimSpace(p.input[modifierStart:classKeywordStart])
-		}
-
-		p.skipWhitespace()
-
-		className := p.parseIdentifier()
-		if className == "" {
-			modifierStart = -1
-			continue
-		}
-
-		p.skipWhitespace()
-
-		// Check if this is a generic class (has <T> after class name)
-		if p.current() != '<' {
-			modifierStart = -1
-			continue
-		}
-
-		// Parse type parameters
-		// Calculate start position (back to beginning of modifiers or "class" keyword)
-		startPos := modifierStart
-		if startPos == -1 {
-			startPos = classKeywordStart
-		}
-
-		typeParams, err := p.parseTypeParameters()
-		if err != nil {
-			p.pos = originalPos
-			return nil, err
-		}
-
-		// Find the class body
-		body, endPos := p.extractClassBody()
-
-		definitions[className] = &GenericClassDef{
-			ClassName:  className,
-			TypeParams: typeParams,
-			Modifiers:  modifiers,
-			Body:       body,
-			StartPos:   startPos,
-			EndPos:     endPos,
 		}
-
-		// Reset modifier tracking for next class
-		modifierStart = -1
 	}
-
-	p.pos = originalPos
+	collect(file.Types)
 	return definitions, nil
 }
 
-// matchKeyword checks if the current position matches a keyword
-func (p *Parser) matchKeyword(keyword string) bool {
-	if p.pos+len(keyword) > len(p.input) {
-		return false
-	}
-
-	// Check if previous character is not alphanumeric (word boundary)
-	if p.pos > 0 {
-		prev := rune(p.input[p.pos-1])
-		if unicode.IsLetter(prev) || unicode.IsDigit(prev) {
-			return false
-		}
-	}
-
-	// Check if keyword matches
-	if p.input[p.pos:p.pos+len(keyword)] != keyword {
-		return false
-	}
-
-	// Check if next character is not alphanumeric (word boundary)
-	if p.pos+len(keyword) < len(p.input) {
-		next := rune(p.input[p.pos+len(keyword)])
-		if unicode.IsLetter(next) || unicode.IsDigit(next) {
-			return false
-		}
+// parseTypeParameters parses type parameters like <T> or <T, U>. Errors
+// cover the whole parameter list.
+func (p *Parser) parseTypeParameters() ([]string, error) {
+	open := p.pos
+	params, err := p.parseTypeParameterNames()
+	if err != nil {
+		return nil, p.withSpan(err, open, p.angleBracketsEnd(open))
 	}
-
-	return true
+	return params, nil
 }
 
-// parseTypeParameters parses type parameters like <T> or <T, U>
-func (p *Parser) parseTypeParameters() ([]string, error) {
+// parseTypeParameterNames parses the type parameters of parseTypeParameters
+func (p *Parser) parseTypeParameterNames() ([]string, error) {
 	if p.current() != '<' {
-		return nil, p.createError(p.pos, "expected '<'")
+		return nil, p.createError(p.pos, CodeSyntax, "expected '<'")
 	}
 
 	// Check for << syntax error
 	if p.peek(1) == '<' {
-		return nil, p.createError(p.pos, "'<<' is not allowed in type parameters")
+		return nil, p.createError(p.pos, CodeShiftInTypeParams, "'<<' is not allowed in type parameters")
 	}
 
 	p.advance(1)
@@ -638,29 +730,29 @@ func (p *Parser) parseTypeParameters() ([]string, error) {
 
 		// Check for >> syntax error
 		if p.current() == '>' && p.peek(1) == '>' {
-			return nil, p.createError(p.pos, "'>>' is not allowed in type parameters")
+			return nil, p.createError(p.pos, CodeShiftInTypeParams, "'>>' is not allowed in type parameters")
 		}
 
 		paramStart := p.pos
 		param := p.parseIdentifier()
 		if param == "" {
-			return nil, p.createError(p.pos, "expected type parameter")
+			return nil, p.createError(p.pos, CodeSyntax, "expected type parameter")
 		}
 
 		// Validate single-letter type parameter
 		if len(param) != 1 {
-			return nil, p.createError(paramStart, fmt.Sprintf("type parameter '%s' must be a single letter (e.g., T, U, V)", param))
+			return nil, p.createError(paramStart, CodeInvalidTypeParam, fmt.Sprintf("type parameter '%s' must be a single letter (e.g., T, U, V)", param))
 		}
 
 		// Validate it's a letter
 		if !unicode.IsLetter(rune(param[0])) {
-			return nil, p.createError(paramStart, fmt.Sprintf("type parameter '%s' must be a letter", param))
+			return nil, p.createError(paramStart, CodeInvalidTypeParam, fmt.Sprintf("type parameter '%s' must be a letter", param))
 		}
 
 		// Check for duplicate parameters
 		for _, existingParam := range params {
 			if existingParam == param {
-				return nil, p.createError(paramStart, fmt.Sprintf("duplicate type parameter '%s'", param))
+				return nil, p.createError(paramStart, CodeDuplicateTypeParam, fmt.Sprintf("duplicate type parameter '%s'", param))
 			}
 		}
 
@@ -671,7 +763,7 @@ func (p *Parser) parseTypeParameters() ([]string, error) {
 		// Check for >> syntax error before normal >
 		if p.current() == '>' {
 			if p.peek(1) == '>' {
-				return nil, p.createError(p.pos, "'>>' is not allowed in type parameters")
+				return nil, p.createError(p.pos, CodeShiftInTypeParams, "'>>' is not allowed in type parameters")
 			}
 			p.advance(1)
 			break
@@ -679,280 +771,57 @@ func (p *Parser) parseTypeParameters() ([]string, error) {
 			p.advance(1)
 			continue
 		} else {
-			return nil, p.createError(p.pos, "expected '>' or ','")
+			return nil, p.createError(p.pos, CodeSyntax, "expected '>' or ','")
 		}
 	}
 
 	return params, nil
 }
 
-// extractClassBody extracts the class body from current position
-func (p *Parser) extractClassBody() (string, int) {
-	p.skipWhitespace()
-
-	// Find the opening brace
-	for p.pos < len(p.input) && p.current() != '{' {
-		p.advance(1)
-	}
-
-	if p.pos >= len(p.input) {
-		return "", p.pos
-	}
-
-	startBody := p.pos
-	p.advance(1) // skip '{'
-
-	// Find matching closing brace
-	braceCount := 1
-	for p.pos < len(p.input) && braceCount > 0 {
-		if p.current() == '{' {
-			braceCount++
-		} else if p.current() == '}' {
-			braceCount--
-		}
-		p.advance(1)
-	}
-
-	endBody := p.pos
-	return p.input[startBody:endBody], endBody
-}
-
-// FindGenericMethodDefinitions scans for generic method definitions.
-// It finds patterns like "public <K> Map<K, List<SObject>> groupBy(String field)".
+// FindGenericMethodDefinitions finds the generic method definitions in the outline
+// of the input, such as "public <K> Map<K, List<SObject>> groupBy(String field)",
+// in any class, or outside of one.
 // Returns a map from "ClassName.methodName" to GenericMethodDef.
 // The className must be provided from context (extracted from containing class).
 func (p *Parser) FindGenericMethodDefinitions(className string) (map[string]*GenericMethodDef, error) {
-	definitions := make(map[string]*GenericMethodDef)
-
-	// Reset parser position
-	originalPos := p.pos
-	p.pos = 0
-
-	// Method modifiers that can appear before generic methods
-	modifiers := []string{"public", "private", "protected", "static", "final", "override", "virtual", "abstract"}
+	// Malformed type parameter lists are reported by FindGenericClassDefinitions
+	file, _ := p.ParseFile()
 
-	for p.pos < len(p.input) {
-		// Skip whitespace and comments
-		p.skipWhitespaceAndComments()
-
-		// Check if we've reached the end
-		if p.pos >= len(p.input) {
-			break
-		}
-
-		// Try to match method modifiers
-		foundModifier := false
-		modifierStart := p.pos
-		for _, modifier := range modifiers {
-			if p.matchKeyword(modifier) {
-				foundModifier = true
-				p.pos += len(modifier)
-				p.skipWhitespace()
-				break
-			}
-		}
-
-		if !foundModifier {
-			p.advance(1)
-			continue
-		}
-
-		// After a modifier, check if we have '<' (generic method)
-		if p.current() != '<' {
-			// Not a generic method, continue
-			continue
-		}
-
-		// Found potential generic method: modifier <TypeParams>
-		beforeAngleBracket := p.pos
-
-		// Try to parse type parameters
-		p.advance(1) // skip '<'
-		typeParams, err := p.parseTypeParameterList()
-		if err != nil {
-			// Not valid type parameters, continue
-			p.pos = beforeAngleBracket + 1
-			continue
-		}
-
-		// After type parameters, we should have return type and method name
-		p.skipWhitespace()
-
-		// Skip over return type (can be complex) to find method name
-		if !p.skipToMethodName() {
-			continue
-		}
-
-		// Parse method name
-		methodName := p.parseIdentifier()
-		if methodName == "" {
-			continue
-		}
-
-		p.skipWhitespace()
-
-		// Expect '(' for method parameters
-		if p.current() != '(' {
-			continue
-		}
-
-		// Advance past the opening '('
-		p.advance(1)
-
-		// Skip to end of parameters
-		if !p.skipToClosingParen() {
-			continue
-		}
-
-		p.advance(1) // skip ')'
-		p.skipWhitespace()
-
-		// Expect '{' for method body
-		if p.current() != '{' {
-			continue
-		}
-
-		// Extract signature (from start of modifiers to opening brace)
-		signatureEnd := p.pos
-		signature := strings.TrimSpace(p.input[modifierStart:signatureEnd])
-
-		// Extract method body
-		body, endPos := p.extractMethodBody()
-
-		key := className + "." + methodName
-		definitions[key] = &GenericMethodDef{
-			ClassName:  className,
-			MethodName: methodName,
-			TypeParams: typeParams,
-			Signature:  signature,
-			Body:       body,
-			StartPos:   modifierStart,
-			EndPos:     endPos,
+	var methods []*MethodDecl
+	var collect func(types []*TypeDecl)
+	collect = func(types []*TypeDecl) {
+		for _, decl := range types {
+			methods = append(methods, decl.Methods...)
+			collect(decl.Types)
 		}
 	}
+	methods = append(methods, file.Methods...)
+	collect(file.Types)
+	slices.SortFunc(methods, func(a, b *MethodDecl) int { return a.Start - b.Start })
 
-	p.pos = originalPos
-	return definitions, nil
-}
-
-// parseTypeParameterList parses a comma-separated list of type parameters
-// Expects to be positioned after the opening '<'
-func (p *Parser) parseTypeParameterList() ([]string, error) {
-	var params []string
-
-	for {
-		p.skipWhitespace()
-
-		// Parse type parameter name
-		param := p.parseIdentifier()
-		if param == "" {
-			return nil, fmt.Errorf("expected type parameter name")
-		}
-
-		// Validate single-letter constraint
-		if len(param) != 1 {
-			return nil, p.createError(p.pos-len(param), fmt.Sprintf("type parameter must be a single letter, got: %s", param))
-		}
-
-		params = append(params, param)
-		p.skipWhitespace()
-
-		// Check for '>' or ','
-		if p.current() == '>' {
-			p.advance(1) // skip '>'
-			break
-		} else if p.current() == ',' {
-			p.advance(1) // skip ','
+	definitions := make(map[string]*GenericMethodDef)
+	for _, method := range methods {
+		if method.TypeParams == nil {
 			continue
-		} else {
-			return nil, p.createError(p.pos, "expected '>' or ','")
 		}
-	}
-
-	return params, nil
-}
-
-// skipToMethodName skips over the return type to find the method name
-// This is a heuristic: we skip until we find an identifier followed by '('
-func (p *Parser) skipToMethodName() bool {
-	depth := 0
-	for p.pos < len(p.input) {
-		p.skipWhitespace()
-
-		if p.current() == '<' {
-			depth++
-			p.advance(1)
-		} else if p.current() == '>' {
-			depth--
-			p.advance(1)
-		} else if depth == 0 && (unicode.IsLetter(rune(p.current())) || p.current() == '_') {
-			// Found potential identifier at depth 0
-			// Save position and try to parse identifier
-			savedPos := p.pos
-			identifier := p.parseIdentifier()
-			if identifier == "" {
-				return false
-			}
-
-			// Check what comes after the identifier (skip whitespace)
-			p.skipWhitespace()
-
-			if p.current() == '(' {
-				// This is the method name! Restore position to start of identifier
-				p.pos = savedPos
-				return true
-			}
-
-			// Not the method name (might be return type like "Map"), continue searching
-			// Position is already advanced past the identifier
-		} else if p.current() == '(' {
-			// Reached parameters without finding method name
-			return false
-		} else {
-			p.advance(1)
-		}
-	}
-	return false
-}
-
-// skipToClosingParen skips to the closing parenthesis, handling nested parens
-func (p *Parser) skipToClosingParen() bool {
-	depth := 1
-	for p.pos < len(p.input) {
-		if p.current() == '(' {
-			depth++
-		} else if p.current() == ')' {
-			depth--
-			if depth == 0 {
-				return true
-			}
-		}
-		p.advance(1)
-	}
-	return false
-}
-
-// extractMethodBody extracts the method body from current position
-// Expects to be positioned at the opening '{'
-func (p *Parser) extractMethodBody() (string, int) {
-	if p.current() != '{' {
-		return "", p.pos
-	}
-
-	startBody := p.pos
-	p.advance(1) // skip '{'
-
-	// Find matching closing brace
-	braceCount := 1
-	for p.pos < len(p.input) && braceCount > 0 {
-		if p.current() == '{' {
-			braceCount++
-		} else if p.current() == '}' {
-			braceCount--
+		line, _ := p.getLineAndColumn(method.Start)
+		docLine := 0
+		if method.DocComment != "" {
+			docLine, _ = p.getLineAndColumn(method.DocStart)
+		}
+		definitions[className+"."+method.Name] = &GenericMethodDef{
+			ClassName:   className,
+			MethodName:  method.Name,
+			TypeParams:  method.TypeParams,
+			Signature:   strings.TrimSpace(p.input[method.Start:method.BodyStart]),
+			Body:        p.input[method.BodyStart:method.End],
+			StartPos:    method.Start,
+			EndPos:      method.End,
+			Line:        line,
+			DocComment:  method.DocComment,
+			DocLine:     docLine,
+			Annotations: method.Annotations,
 		}
-		p.advance(1)
 	}
-
-	endBody := p.pos
-	return p.input[startBody:endBody], endBody
+	return definitions, nil
 }
@@ -1,6 +1,9 @@
 package parser
 
 import (
+	"errors"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -102,6 +105,44 @@ func TestFindGenerics(t *testing.T) {
 			input:    "List<String> list; Set<Integer> set; Map<String, Integer> map;",
 			expected: map[string]string{},
 		},
+		{
+			name:  "built-in types in any casing",
+			input: "LIST<Foo<Integer>> foos; map<String, Integer> m; SET<Id> ids;",
+			expected: map[string]string{
+				"Foo<Integer>": "FooInteger",
+			},
+		},
+		{
+			name:     "ignore built-in Comparator",
+			input:    "public class ByName implements Comparator<Account> {}",
+			expected: map[string]string{},
+		},
+		{
+			name:  "ignore Apex system generics",
+			input: "public class Rows implements Iterable<Row<Id>>, Database.Batchable<SObject> { public Iterator<Id> iterator() {} }",
+			expected: map[string]string{
+				"Row<Id>": "RowId",
+			},
+		},
+		{
+			name:  "generics nested in built-in types",
+			input: "List<Foo<Integer>> foos; Comparator<Bar<String>> c; Map<String, Set<Baz<Id>>> m;",
+			expected: map[string]string{
+				"Foo<Integer>": "FooInteger",
+				"Bar<String>":  "BarString",
+				"Baz<Id>":      "BazId",
+			},
+		},
+		{
+			name:  "array type arguments",
+			input: "Foo<Account[]> a; Foo<Bar<Id>[] > b; Foo<Integer>[] c;",
+			expected: map[string]string{
+				"Foo<Account[]>":  "FooListAccount",
+				"Foo<Bar<Id>[] >": "FooListBarId",
+				"Bar<Id>":         "BarId",
+				"Foo<Integer>":    "FooInteger",
+			},
+		},
 		{
 			name:     "ignore comparison operators",
 			input:    "if (x < 5) { return true; }",
@@ -176,6 +217,12 @@ func TestGenerateConcreteClassName(t *testing.T) {
 			baseType: "Map",
 			expected: "MapStringListInteger",
 		},
+		{
+			name:     "namespaced type",
+			input:    "<Schema.Account>",
+			baseType: "Queue",
+			expected: "QueueSchemaAccount",
+		},
 	}
 
 	for _, tt := range tests {
@@ -242,7 +289,11 @@ func TestParseError(t *testing.T) {
 			}
 			p.pos = tt.pos
 
-			err := p.createError(tt.pos, tt.message)
+			err := p.createError(tt.pos, CodeSyntax, tt.message)
+
+			if err.Code != CodeSyntax {
+				t.Errorf("expected code %s, got %q", CodeSyntax, err.Code)
+			}
 
 			if err.Message != tt.message {
 				t.Errorf("expected message %q, got %q", tt.message, err.Message)
@@ -274,6 +325,9 @@ func TestParseError(t *testing.T) {
 			if !strings.Contains(formatted, tt.message) {
 				t.Errorf("FormatError() should contain message %q", tt.message)
 			}
+			if !strings.Contains(formatted, "error: "+CodeSyntax+": ") {
+				t.Errorf("FormatError() should contain code %s, got %q", CodeSyntax, formatted)
+			}
 		})
 	}
 }
@@ -525,7 +579,7 @@ func TestCollectNestedGenerics(t *testing.T) {
 	}
 
 	generics := make(map[string]*GenericExpr)
-	collectNestedGenerics(expr, generics)
+	NewParser("").collectNestedGenerics(expr, generics)
 
 	// Should collect Middle<Inner<Integer>> and Inner<Integer>
 	if len(generics) < 2 {
@@ -567,7 +621,7 @@ func TestCollectNestedGenerics_BuiltInIgnored(t *testing.T) {
 	}
 
 	generics := make(map[string]*GenericExpr)
-	collectNestedGenerics(expr, generics)
+	NewParser("").collectNestedGenerics(expr, generics)
 
 	// Should not collect List<Integer> because List is built-in
 	for key := range generics {
@@ -631,6 +685,11 @@ func TestIsBuiltInGeneric(t *testing.T) {
 		{"List", true},
 		{"Set", true},
 		{"Map", true},
+		{"Comparator", true},
+		{"Iterable", true},
+		{"Iterator", true},
+		{"Database.Batchable", true},
+		{"Batchable", false},
 		{"Queue", false},
 		{"String", false},
 		{"Integer", false},
@@ -638,7 +697,7 @@ func TestIsBuiltInGeneric(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.typeName, func(t *testing.T) {
-			result := isBuiltInGeneric(tt.typeName)
+			result := NewParser("").isBuiltInGeneric(tt.typeName)
 			if result != tt.expected {
 				t.Errorf("isBuiltInGeneric(%q) = %v, expected %v", tt.typeName, result, tt.expected)
 			}
@@ -646,13 +705,41 @@ func TestIsBuiltInGeneric(t *testing.T) {
 	}
 }
 
+func TestFindGenerics_BuiltInGenerics(t *testing.T) {
+	input := "Iterable<Account> a; Database.Batchable<SObject> b; Map<String, Id> m; List<Foo<Id>> f;"
+	p := NewParser(input)
+	p.SetBuiltInGenerics(map[string]int{"iterable": 1, "Database.Batchable": 1, "List": 1})
+
+	generics, err := p.FindGenerics()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var found []string
+	for text := range generics {
+		found = append(found, text)
+	}
+	sort.Strings(found)
+	// Map is not built in once the list is replaced, Batchable is only by its qualified name
+	expected := []string{"Foo<Id>", "Map<String, Id>"}
+	if strings.Join(found, "; ") != strings.Join(expected, "; ") {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+
+	if arity, ok := p.BuiltInArity("DATABASE.BATCHABLE"); !ok || arity != 1 {
+		t.Errorf("expected Database.Batchable to take 1 type argument, got %d, %v", arity, ok)
+	}
+	if _, ok := NewParser("").BuiltInArity("Pair"); ok {
+		t.Error("expected Pair not to be built in by default")
+	}
+}
+
 func TestFormatError_WithTab(t *testing.T) {
 	// Test FormatError with tab character in source line
 	input := "hello\tworld"
 	p := NewParser(input)
 	p.SetFileName("test.peak")
 
-	err := p.createError(6, "error at tab position")
+	err := p.createError(6, CodeSyntax, "error at tab position")
 	formatted := err.FormatError()
 
 	if !strings.Contains(formatted, "test.peak") {
@@ -666,6 +753,67 @@ func TestFormatError_WithTab(t *testing.T) {
 	}
 }
 
+func TestFormatError_Span(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		parse    func(p *Parser) error
+		start    int
+		end      int
+		expected string
+	}{
+		{
+			name:  "type parameter list",
+			input: "public class Bad<Item, U> {\n}",
+			parse: func(p *Parser) error {
+				_, err := p.FindGenericClassDefinitions()
+				return err
+			},
+			start:    17,
+			end:      26,
+			expected: "public class Bad<Item, U> {\n                ~^~~~~~~~\n",
+		},
+		{
+			name:  "unclosed type parameter list",
+			input: "public class Bad<T U {\n}",
+			parse: func(p *Parser) error {
+				_, err := p.FindGenericClassDefinitions()
+				return err
+			},
+			start:    17,
+			end:      21,
+			expected: "public class Bad<T U {\n                ~~~^\n",
+		},
+		{
+			name:  "generic expression",
+			input: "x = Foo<Integer,>;",
+			parse: func(p *Parser) error {
+				p.pos = strings.IndexByte(p.input, '<')
+				_, err := p.ParseGeneric("Foo")
+				return err
+			},
+			start:    5,
+			end:      18,
+			expected: "x = Foo<Integer,>;\n    ~~~~~~~~~~~~^\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.parse(NewParser(tt.input))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.StartColumn != tt.start || parseErr.EndColumn != tt.end {
+				t.Errorf("expected the span %d-%d, got %d-%d", tt.start, tt.end, parseErr.StartColumn, parseErr.EndColumn)
+			}
+			if formatted := parseErr.FormatError(); !strings.HasSuffix(formatted, tt.expected) {
+				t.Errorf("expected the source line and pointer %q, got:\n%s", tt.expected, formatted)
+			}
+		})
+	}
+}
+
 func TestParseGeneric_Errors(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -762,63 +910,6 @@ func TestFindGenerics_EdgeCases(t *testing.T) {
 	}
 }
 
-func TestMatchKeyword_EdgeCases(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		keyword  string
-		pos      int
-		expected bool
-	}{
-		{
-			name:     "at start of input",
-			input:    "class Foo",
-			keyword:  "class",
-			pos:      0,
-			expected: true,
-		},
-		{
-			name:     "at end of input",
-			input:    "public class",
-			keyword:  "class",
-			pos:      7,
-			expected: true,
-		},
-		{
-			name:     "not at word boundary (prefix)",
-			input:    "myclass Foo",
-			keyword:  "class",
-			pos:      2,
-			expected: false,
-		},
-		{
-			name:     "not at word boundary (suffix)",
-			input:    "class2",
-			keyword:  "class",
-			pos:      0,
-			expected: false,
-		},
-		{
-			name:     "keyword too long for remaining input",
-			input:    "cl",
-			keyword:  "class",
-			pos:      0,
-			expected: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := NewParser(tt.input)
-			p.pos = tt.pos
-			result := p.matchKeyword(tt.keyword)
-			if result != tt.expected {
-				t.Errorf("matchKeyword(%q) at pos %d = %v, expected %v", tt.keyword, tt.pos, result, tt.expected)
-			}
-		})
-	}
-}
-
 func TestParseTypeParameters_AdditionalErrors(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -854,40 +945,6 @@ func TestParseTypeParameters_AdditionalErrors(t *testing.T) {
 	}
 }
 
-func TestExtractClassBody_EdgeCases(t *testing.T) {
-	tests := []struct {
-		name         string
-		input        string
-		expectedBody string
-	}{
-		{
-			name:         "nested braces",
-			input:        "{ public void method() { if (true) { } } }",
-			expectedBody: "{ public void method() { if (true) { } } }",
-		},
-		{
-			name:         "no opening brace found",
-			input:        "no braces here",
-			expectedBody: "",
-		},
-		{
-			name:         "empty body",
-			input:        "{}",
-			expectedBody: "{}",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := NewParser(tt.input)
-			body, _ := p.extractClassBody()
-			if body != tt.expectedBody {
-				t.Errorf("expected body %q, got %q", tt.expectedBody, body)
-			}
-		})
-	}
-}
-
 func TestParseTypeArgument_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -925,50 +982,6 @@ func TestParseTypeArgument_EdgeCases(t *testing.T) {
 	}
 }
 
-func TestSkipComments(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected byte // expected character after skipping
-	}{
-		{
-			name:     "single line comment",
-			input:    "// this is a comment\ncode",
-			expected: 'c',
-		},
-		{
-			name:     "multi-line comment",
-			input:    "/* this is\n a multi-line\n comment */code",
-			expected: 'c',
-		},
-		{
-			name:     "no comment",
-			input:    "code",
-			expected: 'c',
-		},
-		{
-			name:     "multiple single-line comments",
-			input:    "// comment 1\n// comment 2\ncode",
-			expected: 'c',
-		},
-		{
-			name:     "comment at end",
-			input:    "// comment at end",
-			expected: 0, // EOF
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := NewParser(tt.input)
-			p.skipComments()
-			if p.current() != tt.expected {
-				t.Errorf("expected '%c', got '%c'", tt.expected, p.current())
-			}
-		})
-	}
-}
-
 func TestFindGenerics_WithComments(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1071,3 +1084,284 @@ public class RealQueue<T> {
 		})
 	}
 }
+
+func TestParseError_Codes(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+	}{
+		{"public class Queue<T, T> {}", CodeDuplicateTypeParam},
+		{"public class Queue<Type> {}", CodeInvalidTypeParam},
+		{"public class Queue<<T> {}", CodeShiftInTypeParams},
+		{"public class Queue<T U> {}", CodeSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := NewParser(tt.input).FindGenericClassDefinitions()
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected *ParseError, got %v", err)
+			}
+			if parseErr.Code != tt.code {
+				t.Errorf("expected code %s, got %q (%s)", tt.code, parseErr.Code, parseErr.Message)
+			}
+		})
+	}
+}
+
+func TestParseTypeArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // String() of each argument; nil for an error
+	}{
+		{"Integer", []string{"Integer"}},
+		{"String, Integer", []string{"String", "Integer"}},
+		{" Map<String,List<Integer>> ", []string{"Map<String, List<Integer>>"}},
+		{"Schema.Account, ns__Widget__c", []string{"Schema.Account", "ns__Widget__c"}},
+		{"Account[], Integer [ ] []", []string{"List<Account>", "List<List<Integer>>"}},
+		{"Account[", nil},
+		{"", nil},
+		{"String,", nil},
+		{"List<String", nil},
+		{"String> x", nil},
+		{"Schema.", nil},
+	}
+
+	for _, tt := range tests {
+		args, err := ParseTypeArguments(tt.input)
+		if tt.expected == nil {
+			if err == nil {
+				t.Errorf("ParseTypeArguments(%q): expected error, got %v", tt.input, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTypeArguments(%q): unexpected error: %v", tt.input, err)
+			continue
+		}
+		var got []string
+		for _, arg := range args {
+			got = append(got, arg.String())
+		}
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("ParseTypeArguments(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestFindGenericMethodDefinitions_DocComment(t *testing.T) {
+	input := `public class Repository {
+    /**
+     * Returns a cached value.
+     */
+    @TestVisible
+    public <T> T get(String key) {
+        return (T) cache.get(key);
+    }
+
+    /* Not a doc comment */
+    public <T> void put(String key, T value) {
+        cache.put(key, value);
+    }
+}`
+
+	methods, err := NewParser(input).FindGenericMethodDefinitions("Repository")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get := methods["Repository.get"]
+	if get == nil {
+		t.Fatal("expected Repository.get")
+	}
+	if expected := "/**\n     * Returns a cached value.\n     */"; get.DocComment != expected {
+		t.Errorf("expected doc comment %q, got %q", expected, get.DocComment)
+	}
+	if get.DocLine != 2 || get.Line != 6 {
+		t.Errorf("expected doc comment at line 2 and method at line 6, got %d and %d", get.DocLine, get.Line)
+	}
+	if put := methods["Repository.put"]; put == nil || put.DocComment != "" || put.DocLine != 0 {
+		t.Errorf("expected put without a doc comment, got %+v", put)
+	}
+}
+
+func TestFindGenericMethodDefinitions_Annotations(t *testing.T) {
+	input := `public class Repository {
+    @TestVisible
+    @PeakVisibility(private, TestVisible) public static <T> T get(String key) {
+        return (T) cache.get(key);
+    }
+
+    public void reset() {}
+    public <T> void put(String key, T value) {
+        cache.put(key, value);
+    }
+}`
+
+	methods, err := NewParser(input).FindGenericMethodDefinitions("Repository")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get := methods["Repository.get"]
+	if get == nil {
+		t.Fatal("expected Repository.get")
+	}
+	if expected := []string{"@TestVisible", "@PeakVisibility(private, TestVisible)"}; !reflect.DeepEqual(get.Annotations, expected) {
+		t.Errorf("expected annotations %q, got %q", expected, get.Annotations)
+	}
+	if expected := "public static <T> T get(String key)"; get.Signature != expected {
+		t.Errorf("expected signature %q, got %q", expected, get.Signature)
+	}
+	if put := methods["Repository.put"]; put == nil || put.Annotations != nil {
+		t.Errorf("expected put without annotations, got %+v", put)
+	}
+}
+
+func TestGenerateConcreteMethodName(t *testing.T) {
+	tests := []struct {
+		typeArgs []string
+		expected string
+	}{
+		{nil, "get"},
+		{[]string{"Account"}, "getAccount"},
+		{[]string{"String", "Integer"}, "getStringInteger"},
+		{[]string{"Map<String, Integer>"}, "getMapStringInteger"},
+		{[]string{"Schema.Account"}, "getSchemaAccount"},
+	}
+	for _, tt := range tests {
+		if got := GenerateConcreteMethodName("get", tt.typeArgs); got != tt.expected {
+			t.Errorf("GenerateConcreteMethodName(get, %v) = %s, expected %s", tt.typeArgs, got, tt.expected)
+		}
+	}
+}
+
+func TestFindGenericClassDefinitions_Annotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		modifiers   string
+		annotations []string
+	}{
+		{
+			name:        "none",
+			input:       "public class Queue<T> { }",
+			modifiers:   "public",
+			annotations: nil,
+		},
+		{
+			name:        "bare annotation",
+			input:       "@PeakDto\npublic class Queue<T> { }",
+			modifiers:   "public",
+			annotations: []string{"@PeakDto"},
+		},
+		{
+			name:        "annotation with arguments",
+			input:       "@PeakDto @JsonAccess(serializable='always')\nglobal with sharing class Queue<T> { }",
+			modifiers:   "global with sharing",
+			annotations: []string{"@PeakDto", "@JsonAccess(serializable='always')"},
+		},
+		{
+			name:        "annotation of an earlier declaration",
+			input:       "@IsTest\nprivate static void check() { }\npublic class Queue<T> { }",
+			modifiers:   "public",
+			annotations: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := NewParser(tt.input).FindGenericClassDefinitions()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			def := defs["Queue"]
+			if def == nil {
+				t.Fatal("expected Queue<T> to be found")
+			}
+			if def.Modifiers != tt.modifiers {
+				t.Errorf("expected modifiers %q, got %q", tt.modifiers, def.Modifiers)
+			}
+			if !reflect.DeepEqual(def.Annotations, tt.annotations) {
+				t.Errorf("expected annotations %q, got %q", tt.annotations, def.Annotations)
+			}
+		})
+	}
+}
+
+func TestFindGenericClassDefinitions_Supertypes(t *testing.T) {
+	tests := []struct {
+		input      string
+		supertypes string
+	}{
+		{"public class Queue<T> { }", ""},
+		{"public class Queue<T> extends Base { }", "extends Base"},
+		{"public class Queue<T>\n    extends Base\n    implements Iterable<T>, Foo {\n}", "extends Base\n    implements Iterable<T>, Foo"},
+	}
+	for _, tt := range tests {
+		defs, err := NewParser(tt.input).FindGenericClassDefinitions()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := defs["Queue"].Supertypes; got != tt.supertypes {
+			t.Errorf("expected supertypes %q, got %q", tt.supertypes, got)
+		}
+	}
+}
+
+func TestFindGenericClassDefinitions_ErrorRecovery(t *testing.T) {
+	input := `public class Queue<T, T> {
+    public class Inner<U V> {
+        public <A, A> void first() { }
+    }
+
+    public <Type> void second() { }
+
+    public <K> void valid(K key) { }
+
+    private class Pair<P>> { }
+
+    @TestVisible <X, X> Map<X, X> third() { return null; }
+
+    private class Node<N> { }
+}`
+
+	_, err := NewParser(input).FindGenericClassDefinitions()
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ParseErrors, got %v", err)
+	}
+
+	type position struct {
+		code string
+		line int
+	}
+	var got []position
+	for _, e := range errs {
+		got = append(got, position{e.Code, e.Line})
+	}
+	expected := []position{
+		{CodeDuplicateTypeParam, 1},
+		{CodeSyntax, 2},
+		{CodeDuplicateTypeParam, 3},
+		{CodeInvalidTypeParam, 6},
+		{CodeShiftInTypeParams, 10},
+		{CodeDuplicateTypeParam, 12},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected errors %v, got %v", expected, got)
+	}
+
+	var first *ParseError
+	if !errors.As(err, &first) || first != errs[0] {
+		t.Error("expected errors.As to find the first error")
+	}
+	if split := SplitErrors(err); len(split) != len(expected) {
+		t.Errorf("expected %d errors from SplitErrors, got %d", len(expected), len(split))
+	}
+
+	// A single error is returned as is
+	_, err = NewParser("public class Queue<T> {\n    public <K, K> void m() { }\n}").FindGenericClassDefinitions()
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a single *ParseError, got %T", err)
+	}
+}
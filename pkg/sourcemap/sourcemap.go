@@ -0,0 +1,173 @@
+// Package sourcemap records how generated Apex lines correspond to Peak sources.
+//
+// A map is written as a ".peak.map" sidecar next to each generated .cls file.
+// It is used to translate Apex stack traces, which refer to generated classes,
+// back to locations in .peak templates and source files.
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is the current map file format version
+const Version = 1
+
+// Extension is the file extension of source map sidecars
+const Extension = ".peak.map"
+
+// Segment maps a run of consecutive generated lines to consecutive source lines
+type Segment struct {
+	Generated int `json:"generated"` // First generated line (1-based)
+	Source    int `json:"source"`    // Source line of the first generated line (1-based)
+	Count     int `json:"count"`     // Number of lines in the run
+}
+
+// Map describes one generated class
+type Map struct {
+	Version       int       `json:"version"`
+	Class         string    `json:"class"`                   // Generated class name, e.g. "QueueInteger"
+	Source        string    `json:"source"`                  // Peak file, relative to the map file's directory
+	Instantiation string    `json:"instantiation,omitempty"` // Generic expression for concrete classes, e.g. "Queue<Integer>"
+	Lines         []Segment `json:"lines"`
+
+	dir string // Directory the map was loaded from (used to resolve Source)
+}
+
+// New builds a map from a per-line table, where sourceLines[i] is the source line
+// of generated line i+1 and 0 marks lines with no source counterpart.
+func New(class, source, instantiation string, sourceLines []int) *Map {
+	m := &Map{
+		Version:       Version,
+		Class:         class,
+		Source:        filepath.ToSlash(source),
+		Instantiation: instantiation,
+		Lines:         []Segment{},
+	}
+
+	for i, line := range sourceLines {
+		if line == 0 {
+			continue
+		}
+		generated := i + 1
+		if n := len(m.Lines); n > 0 {
+			last := &m.Lines[n-1]
+			if last.Generated+last.Count == generated && last.Source+last.Count == line {
+				last.Count++
+				continue
+			}
+		}
+		m.Lines = append(m.Lines, Segment{Generated: generated, Source: line, Count: 1})
+	}
+
+	return m
+}
+
+// Lookup returns the source line for a generated line, or 0 if it has none
+func (m *Map) Lookup(generated int) int {
+	for _, seg := range m.Lines {
+		if generated >= seg.Generated && generated < seg.Generated+seg.Count {
+			return seg.Source + generated - seg.Generated
+		}
+	}
+	return 0
+}
+
+// SourcePath returns the source path resolved against the directory the map was loaded from
+func (m *Map) SourcePath() string {
+	if m.dir == "" || filepath.IsAbs(m.Source) {
+		return filepath.FromSlash(m.Source)
+	}
+	return filepath.Join(m.dir, filepath.FromSlash(m.Source))
+}
+
+// Write writes the map as JSON to path
+func (m *Map) Write(path string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // Keep "Queue<Integer>" readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Load reads a map file
+func Load(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Map
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid source map %s: %w", path, err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported source map version %d in %s", m.Version, path)
+	}
+	m.dir = filepath.Dir(path)
+	return &m, nil
+}
+
+// PathFor returns the sidecar path for a generated .cls file
+func PathFor(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + Extension
+}
+
+// stackFramePattern matches Apex stack frames such as
+// "Class.QueueInteger.enqueue: line 5, column 1" or "Class.ns.QueueInteger: line 3, column 12"
+var stackFramePattern = regexp.MustCompile(`Class\.([A-Za-z0-9_.]+): line (\d+), column (\d+)`)
+
+// RewriteStackTrace rewrites Apex stack frames that refer to mapped classes so that
+// their location points at the Peak source, e.g.
+// "Class.QueueInteger.enqueue: line 5, column 1" becomes
+// "Class.QueueInteger.enqueue: src/Queue.peak:12:1 (Queue<Integer>)".
+// Maps are keyed by class name; lookups are case-insensitive like Apex itself.
+// Source paths are shown relative to relativeTo when they lie beneath it.
+// Frames for unknown classes are left unchanged.
+func RewriteStackTrace(trace string, maps map[string]*Map, relativeTo string) string {
+	byName := make(map[string]*Map, len(maps))
+	for name, m := range maps {
+		byName[strings.ToLower(name)] = m
+	}
+
+	return stackFramePattern.ReplaceAllStringFunc(trace, func(frame string) string {
+		match := stackFramePattern.FindStringSubmatch(frame)
+		line, _ := strconv.Atoi(match[2])
+
+		// The class may be preceded by a namespace and followed by inner classes
+		// and methods, so try every segment
+		for _, segment := range strings.Split(match[1], ".") {
+			m, ok := byName[strings.ToLower(segment)]
+			if !ok {
+				continue
+			}
+			sourceLine := m.Lookup(line)
+			if sourceLine == 0 {
+				return frame
+			}
+
+			source := m.SourcePath()
+			if relativeTo != "" {
+				// Prefer short relative paths, but not ones that climb out of relativeTo
+				if rel, err := filepath.Rel(relativeTo, source); err == nil && !strings.HasPrefix(rel, "..") {
+					source = rel
+				}
+			}
+			location := fmt.Sprintf("%s:%d:%s", source, sourceLine, match[3])
+			if m.Instantiation != "" {
+				location += " (" + m.Instantiation + ")"
+			}
+			return "Class." + match[1] + ": " + location
+		}
+		return frame
+	})
+}
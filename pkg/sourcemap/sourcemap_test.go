@@ -0,0 +1,135 @@
+package sourcemap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew_Segments(t *testing.T) {
+	m := New("QueueInteger", "Queue.peak", "Queue<Integer>", []int{3, 4, 5, 0, 9, 10})
+
+	if len(m.Lines) != 2 {
+		t.Fatalf("expected 2 segments, got %d: %+v", len(m.Lines), m.Lines)
+	}
+	if m.Lines[0] != (Segment{Generated: 1, Source: 3, Count: 3}) {
+		t.Errorf("unexpected first segment: %+v", m.Lines[0])
+	}
+	if m.Lines[1] != (Segment{Generated: 5, Source: 9, Count: 2}) {
+		t.Errorf("unexpected second segment: %+v", m.Lines[1])
+	}
+}
+
+func TestLookup(t *testing.T) {
+	m := New("QueueInteger", "Queue.peak", "Queue<Integer>", []int{3, 4, 5, 0, 9, 10})
+
+	tests := []struct {
+		generated int
+		want      int
+	}{
+		{1, 3},
+		{3, 5},
+		{4, 0},
+		{6, 10},
+		{7, 0},
+	}
+	for _, tt := range tests {
+		if got := m.Lookup(tt.generated); got != tt.want {
+			t.Errorf("Lookup(%d) = %d, want %d", tt.generated, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "QueueInteger"+Extension)
+
+	m := New("QueueInteger", "../src/Queue.peak", "Queue<Integer>", []int{1, 2})
+	if err := m.Write(path); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Class != "QueueInteger" || loaded.Instantiation != "Queue<Integer>" {
+		t.Errorf("unexpected map: %+v", loaded)
+	}
+	if want := filepath.Join(dir, "..", "src", "Queue.peak"); loaded.SourcePath() != want {
+		t.Errorf("SourcePath() = %s, want %s", loaded.SourcePath(), want)
+	}
+}
+
+func TestLoad_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "X"+Extension)
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
+
+func TestPathFor(t *testing.T) {
+	if got := PathFor(filepath.Join("out", "QueueInteger.cls")); got != filepath.Join("out", "QueueInteger.peak.map") {
+		t.Errorf("unexpected sidecar path: %s", got)
+	}
+}
+
+func TestRewriteStackTrace(t *testing.T) {
+	maps := map[string]*Map{
+		"QueueInteger": New("QueueInteger", "Queue.peak", "Queue<Integer>", []int{2, 3, 4, 5, 6}),
+		"QueueExample": New("QueueExample", "QueueExample.peak", "", []int{1, 2, 3, 4}),
+	}
+
+	tests := []struct {
+		name  string
+		trace string
+		want  string
+	}{
+		{
+			name:  "concrete class frame",
+			trace: "Class.QueueInteger.enqueue: line 4, column 1",
+			want:  "Class.QueueInteger.enqueue: Queue.peak:5:1 (Queue<Integer>)",
+		},
+		{
+			name:  "transpiled class frame",
+			trace: "Class.QueueExample: line 2, column 9",
+			want:  "Class.QueueExample: QueueExample.peak:2:9",
+		},
+		{
+			name:  "namespaced frame",
+			trace: "Class.acme.QueueInteger.dequeue: line 1, column 5",
+			want:  "Class.acme.QueueInteger.dequeue: Queue.peak:2:5 (Queue<Integer>)",
+		},
+		{
+			name:  "case-insensitive class name",
+			trace: "Class.queueinteger.enqueue: line 1, column 1",
+			want:  "Class.queueinteger.enqueue: Queue.peak:2:1 (Queue<Integer>)",
+		},
+		{
+			name:  "unknown class left unchanged",
+			trace: "Class.AccountService.run: line 7, column 1",
+			want:  "Class.AccountService.run: line 7, column 1",
+		},
+		{
+			name:  "unmapped line left unchanged",
+			trace: "Class.QueueInteger.enqueue: line 40, column 1",
+			want:  "Class.QueueInteger.enqueue: line 40, column 1",
+		},
+		{
+			name:  "multi-line trace",
+			trace: "Class.QueueInteger.enqueue: line 4, column 1\nAnonymousBlock: line 1, column 1",
+			want:  "Class.QueueInteger.enqueue: Queue.peak:5:1 (Queue<Integer>)\nAnonymousBlock: line 1, column 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RewriteStackTrace(tt.trace, maps, ""); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package templatecache persists parsed templates on disk between runs, so cold
+// starts on large template libraries skip re-parsing files that have not changed.
+//
+// Entries are keyed by the SHA-256 of a file's content, so renaming or moving a
+// file does not invalidate it. The cache file is versioned and discarded whole
+// when the version does not match.
+package templatecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/ipavlic/peak/pkg/parser"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+// Version is bumped whenever the cached structures or the parser's output change
+const Version = 4
+
+// FileName is the name of the cache file within the cache directory
+const FileName = "templates.json"
+
+// Cache is an on-disk transpiler.TemplateCache. It is not safe for concurrent use.
+type Cache struct {
+	path    string
+	entries map[string]*transpiler.ParsedTemplates // Content hash to parsed templates
+	used    map[string]bool                        // Entries read or written since Load
+	dirty   bool
+}
+
+type cacheFile struct {
+	Version int                                    `json:"version"`
+	Entries map[string]*transpiler.ParsedTemplates `json:"entries"`
+}
+
+// Load opens the cache in dir. A missing, unreadable, or outdated cache file
+// yields an empty cache rather than an error, since the cache is only an optimization.
+func Load(dir string) *Cache {
+	c := &Cache{
+		path:    filepath.Join(dir, FileName),
+		entries: make(map[string]*transpiler.ParsedTemplates),
+		used:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != Version {
+		c.dirty = true // Rewrite the unusable file on Save
+		return c
+	}
+	for key, parsed := range file.Entries {
+		if parsed != nil {
+			c.entries[key] = parsed
+		}
+	}
+	return c
+}
+
+// Get returns a copy of the templates cached for content
+func (c *Cache) Get(content string) (*transpiler.ParsedTemplates, bool) {
+	key := hashContent(content)
+	parsed, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.used[key] = true
+	return copyParsed(parsed), true
+}
+
+// Put caches a copy of the templates parsed from content
+func (c *Cache) Put(content string, parsed *transpiler.ParsedTemplates) {
+	key := hashContent(content)
+	c.entries[key] = copyParsed(parsed)
+	c.used[key] = true
+	c.dirty = true
+}
+
+// Save writes the cache, dropping entries that were not used since Load so the
+// file does not grow as sources change. It does nothing if nothing changed.
+func (c *Cache) Save() error {
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(cacheFile{Version: Version, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so a concurrent run never reads a partial cache
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// copyParsed copies the definitions, which the transpiler may modify
+func copyParsed(parsed *transpiler.ParsedTemplates) *transpiler.ParsedTemplates {
+	out := &transpiler.ParsedTemplates{
+		Classes: make(map[string]*parser.GenericClassDef, len(parsed.Classes)),
+		Methods: make(map[string]*parser.GenericMethodDef, len(parsed.Methods)),
+	}
+	for name, def := range parsed.Classes {
+		d := *def
+		d.TypeParams = append([]string(nil), def.TypeParams...)
+		out.Classes[name] = &d
+	}
+	for key, def := range parsed.Methods {
+		d := *def
+		d.TypeParams = append([]string(nil), def.TypeParams...)
+		out.Methods[key] = &d
+	}
+	return out
+}
+
+// hashContent returns the hex-encoded SHA-256 of content
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package templatecache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/parser"
+	"github.com/ipavlic/peak/pkg/transpiler"
+)
+
+func queueTemplates() *transpiler.ParsedTemplates {
+	return &transpiler.ParsedTemplates{
+		Classes: map[string]*parser.GenericClassDef{
+			"Queue": {ClassName: "Queue", TypeParams: []string{"T"}, Modifiers: "public", Body: "{ List<T> items; }", BodyLine: 1},
+		},
+		Methods: map[string]*parser.GenericMethodDef{},
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	c := Load(dir)
+	c.Put("queue source", queueTemplates())
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := Load(dir)
+	parsed, ok := loaded.Get("queue source")
+	if !ok {
+		t.Fatal("expected cache hit after reload")
+	}
+	if def := parsed.Classes["Queue"]; def == nil || def.Body != "{ List<T> items; }" || def.BodyLine != 1 {
+		t.Errorf("unexpected cached template: %+v", parsed.Classes["Queue"])
+	}
+	if _, ok := loaded.Get("other source"); ok {
+		t.Error("expected cache miss for different content")
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	c := Load(t.TempDir())
+	c.Put("queue source", queueTemplates())
+
+	first, _ := c.Get("queue source")
+	first.Classes["Queue"].Body = ""
+
+	second, _ := c.Get("queue source")
+	if second.Classes["Queue"].Body == "" {
+		t.Error("modifying a returned template should not affect the cache")
+	}
+}
+
+func TestSavePrunesUnusedEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	c := Load(dir)
+	c.Put("old source", queueTemplates())
+	c.Put("kept source", queueTemplates())
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	c = Load(dir)
+	c.Get("kept source")
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	c = Load(dir)
+	if _, ok := c.Get("old source"); ok {
+		t.Error("expected unused entry to be pruned")
+	}
+	if _, ok := c.Get("kept source"); !ok {
+		t.Error("expected used entry to be kept")
+	}
+}
+
+func TestLoad_InvalidOrOutdated(t *testing.T) {
+	for name, content := range map[string]string{
+		"corrupt":  "{not json",
+		"outdated": `{"version": 0, "entries": {}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, FileName), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := Load(dir)
+			if len(c.entries) != 0 {
+				t.Errorf("expected empty cache, got %d entries", len(c.entries))
+			}
+			if err := c.Save(); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			if c := Load(dir); c.dirty {
+				t.Error("expected Save to replace the unusable file")
+			}
+		})
+	}
+}
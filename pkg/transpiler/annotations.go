@@ -0,0 +1,86 @@
+package transpiler
+
+import (
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// peakAnnotations are the annotations Peak understands on templates. They configure
+// code generation and are removed from generated classes and methods; other
+// annotations are copied.
+var peakAnnotations = []string{DTOAnnotation, ComparableAnnotation, OutputDirAnnotation, VisibilityAnnotation, PackageApiAnnotation}
+
+// annotationName returns the name of an annotation without its arguments, e.g. "@JsonAccess"
+func annotationName(annotation string) string {
+	name, _, _ := strings.Cut(annotation, "(")
+	return strings.TrimSpace(name)
+}
+
+// findAnnotation returns the comma-separated arguments of the template's annotation
+// called name, and whether the template has it. Annotations are case-insensitive in Apex.
+func findAnnotation(template *parser.GenericClassDef, name string) ([]string, bool) {
+	for _, annotation := range template.Annotations {
+		if !strings.EqualFold(annotationName(annotation), name) {
+			continue
+		}
+		_, rest, hasArgs := strings.Cut(annotation, "(")
+		if !hasArgs {
+			return nil, true
+		}
+		var args []string
+		for _, arg := range strings.Split(strings.TrimSuffix(strings.TrimSpace(rest), ")"), ",") {
+			if arg = strings.TrimSpace(arg); arg != "" {
+				args = append(args, arg)
+			}
+		}
+		return args, true
+	}
+	return nil, false
+}
+
+// classAnnotations returns the template's Apex annotations for a concrete class declaration,
+// on one line so that declaration lines keep matching the template. Peak's own
+// annotations are left out, and so is @IsTest for an inner class, which Apex only
+// allows on top-level classes.
+func classAnnotations(template *parser.GenericClassDef, inner bool) string {
+	var annotations []string
+	for _, annotation := range template.Annotations {
+		if isPeakAnnotation(annotation) || (inner && strings.EqualFold(annotationName(annotation), TestAnnotation)) {
+			continue
+		}
+		annotations = append(annotations, strings.Join(strings.Fields(annotation), " "))
+	}
+	return strings.Join(annotations, " ")
+}
+
+// methodAnnotations returns the Apex annotations of a generic method for its concrete
+// methods, on one line like those of classes, so that @AuraEnabled or @TestVisible
+// methods keep them. Peak's own annotations are left out.
+func methodAnnotations(method *parser.GenericMethodDef) string {
+	return classAnnotations(&parser.GenericClassDef{Annotations: method.Annotations}, false)
+}
+
+// isPeakAnnotation reports whether annotation is one of peakAnnotations
+func isPeakAnnotation(annotation string) bool {
+	name := annotationName(annotation)
+	for _, peak := range peakAnnotations {
+		if strings.EqualFold(name, peak) {
+			return true
+		}
+	}
+	return false
+}
+
+// insertGenerated inserts a generated method into the class in content, after a header
+// comment, and returns it with its line map: the method's lines are generated code,
+// and every other line keeps its entry from sourceLines.
+func insertGenerated(content string, sourceLines []int, header, method string) (string, []int) {
+	lines := insertedMethodLines(content, []string{method}, []int{0})
+	for i, line := range lines {
+		if line > 0 && line <= len(sourceLines) {
+			lines[i] = sourceLines[line-1]
+		}
+	}
+	return insertMembers(content, header, []string{method}), lines
+}
@@ -0,0 +1,57 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+func TestTranspileFiles_MethodAnnotations(t *testing.T) {
+	files := map[string]string{
+		"Repository.peak": `public class Repository {
+    @AuraEnabled(cacheable=true) // Read by components
+    @TestVisible
+    public static <T> T get(String key) {
+        return (T) cache.get(key);
+    }
+
+    @TestVisible <T> void put(String key, T value) {
+        cache.put(key, value);
+    }
+
+    @SuppressWarnings('PMD') @PeakVisibility(public, TestVisible)
+    private <T> void remove(T value) {
+        cache.remove(value);
+    }
+}`,
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{Methods: map[string][]string{
+		"Repository.get":    {"Account"},
+		"Repository.put":    {"Account"},
+		"Repository.remove": {"Account"},
+	}})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Error != nil {
+		t.Fatalf("unexpected results: %v", results)
+	}
+
+	content := results[0].Content
+	for _, want := range []string{
+		"@AuraEnabled(cacheable=true) @TestVisible public static Account getAccount(String key) {",
+		"@TestVisible void putAccount(String key, Account value) {",
+		"@SuppressWarnings('PMD') @TestVisible public void removeAccount(Account value) {",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	if strings.Count(content, "@TestVisible") != 5 {
+		t.Errorf("expected @TestVisible once per method, got:\n%s", content)
+	}
+}
@@ -0,0 +1,61 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// checkTypeArgCounts returns an error for the first generic usage in content, a
+// source or template at path, that passes a template the wrong number of type
+// arguments, directly or nested as in List<Queue<Integer, String>>. The error is
+// located at the usage and carries a note pointing at the template's declaration.
+func (t *Transpiler) checkTypeArgCounts(path, content string, generics map[string]*parser.GenericExpr) error {
+	masked := maskStringLiterals(content)
+	first, usage := -1, ""
+	var mismatch *parser.GenericExpr
+	for text, expr := range generics {
+		found := t.findTypeArgMismatch(expr)
+		if found == nil {
+			continue
+		}
+		offset := max(strings.Index(masked, text), 0)
+		if first < 0 || offset < first || offset == first && text < usage {
+			first, usage, mismatch = offset, text, found
+		}
+	}
+	if mismatch == nil {
+		return nil
+	}
+
+	template := t.templates[mismatch.BaseType]
+	err := fmt.Errorf("%s takes %d type argument(s), got %d in %s",
+		template.ClassName, len(template.TypeParams), len(mismatch.TypeArgs), usage)
+	templatePath := t.templatePaths[template.ClassName]
+	err = diagnostic.WithNote(templatePath, t.sourceLine(templatePath, template.BodyLine), 0,
+		fmt.Sprintf("template %s<%s> defined here", template.ClassName, strings.Join(template.TypeParams, ", ")), err)
+	line, column := position(content, first)
+	return diagnostic.WithCode(diagnostic.CodeTypeArgCount, diagnostic.At(line, column, err))
+}
+
+// findTypeArgMismatch returns expr or the first of its type arguments that uses a
+// template with the wrong number of type arguments, or nil
+func (t *Transpiler) findTypeArgMismatch(expr *parser.GenericExpr) *parser.GenericExpr {
+	if template, ok := t.templates[expr.BaseType]; ok && !expr.IsSimple && len(expr.TypeArgs) != len(template.TypeParams) {
+		return expr
+	}
+	for i := range expr.TypeArgs {
+		if found := t.findTypeArgMismatch(&expr.TypeArgs[i]); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// position returns the 1-based line and column of offset in content
+func position(content string, offset int) (int, int) {
+	line := strings.Count(content[:offset], "\n") + 1
+	return line, offset - strings.LastIndexByte(content[:offset], '\n')
+}
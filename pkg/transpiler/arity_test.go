@@ -0,0 +1,48 @@
+package transpiler
+
+import (
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_TypeArgCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		usage   string
+		line    int
+		column  int
+		message string
+	}{
+		{"too many", "public class Example {\n    private Queue<Integer, String> q;\n}", 2, 13, "Queue takes 1 type argument(s), got 2 in Queue<Integer, String>"},
+		{"nested", "public class Example {\n    // Values by key\n    private Pair<String, Queue<Integer, String>> p;\n}", 3, 13, "Queue takes 1 type argument(s), got 2 in Pair<String, Queue<Integer, String>>"},
+		{"too few", "public class Example {\n    private Pair<String> p;\n}", 2, 13, "Pair takes 2 type argument(s), got 1 in Pair<String>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+				"Pair.peak":    "public class Pair<A, B>\n{\n    private A first;\n}",
+				"Example.peak": tt.usage,
+			}
+			results, err := NewTranspiler(nil).TranspileFiles(files)
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].OriginalPath != "Example.peak" || results[0].Error == nil {
+				t.Fatalf("expected a single error for Example.peak, got %+v", results)
+			}
+
+			d := diagnostic.FromError("Example.peak", results[0].Error)
+			if d.Code != diagnostic.CodeTypeArgCount || d.Line != tt.line || d.Column != tt.column {
+				t.Errorf("expected %s at %d:%d, got %s at %d:%d", diagnostic.CodeTypeArgCount, tt.line, tt.column, d.Code, d.Line, d.Column)
+			}
+			if d.Message != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, d.Message)
+			}
+			if len(d.Notes) != 1 || d.Notes[0].File == "Example.peak" || d.Notes[0].Line == 0 {
+				t.Errorf("expected a note at the template, got %+v", d.Notes)
+			}
+		})
+	}
+}
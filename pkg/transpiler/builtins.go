@@ -0,0 +1,32 @@
+package transpiler
+
+import "github.com/ipavlic/peak/pkg/parser"
+
+// SetBuiltInGenerics sets the generic types passed through unchanged instead of
+// expanded, by name, with their number of type arguments (nil = the Apex system
+// generics of parser.DefaultBuiltInGenerics). Use it for existing classes that only
+// look like templates.
+func (t *Transpiler) SetBuiltInGenerics(builtIns map[string]int) {
+	t.builtInGenerics = builtIns
+}
+
+// newParser returns a parser of content that passes the built-in generics through
+func (t *Transpiler) newParser(content string) *parser.Parser {
+	p := parser.NewParser(content)
+	if t.builtInGenerics != nil {
+		p.SetBuiltInGenerics(t.builtInGenerics)
+	}
+	return p
+}
+
+// isBuiltInGeneric reports whether typeName is a built-in generic type
+func (t *Transpiler) isBuiltInGeneric(typeName string) bool {
+	_, ok := t.builtInArity(typeName)
+	return ok
+}
+
+// builtInArity returns the number of type arguments the built-in generic typeName
+// takes, and false if it is not a built-in generic
+func (t *Transpiler) builtInArity(typeName string) (int, bool) {
+	return t.newParser("").BuiltInArity(typeName)
+}
@@ -0,0 +1,108 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+func TestTranspileFiles_SystemGenerics(t *testing.T) {
+	files := map[string]string{
+		"Rows.peak": `public class Rows<T> implements Iterable<T>, Database.Batchable<T> {
+    private List<T> items;
+    public Iterator<T> iterator() {
+        return items.iterator();
+    }
+}`,
+		"Example.peak": "public class Example {\n    private Rows<Account> rows;\n    private System.Iterable<Rows<Id>> all;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetSelfCheck(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	byPath := make(map[string]FileResult)
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("unexpected error: %v", r.Error)
+		}
+		byPath[r.OutputPath] = r
+	}
+	rows := byPath["RowsAccount.cls"].Content
+	for _, expected := range []string{
+		"public class RowsAccount implements Iterable<Account>, Database.Batchable<Account> {",
+		"public Iterator<Account> iterator() {",
+	} {
+		if !strings.Contains(rows, expected) {
+			t.Errorf("expected %q in:\n%s", expected, rows)
+		}
+	}
+	if example := byPath["Example.cls"].Content; !strings.Contains(example, "private System.Iterable<RowsId> all;") {
+		t.Errorf("expected only the template to be replaced, got:\n%s", example)
+	}
+}
+
+func TestTranspileFiles_ConfiguredBuiltInGenerics(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetBuiltInGenerics(map[string]int{"List": 1, "Iterable": 1, "Database.Batchable": 1, "Pair": 2})
+	tr.SetInstantiate(&config.Instantiate{
+		Classes: map[string][]string{"Queue": {"pair<String, Id>"}},
+	})
+	files := map[string]string{
+		"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": `public class Example implements Database.Batchable<SObject> {
+    private Iterable<Account> accounts;
+    private Pair<String, Integer> pair;
+    private Queue<Iterable<Account>> queue;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	byPath := make(map[string]FileResult)
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("unexpected error: %v", r.Error)
+		}
+		byPath[r.OutputPath] = r
+	}
+	for _, class := range []string{"QueueIterableAccount.cls", "QueuepairStringId.cls"} {
+		if _, ok := byPath[class]; !ok {
+			t.Errorf("expected %s, got %v", class, byPath)
+		}
+	}
+	example := byPath["Example.cls"].Content
+	for _, expected := range []string{
+		"implements Database.Batchable<SObject>",
+		"private Iterable<Account> accounts;",
+		"private Pair<String, Integer> pair;",
+		"private QueueIterableAccount queue;",
+	} {
+		if !strings.Contains(example, expected) {
+			t.Errorf("expected %q in:\n%s", expected, example)
+		}
+	}
+
+	// Built-in generics from the configuration take their number of type arguments
+	tr.SetInstantiate(&config.Instantiate{
+		Classes: map[string][]string{"Queue": {"Pair<String>"}},
+	})
+	if results, _ := tr.TranspileFiles(files); !hasError(results, "Pair takes 2 type argument(s), got 1") {
+		t.Errorf("expected an arity error for Pair<String>, got %v", results)
+	}
+}
+
+// hasError reports whether any of results failed with an error containing text
+func hasError(results []FileResult, text string) bool {
+	for _, r := range results {
+		if r.Error != nil && strings.Contains(r.Error.Error(), text) {
+			return true
+		}
+	}
+	return false
+}
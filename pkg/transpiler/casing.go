@@ -0,0 +1,73 @@
+package transpiler
+
+import (
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// Apex identifiers are case-insensitive, so queue<integer> names the same class as
+// Queue<Integer>. Template and generic method names are resolved to the casing they
+// were declared with as soon as they are parsed, so the rest of the transpiler can
+// look them up as written; other type names keep the casing of the source.
+
+// addTemplate registers def, the template declared in path
+func (t *Transpiler) addTemplate(name, path string, def *parser.GenericClassDef) {
+	t.templates[name] = def
+	t.templatePaths[name] = path
+	t.templateNames[strings.ToLower(name)] = name
+}
+
+// templateName returns the declared name of the template called name in any casing,
+// and false if there is none
+func (t *Transpiler) templateName(name string) (string, bool) {
+	if _, ok := t.templates[name]; ok {
+		return name, true
+	}
+	declared, ok := t.templateNames[strings.ToLower(name)]
+	return declared, ok
+}
+
+// methodKey returns the declared key of the generic method called key, such as
+// Repository.get for repository.GET, and false if there is none
+func (t *Transpiler) methodKey(key string) (string, bool) {
+	if _, ok := t.methodTemplates[key]; ok {
+		return key, true
+	}
+	for declared := range t.methodTemplates {
+		if strings.EqualFold(declared, key) {
+			return declared, true
+		}
+	}
+	return "", false
+}
+
+// resolveNames spells the templates in expr and its type arguments as declared
+func (t *Transpiler) resolveNames(expr *parser.GenericExpr) {
+	if !expr.IsSimple {
+		if name, ok := t.templateName(expr.BaseType); ok {
+			expr.BaseType = name
+		}
+	}
+	for i := range expr.TypeArgs {
+		t.resolveNames(&expr.TypeArgs[i])
+	}
+}
+
+// resolveGenerics spells the templates in generics, as found by FindGenerics, as
+// declared, and returns generics
+func (t *Transpiler) resolveGenerics(generics map[string]*parser.GenericExpr) map[string]*parser.GenericExpr {
+	for _, expr := range generics {
+		t.resolveNames(expr)
+	}
+	return generics
+}
+
+// resolveTypeArgs spells the templates in args, as parsed by ParseTypeArguments, as
+// declared, and returns args
+func (t *Transpiler) resolveTypeArgs(args []parser.GenericExpr) []parser.GenericExpr {
+	for i := range args {
+		t.resolveNames(&args[i])
+	}
+	return args
+}
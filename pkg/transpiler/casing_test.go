@@ -0,0 +1,71 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+func TestTranspileFiles_CaseInsensitiveNames(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{
+		Classes: map[string][]string{"queue": {"Boolean"}},
+		Methods: map[string][]string{"repository.GET": {"Contact"}},
+	})
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+    public queue<T> self() { return this; }
+}`,
+		"Repository.peak": `public class Repository {
+    public <T> T get(String key) { return null; }
+}`,
+		"Example.peak": `public class Example {
+    private queue<integer> a = new QUEUE<Integer>();
+    private LIST<queue<String>> b;
+    Account c = repo.GET<Account>('c');
+    Account d = repo.get<account>('d');
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	byPath := make(map[string]FileResult)
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("unexpected error: %v", r.Error)
+		}
+		byPath[r.OutputPath] = r
+	}
+
+	for _, class := range []string{"QueueInteger.cls", "QueueString.cls", "QueueBoolean.cls"} {
+		if _, ok := byPath[class]; !ok {
+			t.Errorf("expected %s, got %v", class, byPath)
+		}
+	}
+	if self := byPath["QueueInteger.cls"].Content; !strings.Contains(self, "public QueueInteger self()") {
+		t.Errorf("expected the template's own type to be replaced, got:\n%s", self)
+	}
+
+	// The casing of each usage is kept; Apex resolves it to the generated class
+	example := byPath["Example.cls"].Content
+	for _, expected := range []string{
+		"private Queueinteger a = new QueueInteger();",
+		"private LIST<QueueString> b;",
+		"repo.GETAccount('c')",
+		"repo.getaccount('d')",
+	} {
+		if !strings.Contains(example, expected) {
+			t.Errorf("expected %q in:\n%s", expected, example)
+		}
+	}
+
+	// get<Account> and get<account> are one method, named after the first spelling in sort order
+	repository := byPath["Repository.cls"].Content
+	if strings.Count(repository, "getAccount(") != 1 || strings.Contains(repository, "getaccount(") || !strings.Contains(repository, "getContact(") {
+		t.Errorf("expected getAccount once and getContact, got:\n%s", repository)
+	}
+}
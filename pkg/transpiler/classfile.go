@@ -0,0 +1,53 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// checkClassFile checks that content, the source at path, declares exactly one
+// top-level class, interface or enum, named after the file. Salesforce requires
+// every .cls file to hold a single type of the same name, and rejects the deploy
+// otherwise with an error that does not point back at the source.
+func checkClassFile(path, content string) error {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	code := maskNonCode(content)
+
+	var declarations [][]int
+	depth, scanned := 0, 0
+	for _, match := range typeDeclarationPattern.FindAllStringSubmatchIndex(code, -1) {
+		depth += strings.Count(code[scanned:match[0]], "{") - strings.Count(code[scanned:match[0]], "}")
+		scanned = match[0]
+		if depth == 0 {
+			declarations = append(declarations, match)
+		}
+	}
+
+	fail := func(offset int, err error) error {
+		line, column := position(content, offset)
+		return diagnostic.WithCode(diagnostic.CodeClassFile, diagnostic.At(line, column, err))
+	}
+	if len(declarations) == 0 {
+		return diagnostic.WithCode(diagnostic.CodeClassFile,
+			fmt.Errorf("%s declares no top-level class; Salesforce requires its .cls file to declare %s", filepath.Base(path), name))
+	}
+	first := declarations[0]
+	if declared := code[first[2]:first[3]]; !strings.EqualFold(declared, name) {
+		return fail(first[2], fmt.Errorf("%s %s does not match the file name %s; Salesforce requires it to be named %s",
+			declarationKeyword(code, first), declared, filepath.Base(path), name))
+	}
+	if len(declarations) > 1 {
+		second := declarations[1]
+		return fail(second[2], fmt.Errorf("second top-level %s %s in %s; Salesforce allows one class per .cls file, so move it into its own file or inside %s",
+			declarationKeyword(code, second), code[second[2]:second[3]], filepath.Base(path), name))
+	}
+	return nil
+}
+
+// declarationKeyword returns the lowercased keyword of a typeDeclarationPattern match in code
+func declarationKeyword(code string, match []int) string {
+	return strings.ToLower(strings.Fields(code[match[0]:match[2]])[0])
+}
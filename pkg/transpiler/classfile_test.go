@@ -0,0 +1,65 @@
+package transpiler
+
+import (
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestCheckClassFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		valid   bool
+		line    int
+		column  int
+	}{
+		{"matching class", "src/Example.peak", "public class Example {\n    public class Inner {}\n    enum Color { RED }\n}", true, 0, 0},
+		{"case-insensitive match", "Example.peak", "// class Other\npublic CLASS example {\n    String s = 'class Other';\n}", true, 0, 0},
+		{"interface", "Shape.peak", "public interface Shape {\n    Decimal area();\n}", true, 0, 0},
+		{"mismatched name", "Example.peak", "public class AccountHelper {\n}", false, 1, 14},
+		{"second top-level class", "Example.peak", "public class Example {\n}\n\npublic class Other {\n}", false, 4, 14},
+		{"no class", "Example.peak", "// nothing here\n", false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkClassFile(tt.path, tt.content)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			d := diagnostic.FromError(tt.path, err)
+			if d.Code != diagnostic.CodeClassFile || d.Line != tt.line || d.Column != tt.column {
+				t.Errorf("expected %s at %d:%d, got %s at %d:%d: %s", diagnostic.CodeClassFile, tt.line, tt.column, d.Code, d.Line, d.Column, d.Message)
+			}
+		})
+	}
+}
+
+func TestTranspileFiles_ClassFileMismatch(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":          "public class Queue<T> {\n    private List<T> items;\n}",
+		"AccountService.peak": "public class AccountHelper {\n    Queue<Integer> q;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	found := false
+	for _, result := range results {
+		if result.OriginalPath == "AccountService.peak" {
+			d := diagnostic.FromError(result.OriginalPath, result.Error)
+			found = d.Code == diagnostic.CodeClassFile
+		}
+	}
+	if !found {
+		t.Errorf("expected %s for AccountService.peak, got %+v", diagnostic.CodeClassFile, results)
+	}
+}
@@ -0,0 +1,142 @@
+package transpiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// maxClassNameLength is the number of characters Apex allows in a class name
+const maxClassNameLength = 40
+
+// SetLongClassNames sets what happens to concrete class names longer than Apex allows,
+// such as those of deeply nested instantiations: config.LongClassNamesError (the
+// default) reports them, and config.LongClassNamesHash shortens them, see shortClassName.
+func (t *Transpiler) SetLongClassNames(policy string) {
+	t.longClassNames = policy
+}
+
+// SetClassNaming sets the naming pattern of concrete classes generated as top-level
+// classes; nil runs the template name and its type arguments together
+func (t *Transpiler) SetClassNaming(naming *config.ClassNaming) {
+	t.classNaming = naming
+}
+
+// concreteClassName names the top-level class generated for expr, e.g.
+// DictStringInteger for Dict<String, Integer>
+func (t *Transpiler) concreteClassName(expr *parser.GenericExpr) string {
+	return t.fitClassName(t.namedClassName(expr), expr)
+}
+
+// namedClassName names the top-level class generated for expr after the naming
+// pattern, before it is shortened. Names only differ from GenerateConcreteClassName,
+// which stays the identity of an instantiation, in how they are spelled.
+func (t *Transpiler) namedClassName(expr *parser.GenericExpr) string {
+	if t.classNaming == nil {
+		return parser.GenerateConcreteClassName(expr)
+	}
+	return t.classNaming.Prefix + classNameParts(expr, t.classNaming) + t.classNaming.Suffix
+}
+
+// classNameParts joins the template name of expr and its type arguments with the
+// separator of naming: Queue_List_Integer, or Queue_ListInteger with camel nesting
+func classNameParts(expr *parser.GenericExpr, naming *config.ClassNaming) string {
+	parts := make([]string, 0, 1+len(expr.TypeArgs))
+	parts = append(parts, expr.BaseType)
+	for _, typeArg := range expr.TypeArgs {
+		switch {
+		case typeArg.IsSimple:
+			parts = append(parts, strings.ReplaceAll(typeArg.BaseType, ".", ""))
+		case naming.Nested == config.NestedCamel:
+			parts = append(parts, parser.GenerateConcreteClassName(&typeArg))
+		default:
+			parts = append(parts, classNameParts(&typeArg, naming))
+		}
+	}
+	return strings.Join(parts, naming.Separator)
+}
+
+// fitClassName returns name, the class declared for expr, shortened if it is longer
+// than Apex allows and long names are hashed
+func (t *Transpiler) fitClassName(name string, expr *parser.GenericExpr) string {
+	if len(name) <= maxClassNameLength || t.longClassNames != config.LongClassNamesHash {
+		return name
+	}
+	return shortClassName(name, expr.String())
+}
+
+// shortClassName shortens name, the class generated for instantiation, to the
+// longest prefix that fits with an underscore and the first 8 hex digits of the
+// SHA-256 of instantiation. Instantiations that only differ after the prefix get
+// different names, and a name stays the same from one build to the next. Like Apex,
+// the hash ignores case, so Queue<integer> is shortened like Queue<Integer>.
+func shortClassName(name, instantiation string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(instantiation)))
+	hash := hex.EncodeToString(sum[:4])
+	prefix := strings.TrimRight(name[:maxClassNameLength-len(hash)-1], "_") // Apex names cannot have "__"
+	return prefix + "_" + hash
+}
+
+// unfittedClassName returns the name the class for expr, an instantiation of template,
+// is declared with before it is shortened
+func (t *Transpiler) unfittedClassName(template *parser.GenericClassDef, expr *parser.GenericExpr) string {
+	if t.holderClasses {
+		return innerClassName(template, expr)
+	}
+	return t.namedClassName(expr)
+}
+
+// checkClassNames reports every instantiation whose class name is longer than Apex
+// allows, unless long names are hashed. Errors are reported on the template, ordered
+// by instantiation. It runs after usages are collected and expanded (Phase 2).
+func (t *Transpiler) checkClassNames(results *[]FileResult) bool {
+	if t.longClassNames == config.LongClassNamesHash {
+		return false
+	}
+	var long []*parser.GenericExpr
+	for _, expr := range t.usages {
+		template, ok := t.templates[expr.BaseType]
+		if ok && len(t.unfittedClassName(template, expr)) > maxClassNameLength {
+			long = append(long, expr)
+		}
+	}
+	sort.Slice(long, func(i, j int) bool {
+		return long[i].String() < long[j].String()
+	})
+
+	for _, expr := range long {
+		template := t.templates[expr.BaseType]
+		name := t.unfittedClassName(template, expr)
+		path := t.templatePaths[expr.BaseType]
+		err := fmt.Errorf("class name %s for %s has %d characters, more than the %d Apex allows; use shorter type names, or set longClassNames to %s to shorten such names",
+			name, expr.String(), len(name), maxClassNameLength, config.LongClassNamesHash)
+		*results = append(*results, FileResult{
+			OriginalPath: path,
+			Error:        diagnostic.WithCode(diagnostic.CodeClassNameTooLong, diagnostic.At(t.sourceLine(path, template.BodyLine), 0, err)),
+		})
+	}
+	return len(long) > 0
+}
+
+// ShortenedClassNames returns the concrete classes of the last run whose names were
+// shortened because they were too long, by the name they are referred to with,
+// with the instantiation each was generated for
+func (t *Transpiler) ShortenedClassNames() map[string]string {
+	names := make(map[string]string)
+	if t.longClassNames != config.LongClassNamesHash {
+		return names
+	}
+	for _, expr := range t.usages {
+		template, ok := t.templates[expr.BaseType]
+		if ok && len(t.unfittedClassName(template, expr)) > maxClassNameLength {
+			names[t.classReference(expr)] = expr.String()
+		}
+	}
+	return names
+}
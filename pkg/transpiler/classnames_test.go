@@ -0,0 +1,151 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+const longNameExample = `public class Example {
+    private Queue<Map<String, List<OpportunityLineItemSchedule>>> schedules = new Queue<Map<String, List<OpportunityLineItemSchedule>>>();
+    private Queue<Integer> numbers;
+}`
+
+func TestShortClassName(t *testing.T) {
+	name := "QueueMapStringListOpportunityLineItemSchedule"
+	short := shortClassName(name, "Queue<Map<String, List<OpportunityLineItemSchedule>>>")
+	if len(short) != maxClassNameLength || !strings.HasPrefix(short, "QueueMapStringListOpportunityLi_") {
+		t.Errorf("expected a 40 character name with the prefix of %s, got %s", name, short)
+	}
+	if again := shortClassName(name, "Queue<Map<String, List<OpportunityLineItemSchedule>>>"); again != short {
+		t.Errorf("expected the same name on every call, got %s and %s", short, again)
+	}
+	if other := shortClassName(name, "Queue<Map<String, List<OpportunityLineItemSchedules>>>"); other == short {
+		t.Errorf("expected different instantiations to get different names, both got %s", short)
+	}
+	if got := shortClassName("Queue_______________________________________", "Queue<X>"); strings.Contains(got, "__") {
+		t.Errorf("expected no double underscore, got %s", got)
+	}
+}
+
+func TestTranspileFiles_ClassNameTooLong(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private T value;\n}",
+		"Example.peak": longNameExample,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	var errs []error
+	for _, r := range results {
+		if r.Error != nil {
+			errs = append(errs, r.Error)
+		}
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected a single error, got %v", errs)
+	}
+	if d := diagnostic.FromError("", errs[0]); d.Code != diagnostic.CodeClassNameTooLong || d.Line != 1 {
+		t.Errorf("expected %s at line 1, got %+v", diagnostic.CodeClassNameTooLong, d)
+	}
+	if msg := errs[0].Error(); !strings.Contains(msg, "QueueMapStringListOpportunityLineItemSchedule") || !strings.Contains(msg, "45 characters") {
+		t.Errorf("expected the long name and its length in the error, got %q", msg)
+	}
+}
+
+func TestTranspileFiles_HashedClassNames(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetLongClassNames(config.LongClassNamesHash)
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private T value;\n}",
+		"Example.peak": longNameExample,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	names := tr.ShortenedClassNames()
+	if len(names) != 1 {
+		t.Fatalf("expected a single shortened name, got %v", names)
+	}
+	var short string
+	for name, instantiation := range names {
+		short = name
+		if instantiation != "Queue<Map<String, List<OpportunityLineItemSchedule>>>" {
+			t.Errorf("expected the instantiation of %s, got %s", name, instantiation)
+		}
+	}
+
+	byPath := make(map[string]FileResult)
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("unexpected error: %v", r.Error)
+		}
+		byPath[r.OutputPath] = r
+	}
+	class, ok := byPath[short+".cls"]
+	if !ok {
+		t.Fatalf("expected %s.cls, got %v", short, byPath)
+	}
+	if !strings.Contains(class.Content, "public class "+short+" {") {
+		t.Errorf("expected the class to be declared as %s, got:\n%s", short, class.Content)
+	}
+	if _, ok := byPath["QueueInteger.cls"]; !ok {
+		t.Errorf("expected short names to be kept, got %v", byPath)
+	}
+	example := byPath["Example.cls"].Content
+	if !strings.Contains(example, "private "+short+" schedules = new "+short+"();") {
+		t.Errorf("expected references to use %s, got:\n%s", short, example)
+	}
+}
+
+func TestTranspileFiles_ClassNaming(t *testing.T) {
+	files := map[string]string{
+		"Dict.peak": "public class Dict<K, V> {\n    private Map<K, V> entries;\n}",
+		"Example.peak": `public class Example {
+    private Dict<String, List<Schema.Account>> accounts = new Dict<String, List<Schema.Account>>();
+}`,
+	}
+	tests := []struct {
+		naming   *config.ClassNaming
+		expected string
+	}{
+		{nil, "DictStringListSchemaAccount"},
+		{&config.ClassNaming{Prefix: "acme_", Separator: "_", Nested: config.NestedJoin}, "acme_Dict_String_List_SchemaAccount"},
+		{&config.ClassNaming{Separator: "_", Suffix: "Gen", Nested: config.NestedCamel}, "Dict_String_ListSchemaAccountGen"},
+	}
+	for _, tt := range tests {
+		tr := NewTranspiler(nil)
+		tr.SetClassNaming(tt.naming)
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+
+		byPath := make(map[string]FileResult)
+		for _, r := range results {
+			if r.Error != nil {
+				t.Fatalf("unexpected error: %v", r.Error)
+			}
+			byPath[r.OutputPath] = r
+		}
+		class, ok := byPath[tt.expected+".cls"]
+		if !ok {
+			t.Errorf("expected %s.cls, got %v", tt.expected, byPath)
+			continue
+		}
+		if !strings.Contains(class.Content, "public class "+tt.expected+" {") {
+			t.Errorf("expected the class to be declared as %s, got:\n%s", tt.expected, class.Content)
+		}
+		example := byPath["Example.cls"].Content
+		if !strings.Contains(example, "private "+tt.expected+" accounts = new "+tt.expected+"();") {
+			t.Errorf("expected references to use %s, got:\n%s", tt.expected, example)
+		}
+	}
+}
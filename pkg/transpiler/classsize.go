@@ -0,0 +1,51 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+const (
+	// maxClassSize is the number of characters Salesforce allows in an Apex class
+	maxClassSize = 1_000_000
+
+	// classSizeWarning is the size from which generated classes are reported as
+	// approaching maxClassSize, leaving room for templates to grow
+	classSizeWarning = maxClassSize * 8 / 10
+)
+
+// checkClassSize adds a warning if result, a class generated from a template, is
+// close to or above the Apex class size limit, which large templates instantiated
+// with long nested type names, or holders of many instantiations, can reach
+func (t *Transpiler) checkClassSize(result FileResult) {
+	if result.Error != nil || result.TemplatePath == "" {
+		return
+	}
+	size := utf8.RuneCountInString(result.Content)
+	if size < classSizeWarning {
+		return
+	}
+
+	template := filepath.Base(result.TemplatePath)
+	hint := fmt.Sprintf("split %s into smaller templates", template)
+	switch {
+	case result.Members != nil:
+		hint = "generate it without holder classes, so each instantiation is a class of its own, or " + hint
+	case result.Instantiation != "":
+		hint = fmt.Sprintf("write a specialized class for %s, or %s", result.Instantiation, hint)
+	}
+	state := "approaches"
+	if size > maxClassSize {
+		state = "exceeds"
+	}
+	t.warnings = append(t.warnings, diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityWarning,
+		Code:     diagnostic.CodeLargeClass,
+		File:     result.TemplatePath,
+		Message: fmt.Sprintf("generated %s has %d characters, which %s the Apex limit of %d per class; %s",
+			filepath.Base(result.OutputPath), size, state, maxClassSize, hint),
+	})
+}
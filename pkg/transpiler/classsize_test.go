@@ -0,0 +1,40 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestCheckClassSize(t *testing.T) {
+	large := strings.Repeat("x", classSizeWarning)
+	tests := []struct {
+		name   string
+		result FileResult
+		want   string // Expected message fragment, or "" for no warning
+	}{
+		{"small concrete class", FileResult{OutputPath: "QueueInteger.cls", TemplatePath: "Queue.peak", Instantiation: "Queue<Integer>", Content: "public class QueueInteger {}"}, ""},
+		{"large source", FileResult{OriginalPath: "Example.peak", OutputPath: "Example.cls", Content: large}, ""},
+		{"large concrete class", FileResult{OutputPath: "QueueInteger.cls", TemplatePath: "Queue.peak", Instantiation: "Queue<Integer>", Content: large},
+			"generated QueueInteger.cls has 800000 characters, which approaches the Apex limit of 1000000 per class; write a specialized class for Queue<Integer>"},
+		{"oversized holder", FileResult{OutputPath: "Queues.cls", TemplatePath: "Queue.peak", Members: map[string]string{}, Content: large + large},
+			"which exceeds the Apex limit of 1000000 per class; generate it without holder classes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTranspiler(nil)
+			tr.checkClassSize(tt.result)
+			warnings := tr.Warnings()
+			if tt.want == "" {
+				if len(warnings) != 0 {
+					t.Errorf("expected no warning, got %+v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || warnings[0].Code != diagnostic.CodeLargeClass || warnings[0].File != "Queue.peak" || !strings.Contains(warnings[0].Message, tt.want) {
+				t.Errorf("expected a %s warning on Queue.peak containing %q, got %+v", diagnostic.CodeLargeClass, tt.want, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// ComparableAnnotation makes the concrete classes of a template implement Comparable,
+// ordering instances by the fields named in its arguments, e.g. @PeakComparable(priority, name).
+// Fields are compared in order; nulls sort first.
+const ComparableAnnotation = "@PeakComparable"
+
+// Comparison kinds, chosen per field from its type in each concrete class
+const (
+	compareOperators = iota // Primitive types ordered by < and >
+	compareString           // String.compareTo
+	compareId               // Ids, compared as strings
+	compareBoolean          // false before true
+	compareMethod           // Anything else must implement Comparable
+)
+
+// comparisonKinds maps lowercase Apex types to how they are compared. Types
+// that cannot be ordered at all map to -1.
+var comparisonKinds = map[string]int{
+	"integer":  compareOperators,
+	"long":     compareOperators,
+	"decimal":  compareOperators,
+	"double":   compareOperators,
+	"date":     compareOperators,
+	"datetime": compareOperators,
+	"time":     compareOperators,
+	"string":   compareString,
+	"id":       compareId,
+	"boolean":  compareBoolean,
+	"blob":     -1,
+	"object":   -1,
+	"sobject":  -1,
+	"list":     -1,
+	"set":      -1,
+	"map":      -1,
+}
+
+// statementKeywords can precede an identifier the way a type does, as in "return value;"
+var statementKeywords = map[string]bool{"return": true, "throw": true, "new": true, "else": true}
+
+// withInterface adds iface to the implements clause of supertypes, unless it is already there
+func withInterface(supertypes, iface string) string {
+	words := strings.FieldsFunc(supertypes, func(r rune) bool { return !isIdentifierChar(r) })
+	implements := false
+	for _, word := range words {
+		if strings.EqualFold(word, iface) {
+			return supertypes
+		}
+		implements = implements || strings.EqualFold(word, "implements")
+	}
+	if implements {
+		return supertypes + ", " + iface
+	}
+	return strings.TrimSpace(supertypes + " implements " + iface)
+}
+
+// fieldType returns the type a field is declared with in a template body, as written
+func fieldType(body, field string) (string, bool) {
+	declaration := regexp.MustCompile(`(?i)(?:^|[\s;{}])([A-Za-z_][\w.]*(?:<[\w.<>,\s]*>)?)\s+` + regexp.QuoteMeta(field) + `\s*[;=]`)
+	for _, match := range declaration.FindAllStringSubmatch(maskStringLiterals(body), -1) {
+		if !statementKeywords[strings.ToLower(match[1])] {
+			return match[1], true
+		}
+	}
+	return "", false
+}
+
+// compareToMethod generates the compareTo method of the concrete class className,
+// instantiated from template with expr, comparing the given fields in order
+func compareToMethod(template *parser.GenericClassDef, expr *parser.GenericExpr, className string, fields []string) (string, error) {
+	fail := func(format string, args ...any) (string, error) {
+		return "", diagnostic.WithCode(diagnostic.CodeInvalidComparable, fmt.Errorf(format, args...))
+	}
+	if len(fields) == 0 {
+		return fail("%s on %s must name the fields to compare, e.g. %s(name)", ComparableAnnotation, template.ClassName, ComparableAnnotation)
+	}
+
+	substitutions := make(map[string]string, len(template.TypeParams))
+	for i, param := range template.TypeParams {
+		if i < len(expr.TypeArgs) {
+			substitutions[param] = expr.TypeArgs[i].String()
+		}
+	}
+
+	var method strings.Builder
+	fmt.Fprintf(&method, "public Integer compareTo(Object obj) {\n")
+	fmt.Fprintf(&method, "    %s other = (%s) obj;\n", className, className)
+	fmt.Fprintf(&method, "    Integer result;\n")
+
+	for i, field := range fields {
+		declared, ok := fieldType(template.Body, field)
+		if !ok {
+			return fail("%s field '%s' is not declared in %s", ComparableAnnotation, field, template.ClassName)
+		}
+		concrete := substituteIdentifiers(declared, substitutions)
+
+		base, _, _ := strings.Cut(concrete, "<")
+		kind, known := comparisonKinds[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(base), "System."))]
+		if known && kind < 0 {
+			return fail("%s field '%s' of %s has type %s, which cannot be ordered", ComparableAnnotation, field, expr.String(), concrete)
+		}
+		if !known {
+			kind = compareMethod
+		}
+
+		a, b := "this."+field, "other."+field
+		var compare string
+		switch kind {
+		case compareOperators:
+			compare = fmt.Sprintf("%s < %s ? -1 : (%s > %s ? 1 : 0)", a, b, a, b)
+		case compareString:
+			compare = fmt.Sprintf("%s.compareTo(%s)", a, b)
+		case compareId:
+			compare = fmt.Sprintf("((String) %s).compareTo((String) %s)", a, b)
+		case compareBoolean:
+			compare = fmt.Sprintf("%s == %s ? 0 : (%s ? 1 : -1)", a, b, a)
+		default:
+			compare = fmt.Sprintf("%s.compareTo(%s)", a, b)
+		}
+
+		fmt.Fprintf(&method, "    if (%s == null || %s == null) {\n", a, b)
+		fmt.Fprintf(&method, "        result = %s == null ? (%s == null ? 0 : -1) : 1;\n", a, b)
+		fmt.Fprintf(&method, "    } else {\n")
+		fmt.Fprintf(&method, "        result = %s;\n", compare)
+		fmt.Fprintf(&method, "    }\n")
+		if i < len(fields)-1 {
+			fmt.Fprintf(&method, "    if (result != 0) {\n")
+			fmt.Fprintf(&method, "        return result;\n")
+			fmt.Fprintf(&method, "    }\n")
+		}
+	}
+	fmt.Fprintf(&method, "    return result;\n")
+	fmt.Fprintf(&method, "}")
+	return method.String(), nil
+}
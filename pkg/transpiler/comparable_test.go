@@ -0,0 +1,118 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestWithInterface(t *testing.T) {
+	tests := []struct {
+		supertypes string
+		expected   string
+	}{
+		{"", "implements Comparable"},
+		{"extends Base", "extends Base implements Comparable"},
+		{"implements Foo", "implements Foo, Comparable"},
+		{"extends Base implements Foo, Bar", "extends Base implements Foo, Bar, Comparable"},
+		{"implements comparable", "implements comparable"},
+	}
+	for _, tt := range tests {
+		if got := withInterface(tt.supertypes, "Comparable"); got != tt.expected {
+			t.Errorf("withInterface(%q) = %q, expected %q", tt.supertypes, got, tt.expected)
+		}
+	}
+}
+
+func TestFieldType(t *testing.T) {
+	body := `{
+    public T value;
+    private List<Map<String, T>> items = new List<Map<String, T>>();
+    String label = 'Integer count;';
+    public T get() {
+        return value;
+    }
+}`
+	tests := []struct {
+		field    string
+		expected string
+		found    bool
+	}{
+		{"value", "T", true},
+		{"items", "List<Map<String, T>>", true},
+		{"label", "String", true},
+		{"count", "", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		got, found := fieldType(body, tt.field)
+		if got != tt.expected || found != tt.found {
+			t.Errorf("fieldType(%q) = %q, %v, expected %q, %v", tt.field, got, found, tt.expected, tt.found)
+		}
+	}
+}
+
+func TestTranspileFiles_Comparable(t *testing.T) {
+	files := map[string]string{
+		"Ranked.peak": `@PeakComparable(priority, value, active)
+public class Ranked<T> implements Serializable {
+    public Integer priority;
+    public T value;
+    public Boolean active;
+}`,
+		"Example.peak": `public class Example {
+    private Ranked<String> byName;
+    private Ranked<Id> byId;
+    private Ranked<List<Integer>> byList;
+}`,
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	byPath := make(map[string]FileResult)
+	for _, result := range results {
+		byPath[result.OutputPath] = result
+	}
+
+	byName := byPath["RankedString.cls"]
+	for _, want := range []string{
+		"public class RankedString implements Serializable, Comparable {",
+		"public Integer compareTo(Object obj) {",
+		"RankedString other = (RankedString) obj;",
+		"result = this.priority < other.priority ? -1 : (this.priority > other.priority ? 1 : 0);",
+		"result = this.value.compareTo(other.value);",
+		"result = this.active == other.active ? 0 : (this.active ? 1 : -1);",
+		"result = this.priority == null ? (other.priority == null ? 0 : -1) : 1;",
+	} {
+		if !strings.Contains(byName.Content, want) {
+			t.Errorf("expected %q in output:\n%s", want, byName.Content)
+		}
+	}
+	if strings.Contains(byName.Content, "@PeakComparable") {
+		t.Errorf("the annotation should not be emitted:\n%s", byName.Content)
+	}
+	if want := strings.Count(byName.Content, "\n") + 1; len(byName.SourceLines) != want {
+		t.Errorf("expected %d mapped lines, got %d", want, len(byName.SourceLines))
+	}
+
+	if !strings.Contains(byPath["RankedId.cls"].Content, "result = ((String) this.value).compareTo((String) other.value);") {
+		t.Errorf("expected Ids to be compared as strings:\n%s", byPath["RankedId.cls"].Content)
+	}
+
+	// Types that cannot be ordered fail the instantiation, on the template
+	var failed FileResult
+	for _, result := range results {
+		if result.Error != nil {
+			failed = result
+		}
+	}
+	if failed.Error == nil || failed.OriginalPath != "Ranked.peak" {
+		t.Fatalf("expected an error on Ranked.peak, got %+v", failed)
+	}
+	if d := diagnostic.FromError(failed.OriginalPath, failed.Error); d.Code != diagnostic.CodeInvalidComparable || !strings.Contains(d.Message, "Ranked<List<Integer>>") {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+}
@@ -0,0 +1,154 @@
+package transpiler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// conditionalPattern matches a line holding only a "// peak:if", "// peak:else" or
+// "// peak:endif" comment, capturing the keyword and the rest of the comment
+var conditionalPattern = regexp.MustCompile(`^[ \t]*//[ \t]*peak:(if|else|endif)\b[ \t]*(.*?)[ \t]*$`)
+
+// conditionalSection is a peak:if section being evaluated
+type conditionalSection struct {
+	line   int  // Line of the peak:if, for errors
+	active bool // Whether the lines read so far in the section are kept
+	parent bool // Whether the enclosing section is active
+	inElse bool // Whether peak:else was seen
+}
+
+// SetSymbols sets the symbols defined for "// peak:if SYMBOL" sections. Symbols
+// are matched regardless of case, like Apex identifiers.
+func (t *Transpiler) SetSymbols(symbols []string) {
+	t.symbols = make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		t.symbols[strings.ToLower(symbol)] = true
+	}
+}
+
+// applyConditionals blanks out the lines of content that inactive peak:if sections
+// cover, along with the peak:if, peak:else and peak:endif lines themselves, keeping
+// every other line where it is so that diagnostics and source maps stay accurate.
+// The blanked lines are recorded for path and dropped from the outputs, see
+// stripInactiveLines. A "// peak:if SYMBOL" section is active when SYMBOL is
+// defined, and "// peak:if !SYMBOL" when it is not; sections may be nested.
+func (t *Transpiler) applyConditionals(path, content string) (string, error) {
+	delete(t.inactive, path)
+	if !strings.Contains(content, "peak:") {
+		return content, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	var stack []conditionalSection
+	var inactive []lineRange
+	for i, line := range lines {
+		number := i + 1
+		match := conditionalPattern.FindStringSubmatch(line)
+		if match == nil {
+			if len(stack) > 0 && !stack[len(stack)-1].active {
+				inactive = addLine(inactive, number)
+			}
+			continue
+		}
+
+		column := strings.Index(line, "peak:") + 1
+		switch keyword, argument := match[1], match[2]; keyword {
+		case "if":
+			symbol, negated := strings.CutPrefix(argument, "!")
+			if !config.IsSymbol(symbol) {
+				return content, diagnostic.WithCode(diagnostic.CodeConditional, diagnostic.At(number, column,
+					fmt.Errorf("peak:if requires a symbol such as TEST or !TEST, got '%s'", argument)))
+			}
+			parent := len(stack) == 0 || stack[len(stack)-1].active
+			stack = append(stack, conditionalSection{
+				line:   number,
+				active: parent && t.symbols[strings.ToLower(symbol)] != negated,
+				parent: parent,
+			})
+		case "else":
+			if len(stack) == 0 {
+				return content, diagnostic.WithCode(diagnostic.CodeConditional, diagnostic.At(number, column,
+					errors.New("peak:else without a matching peak:if")))
+			}
+			section := &stack[len(stack)-1]
+			if section.inElse {
+				return content, diagnostic.WithCode(diagnostic.CodeConditional, diagnostic.At(number, column,
+					fmt.Errorf("second peak:else for the peak:if on line %d", section.line)))
+			}
+			section.inElse = true
+			section.active = section.parent && !section.active
+		case "endif":
+			if len(stack) == 0 {
+				return content, diagnostic.WithCode(diagnostic.CodeConditional, diagnostic.At(number, column,
+					errors.New("peak:endif without a matching peak:if")))
+			}
+			stack = stack[:len(stack)-1]
+		}
+		inactive = addLine(inactive, number)
+	}
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		return content, diagnostic.WithCode(diagnostic.CodeConditional, diagnostic.At(open.line,
+			strings.Index(lines[open.line-1], "peak:")+1, errors.New("peak:if without a matching peak:endif")))
+	}
+
+	if len(inactive) == 0 {
+		return content, nil
+	}
+	for _, r := range inactive {
+		for line := r.first; line <= r.last; line++ {
+			lines[line-1] = ""
+		}
+	}
+	t.inactive[path] = inactive
+	return strings.Join(lines, "\n"), nil
+}
+
+// addLine adds line to ranges, extending the last range if line follows it
+func addLine(ranges []lineRange, line int) []lineRange {
+	if n := len(ranges); n > 0 && ranges[n-1].last == line-1 {
+		ranges[n-1].last = line
+		return ranges
+	}
+	return append(ranges, lineRange{line, line})
+}
+
+// stripInactiveLines removes the output lines that applyConditionals blanked out
+// from result, using its source lines to find them: lines of the source for
+// sources, and of the template for classes generated from one
+func (t *Transpiler) stripInactiveLines(result FileResult) FileResult {
+	path := result.OriginalPath
+	if result.TemplatePath != "" {
+		path = result.TemplatePath
+	}
+	inactive := t.inactive[path]
+	if len(inactive) == 0 || result.SourceLines == nil {
+		return result
+	}
+
+	lines := strings.Split(result.Content, "\n")
+	if len(lines) != len(result.SourceLines) {
+		return result
+	}
+	kept := make([]string, 0, len(lines))
+	sourceLines := make([]int, 0, len(lines))
+	for i, line := range lines {
+		source := result.SourceLines[i]
+		if strings.TrimSpace(line) == "" && slices.ContainsFunc(inactive, func(r lineRange) bool {
+			return r.first <= source && source <= r.last
+		}) {
+			continue
+		}
+		kept = append(kept, line)
+		sourceLines = append(sourceLines, source)
+	}
+	result.Content = strings.Join(kept, "\n")
+	result.SourceLines = sourceLines
+	return result
+}
@@ -0,0 +1,157 @@
+package transpiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestApplyConditionals(t *testing.T) {
+	content := "a\n" +
+		"// peak:if TEST\n" +
+		"b\n" +
+		"    // peak:if !debug\n" +
+		"c\n" +
+		"    // peak:else\n" +
+		"d\n" +
+		"    // peak:endif\n" +
+		"// peak:else\n" +
+		"e\n" +
+		"// peak:endif\n" +
+		"f // peak:if TEST"
+
+	tr := NewTranspiler(nil)
+	tr.SetSymbols([]string{"test", "DEBUG"})
+	got, err := tr.applyConditionals("A.peak", content)
+	if err != nil {
+		t.Fatalf("applyConditionals failed: %v", err)
+	}
+	if want := "a\n\nb\n\n\n\nd\n\n\n\n\nf // peak:if TEST"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if want := []lineRange{{2, 2}, {4, 6}, {8, 11}}; !reflect.DeepEqual(tr.inactive["A.peak"], want) {
+		t.Errorf("expected inactive lines %v, got %v", want, tr.inactive["A.peak"])
+	}
+
+	tr.SetSymbols(nil)
+	if got, _ := tr.applyConditionals("A.peak", content); got != "a\n\n\n\n\n\n\n\n\ne\n\nf // peak:if TEST" {
+		t.Errorf("expected only e without symbols, got %q", got)
+	}
+}
+
+func TestApplyConditionals_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		message string
+	}{
+		{"missing symbol", "a\n  // peak:if\n// peak:endif", 2, "requires a symbol"},
+		{"two symbols", "// peak:if TEST DEBUG\n// peak:endif", 1, "requires a symbol"},
+		{"else without if", "a\n// peak:else", 2, "peak:else without"},
+		{"endif without if", "// peak:endif", 1, "peak:endif without"},
+		{"second else", "// peak:if TEST\n// peak:else\n// peak:else\n// peak:endif", 3, "second peak:else for the peak:if on line 1"},
+		{"unclosed", "// peak:if TEST\n// peak:if DEBUG\n// peak:endif", 1, "peak:if without"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTranspiler(nil).applyConditionals("A.peak", tt.content)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			d := diagnostic.FromError("A.peak", err)
+			if d.Code != diagnostic.CodeConditional || d.Line != tt.line || !strings.Contains(d.Message, tt.message) {
+				t.Errorf("expected %s at line %d containing %q, got %+v", diagnostic.CodeConditional, tt.line, tt.message, d)
+			}
+		})
+	}
+}
+
+func TestTranspileFiles_Conditionals(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": "public class Queue<T> {\n" +
+			"    private List<T> items;\n" +
+			"    // peak:if TEST\n" +
+			"    public void reset() { items.clear(); }\n" +
+			"    // peak:endif\n" +
+			"    public Integer size() { return items.size(); }\n" +
+			"}",
+		"Example.peak": "public class Example {\n" +
+			"    // peak:if TEST\n" +
+			"    Queue<Boolean> test;\n" +
+			"    // peak:else\n" +
+			"    Queue<Integer> prod;\n" +
+			"    // peak:endif\n" +
+			"}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	outputs := make(map[string]FileResult)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result
+	}
+	if _, ok := outputs["QueueBoolean.cls"]; ok {
+		t.Error("expected usages in inactive sections not to be instantiated")
+	}
+
+	example := outputs["Example.cls"]
+	if want := "public class Example {\n    QueueInteger prod;\n}"; !strings.HasSuffix(example.Content, want) {
+		t.Errorf("expected output ending in %q, got:\n%s", want, example.Content)
+	}
+	if want := []int{0, 1, 5, 7}; !reflect.DeepEqual(example.SourceLines, want) {
+		t.Errorf("expected source lines %v, got %v", want, example.SourceLines)
+	}
+
+	queue := outputs["QueueInteger.cls"]
+	if strings.Contains(queue.Content, "reset") || strings.Contains(queue.Content, "\n\n") {
+		t.Errorf("expected the TEST section to be stripped, got:\n%s", queue.Content)
+	}
+	if want := []int{0, 1, 2, 6, 7}; !reflect.DeepEqual(queue.SourceLines, want) {
+		t.Errorf("expected source lines %v, got %v", want, queue.SourceLines)
+	}
+}
+
+func TestTranspileFiles_ConditionalsDefined(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    // peak:if TEST\n    public void reset() { }\n    // peak:endif\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer> q;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetSymbols([]string{"TEST"})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		if result.OutputPath == "QueueInteger.cls" && !strings.Contains(result.Content, "{\n    public void reset() { }\n}") {
+			t.Errorf("expected the TEST section to be kept, got:\n%s", result.Content)
+		}
+	}
+}
+
+func TestTranspileFiles_MalformedConditional(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    // peak:if TEST\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer> q;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	if len(results) != 1 || results[0].OriginalPath != "Queue.peak" {
+		t.Fatalf("expected a single error for Queue.peak, got %+v", results)
+	}
+	if d := diagnostic.FromError("Queue.peak", results[0].Error); d.Code != diagnostic.CodeConditional || d.Line != 2 || d.Column != 8 {
+		t.Errorf("expected %s at 2:8, got %+v", diagnostic.CodeConditional, d)
+	}
+}
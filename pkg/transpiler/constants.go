@@ -0,0 +1,104 @@
+package transpiler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+var (
+	// defineDirectivePattern matches a line holding only a "// peak:define NAME value"
+	// comment, capturing the name and value
+	defineDirectivePattern = regexp.MustCompile(`^[ \t]*//[ \t]*peak:define\b[ \t]*(.*?)[ \t]*$`)
+
+	// constantDefinitionPattern splits the text of a peak:define into name and value
+	constantDefinitionPattern = regexp.MustCompile(`^([A-Za-z_]\w*)[ \t]+(\S.*)$`)
+
+	// placeholderPattern matches a ${NAME} placeholder, capturing the name
+	placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_]\w*)\}`)
+)
+
+// SetConstants sets project-wide constants for ${NAME} placeholders, which take
+// precedence over those defined with peak:define in a file. Names are matched
+// regardless of case, like Apex identifiers.
+func (t *Transpiler) SetConstants(constants map[string]string) {
+	t.constants = make(map[string]string, len(constants))
+	for name, value := range constants {
+		t.constants[strings.ToLower(name)] = value
+	}
+}
+
+// applyConstants replaces the ${NAME} placeholders in content, the source at path,
+// with the values of constants: those set with SetConstants, then those defined by
+// the "// peak:define NAME value" lines of the file. The peak:define lines are
+// blanked out and dropped from the outputs like inactive peak:if sections. An
+// undefined placeholder in code is an error; in strings and comments it is left as
+// it is, since it may be meant literally.
+func (t *Transpiler) applyConstants(path, content string) (string, error) {
+	if !strings.Contains(content, "peak:define") && !strings.Contains(content, "${") {
+		return content, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	defined := make(map[string]string)
+	definedAt := make(map[string]int)
+	var directives []lineRange
+	for i, line := range lines {
+		match := defineDirectivePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		column := strings.Index(line, "peak:define") + 1
+		definition := constantDefinitionPattern.FindStringSubmatch(match[1])
+		if definition == nil {
+			return content, diagnostic.WithCode(diagnostic.CodeConstant, diagnostic.At(i+1, column,
+				fmt.Errorf("peak:define requires a name and a value, as in MAX_SIZE 200, got '%s'", match[1])))
+		}
+		name := strings.ToLower(definition[1])
+		if previous, ok := definedAt[name]; ok {
+			return content, diagnostic.WithCode(diagnostic.CodeConstant, diagnostic.At(i+1, column,
+				fmt.Errorf("constant %s is already defined on line %d", definition[1], previous)))
+		}
+		defined[name], definedAt[name] = definition[2], i+1
+		lines[i] = ""
+		directives = append(directives, lineRange{i + 1, i + 1})
+	}
+	if len(directives) > 0 {
+		content = strings.Join(lines, "\n")
+		inactive := append(t.inactive[path], directives...)
+		sort.Slice(inactive, func(i, j int) bool { return inactive[i].first < inactive[j].first })
+		t.inactive[path] = inactive
+	}
+
+	matches := placeholderPattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content, nil
+	}
+	code := maskNonCode(content)
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		name := strings.ToLower(content[match[2]:match[3]])
+		value, ok := t.constants[name]
+		if !ok {
+			value, ok = defined[name]
+		}
+		if !ok {
+			if code[match[0]] != '$' {
+				continue // In a string or comment
+			}
+			line, column := position(content, match[0])
+			return content, diagnostic.WithCode(diagnostic.CodeConstant, diagnostic.At(line, column,
+				errors.New(content[match[0]:match[1]]+" names no constant; define it with peak:define or in defines")))
+		}
+		b.WriteString(content[last:match[0]])
+		b.WriteString(value)
+		last = match[1]
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
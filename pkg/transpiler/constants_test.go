@@ -0,0 +1,89 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_Constants(t *testing.T) {
+	files := map[string]string{
+		"Buffer.peak": "public class Buffer<T> {\n" +
+			"    // peak:define MAX_SIZE 100\n" +
+			"    // peak:define Label 'buffer'\n" +
+			"    private static final Integer MAX = ${MAX_SIZE};\n" +
+			"    private String name = ${LABEL};\n" +
+			"    private String hint = 'use ${UNDEFINED} here'; // ${ALSO_UNDEFINED}\n" +
+			"}",
+		"Use.peak": "public class Use {\n    Buffer<Integer> b;\n}",
+	}
+
+	for _, tt := range []struct {
+		name      string
+		constants map[string]string
+		max       string
+	}{
+		{"defined in the file", nil, "100"},
+		{"overridden by config", map[string]string{"max_size": "500"}, "500"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTranspiler(nil)
+			tr.SetConstants(tt.constants)
+			results, err := tr.TranspileFiles(files)
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			var buffer FileResult
+			for _, result := range results {
+				if result.Error != nil {
+					t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+				}
+				if result.OutputPath == "BufferInteger.cls" {
+					buffer = result
+				}
+			}
+			want := "public class BufferInteger {\n" +
+				"    private static final Integer MAX = " + tt.max + ";\n" +
+				"    private String name = 'buffer';\n" +
+				"    private String hint = 'use ${UNDEFINED} here'; // ${ALSO_UNDEFINED}\n" +
+				"}"
+			if !strings.HasSuffix(buffer.Content, want) {
+				t.Errorf("expected output ending in:\n%s\ngot:\n%s", want, buffer.Content)
+			}
+			if lines := []int{0, 1, 4, 5, 6, 7}; len(buffer.SourceLines) != len(lines) || buffer.SourceLines[2] != 4 {
+				t.Errorf("expected source lines %v, got %v", lines, buffer.SourceLines)
+			}
+		})
+	}
+}
+
+func TestTranspileFiles_ConstantErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		column  int
+		message string
+	}{
+		{"undefined", "public class Use {\n    Integer max = ${MAX_SIZE};\n}", 2, 19, "${MAX_SIZE} names no constant"},
+		{"missing value", "// peak:define MAX_SIZE\npublic class Use {\n}", 1, 4, "requires a name and a value"},
+		{"invalid name", "// peak:define 2X 5\npublic class Use {\n}", 1, 4, "requires a name and a value"},
+		{"redefined", "// peak:define MAX 1\n// peak:define max 2\npublic class Use {\n}", 2, 4, "constant max is already defined on line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := NewTranspiler(nil).TranspileFiles(map[string]string{"Use.peak": tt.content})
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Error == nil {
+				t.Fatalf("expected a single error, got %+v", results)
+			}
+			d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+			if d.Code != diagnostic.CodeConstant || d.Line != tt.line || d.Column != tt.column || !strings.Contains(d.Message, tt.message) {
+				t.Errorf("expected %s at %d:%d containing %q, got %+v", diagnostic.CodeConstant, tt.line, tt.column, tt.message, d)
+			}
+		})
+	}
+}
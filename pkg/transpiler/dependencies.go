@@ -0,0 +1,209 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// maxDependencyDepth is how many templates deep instantiating a template may
+// instantiate others, as Stack<Integer> does Queue<Integer> when Stack<T> extends
+// Queue<T>. Deeper chains come from templates that instantiate themselves with
+// growing type arguments, such as Node<T> holding a Node<List<T>>, which never end.
+const maxDependencyDepth = 16
+
+// mentionsTypeParams reports whether expr or any of its type arguments is one of params
+func mentionsTypeParams(expr parser.GenericExpr, params []string) bool {
+	for _, param := range params {
+		if expr.IsSimple && expr.BaseType == param {
+			return true
+		}
+	}
+	for _, arg := range expr.TypeArgs {
+		if mentionsTypeParams(arg, params) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOwnType reports whether expr names the class that template declares, with its
+// type parameters in order, as in Queue<T> within Queue<T>
+func isOwnType(expr parser.GenericExpr, template *parser.GenericClassDef) bool {
+	if expr.BaseType != template.ClassName || len(expr.TypeArgs) != len(template.TypeParams) {
+		return false
+	}
+	for i, arg := range expr.TypeArgs {
+		if !arg.IsSimple || arg.BaseType != template.TypeParams[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// substituteTypeArgs returns expr with the type parameters in args replaced by their
+// type arguments, as in Dict<String, V> becoming Dict<String, Account> for V = Account
+func substituteTypeArgs(expr parser.GenericExpr, args map[string]parser.GenericExpr) parser.GenericExpr {
+	if expr.IsSimple {
+		if arg, ok := args[expr.BaseType]; ok {
+			return arg
+		}
+		return expr
+	}
+	substituted := parser.GenericExpr{BaseType: expr.BaseType, TypeArgs: make([]parser.GenericExpr, len(expr.TypeArgs))}
+	for i, arg := range expr.TypeArgs {
+		substituted.TypeArgs[i] = substituteTypeArgs(arg, args)
+	}
+	return substituted
+}
+
+// templateDependencies returns the generic expressions of other templates, or its
+// own, that the supertypes and body of template use with its type parameters, such
+// as Queue<T> in Stack<T> extends Queue<T> or Box<T> in a field
+func (t *Transpiler) templateDependencies(template *parser.GenericClassDef) []parser.GenericExpr {
+	code := maskNonCode(template.Supertypes + "\n" + template.Body)
+	generics, err := t.newParser(code).FindGenerics()
+	if err != nil {
+		return nil // Reported when the template's own file was scanned
+	}
+	t.resolveGenerics(generics)
+	originals := make([]string, 0, len(generics))
+	for original := range generics {
+		originals = append(originals, original)
+	}
+	sort.Strings(originals)
+
+	var dependencies []parser.GenericExpr
+	for _, original := range originals {
+		expr := generics[original]
+		if _, isTemplate := t.templates[expr.BaseType]; !isTemplate || !mentionsTypeParams(*expr, template.TypeParams) {
+			continue
+		}
+		if isOwnType(*expr, template) {
+			continue // The class itself, as in a Queue<T> parameter of Queue<T>
+		}
+		dependencies = append(dependencies, *expr)
+	}
+	return dependencies
+}
+
+// expandDependencies adds the instantiations that instantiating templates requires,
+// transitively: Stack<Integer> needs Queue<Integer> when Stack<T> extends Queue<T>,
+// and StringDict<Account> needs Dict<String, Account> when StringDict<V> extends
+// Dict<String, V>. Templates used with their type parameters are only instantiated
+// this way, since their usages in the template itself name no concrete class, and so
+// are templates nested in the type arguments of config instantiations. An
+// instantiation chain deeper than maxDependencyDepth is an error on its template.
+func (t *Transpiler) expandDependencies(results *[]FileResult) bool {
+	type pending struct {
+		expr  *parser.GenericExpr
+		depth int
+	}
+
+	generated := make(map[string]bool, len(t.usages))
+	queue := make([]pending, 0, len(t.usages))
+	keys := make([]string, 0, len(t.usages))
+	for key := range t.usages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		expr := t.usages[key]
+		generated[strings.ToLower(parser.GenerateConcreteClassName(expr))] = true
+		queue = append(queue, pending{expr: expr})
+	}
+
+	// Templates in the type arguments of instantiations from config and directives,
+	// as Wrapper<Account> in Queue<Wrapper<Account>> or in Repository.get<Wrapper<Account>>,
+	// are not usages of their own; those in sources are found when they are scanned
+	var nested []parser.GenericExpr
+	for _, key := range keys {
+		nested = append(nested, t.usages[key].TypeArgs...)
+	}
+	methodKeys := make([]string, 0, len(t.methodUsages))
+	for key := range t.methodUsages {
+		methodKeys = append(methodKeys, key)
+	}
+	sort.Strings(methodKeys)
+	for _, key := range methodKeys {
+		for _, typeArgs := range t.methodUsages[key] {
+			if args, err := parser.ParseTypeArguments(typeArgs); err == nil {
+				nested = append(nested, t.resolveTypeArgs(args)...)
+			}
+		}
+	}
+	for _, arg := range nested {
+		for _, needed := range t.templateExprs(arg) {
+			className := strings.ToLower(parser.GenerateConcreteClassName(needed))
+			if !generated[className] {
+				generated[className] = true
+				t.usages[needed.String()] = needed
+				queue = append(queue, pending{expr: needed})
+			}
+		}
+	}
+
+	dependencies := make(map[string][]parser.GenericExpr)
+	reported := make(map[string]bool)
+	hasErrors := false
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		template, ok := t.templates[next.expr.BaseType]
+		if !ok || len(template.TypeParams) != len(next.expr.TypeArgs) {
+			continue
+		}
+		deps, ok := dependencies[template.ClassName]
+		if !ok {
+			deps = t.templateDependencies(template)
+			dependencies[template.ClassName] = deps
+		}
+
+		args := make(map[string]parser.GenericExpr, len(template.TypeParams))
+		for i, param := range template.TypeParams {
+			args[param] = next.expr.TypeArgs[i]
+		}
+		for _, dep := range deps {
+			expr := substituteTypeArgs(dep, args)
+			for _, needed := range t.templateExprs(expr) {
+				className := strings.ToLower(parser.GenerateConcreteClassName(needed))
+				if generated[className] {
+					continue
+				}
+				if next.depth >= maxDependencyDepth {
+					if !reported[template.ClassName] {
+						reported[template.ClassName] = true
+						hasErrors = true
+						*results = append(*results, FileResult{
+							OriginalPath: t.templatePaths[template.ClassName],
+							Error: diagnostic.WithCode(diagnostic.CodeRecursiveInstantiation,
+								fmt.Errorf("%s in %s needs ever deeper instantiations (more than %d templates deep); a template cannot use itself with growing type arguments",
+									dep.String(), template.ClassName, maxDependencyDepth)),
+						})
+					}
+					continue
+				}
+				generated[className] = true
+				t.usages[needed.String()] = needed
+				queue = append(queue, pending{expr: needed, depth: next.depth + 1})
+			}
+		}
+	}
+	return hasErrors
+}
+
+// templateExprs returns expr and the generic expressions nested in it whose base
+// type is a template, outermost first, as in Queue<Box<Integer>> and Box<Integer>
+func (t *Transpiler) templateExprs(expr parser.GenericExpr) []*parser.GenericExpr {
+	var exprs []*parser.GenericExpr
+	if _, isTemplate := t.templates[expr.BaseType]; isTemplate && !expr.IsSimple {
+		exprs = append(exprs, &expr)
+	}
+	for _, arg := range expr.TypeArgs {
+		exprs = append(exprs, t.templateExprs(arg)...)
+	}
+	return exprs
+}
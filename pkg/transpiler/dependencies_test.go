@@ -0,0 +1,133 @@
+package transpiler
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_TemplateInheritance(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":      "public virtual class Queue<T> {\n    protected List<T> items;\n}",
+		"Stack.peak":      "public class Stack<T> extends Queue<T> {\n    public T pop() {\n        return items.remove(items.size() - 1);\n    }\n}",
+		"Dict.peak":       "public virtual class Dict<K, V> {\n    protected Map<K, V> entries;\n}",
+		"StringDict.peak": "public class StringDict<V> extends Dict<String, V> {\n}",
+		"Example.peak":    "public class Example {\n    Stack<Integer> s;\n    StringDict<Account> d;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	for path, want := range map[string]string{
+		"StackInteger.cls":      "public class StackInteger extends QueueInteger {",
+		"QueueInteger.cls":      "protected List<Integer> items;",
+		"StringDictAccount.cls": "public class StringDictAccount extends DictStringAccount {",
+		"DictStringAccount.cls": "protected Map<String, Account> entries;",
+	} {
+		content, ok := outputs[path]
+		if !ok {
+			t.Errorf("expected %s, got %v", path, slices.Sorted(maps.Keys(outputs)))
+			continue
+		}
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in %s, got:\n%s", want, path, content)
+		}
+	}
+}
+
+func TestTranspileFiles_TypeParamDependencies(t *testing.T) {
+	files := map[string]string{
+		"Box.peak":     "public class Box<T> {\n    T value;\n}",
+		"Pair.peak":    "public class Pair<A, B> {\n    A first;\n    B second;\n}",
+		"Wrapper.peak": "public class Wrapper<T> {\n    Box<T> box;\n    List<Pair<String, Box<T>>> pairs;\n}",
+		"Example.peak": "public class Example {\n    Wrapper<Integer> w;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var outputs []string
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		if !result.IsTemplate {
+			outputs = append(outputs, result.OutputPath)
+		}
+	}
+	slices.Sort(outputs)
+	// Box<T> in Wrapper<T> names no class of its own
+	want := []string{"BoxInteger.cls", "Example.cls", "PairStringBoxInteger.cls", "WrapperInteger.cls"}
+	if !slices.Equal(outputs, want) {
+		t.Errorf("expected outputs %v, got %v", want, outputs)
+	}
+}
+
+func TestTranspileFiles_RecursiveInstantiation(t *testing.T) {
+	files := map[string]string{
+		"Node.peak":    "public class Node<T> {\n    private Node<T> next;\n    private Node<List<T>> children;\n}",
+		"Example.peak": "public class Example {\n    Node<Integer> n;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected a single error, got %+v", results)
+	}
+	d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+	if d.File != "Node.peak" || d.Code != diagnostic.CodeRecursiveInstantiation || !strings.Contains(d.Message, "Node<List<T>>") {
+		t.Errorf("expected %s for Node<List<T>> in Node.peak, got %s in %s: %s", diagnostic.CodeRecursiveInstantiation, d.Code, d.File, d.Message)
+	}
+}
+
+func TestTranspileFiles_ForcedNestedInstantiations(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":      "public class Queue<T> {\n    private List<T> items;\n}",
+		"Wrapper.peak":    "public class Wrapper<T> {\n    T value;\n}",
+		"Repository.peak": "public class Repository {\n    public <T> T get(String key) {\n        return (T) cache.get(key);\n    }\n}",
+		"Example.peak":    "public class Example {\n    // peak:instantiate Queue<List<Wrapper<Decimal>>>\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{
+		Classes: map[string][]string{"Queue": {"Wrapper<Account>"}},
+		Methods: map[string][]string{"Repository.get": {"Wrapper<Integer>"}},
+	})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	for _, path := range []string{"QueueWrapperAccount.cls", "WrapperAccount.cls", "QueueListWrapperDecimal.cls", "WrapperDecimal.cls", "WrapperInteger.cls"} {
+		if _, ok := outputs[path]; !ok {
+			t.Errorf("expected %s, got %v", path, slices.Sorted(maps.Keys(outputs)))
+		}
+	}
+	if repository := outputs["Repository.cls"]; !strings.Contains(repository, "WrapperInteger getWrapperInteger(String key)") {
+		t.Errorf("expected getWrapperInteger to return WrapperInteger, got:\n%s", repository)
+	}
+}
@@ -0,0 +1,241 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+var (
+	// instantiateDirectivePattern matches a "// peak:instantiate Queue<Decimal>" comment,
+	// capturing the instantiation
+	instantiateDirectivePattern = regexp.MustCompile(`(?m)//[ \t]*peak:instantiate\b[ \t]*(.*?)[ \t]*$`)
+
+	// ignorePattern matches a "// peak:ignore" or "// peak:ignore-next-line" comment,
+	// capturing "-next-line" and the optional codes and reason that follow
+	ignorePattern = regexp.MustCompile(`(?m)//[ \t]*peak:ignore(-next-line)?(?:[ \t]+(.*?))?[ \t]*$`)
+
+	// diagnosticCodePattern matches a diagnostic code such as PEAK113
+	diagnosticCodePattern = regexp.MustCompile(`(?i)^PEAK\d{3}$`)
+)
+
+// collectDirectives adds the instantiations requested by "// peak:instantiate" comments
+// in content, the source at path, as if they were used in code: a class instantiation
+// such as Queue<Decimal>, or a generic method instantiation such as
+// Repository.get<Contact>, which is added to those from instantiate.methods. It
+// returns an error, located at the directive, for the first one that names an
+// unknown template or has invalid type arguments.
+func (t *Transpiler) collectDirectives(path, content string) error {
+	masked := maskStringLiterals(content)
+	for _, match := range instantiateDirectivePattern.FindAllStringSubmatchIndex(masked, -1) {
+		text := content[match[2]:match[3]]
+		line, column := position(content, match[2])
+		if err := t.addDirective(path, text); err != nil {
+			return diagnostic.At(line, column, err)
+		}
+	}
+	return nil
+}
+
+// addDirective adds the instantiation text of a peak:instantiate directive in path
+func (t *Transpiler) addDirective(path, text string) error {
+	expr, err := t.parseInstantiation(text)
+	if err != nil {
+		return diagnostic.WithCode(diagnostic.CodeInvalidInstantiation,
+			fmt.Errorf("invalid peak:instantiate directive '%s': %w", text, err))
+	}
+
+	// Generic methods are named ClassName.methodName; templates are never qualified
+	if strings.Contains(expr.BaseType, ".") {
+		methodTemplate, exists := t.methodTemplates[expr.BaseType]
+		if !exists {
+			return diagnostic.WithCode(diagnostic.CodeUndefinedMethod,
+				fmt.Errorf("peak:instantiate directive '%s' references undefined generic method%s", text, t.methodSuggestion(expr.BaseType)))
+		}
+		if err := t.validateTypeArgs(expr.BaseType, len(methodTemplate.TypeParams), expr.TypeArgs); err != nil {
+			return diagnostic.WithCode(diagnostic.CodeInvalidInstantiation,
+				fmt.Errorf("invalid peak:instantiate directive '%s': %w", text, err))
+		}
+		t.addMethodUsage(expr.BaseType, path, joinTypeArgs(expr.TypeArgs))
+		return nil
+	}
+
+	template, exists := t.templates[expr.BaseType]
+	if !exists {
+		return diagnostic.WithCode(diagnostic.CodeUndefinedTemplate,
+			fmt.Errorf("peak:instantiate directive '%s' references undefined template%s", text, t.templateSuggestion(expr.BaseType)))
+	}
+	if err := t.validateTypeArgs(expr.BaseType, len(template.TypeParams), expr.TypeArgs); err != nil {
+		return diagnostic.WithCode(diagnostic.CodeInvalidInstantiation,
+			fmt.Errorf("invalid peak:instantiate directive '%s': %w", text, err))
+	}
+	t.usages[text] = expr
+	t.usedClasses[strings.ToLower(parser.GenerateConcreteClassName(expr))] = true
+	t.addUser(expr.BaseType, path)
+	if t.templatePaths[expr.BaseType] != path {
+		t.usedTemplates[expr.BaseType] = true
+	}
+	return nil
+}
+
+// joinTypeArgs formats type arguments as a comma-separated list, e.g. "String, Integer"
+func joinTypeArgs(args []parser.GenericExpr) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// lineRange is a range of 1-based source lines, inclusive
+type lineRange struct {
+	first, last int
+}
+
+// suppression is a peak:ignore pragma: the lines it covers and the diagnostic codes
+// it suppresses there. Without codes, the lines are not scanned at all.
+type suppression struct {
+	lines lineRange
+	codes []string
+}
+
+// findSuppressions returns the peak:ignore pragmas in content. "// peak:ignore"
+// covers the line it is on and "// peak:ignore-next-line" the line after it; when
+// that line opens a block, the pragma covers the block up to its closing brace.
+// Leading codes such as PEAK113 restrict the pragma to those diagnostics; any
+// other text is a free-form reason.
+func findSuppressions(content string) []suppression {
+	var suppressions []suppression
+	var code []string // Lines with comments and strings masked, loaded on first use
+	for _, match := range ignorePattern.FindAllStringSubmatchIndex(maskStringLiterals(content), -1) {
+		if code == nil {
+			code = strings.Split(maskNonCode(content), "\n")
+		}
+		line, _ := position(content, match[0])
+		if match[2] >= 0 {
+			line++ // peak:ignore-next-line
+		}
+		if line > len(code) {
+			continue
+		}
+
+		var codes []string
+		if match[4] >= 0 {
+			for _, field := range strings.FieldsFunc(content[match[4]:match[5]], func(r rune) bool {
+				return r == ' ' || r == '\t' || r == ','
+			}) {
+				if !diagnosticCodePattern.MatchString(field) {
+					break // The rest is the reason
+				}
+				codes = append(codes, strings.ToUpper(field))
+			}
+		}
+		suppressions = append(suppressions, suppression{lines: lineRange{line, blockEnd(code, line)}, codes: codes})
+	}
+	return suppressions
+}
+
+// blockEnd returns the line of the brace that closes the block opened on line, or
+// line itself if it opens no block. code holds the lines of the source with
+// comments and string literals masked.
+func blockEnd(code []string, line int) int {
+	depth := 0
+	for i := line - 1; i < len(code); i++ {
+		depth += strings.Count(code[i], "{") - strings.Count(code[i], "}")
+		if depth <= 0 {
+			return i + 1
+		}
+	}
+	return len(code) // Unclosed block: ignore the rest of the file
+}
+
+// ignoredLines returns the lines of the suppressions that have no codes, which are
+// not scanned at all
+func ignoredLines(suppressions []suppression) []lineRange {
+	var ranges []lineRange
+	for _, s := range suppressions {
+		if len(s.codes) == 0 {
+			ranges = append(ranges, s.lines)
+		}
+	}
+	return ranges
+}
+
+// scanWithSuppressions scans the source at path for generic usages like scanUsages,
+// skipping the lines that peak:ignore pragmas cover. An error with a code that a
+// pragma suppresses at the error's line is not reported; the pragma's lines are
+// skipped instead, as if it had no codes, and the source is scanned again. It
+// returns the usages and the lines that were skipped.
+func (t *Transpiler) scanWithSuppressions(path, content string) (map[string]*parser.GenericExpr, []lineRange, error) {
+	suppressions := findSuppressions(content)
+	ignored := ignoredLines(suppressions)
+	for {
+		generics, err := t.scanUsages(path, content, ignored)
+		if err == nil {
+			return generics, ignored, nil
+		}
+		d := diagnostic.FromError(path, err)
+		i := slices.IndexFunc(suppressions, func(s suppression) bool {
+			return s.lines.first <= d.Line && d.Line <= s.lines.last && slices.Contains(s.codes, d.Code)
+		})
+		if i < 0 {
+			return nil, nil, err
+		}
+		ignored = append(ignored, suppressions[i].lines)
+		suppressions = slices.Delete(suppressions, i, i+1) // Each pragma is applied once
+	}
+}
+
+// maskLines blanks out the given lines of content, keeping line breaks and every
+// offset unchanged
+func maskLines(content string, ranges []lineRange) string {
+	if len(ranges) == 0 {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for _, r := range ranges {
+		for line := r.first; line <= r.last; line++ {
+			lines[line-1] = strings.Repeat(" ", len(lines[line-1]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// restoreLines copies the given lines of original into output, undoing any
+// replacements made there. Replacements never add or remove line breaks, so the
+// lines of both correspond.
+func restoreLines(original, output string, ranges []lineRange) string {
+	if len(ranges) == 0 {
+		return output
+	}
+	originalLines := strings.Split(original, "\n")
+	outputLines := strings.Split(output, "\n")
+	if len(originalLines) != len(outputLines) {
+		return output
+	}
+	for _, r := range ranges {
+		copy(outputLines[r.first-1:r.last], originalLines[r.first-1:r.last])
+	}
+	return strings.Join(outputLines, "\n")
+}
+
+// maskIgnoredOutput returns the content of result with the lines that come from
+// lines skipped by peak:ignore pragmas blanked out, since they may keep generic
+// usages as written. Concrete classes are returned as they are.
+func (t *Transpiler) maskIgnoredOutput(result FileResult) string {
+	ignored := t.ignored[result.OriginalPath]
+	if len(ignored) == 0 || result.TemplatePath != "" {
+		return result.Content
+	}
+	var outputLines []lineRange
+	for i, line := range result.SourceLines {
+		if slices.ContainsFunc(ignored, func(r lineRange) bool { return r.first <= line && line <= r.last }) {
+			outputLines = append(outputLines, lineRange{i + 1, i + 1})
+		}
+	}
+	return maskLines(result.Content, outputLines)
+}
@@ -0,0 +1,158 @@
+package transpiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_InstantiateDirectives(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":      "public class Queue<T> {\n    private List<T> items;\n}",
+		"Repository.peak": "public class Repository {\n    public <T> T get(String key) {\n        return (T) cache.get(key);\n    }\n}",
+		"Example.peak": "public class Example {\n" +
+			"    // peak:instantiate Queue<Decimal>\n" +
+			"    //peak:instantiate Repository.get<Contact>\n" +
+			"    String s = '// peak:instantiate Queue<Boolean>';\n" +
+			"}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{Methods: map[string][]string{"Repository.get": {"Contact", "Account"}}})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	if _, ok := outputs["QueueDecimal.cls"]; !ok {
+		t.Error("expected QueueDecimal.cls from the directive")
+	}
+	if _, ok := outputs["QueueBoolean.cls"]; ok {
+		t.Error("expected a directive in a string literal to be ignored")
+	}
+	repository := outputs["Repository.cls"]
+	if strings.Count(repository, "getContact(") != 1 || !strings.Contains(repository, "getAccount(") {
+		t.Errorf("expected getContact once and getAccount, got:\n%s", repository)
+	}
+}
+
+func TestTranspileFiles_InvalidInstantiateDirective(t *testing.T) {
+	tests := []struct {
+		name      string
+		directive string
+		code      string
+	}{
+		{"undefined template", "Stack<Integer>", diagnostic.CodeUndefinedTemplate},
+		{"undefined method", "Repository.find<Integer>", diagnostic.CodeUndefinedMethod},
+		{"wrong type argument count", "Queue<Integer, String>", diagnostic.CodeInvalidInstantiation},
+		{"not generic", "Queue", diagnostic.CodeInvalidInstantiation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+				"Example.peak": "public class Example {\n    // peak:instantiate " + tt.directive + "\n}",
+			}
+			results, err := NewTranspiler(nil).TranspileFiles(files)
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Error == nil {
+				t.Fatalf("expected a single error, got %+v", results)
+			}
+			d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+			if d.File != "Example.peak" || d.Code != tt.code || d.Line != 2 || d.Column != 25 {
+				t.Errorf("expected %s at Example.peak:2:25, got %s at %s:%d:%d", tt.code, d.Code, d.File, d.Line, d.Column)
+			}
+		})
+	}
+}
+
+func TestFindSuppressions(t *testing.T) {
+	content := "public class Example {\n" +
+		"    Queue<Integer> a; // peak:ignore\n" +
+		"    // peak:ignore-next-line PEAK113, peak113 legacy wrapper\n" +
+		"    void run() {\n" +
+		"        Queue<String> b;\n" +
+		"    }\n" +
+		"    String s = '// peak:ignore';\n" +
+		"    // peak:ignored\n" +
+		"}"
+	got := findSuppressions(content)
+	want := []suppression{
+		{lines: lineRange{2, 2}},
+		{lines: lineRange{4, 6}, codes: []string{"PEAK113", "PEAK113"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTranspileFiles_IgnorePragmas(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n" +
+			"    Queue<Integer> a;\n" +
+			"    Queue<Integer> b; // peak:ignore\n" +
+			"    // peak:ignore-next-line\n" +
+			"    void run() {\n" +
+			"        Queue<String> c;\n" +
+			"    }\n" +
+			"    Queue<Integer, String> d; // peak:ignore PEAK113 wrapped by hand\n" +
+			"}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	if _, ok := outputs["QueueString.cls"]; ok {
+		t.Error("expected usages in an ignored block not to be instantiated")
+	}
+	example := outputs["Example.cls"]
+	for _, want := range []string{
+		"    QueueInteger a;\n",
+		"    Queue<Integer> b; // peak:ignore\n",
+		"        Queue<String> c;\n",
+		"    Queue<Integer, String> d;",
+	} {
+		if !strings.Contains(example, want) {
+			t.Errorf("expected %q in output:\n%s", want, example)
+		}
+	}
+}
+
+func TestTranspileFiles_IgnorePragmaOtherCode(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer, String> d; // peak:ignore PEAK101\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected a single error, got %+v", results)
+	}
+	if d := diagnostic.FromError(results[0].OriginalPath, results[0].Error); d.Code != diagnostic.CodeTypeArgCount {
+		t.Errorf("expected %s, got %s", diagnostic.CodeTypeArgCount, d.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package transpiler
+
+import (
+	"fmt"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// DTOAnnotation marks a template as a data transfer object. Each concrete class
+// generated from it gets a static fromJson helper that deserializes into that class.
+const DTOAnnotation = "@PeakDto"
+
+// isDTO reports whether template carries DTOAnnotation
+func isDTO(template *parser.GenericClassDef) bool {
+	_, ok := findAnnotation(template, DTOAnnotation)
+	return ok
+}
+
+// addJSONHelpers inserts a static fromJson method into the concrete class className,
+// so callers need not repeat the class name in a cast and a Type:
+//
+//	public static QueueAccount fromJson(String jsonString) {
+//	    return (QueueAccount) JSON.deserialize(jsonString, QueueAccount.class);
+//	}
+//
+// sourceLines is the line map of content; the map for the result is returned with it.
+func addJSONHelpers(content string, sourceLines []int, className string) (string, []int) {
+	// The parameter must not be called json: Apex names are case-insensitive, so it would hide the JSON class
+	helper := fmt.Sprintf("public static %[1]s fromJson(String jsonString) {\n    return (%[1]s) JSON.deserialize(jsonString, %[1]s.class);\n}", className)
+	return insertGenerated(content, sourceLines, "// Generated JSON helpers", helper)
+}
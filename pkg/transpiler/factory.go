@@ -0,0 +1,189 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// FactorySuffix is appended to a template's name to name its factory class
+const FactorySuffix = "Factory"
+
+// factoryPlan is a factory class to generate for a template, with its output path resolved
+type factoryPlan struct {
+	template     *parser.GenericClassDef
+	constructors []string   // Parameter lists of the template's public constructors
+	result       FileResult // Output path and provenance, without content
+}
+
+// SetFactories enables generating a factory class for each instantiated template,
+// e.g. QueueFactory with a newIntegerQueue() method for Queue<Integer>. Its methods
+// are virtual and its instance can be replaced in tests, so callers that create
+// instances through the factory can be given test doubles.
+func (t *Transpiler) SetFactories(enabled bool) {
+	t.factories = enabled
+}
+
+// planFactories resolves the output of the factory class of every template with at
+// least one planned concrete class, in the order of concrete. Abstract templates, and
+// templates whose constructors are not visible to other classes, get no factory.
+func (t *Transpiler) planFactories(concrete []concretePlan) []factoryPlan {
+	var plans []factoryPlan
+	for i, plan := range concrete {
+		if i > 0 && concrete[i-1].template == plan.template {
+			continue
+		}
+		template := plan.template
+		if hasModifier(template.Modifiers, "abstract") {
+			continue
+		}
+		constructors, ok := publicConstructors(template)
+		if !ok {
+			continue
+		}
+
+		name := template.ClassName + FactorySuffix
+		templatePath := t.templatePaths[template.ClassName]
+		outputPath := t.generatedOutputPath(template.ClassName, nil, name)
+
+		plans = append(plans, factoryPlan{
+			template:     template,
+			constructors: constructors,
+			result:       FileResult{OutputPath: outputPath, TemplatePath: templatePath, Test: t.testTemplates[template.ClassName]},
+		})
+	}
+	return plans
+}
+
+// hasModifier reports whether modifiers, as written before "class", include modifier
+func hasModifier(modifiers, modifier string) bool {
+	for _, field := range strings.Fields(modifiers) {
+		if strings.EqualFold(field, modifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicConstructors returns the parameter lists of the public and global constructors
+// declared in template's body, or a single empty list if it declares none, since Apex
+// then provides a public no-argument constructor. It returns false if every declared
+// constructor is private or protected, so no other class can create instances.
+func publicConstructors(template *parser.GenericClassDef) ([]string, bool) {
+	pattern := regexp.MustCompile(`(?im)(?:^|[;{}])\s*((?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|global|protected|private)\s+)?)` +
+		regexp.QuoteMeta(template.ClassName) + `\s*\(([^)]*)\)\s*\{`)
+
+	// The body's opening brace comes first; constructors follow it
+	body := maskStringLiterals(template.Body)
+	if open := strings.IndexByte(body, '{'); open >= 0 {
+		body = body[open:]
+	}
+
+	var params []string
+	declared := false
+	for _, match := range pattern.FindAllStringSubmatch(body, -1) {
+		declared = true
+		if hasModifier(match[1], "public") || hasModifier(match[1], "global") {
+			params = append(params, strings.Join(strings.Fields(match[2]), " "))
+		}
+	}
+	if !declared {
+		return []string{""}, true
+	}
+	return params, len(params) > 0
+}
+
+// parameterNames returns the names declared in a constructor's parameter list,
+// such as ["items", "capacity"] for "final List<T> items, Integer capacity"
+func parameterNames(params string) []string {
+	var names []string
+	depth, start := 0, 0
+	for i := 0; i <= len(params); i++ {
+		if i < len(params) {
+			switch params[i] {
+			case '<':
+				depth++
+				continue
+			case '>':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if fields := strings.Fields(params[start:i]); len(fields) > 0 {
+			names = append(names, fields[len(fields)-1])
+		}
+		start = i + 1
+	}
+	return names
+}
+
+// factoryMethodName names the factory method creating instances of the concrete class
+// for expr, e.g. newIntegerQueue for Queue<Integer>, so methods read as the type they create
+func factoryMethodName(template *parser.GenericClassDef, expr *parser.GenericExpr) string {
+	return "new" + strings.TrimPrefix(parser.GenerateConcreteClassName(expr), template.ClassName) + template.ClassName
+}
+
+// generateFactory generates the factory class of plan's template, with a creation
+// method per public constructor for each concrete class in created. The factory of a
+// test-only template is a test class itself; other factories leave out test-only
+// classes, which production code cannot reference:
+//
+//	public virtual class QueueFactory {
+//	    // Tests can replace the instance with a subclass that returns test doubles
+//	    @TestVisible
+//	    private static QueueFactory instance = new QueueFactory();
+//
+//	    public static QueueFactory getInstance() {
+//	        return instance;
+//	    }
+//
+//	    public virtual QueueInteger newIntegerQueue() {
+//	        return new QueueInteger();
+//	    }
+//	}
+func (t *Transpiler) generateFactory(plan factoryPlan, created []concretePlan) FileResult {
+	name := plan.template.ClassName + FactorySuffix
+
+	modifiers := "public virtual"
+	if plan.result.Test {
+		modifiers = TestAnnotation + " " + modifiers
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s class %s {\n", modifiers, name)
+	b.WriteString("    // Tests can replace the instance with a subclass that returns test doubles\n")
+	fmt.Fprintf(&b, "    @TestVisible\n    private static %[1]s instance = new %[1]s();\n\n", name)
+	fmt.Fprintf(&b, "    public static %s getInstance() {\n        return instance;\n    }\n", name)
+
+	for _, concrete := range created {
+		if concrete.result.Test && !plan.result.Test {
+			continue
+		}
+		concreteName := t.classReference(concrete.expr)
+		substitutions := templateSubstitutions(plan.template, concrete.expr, concreteName)
+		for _, params := range plan.constructors {
+			if params != "" {
+				params = t.instantiateTypes(params, substitutions)
+			}
+			fmt.Fprintf(&b, "\n    public virtual %s %s(%s) {\n        return new %s(%s);\n    }\n",
+				concreteName, factoryMethodName(plan.template, concrete.expr), params,
+				concreteName, strings.Join(parameterNames(params), ", "))
+		}
+	}
+	b.WriteString("}\n")
+
+	result := plan.result
+	result.Content = b.String()
+	result = t.withProvenance(result)
+	if err := t.checkOutput(result, templateSource(plan.template), substitutedParams(plan.template, created)); err != nil {
+		return FileResult{OriginalPath: plan.result.TemplatePath, Error: err}
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package transpiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+func TestParameterNames(t *testing.T) {
+	tests := []struct {
+		params   string
+		expected []string
+	}{
+		{"", nil},
+		{"Integer capacity", []string{"capacity"}},
+		{"final List<T> items, Integer capacity", []string{"items", "capacity"}},
+		{"Map<String, List<T>> byKey, T fallback", []string{"byKey", "fallback"}},
+	}
+	for _, tt := range tests {
+		if got := parameterNames(tt.params); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parameterNames(%q) = %v, expected %v", tt.params, got, tt.expected)
+		}
+	}
+}
+
+func TestPublicConstructors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []string
+		ok       bool
+	}{
+		{"implicit", "{\n    public T value;\n}", []string{""}, true},
+		{"public and global", "{\n    public Box() {}\n    global Box(T value) {\n        this.value = value;\n    }\n}", []string{"", "T value"}, true},
+		{"private skipped", "{\n    private Box() {}\n    public Box(List<T> items, Integer size) {}\n}", []string{"List<T> items, Integer size"}, true},
+		{"only private", "{\n    Box() {}\n    protected Box(T value) {}\n}", nil, false},
+		{"strings and calls ignored", "{\n    String s = 'public Box(T value) {';\n    public Box copy() {\n        return new Box(value);\n    }\n}", []string{""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &parser.GenericClassDef{ClassName: "Box", TypeParams: []string{"T"}, Body: tt.body}
+			got, ok := publicConstructors(template)
+			if !reflect.DeepEqual(got, tt.expected) || ok != tt.ok {
+				t.Errorf("publicConstructors() = %q, %v, expected %q, %v", got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTranspileFiles_Factories(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+    public Queue() {
+        items = new List<T>();
+    }
+    public Queue(List<T> items) {
+        this.items = items;
+    }
+}`,
+		"Shape.peak": `public abstract class Shape<T> {
+    public T size;
+}`,
+		"Guarded.peak": `public class Guarded<T> {
+    private Guarded() {}
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> numbers;
+    private Queue<List<String>> batches;
+    private Shape<Decimal> shape;
+    private Guarded<String> guarded;
+}`,
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetFactories(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	byPath := make(map[string]FileResult)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		byPath[result.OutputPath] = result
+	}
+
+	factory, ok := byPath["QueueFactory.cls"]
+	if !ok {
+		t.Fatalf("expected QueueFactory.cls, got %v", results)
+	}
+	if factory.TemplatePath != "Queue.peak" || factory.Instantiation != "" || factory.OriginalPath != "" {
+		t.Errorf("unexpected provenance: %+v", factory)
+	}
+	for _, want := range []string{
+		"// Generated by Peak from Queue.peak. Do not edit.\npublic virtual class QueueFactory {",
+		"@TestVisible\n    private static QueueFactory instance = new QueueFactory();",
+		"public static QueueFactory getInstance() {",
+		"public virtual QueueInteger newIntegerQueue() {\n        return new QueueInteger();",
+		"public virtual QueueInteger newIntegerQueue(List<Integer> items) {\n        return new QueueInteger(items);",
+		"public virtual QueueListString newListStringQueue(List<List<String>> items) {",
+	} {
+		if !strings.Contains(factory.Content, want) {
+			t.Errorf("expected %q in factory:\n%s", want, factory.Content)
+		}
+	}
+
+	for _, path := range []string{"ShapeFactory.cls", "GuardedFactory.cls"} {
+		if _, ok := byPath[path]; ok {
+			t.Errorf("expected no %s", path)
+		}
+	}
+	if _, ok := byPath["ShapeDecimal.cls"]; !ok {
+		t.Error("expected concrete classes of templates without factories to be generated")
+	}
+}
+
+func TestTranspileFiles_FactoriesDisabled(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		if strings.HasSuffix(result.OutputPath, "QueueFactory.cls") {
+			t.Errorf("factories should be opt-in, got %s", result.OutputPath)
+		}
+	}
+}
+
+func TestTranspileFiles_FactoryCollision(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":            "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak":          "public class Example {\n    private Queue<Integer> q;\n}",
+		"lib/QueueFactory.peak": "public class QueueFactory {\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetFactories(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var collision error
+	for _, result := range results {
+		if result.Error != nil {
+			if result.OriginalPath != "Queue.peak" {
+				t.Errorf("expected the error on the template, got %s", result.OriginalPath)
+			}
+			collision = result.Error
+		}
+	}
+	if collision == nil {
+		t.Fatal("expected the factory to collide with the hand-written QueueFactory")
+	}
+	if code := diagnostic.FromError("", collision).Code; code != diagnostic.CodeOutputCollision {
+		t.Errorf("expected %s, got %s", diagnostic.CodeOutputCollision, code)
+	}
+	if !strings.Contains(collision.Error(), "(from Queue.peak)") {
+		t.Errorf("unexpected message: %v", collision)
+	}
+}
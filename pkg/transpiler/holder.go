@@ -0,0 +1,206 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// shadowedTypes are Apex types an inner class must not be named after: inside the
+// holder, the inner class would hide them from every other inner class
+var shadowedTypes = map[string]bool{
+	"blob": true, "boolean": true, "date": true, "datetime": true, "decimal": true, "double": true,
+	"id": true, "integer": true, "long": true, "object": true, "string": true, "time": true,
+	"sobject": true, "list": true, "set": true, "map": true, "type": true, "schema": true,
+	"system": true, "database": true, "json": true, "math": true, "limits": true, "test": true,
+}
+
+// innerTypePattern matches the declaration of a class, interface or enum
+var innerTypePattern = regexp.MustCompile(`(?i)\b(?:class|interface|enum)\s+[A-Za-z_]\w*`)
+
+// staticPattern matches the static modifier of a field, method or initializer block
+var staticPattern = regexp.MustCompile(`(?i)\bstatic\b`)
+
+// holderPlan is a holder class to generate for a template, with its output path resolved
+type holderPlan struct {
+	template *parser.GenericClassDef
+	result   FileResult // Output path and provenance, without content
+}
+
+// SetHolderClasses enables generating the concrete classes of each template as inner
+// classes of a single holder class, such as Queues.Integer_ and Queues.Account_ for
+// Queue<Integer> and Queue<Account>, instead of one top-level class per instantiation.
+// Usages are rewritten to the qualified inner class names.
+func (t *Transpiler) SetHolderClasses(enabled bool) {
+	t.holderClasses = enabled
+}
+
+// holderClassName names the holder class of a template with the plural of its name,
+// e.g. Queues for Queue and Boxes for Box
+func holderClassName(template *parser.GenericClassDef) string {
+	name := template.ClassName
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case len(lower) > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// innerClassName names the inner class for an instantiation after its type arguments,
+// e.g. StringInteger for Dict<String, Integer>. A trailing underscore is added when the
+// name would hide a type the class uses or an Apex built-in type, as in Integer_ for
+// Queue<Integer>: inside Queues, an inner class named Integer would replace Integer.
+func innerClassName(template *parser.GenericClassDef, expr *parser.GenericExpr) string {
+	name := strings.TrimPrefix(parser.GenerateConcreteClassName(expr), template.ClassName)
+	if shadowedTypes[strings.ToLower(name)] || usesType(expr.TypeArgs, name) {
+		name += "_"
+	}
+	return name
+}
+
+// usesType reports whether name, compared case-insensitively, is one of the types in args
+func usesType(args []parser.GenericExpr, name string) bool {
+	for _, arg := range args {
+		if strings.EqualFold(arg.BaseType, name) || usesType(arg.TypeArgs, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// classReference returns the name that refers to the concrete class generated for
+// expr from other classes: the class name, or the qualified inner class name in
+// holder mode
+func (t *Transpiler) classReference(expr *parser.GenericExpr) string {
+	template, ok := t.templates[expr.BaseType]
+	if !t.holderClasses || !ok {
+		return t.concreteClassName(expr)
+	}
+	return holderClassName(template) + "." + t.fitClassName(innerClassName(template, expr), expr)
+}
+
+// declaredClassName returns the name the concrete class for expr is declared with,
+// which also refers to it from within its own body
+func (t *Transpiler) declaredClassName(template *parser.GenericClassDef, expr *parser.GenericExpr) string {
+	if t.holderClasses {
+		return t.fitClassName(innerClassName(template, expr), expr)
+	}
+	return t.concreteClassName(expr)
+}
+
+// planHolders resolves the output of the holder class of every template with at least
+// one planned concrete class, in the order of concrete
+func (t *Transpiler) planHolders(concrete []concretePlan) []holderPlan {
+	var plans []holderPlan
+	for i, plan := range concrete {
+		if i > 0 && concrete[i-1].template == plan.template {
+			continue
+		}
+		name := holderClassName(plan.template)
+		templatePath := t.templatePaths[plan.template.ClassName]
+		outputPath := t.generatedOutputPath(plan.template.ClassName, nil, name)
+		plans = append(plans, holderPlan{
+			template: plan.template,
+			result:   FileResult{OutputPath: outputPath, TemplatePath: templatePath, Test: t.testTemplates[plan.template.ClassName]},
+		})
+	}
+	return plans
+}
+
+// declaresInnerTypes reports whether the body of template declares a class, interface
+// or enum. Apex does not allow types inside inner classes, so such a template cannot
+// be generated into a holder.
+func declaresInnerTypes(template *parser.GenericClassDef) bool {
+	return innerTypePattern.MatchString(maskNonCode(template.Body))
+}
+
+// declaresStaticMembers reports whether the body of template declares a static field,
+// method or initializer block. Apex allows static members only in top-level classes,
+// so such a template cannot be generated into a holder either.
+func declaresStaticMembers(template *parser.GenericClassDef) bool {
+	return staticPattern.MatchString(maskNonCode(template.Body))
+}
+
+// holderUnsupported describes why template cannot be generated into a holder, or
+// returns "" if it can
+func holderUnsupported(template *parser.GenericClassDef) string {
+	switch {
+	case declaresInnerTypes(template):
+		return "declares inner types"
+	case declaresStaticMembers(template):
+		return "declares static members"
+	case isDTO(template):
+		return "gets static fromJson methods from @PeakDto"
+	}
+	return ""
+}
+
+// generateHolder generates the holder class of plan's template, with an inner class for
+// each of members. It returns the holder, the members that were generated, and an error
+// result for each member that could not be.
+func (t *Transpiler) generateHolder(plan holderPlan, members []concretePlan) (FileResult, []concretePlan, []FileResult) {
+	template := plan.template
+	if reason := holderUnsupported(template); reason != "" {
+		err := diagnostic.WithCode(diagnostic.CodeHolderUnsupported,
+			fmt.Errorf("template %s %s, which Apex does not allow in the inner classes of %s; generate it without holder classes",
+				template.ClassName, reason, holderClassName(template)))
+		return FileResult{OriginalPath: plan.result.TemplatePath, Error: err}, nil, nil
+	}
+
+	modifiers := "public"
+	if hasModifier(t.classModifiers(template), "global") {
+		modifiers = "global"
+	}
+
+	var b strings.Builder
+	lines := []int{0}
+	if plan.result.Test {
+		modifiers = TestAnnotation + " " + modifiers
+	}
+	fmt.Fprintf(&b, "%s class %s {\n", modifiers, holderClassName(template))
+
+	var generated []concretePlan
+	var failures []FileResult
+	for _, member := range members {
+		content, sourceLines, err := t.concreteClassContent(member)
+		if err != nil {
+			failures = append(failures, FileResult{OriginalPath: plan.result.TemplatePath, Error: err})
+			continue
+		}
+		if len(generated) > 0 {
+			b.WriteString("\n")
+			lines = append(lines, 0)
+		}
+		for _, line := range strings.Split(content, "\n") {
+			if line != "" {
+				b.WriteString("    ")
+			}
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		lines = append(lines, sourceLines...)
+		generated = append(generated, member)
+	}
+	b.WriteString("}")
+	lines = append(lines, 0)
+
+	result := plan.result
+	result.Content = b.String()
+	result.SourceLines = lines
+	result.Members = make(map[string]string, len(generated))
+	for _, member := range generated {
+		result.Members[member.expr.String()] = t.classReference(member.expr)
+	}
+	result = t.withProvenance(result)
+	if err := t.checkOutput(result, templateSource(template), substitutedParams(template, generated)); err != nil {
+		return FileResult{OriginalPath: plan.result.TemplatePath, Error: err}, nil, failures
+	}
+	return result, generated, failures
+}
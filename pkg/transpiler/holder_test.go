@@ -0,0 +1,256 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+func TestHolderClassName(t *testing.T) {
+	tests := map[string]string{
+		"Queue":    "Queues",
+		"Box":      "Boxes",
+		"Address":  "Addresses",
+		"Batch":    "Batches",
+		"Registry": "Registries",
+		"Day":      "Days",
+	}
+	for name, expected := range tests {
+		if got := holderClassName(&parser.GenericClassDef{ClassName: name}); got != expected {
+			t.Errorf("holderClassName(%s) = %s, expected %s", name, got, expected)
+		}
+	}
+}
+
+func TestInnerClassName(t *testing.T) {
+	tests := map[string]string{
+		"Queue<Integer>":         "Integer_",
+		"Queue<Account>":         "Account_",
+		"Queue<List<Integer>>":   "ListInteger",
+		"Dict<String, Integer>":  "StringInteger",
+		"Dict<Date, Time>":       "DateTime_",
+		"Dict<String, Queue<X>>": "StringQueueX",
+	}
+	for input, expected := range tests {
+		generics, err := parser.NewParser(input).FindGenerics()
+		if err != nil || generics[input] == nil {
+			t.Fatalf("FindGenerics(%q) = %v, %v", input, generics, err)
+		}
+		expr := generics[input]
+		template := &parser.GenericClassDef{ClassName: expr.BaseType}
+		if got := innerClassName(template, expr); got != expected {
+			t.Errorf("innerClassName(%s) = %s, expected %s", input, got, expected)
+		}
+	}
+}
+
+func TestDeclaresInnerTypes(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected bool
+	}{
+		{"{\n    public T value;\n}", false},
+		{"{\n    // Not a class Foo\n    String s = 'enum Color';\n    /* interface Bar */\n}", false},
+		{"{\n    public class Node {\n        public T value;\n    }\n}", true},
+		{"{\n    public enum Color { RED }\n}", true},
+	}
+	for _, tt := range tests {
+		template := &parser.GenericClassDef{ClassName: "Tree", TypeParams: []string{"T"}, Body: tt.body}
+		if got := declaresInnerTypes(template); got != tt.expected {
+			t.Errorf("declaresInnerTypes(%q) = %v, expected %v", tt.body, got, tt.expected)
+		}
+	}
+}
+
+func TestTranspileFiles_HolderClasses(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+    public Queue() {
+        items = new List<T>();
+    }
+    public Queue<T> copy() {
+        Queue<T> other = new Queue<T>();
+        return other;
+    }
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> numbers = new Queue<Integer>();
+    private Queue<Account> accounts;
+    private Queue<Queue<Integer>> nested;
+}`,
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetHolderClasses(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	byPath := make(map[string]FileResult)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		byPath[result.OutputPath] = result
+	}
+
+	if _, ok := byPath["QueueInteger.cls"]; ok {
+		t.Error("expected no top-level concrete classes in holder mode")
+	}
+	holder, ok := byPath["Queues.cls"]
+	if !ok {
+		t.Fatalf("expected Queues.cls, got %v", results)
+	}
+	for _, want := range []string{
+		"// Generated by Peak from Queue.peak. Do not edit.\npublic class Queues {\n    public class Account_ {",
+		"    public class Integer_ {\n        private List<Integer> items;\n        public Integer_() {",
+		"        public Queues.Integer_ copy() {\n            Queues.Integer_ other = new Queues.Integer_();",
+		"    public class QueueInteger {\n        private List<Queues.Integer_> items;",
+	} {
+		if !strings.Contains(holder.Content, want) {
+			t.Errorf("expected %q in holder:\n%s", want, holder.Content)
+		}
+	}
+	if want := strings.Count(holder.Content, "\n") + 1; len(holder.SourceLines) != want {
+		t.Errorf("expected %d mapped lines, got %d", want, len(holder.SourceLines))
+	}
+	// Line 3 declares the first inner class, from the template's line 1
+	if holder.SourceLines[2] != 1 || holder.SourceLines[3] != 2 {
+		t.Errorf("unexpected line map %v", holder.SourceLines)
+	}
+	if holder.Members["Queue<Integer>"] != "Queues.Integer_" || len(holder.Members) != 3 {
+		t.Errorf("unexpected members %v", holder.Members)
+	}
+
+	example := byPath["Example.cls"].Content
+	for _, want := range []string{
+		"private Queues.Integer_ numbers = new Queues.Integer_();",
+		"private Queues.Account_ accounts;",
+		"private Queues.QueueInteger nested;",
+	} {
+		if !strings.Contains(example, want) {
+			t.Errorf("expected %q in output:\n%s", want, example)
+		}
+	}
+}
+
+func TestTranspileFiles_HolderClassesInnerTypes(t *testing.T) {
+	files := map[string]string{
+		"Tree.peak": `public class Tree<T> {
+    public class Node {
+        public T value;
+    }
+}`,
+		"Example.peak": "public class Example {\n    private Tree<Integer> tree;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetHolderClasses(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var errs []FileResult
+	for _, result := range results {
+		if result.Error != nil {
+			errs = append(errs, result)
+		}
+	}
+	if len(errs) != 1 || errs[0].OriginalPath != "Tree.peak" {
+		t.Fatalf("expected one error on the template, got %+v", errs)
+	}
+	if code := diagnostic.FromError("", errs[0].Error).Code; code != diagnostic.CodeHolderUnsupported {
+		t.Errorf("expected %s, got %s", diagnostic.CodeHolderUnsupported, code)
+	}
+}
+
+func TestGenerateRegistry_HolderMembers(t *testing.T) {
+	registry := GenerateRegistry([]FileResult{{
+		OutputPath: "Queues.cls",
+		Members:    map[string]string{"Queue<Integer>": "Queues.Integer_"},
+	}})
+	if !strings.Contains(registry, "'queue<integer>' => Queues.Integer_.class") {
+		t.Errorf("expected the inner class in the registry:\n%s", registry)
+	}
+}
+
+func TestTranspileFiles_HolderClassesStaticMembers(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		reason   string
+	}{
+		{
+			name: "static field and method",
+			template: `public class Counter<T> {
+    public static Integer count = 0;
+    public static Counter<T> create() {
+        count++;
+        return new Counter<T>();
+    }
+    // static in a comment
+    public String label = 'static';
+}`,
+			reason: "declares static members",
+		},
+		{
+			name:     "dto",
+			template: "@PeakDto\npublic class Counter<T> {\n    public T value;\n}",
+			reason:   "fromJson",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"Counter.peak": tt.template,
+				"Example.peak": "public class Example {\n    private Counter<Integer> counter;\n}",
+			}
+			tr := NewTranspiler(nil)
+			tr.SetHolderClasses(true)
+			results, err := tr.TranspileFiles(files)
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+
+			var errs []FileResult
+			for _, result := range results {
+				if result.Error != nil {
+					errs = append(errs, result)
+				} else if strings.Contains(result.Content, "static") {
+					t.Errorf("expected no static members in %s:\n%s", result.OutputPath, result.Content)
+				}
+			}
+			if len(errs) != 1 || errs[0].OriginalPath != "Counter.peak" {
+				t.Fatalf("expected one error on the template, got %+v", errs)
+			}
+			if code := diagnostic.FromError("", errs[0].Error).Code; code != diagnostic.CodeHolderUnsupported {
+				t.Errorf("expected %s, got %s", diagnostic.CodeHolderUnsupported, code)
+			}
+			if !strings.Contains(errs[0].Error.Error(), tt.reason) {
+				t.Errorf("expected %q in %v", tt.reason, errs[0].Error)
+			}
+		})
+	}
+}
+
+func TestDeclaresStaticMembers(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected bool
+	}{
+		{"{ public static Integer count = 0; }", true},
+		{"{ static { init(); } }", true},
+		{"{ public T value; // not static\n}", false},
+		{"{ String s = 'static'; Integer staticCount; }", false},
+	}
+	for _, tt := range tests {
+		if got := declaresStaticMembers(&parser.GenericClassDef{Body: tt.body}); got != tt.expected {
+			t.Errorf("declaresStaticMembers(%q) = %v, expected %v", tt.body, got, tt.expected)
+		}
+	}
+}
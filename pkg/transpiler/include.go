@@ -0,0 +1,159 @@
+package transpiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// includePattern matches a line holding only a "// peak:include path" comment,
+// capturing the path
+var includePattern = regexp.MustCompile(`^[ \t]*//[ \t]*peak:include\b[ \t]*(.*?)[ \t]*$`)
+
+// includedLine records where a line of a source with its includes expanded comes from
+type includedLine struct {
+	line        int    // Line in the source: the line itself, or the peak:include that brought it in
+	snippet     string // Snippet file the line comes from, or "" for the source's own lines
+	snippetLine int    // Line in the snippet
+}
+
+// SetIncludeReader sets the function that reads the snippets named by
+// "// peak:include" directives. By default they are read from disk.
+func (t *Transpiler) SetIncludeReader(read func(path string) (string, error)) {
+	t.readInclude = read
+}
+
+// readIncludeFile reads a snippet from disk
+func readIncludeFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+// expandIncludes replaces each "// peak:include path" line of content, the source at
+// path, with the contents of the snippet it names, resolved relative to the directory
+// of the file containing the directive. Snippets may include other snippets. Where
+// each line of the result comes from is recorded for path, so outputs, diagnostics
+// and templates can be located in the source, see sourceLine.
+func (t *Transpiler) expandIncludes(path, content string) (string, error) {
+	delete(t.included, path)
+	if !strings.Contains(content, "peak:include") {
+		return content, nil
+	}
+	lines, origins, err := t.expandSnippet(path, content, []string{filepath.Clean(path)})
+	if err != nil {
+		return content, diagnostic.WithCode(diagnostic.CodeInclude, err)
+	}
+	if origins == nil {
+		return content, nil
+	}
+	t.included[path] = origins
+	return strings.Join(lines, "\n"), nil
+}
+
+// expandSnippet returns the lines of content, the file at path, with its includes
+// expanded, and the origin of each line relative to path, or nil origins if content
+// includes nothing. chain holds the files being expanded, to detect cycles. Errors
+// are located at the directive in path.
+func (t *Transpiler) expandSnippet(path, content string, chain []string) ([]string, []includedLine, error) {
+	lines := strings.Split(content, "\n")
+	var expanded []string
+	var origins []includedLine
+	found := false
+	for i, line := range lines {
+		match := includePattern.FindStringSubmatch(line)
+		if match == nil {
+			expanded = append(expanded, line)
+			origins = append(origins, includedLine{line: i + 1})
+			continue
+		}
+
+		found = true
+		column := strings.Index(line, "peak:include") + 1
+		if match[1] == "" {
+			return nil, nil, diagnostic.At(i+1, column, errors.New("peak:include requires a path"))
+		}
+		snippet := match[1]
+		if !filepath.IsAbs(snippet) {
+			snippet = filepath.Join(filepath.Dir(path), snippet)
+		}
+		snippet = filepath.Clean(snippet)
+		if slices.Contains(chain, snippet) {
+			return nil, nil, diagnostic.At(i+1, column, fmt.Errorf("peak:include '%s' forms a cycle", match[1]))
+		}
+		snippetContent, err := t.readInclude(snippet)
+		if err != nil {
+			return nil, nil, diagnostic.At(i+1, column, fmt.Errorf("cannot read peak:include '%s': %w", match[1], err))
+		}
+		snippetContent = strings.TrimSuffix(strings.ReplaceAll(snippetContent, "\r\n", "\n"), "\n")
+		snippetLines, snippetOrigins, err := t.expandSnippet(snippet, snippetContent, append(chain, snippet))
+		if err != nil {
+			return nil, nil, diagnostic.At(i+1, column, fmt.Errorf("in '%s': %w", match[1], err))
+		}
+
+		expanded = append(expanded, snippetLines...)
+		for j := range snippetLines {
+			origin := includedLine{line: i + 1, snippet: snippet, snippetLine: j + 1}
+			if snippetOrigins != nil {
+				origin.snippetLine = snippetOrigins[j].line
+				if snippetOrigins[j].snippet != "" {
+					origin.snippet, origin.snippetLine = snippetOrigins[j].snippet, snippetOrigins[j].snippetLine
+				}
+			}
+			origins = append(origins, origin)
+		}
+	}
+	if !found {
+		return lines, nil, nil
+	}
+	return expanded, origins, nil
+}
+
+// sourceLine returns the line of the source at path that line of its expanded
+// content comes from: the peak:include directive for lines of a snippet
+func (t *Transpiler) sourceLine(path string, line int) int {
+	if origins := t.included[path]; line > 0 && line <= len(origins) {
+		return origins[line-1].line
+	}
+	return line
+}
+
+// locateIncludedLines maps the source lines of result, and the location of its
+// error, from the expanded content of its source back to the source. An error in
+// a snippet is reported at the peak:include directive, with a note at the snippet.
+func (t *Transpiler) locateIncludedLines(result FileResult) FileResult {
+	path := result.OriginalPath
+	if result.TemplatePath != "" {
+		path = result.TemplatePath
+	}
+	origins := t.included[path]
+	if origins == nil {
+		return result
+	}
+
+	if result.SourceLines != nil {
+		lines := make([]int, len(result.SourceLines))
+		for i, line := range result.SourceLines {
+			lines[i] = t.sourceLine(path, line)
+		}
+		result.SourceLines = lines
+	}
+	if result.Error != nil && result.TemplatePath == "" {
+		d := diagnostic.FromError(path, result.Error)
+		if d.Line > 0 && d.Line <= len(origins) {
+			origin := origins[d.Line-1]
+			if origin.snippet == "" {
+				result.Error = diagnostic.At(origin.line, d.Column, result.Error)
+			} else {
+				result.Error = diagnostic.At(origin.line, 0, diagnostic.WithNote(origin.snippet, origin.snippetLine, d.Column,
+					"in this line of the included snippet", result.Error))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package transpiler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// snippetReader returns an include reader serving snippets from a map
+func snippetReader(snippets map[string]string) func(string) (string, error) {
+	return func(path string) (string, error) {
+		content, ok := snippets[filepath.ToSlash(path)]
+		if !ok {
+			return "", os.ErrNotExist
+		}
+		return content, nil
+	}
+}
+
+func TestTranspileFiles_Include(t *testing.T) {
+	files := map[string]string{
+		"src/Queue.peak": "public class Queue<T> {\n" +
+			"    private List<T> items;\n" +
+			"    // peak:include ../shared/Common.peakpart\n" +
+			"    public T peek() { return items[0]; }\n" +
+			"}",
+		"src/Use.peak": "public class Use {\n    Queue<Integer> q;\n}",
+	}
+	tr := NewTranspiler(nil)
+	tr.SetIncludeReader(snippetReader(map[string]string{
+		"shared/Common.peakpart": "    public Boolean isEmpty() { return items.isEmpty(); }\r\n    // peak:include Count.peakpart\r\n",
+		"shared/Count.peakpart":  "    public Integer count() { return items.size(); }\n",
+	}))
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	var queue *FileResult
+	for i, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		if result.OutputPath == "src/QueueInteger.cls" {
+			queue = &results[i]
+		}
+	}
+	if queue == nil {
+		t.Fatal("expected src/QueueInteger.cls")
+	}
+	want := "public class QueueInteger {\n" +
+		"    private List<Integer> items;\n" +
+		"    public Boolean isEmpty() { return items.isEmpty(); }\n" +
+		"    public Integer count() { return items.size(); }\n" +
+		"    public Integer peek() { return items[0]; }\n" +
+		"}"
+	if !strings.HasSuffix(queue.Content, want) {
+		t.Errorf("expected output ending in:\n%s\ngot:\n%s", want, queue.Content)
+	}
+	// Snippet lines map to the peak:include directive
+	if lines := []int{0, 1, 2, 3, 3, 4, 5}; !reflect.DeepEqual(queue.SourceLines, lines) {
+		t.Errorf("expected source lines %v, got %v", lines, queue.SourceLines)
+	}
+	if infos := tr.Templates(); len(infos) != 1 || infos[0].Line != 1 {
+		t.Errorf("expected Queue at line 1, got %+v", infos)
+	}
+}
+
+func TestTranspileFiles_IncludeErrors(t *testing.T) {
+	snippets := map[string]string{
+		"A.peakpart": "// peak:include B.peakpart",
+		"B.peakpart": "    // peak:include A.peakpart",
+		"C.peakpart": "    Queue<Integer, String> bad;",
+	}
+	tests := []struct {
+		name    string
+		include string
+		code    string
+		line    int
+		column  int
+		message string
+		note    diagnostic.Note
+	}{
+		{"missing path", "// peak:include", diagnostic.CodeInclude, 3, 8, "requires a path", diagnostic.Note{}},
+		{"missing snippet", "// peak:include Missing.peakpart", diagnostic.CodeInclude, 3, 8, "cannot read peak:include 'Missing.peakpart'", diagnostic.Note{}},
+		{"cycle", "// peak:include A.peakpart", diagnostic.CodeInclude, 3, 8, "in 'A.peakpart': in 'B.peakpart': peak:include 'A.peakpart' forms a cycle", diagnostic.Note{}},
+		{"error in snippet", "// peak:include C.peakpart", diagnostic.CodeTypeArgCount, 3, 0, "Queue takes 1 type argument(s)",
+			diagnostic.Note{File: "C.peakpart", Line: 1, Column: 5, Message: "in this line of the included snippet"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"Queue.peak": "public class Queue<T> {\n}",
+				"Use.peak":   "public class Use {\n    Queue<Integer> q;\n    " + tt.include + "\n}",
+			}
+			tr := NewTranspiler(nil)
+			tr.SetIncludeReader(snippetReader(snippets))
+			results, err := tr.TranspileFiles(files)
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Error == nil {
+				t.Fatalf("expected a single error, got %+v", results)
+			}
+			d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+			if d.File != "Use.peak" || d.Code != tt.code || d.Line != tt.line || d.Column != tt.column || !strings.Contains(d.Message, tt.message) {
+				t.Errorf("expected %s at Use.peak:%d:%d containing %q, got %+v", tt.code, tt.line, tt.column, tt.message, d)
+			}
+			if tt.note.File != "" && (len(d.Notes) == 0 || d.Notes[0] != tt.note) {
+				t.Errorf("expected note %+v, got %+v", tt.note, d.Notes)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package transpiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// Fingerprints identify the inputs each output of a run was generated from, by output
+// path. An output whose fingerprint is the same in two runs has the same content.
+type Fingerprints map[string]string
+
+// SetIncremental makes the transpiler fingerprint the inputs of every output, see
+// Fingerprints, and skip generating the outputs whose fingerprint equals the one in
+// previous: those are emitted with Unchanged set and without content. A source output
+// depends on the source and on the files of the templates it uses, a concrete class on
+// the file of its template and its type arguments, and a holder or factory class on the
+// file of its template and all of its instantiations; every output also depends on the
+// names and type parameters of all templates. Settings, such as the output paths and
+// visibility, are not part of fingerprints, so previous must be nil whenever they change.
+// A nil previous generates every output, as in the first build of a watch session.
+func (t *Transpiler) SetIncremental(previous Fingerprints) {
+	t.incremental = true
+	t.previous = previous
+}
+
+// Fingerprints returns the fingerprints of the outputs planned by the last run, including
+// outputs that failed, for SetIncremental on the next run. Callers should pass on only
+// the fingerprints of outputs that were written.
+func (t *Transpiler) Fingerprints() Fingerprints {
+	return t.fingerprints
+}
+
+// recordContent remembers the hash of content, the source at path after its includes
+// and constants are expanded, for fingerprinting
+func (t *Transpiler) recordContent(path, content string) {
+	if t.incremental {
+		t.contentHashes[path] = hashStrings(content)
+	}
+}
+
+// fingerprintPlans fingerprints the planned outputs: sources, then concrete classes,
+// holders and factories, each from what can change its content
+func (t *Transpiler) fingerprintPlans(sources []FileResult, concrete []concretePlan, holders []holderPlan, factories []factoryPlan) {
+	if !t.incremental {
+		return
+	}
+	signature := t.templateSignature()
+
+	// Templates each source uses, the inverse of users
+	uses := make(map[string][]string)
+	for name, paths := range t.users {
+		for path := range paths {
+			uses[path] = append(uses[path], name)
+		}
+	}
+	for _, result := range sources {
+		parts := []string{signature, t.contentHashes[result.OriginalPath]}
+		names := uses[result.OriginalPath]
+		sort.Strings(names)
+		for _, name := range names {
+			parts = append(parts, name, t.contentHashes[t.templateFile(name)])
+		}
+		// Concrete methods are generated from every call of the source's generic methods
+		var keys []string
+		for key, path := range t.methodPaths {
+			if path == result.OriginalPath {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			parts = append(parts, key, strings.Join(t.methodUsages[key], ","))
+		}
+		t.fingerprints[result.OutputPath] = hashStrings(parts...)
+	}
+
+	instantiations := make(map[*parser.GenericClassDef][]string)
+	for _, plan := range concrete {
+		t.fingerprints[plan.result.OutputPath] = hashStrings(signature, t.contentHashes[plan.result.TemplatePath], plan.result.Instantiation)
+		instantiations[plan.template] = append(instantiations[plan.template], plan.result.Instantiation)
+	}
+	group := func(template *parser.GenericClassDef, result FileResult) {
+		exprs := append([]string(nil), instantiations[template]...)
+		sort.Strings(exprs)
+		t.fingerprints[result.OutputPath] = hashStrings(signature, t.contentHashes[result.TemplatePath], strings.Join(exprs, ";"))
+	}
+	for _, plan := range holders {
+		group(plan.template, plan.result)
+	}
+	for _, plan := range factories {
+		group(plan.template, plan.result)
+	}
+}
+
+// templateSignature describes the names, type parameters and files of all templates,
+// on which the rewriting of every generic expression depends
+func (t *Transpiler) templateSignature() string {
+	var parts []string
+	for name, template := range t.templates {
+		parts = append(parts, name+"<"+strings.Join(template.TypeParams, ",")+">@"+t.templatePaths[name])
+	}
+	for key, method := range t.methodTemplates {
+		parts = append(parts, key+"<"+strings.Join(method.TypeParams, ",")+">@"+t.methodPaths[key])
+	}
+	sort.Strings(parts)
+	return hashStrings(parts...)
+}
+
+// templateFile returns the file of the class or method template named name
+func (t *Transpiler) templateFile(name string) string {
+	if path, ok := t.templatePaths[name]; ok {
+		return path
+	}
+	return t.methodPaths[name]
+}
+
+// unchanged reports whether result, a planned output, would be generated with the same
+// content as in the previous run, and so can be skipped
+func (t *Transpiler) unchanged(result FileResult) bool {
+	previous, ok := t.previous[result.OutputPath]
+	return ok && previous == t.fingerprints[result.OutputPath]
+}
+
+// unchangedResult returns the result emitted for a skipped output
+func unchangedResult(result FileResult) FileResult {
+	return FileResult{
+		OriginalPath:  result.OriginalPath,
+		OutputPath:    result.OutputPath,
+		TemplatePath:  result.TemplatePath,
+		Instantiation: result.Instantiation,
+		Unchanged:     true,
+	}
+}
+
+// hashStrings returns the hex SHA-256 of parts, separated so that no two lists of
+// parts hash alike
+func hashStrings(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
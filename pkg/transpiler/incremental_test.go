@@ -0,0 +1,70 @@
+package transpiler
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestTranspileFiles_Incremental(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer> numbers;\n}",
+		"Other.peak":   "public class Other {\n    Integer count;\n}",
+	}
+
+	// build transpiles files after the previous build, returning the outputs it regenerated
+	var previous Fingerprints
+	build := func() []string {
+		t.Helper()
+		tr := NewTranspiler(nil)
+		tr.SetIncremental(previous)
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+		var generated []string
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+			}
+			if result.Unchanged && result.Content != "" {
+				t.Errorf("expected no content for unchanged %s", result.OutputPath)
+			}
+			if !result.IsTemplate && !result.Unchanged {
+				generated = append(generated, result.OutputPath)
+			}
+		}
+		sort.Strings(generated)
+		previous = tr.Fingerprints()
+		return generated
+	}
+
+	steps := []struct {
+		name      string
+		file      string
+		content   string
+		generated []string
+	}{
+		{"first build", "", "", []string{"Example.cls", "Other.cls", "QueueInteger.cls"}},
+		{"no change", "", "", nil},
+		{"usage edited", "Example.peak", "public class Example {\n    Queue<Integer> numbers;\n    Queue<String> names;\n}", []string{"Example.cls", "QueueString.cls"}},
+		{"template edited", "Queue.peak", "public class Queue<T> {\n    private List<T> items = new List<T>();\n}", []string{"Example.cls", "QueueInteger.cls", "QueueString.cls"}},
+		{"unrelated source edited", "Other.peak", "public class Other {\n    Long count;\n}", []string{"Other.cls"}},
+	}
+	for _, step := range steps {
+		if step.file != "" {
+			files[step.file] = step.content
+		}
+		generated := build()
+		if len(generated) != len(step.generated) {
+			t.Errorf("%s: expected %v to be generated, got %v", step.name, step.generated, generated)
+			continue
+		}
+		for i := range generated {
+			if generated[i] != step.generated[i] {
+				t.Errorf("%s: expected %v to be generated, got %v", step.name, step.generated, generated)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// maxReportedTemplates is the number of templates named in a class limit diagnostic
+const maxReportedTemplates = 5
+
+// SetClassLimit reports runs that would generate more concrete classes than
+// limit.Max (nil = unlimited). With severity "warning" the report is one of the
+// Warnings; with "error" it is an error result and nothing is generated.
+func (t *Transpiler) SetClassLimit(limit *config.ClassLimit) {
+	t.classLimit = limit
+}
+
+// checkClassLimit returns a diagnostic if the planned concrete classes that are not
+// duplicates exceed the class limit, or nil. The message breaks the count down by
+// template and names the most deeply nested instantiation, as runaway counts usually
+// come from nesting, and the diagnostic is reported on the largest template.
+func (t *Transpiler) checkClassLimit(concrete []concretePlan, duplicate func(int) bool) *diagnostic.Diagnostic {
+	if t.classLimit == nil || t.classLimit.Max <= 0 {
+		return nil
+	}
+
+	counts := make(map[*parser.GenericClassDef]int)
+	var total int
+	var deepest *parser.GenericExpr
+	for i, plan := range concrete {
+		if duplicate(i) {
+			continue
+		}
+		total++
+		counts[plan.template]++
+		if deepest == nil || nestingDepth(plan.expr) > nestingDepth(deepest) {
+			deepest = plan.expr
+		}
+	}
+	if total <= t.classLimit.Max {
+		return nil
+	}
+
+	templates := make([]*parser.GenericClassDef, 0, len(counts))
+	for template := range counts {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if counts[templates[i]] != counts[templates[j]] {
+			return counts[templates[i]] > counts[templates[j]]
+		}
+		return templates[i].ClassName < templates[j].ClassName
+	})
+
+	breakdown := make([]string, 0, maxReportedTemplates+1)
+	for i, template := range templates {
+		if i == maxReportedTemplates {
+			breakdown = append(breakdown, fmt.Sprintf("%d more template(s)", len(templates)-i))
+			break
+		}
+		breakdown = append(breakdown, fmt.Sprintf("%s %d", template.ClassName, counts[template]))
+	}
+
+	severity := diagnostic.SeverityWarning
+	if t.classLimit.Severity == config.LimitError {
+		severity = diagnostic.SeverityError
+	}
+	return &diagnostic.Diagnostic{
+		Severity: severity,
+		Code:     diagnostic.CodeTooManyClasses,
+		File:     t.templatePaths[templates[0].ClassName],
+		Message: fmt.Sprintf("run would generate %d concrete classes, more than the limit of %d (%s); deepest nesting: %s",
+			total, t.classLimit.Max, strings.Join(breakdown, ", "), deepest.String()),
+	}
+}
+
+// nestingDepth returns how deeply generic expressions are nested in expr:
+// 1 for Queue<Integer>, 2 for Queue<List<Integer>>, and 0 for simple types
+func nestingDepth(expr *parser.GenericExpr) int {
+	if expr.IsSimple || len(expr.TypeArgs) == 0 {
+		return 0
+	}
+	depth := 0
+	for i := range expr.TypeArgs {
+		depth = max(depth, nestingDepth(&expr.TypeArgs[i]))
+	}
+	return depth + 1
+}
@@ -0,0 +1,108 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+func TestNestingDepth(t *testing.T) {
+	tests := map[string]int{
+		"Queue<Integer>":                1,
+		"Queue<List<Integer>>":          2,
+		"Dict<String, Queue<List<Id>>>": 3,
+	}
+	for input, expected := range tests {
+		generics, err := parser.NewParser(input).FindGenerics()
+		if err != nil || generics[input] == nil {
+			t.Fatalf("FindGenerics(%q) = %v, %v", input, generics, err)
+		}
+		if got := nestingDepth(generics[input]); got != expected {
+			t.Errorf("nestingDepth(%q) = %d, expected %d", input, got, expected)
+		}
+	}
+}
+
+var classLimitFiles = map[string]string{
+	"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n}",
+	"Dict.peak":  "public class Dict<K, V> {\n    private Map<K, V> items;\n}",
+	"Example.peak": `public class Example {
+    private Queue<Integer> a;
+    private Queue<String> b;
+    private Queue<string> duplicate;
+    private Queue<Queue<Integer>> c;
+    private Dict<String, Integer> d;
+}`,
+}
+
+func TestTranspileFiles_ClassLimitWarning(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetClassLimit(&config.ClassLimit{Max: 3, Severity: config.LimitWarning})
+	results, err := tr.TranspileFiles(classLimitFiles)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var generated int
+	for _, result := range results {
+		if result.Instantiation != "" {
+			generated++
+		}
+	}
+	if generated != 4 {
+		t.Errorf("expected the classes to be generated despite the warning, got %d", generated)
+	}
+
+	warnings := tr.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("expected one warning, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Code != diagnostic.CodeTooManyClasses || w.Severity != diagnostic.SeverityWarning || w.File != "Queue.peak" {
+		t.Errorf("unexpected warning %+v", w)
+	}
+	// Queue<string> duplicates Queue<String> and is not counted
+	want := "run would generate 4 concrete classes, more than the limit of 3 (Queue 3, Dict 1); deepest nesting: Queue<Queue<Integer>>"
+	if w.Message != want {
+		t.Errorf("expected message %q, got %q", want, w.Message)
+	}
+}
+
+func TestTranspileFiles_ClassLimitError(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetClassLimit(&config.ClassLimit{Max: 3, Severity: config.LimitError})
+	results, err := tr.TranspileFiles(classLimitFiles)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected a single error result, got %+v", results)
+	}
+	if code := diagnostic.FromError("", results[0].Error).Code; code != diagnostic.CodeTooManyClasses {
+		t.Errorf("expected %s, got %s", diagnostic.CodeTooManyClasses, code)
+	}
+	if results[0].OriginalPath != "Queue.peak" || !strings.Contains(results[0].Error.Error(), "limit of 3") {
+		t.Errorf("unexpected error result %+v", results[0])
+	}
+}
+
+func TestTranspileFiles_ClassLimitNotExceeded(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetClassLimit(&config.ClassLimit{Max: 4, Severity: config.LimitError})
+	results, err := tr.TranspileFiles(classLimitFiles)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("unexpected error: %v", result.Error)
+		}
+	}
+	if len(tr.Warnings()) != 0 {
+		t.Errorf("unexpected warnings %v", tr.Warnings())
+	}
+}
@@ -0,0 +1,137 @@
+package transpiler
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// dynamicTypeCalls are the Apex methods whose string arguments name a type at runtime.
+// Apex is case-insensitive, so they are matched regardless of case.
+var dynamicTypeCalls = []string{"Type.forName", "JSON.deserializeStrict", "JSON.deserialize"}
+
+// stringLiteralEnd returns the position just after the Apex string literal that
+// starts with the quote at content[start], or the end of the line if it is unterminated
+func stringLiteralEnd(content string, start int) int {
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++ // Skip the escaped character, which may be a quote
+		case '\'':
+			return i + 1
+		case '\n':
+			// Apex strings cannot span lines; stop at the newline so an
+			// unbalanced quote does not swallow the rest of the file
+			return i
+		}
+	}
+	return len(content)
+}
+
+// maskStringLiterals blanks out the contents of string literals, keeping the quotes,
+// line breaks and every offset unchanged, so that text in strings such as
+// 'Queue<Integer> is empty' is not mistaken for a generic usage
+func maskStringLiterals(content string) string {
+	if strings.IndexByte(content, '\'') < 0 {
+		return content
+	}
+	return mask(content, parser.TokenString)
+}
+
+// maskNonCode blanks out comments as well as the contents of string literals,
+// keeping line breaks and every offset unchanged, so that only code remains
+func maskNonCode(content string) string {
+	return mask(content, parser.TokenString, parser.TokenComment)
+}
+
+// mask blanks out the tokens of the given kinds, except for line breaks and the
+// quotes around string literals
+func mask(content string, kinds ...parser.TokenKind) string {
+	masked := []byte(content)
+	for _, tok := range parser.Tokenize(content) {
+		if !slices.Contains(kinds, tok.Kind) {
+			continue
+		}
+		start, end := tok.Pos, tok.End()
+		if tok.Kind == parser.TokenString {
+			start++ // Keep the opening quote
+			if len(tok.Text) >= 2 && strings.HasSuffix(tok.Text, "'") {
+				end-- // and the closing one
+			}
+		}
+		for i := start; i < end; i++ {
+			if content[i] != '\n' {
+				masked[i] = ' '
+			}
+		}
+	}
+	return string(masked)
+}
+
+// findDynamicTypeLiterals returns the string literal arguments of dynamic type calls
+// such as Type.forName('Queue<Integer>'), keyed by the position of their opening
+// quote, with their contents as values. Literals in nested calls are included.
+func findDynamicTypeLiterals(content string) map[int]string {
+	literals := make(map[int]string)
+
+	var tokens []parser.Token
+	for _, tok := range parser.Tokenize(content) {
+		if tok.Kind != parser.TokenComment {
+			tokens = append(tokens, tok)
+		}
+	}
+	for i := range tokens {
+		if i > 0 && tokens[i-1].Kind == parser.TokenIdentifier && tokens[i-1].End() == tokens[i].Pos {
+			continue // Not the start of a name
+		}
+		for _, call := range dynamicTypeCalls {
+			if open := matchCall(tokens, i, call); open > 0 {
+				collectCallLiterals(tokens, open, literals)
+				// Scanning goes on inside the arguments, so nested calls are found too
+				break
+			}
+		}
+	}
+	return literals
+}
+
+// matchCall returns the index of the opening parenthesis of the call of the dotted
+// name call, in any casing, whose name starts at tokens[i], or 0 if there is none
+func matchCall(tokens []parser.Token, i int, call string) int {
+	for n, part := range strings.Split(call, ".") {
+		if n > 0 {
+			if i >= len(tokens) || !tokens[i].IsPunct('.') || tokens[i].Pos != tokens[i-1].End() {
+				return 0
+			}
+			i++
+		}
+		if i >= len(tokens) || !tokens[i].IsKeyword(part) || (n > 0 && tokens[i].Pos != tokens[i-1].End()) {
+			return 0
+		}
+		i++
+	}
+	if i >= len(tokens) || !tokens[i].IsPunct('(') {
+		return 0
+	}
+	return i
+}
+
+// collectCallLiterals records the string literals passed directly as arguments
+// of the call whose opening parenthesis is tokens[open]
+func collectCallLiterals(tokens []parser.Token, open int, literals map[int]string) {
+	depth := 0
+	for _, tok := range tokens[open:] {
+		switch {
+		case tok.IsPunct('('):
+			depth++
+		case tok.IsPunct(')'):
+			depth--
+			if depth == 0 {
+				return
+			}
+		case tok.Kind == parser.TokenString && depth == 1 && len(tok.Text) >= 2 && strings.HasSuffix(tok.Text, "'"):
+			literals[tok.Pos] = tok.Text[1 : len(tok.Text)-1]
+		}
+	}
+}
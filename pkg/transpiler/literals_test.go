@@ -0,0 +1,76 @@
+package transpiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskStringLiterals(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"Queue<Integer> q;", "Queue<Integer> q;"},
+		{"String s = 'Queue<Integer>';", "String s = '              ';"},
+		{`String s = 'it\'s Queue<A>'; Queue<B> q;`, `String s = '              '; Queue<B> q;`},
+		{"// it's Queue<A>\nQueue<B> q;", "// it's Queue<A>\nQueue<B> q;"},
+		{"/* 'Queue<A>' */ 'x'", "/* 'Queue<A>' */ ' '"},
+		{"String s = 'unterminated\nQueue<B> q;", "String s = '            \nQueue<B> q;"},
+	}
+	for _, tt := range tests {
+		got := maskStringLiterals(tt.content)
+		if got != tt.expected {
+			t.Errorf("maskStringLiterals(%q) = %q, expected %q", tt.content, got, tt.expected)
+		}
+		if len(got) != len(tt.content) {
+			t.Errorf("maskStringLiterals(%q) changed the length", tt.content)
+		}
+	}
+}
+
+func TestFindDynamicTypeLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[int]string
+	}{
+		{
+			name:     "Type.forName",
+			content:  "Type t = Type.forName('Queue<Integer>');",
+			expected: map[int]string{22: "Queue<Integer>"},
+		},
+		{
+			name:     "namespace argument and case",
+			content:  "type.FORNAME('ns', 'Queue<Integer>')",
+			expected: map[int]string{13: "ns", 19: "Queue<Integer>"},
+		},
+		{
+			name:     "nested call",
+			content:  "JSON.deserialize(body, Type.forName('Queue<Integer>'))",
+			expected: map[int]string{36: "Queue<Integer>"},
+		},
+		{
+			name:     "deserializeStrict",
+			content:  "JSON.deserializeStrict(body, 'Queue<Integer>')",
+			expected: map[int]string{29: "Queue<Integer>"},
+		},
+		{
+			name:     "literal inside another call is not an argument",
+			content:  "Type.forName(prefix('Queue<Integer>'))",
+			expected: map[int]string{},
+		},
+		{
+			name:     "other calls and comments",
+			content:  "log('Queue<Integer>'); // Type.forName('Queue<String>')\nMyType.forName('Queue<Date>')",
+			expected: map[int]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findDynamicTypeLiterals(tt.content)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("findDynamicTypeLiterals(%q) = %v, expected %v", tt.content, got, tt.expected)
+			}
+		})
+	}
+}
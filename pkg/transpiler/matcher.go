@@ -0,0 +1,58 @@
+package transpiler
+
+// patternMatcher finds the longest of a fixed set of patterns starting at a given
+// position, walking a byte trie so the cost depends on the length of the match
+// rather than on the number of patterns.
+type patternMatcher struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children    map[byte]*trieNode
+	replacement string
+	terminal    bool // A pattern ends at this node
+}
+
+// newPatternMatcher builds a matcher for the keys of replacements
+func newPatternMatcher(replacements map[string]string) *patternMatcher {
+	m := &patternMatcher{root: &trieNode{}}
+	for pattern, replacement := range replacements {
+		if pattern == "" {
+			continue
+		}
+		node := m.root
+		for i := 0; i < len(pattern); i++ {
+			if node.children == nil {
+				node.children = make(map[byte]*trieNode)
+			}
+			child, ok := node.children[pattern[i]]
+			if !ok {
+				child = &trieNode{}
+				node.children[pattern[i]] = child
+			}
+			node = child
+		}
+		node.terminal = true
+		node.replacement = replacement
+	}
+	return m
+}
+
+// match returns the replacement for the longest pattern starting at content[i:]
+// and the pattern's length, or 0 if no pattern starts there
+func (m *patternMatcher) match(content string, i int) (string, int) {
+	var replacement string
+	length := 0
+	node := m.root
+	for j := i; j < len(content); j++ {
+		node = node.children[content[j]]
+		if node == nil {
+			break
+		}
+		if node.terminal {
+			replacement = node.replacement
+			length = j - i + 1
+		}
+	}
+	return replacement, length
+}
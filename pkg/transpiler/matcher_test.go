@@ -0,0 +1,58 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+func TestPatternMatcher(t *testing.T) {
+	m := newPatternMatcher(map[string]string{
+		"Queue<Integer>":       "QueueInteger",
+		"Queue<List<Integer>>": "QueueListInteger",
+		"Dict<String,Integer>": "DictStringInteger",
+	})
+
+	tests := []struct {
+		content     string
+		pos         int
+		replacement string
+		length      int
+	}{
+		{"Queue<Integer> q;", 0, "QueueInteger", len("Queue<Integer>")},
+		{"Queue<List<Integer>> q;", 0, "QueueListInteger", len("Queue<List<Integer>>")},
+		{"new Queue<Integer>()", 4, "QueueInteger", len("Queue<Integer>")},
+		{"new Queue<Integer>()", 3, "", 0},
+		{"Queue<Int", 0, "", 0},
+		{"Dict<String,Integer>", 0, "DictStringInteger", len("Dict<String,Integer>")},
+	}
+	for _, tt := range tests {
+		replacement, length := m.match(tt.content, tt.pos)
+		if replacement != tt.replacement || length != tt.length {
+			t.Errorf("match(%q, %d) = (%q, %d), want (%q, %d)", tt.content, tt.pos, replacement, length, tt.replacement, tt.length)
+		}
+	}
+}
+
+func TestReplaceGenericUsages_ManyInstantiations(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.templates["Queue"] = &parser.GenericClassDef{ClassName: "Queue", TypeParams: []string{"T"}}
+
+	// Hundreds of distinct instantiations, some of them prefixes of others
+	generics := make(map[string]*parser.GenericExpr)
+	var input, expected strings.Builder
+	for i := 0; i < 300; i++ {
+		arg := fmt.Sprintf("Type%d", i)
+		original := "Queue<" + arg + ">"
+		generics[original] = &parser.GenericExpr{BaseType: "Queue", TypeArgs: []parser.GenericExpr{{BaseType: arg}}}
+		fmt.Fprintf(&input, "%s q%d; // %s\n", original, i, original)
+		fmt.Fprintf(&expected, "Queue%s q%d; // %s\n", arg, i, original)
+	}
+
+	result := tr.replaceGenericUsages(input.String(), generics)
+	if result != expected.String() {
+		t.Errorf("unexpected replacement result:\n%s", result)
+	}
+}
@@ -0,0 +1,227 @@
+package transpiler
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// methodCall is a call of a generic method with explicit type arguments, such as
+// repo.get<Account>('key'), located by the offsets of get<Account> in its source
+type methodCall struct {
+	start, end int
+	name       string // Concrete method name, e.g. getAccount
+}
+
+// collectMethodCalls adds the generic method instantiations that calls in content,
+// the non-template source at path, pass type arguments to, as in repo.get<Account>(
+// or Repository.get<Account>(, and records the calls for rewriting to the concrete
+// method names. A call qualified by a class name, or an unqualified call of a method
+// of the source's own class, names its method; any other call must match the generic
+// method of a single class. Calls with the type parameters of the source's own
+// generic methods are left to the concrete methods generated from them.
+func (t *Transpiler) collectMethodCalls(path, content string) error {
+	delete(t.methodCalls, path)
+	if len(t.methodTemplates) == 0 || t.isTemplateFile(path) {
+		return nil
+	}
+
+	className := t.extractClassName(content)
+	var ownTypeParams []string
+	for key, method := range t.methodTemplates {
+		if t.methodPaths[key] == path {
+			ownTypeParams = append(ownTypeParams, method.TypeParams...)
+		}
+	}
+
+	code := maskNonCode(content)
+	var calls []methodCall
+	for i := 0; i < len(code); i++ {
+		if !isIdentifierChar(rune(code[i])) || i > 0 && isIdentifierChar(rune(code[i-1])) {
+			continue
+		}
+		start := i
+		for i < len(code) && isIdentifierChar(rune(code[i])) {
+			i++
+		}
+		name := code[start:i]
+		if !t.isGenericMethodName(name) {
+			continue
+		}
+		typeArgs, end, ok := callTypeArgs(code, i)
+		if !ok {
+			continue
+		}
+		i = end - 1
+
+		args, err := parser.ParseTypeArguments(typeArgs)
+		t.resolveTypeArgs(args)
+		if err != nil || slices.ContainsFunc(args, func(arg parser.GenericExpr) bool {
+			return mentionsTypeParams(arg, ownTypeParams)
+		}) {
+			continue // Not a type argument list, or instantiated with the enclosing method
+		}
+		text := content[start:end]
+		line, column := position(content, start)
+		key, err := t.resolveMethodCall(className, callQualifier(code, start), name, text)
+		if err == nil {
+			err = t.validateTypeArgs(key, len(t.methodTemplates[key].TypeParams), args)
+			if err != nil {
+				err = diagnostic.WithCode(diagnostic.CodeInvalidInstantiation,
+					fmt.Errorf("invalid generic method call '%s': %w", text, err))
+			}
+		}
+		if err != nil {
+			return diagnostic.At(line, column, err)
+		}
+
+		t.addMethodUsage(key, path, joinTypeArgs(args))
+		typeArgNames := make([]string, len(args))
+		for j, arg := range args {
+			typeArgNames[j] = arg.String()
+		}
+		calls = append(calls, methodCall{start: start, end: end, name: parser.GenerateConcreteMethodName(name, typeArgNames)})
+	}
+	if len(calls) > 0 {
+		t.methodCalls[path] = calls
+	}
+	return nil
+}
+
+// isTemplateFile reports whether path declares a generic class
+func (t *Transpiler) isTemplateFile(path string) bool {
+	for _, templatePath := range t.templatePaths {
+		if templatePath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// isGenericMethodName reports whether a generic method of any class is called name
+func (t *Transpiler) isGenericMethodName(name string) bool {
+	for _, method := range t.methodTemplates {
+		if strings.EqualFold(method.MethodName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// callTypeArgs returns the type arguments of a generic method call whose method name
+// ends at offset i of code, as in get<Account>(, and the offset just past the closing
+// '>'. The type arguments must be on the same line as the name and be followed by
+// the opening parenthesis of the call.
+func callTypeArgs(code string, i int) (string, int, bool) {
+	if i >= len(code) || code[i] != '<' {
+		return "", 0, false
+	}
+	depth := 0
+	for j := i; j < len(code) && code[j] != '\n'; j++ {
+		switch code[j] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			rest := strings.TrimLeft(code[j+1:], " \t")
+			if !strings.HasPrefix(rest, "(") {
+				return "", 0, false
+			}
+			return code[i+1 : j], j + 1, true
+		case '(', ')', ';', '{', '}', '=':
+			return "", 0, false
+		}
+	}
+	return "", 0, false
+}
+
+// callQualifier returns the identifier before the '.' that precedes the method name
+// at offset start of code, as "repo" in repo.get<Account>(, or "" if there is none
+func callQualifier(code string, start int) string {
+	i := start
+	for i > 0 && (code[i-1] == ' ' || code[i-1] == '\t') {
+		i--
+	}
+	if i == 0 || code[i-1] != '.' {
+		return ""
+	}
+	i--
+	for i > 0 && (code[i-1] == ' ' || code[i-1] == '\t') {
+		i--
+	}
+	end := i
+	for i > 0 && isIdentifierChar(rune(code[i-1])) {
+		i--
+	}
+	return code[i:end]
+}
+
+// resolveMethodCall returns the "ClassName.methodName" key of the generic method
+// that a call of name, text in the source of className, refers to
+func (t *Transpiler) resolveMethodCall(className, qualifier, name, text string) (string, error) {
+	if key, ok := t.methodKey(qualifier + "." + name); ok {
+		return key, nil // A static call, as in Repository.get<Account>(
+	}
+	if qualifier == "" || strings.EqualFold(qualifier, "this") {
+		if key, ok := t.methodKey(className + "." + name); ok {
+			return key, nil
+		}
+	}
+
+	var keys []string
+	for key, method := range t.methodTemplates {
+		if strings.EqualFold(method.MethodName, name) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 1 {
+		return keys[0], nil
+	}
+	sort.Strings(keys)
+	return "", diagnostic.WithCode(diagnostic.CodeAmbiguousMethodCall,
+		fmt.Errorf("generic method call '%s' matches %s; qualify it with the class name or use a peak:instantiate directive",
+			text, strings.Join(keys, " and ")))
+}
+
+// addMethodUsage adds an instantiation of the generic method key with typeArgs, as
+// formatted by joinTypeArgs, used in path, unless config, a directive or another
+// call already added it. Of usages that only differ in case, the first in sort order
+// is kept, so the concrete method is named the same whatever order sources are read in.
+func (t *Transpiler) addMethodUsage(key, path, typeArgs string) {
+	t.addUser(key, path)
+	for i, existing := range t.methodUsages[key] {
+		if args, err := parser.ParseTypeArguments(existing); err == nil && strings.EqualFold(joinTypeArgs(args), typeArgs) {
+			if typeArgs < existing {
+				t.methodUsages[key][i] = typeArgs
+			}
+			return
+		}
+	}
+	t.methodUsages[key] = append(t.methodUsages[key], typeArgs)
+}
+
+// rewriteMethodCalls replaces the generic method calls collected from the source at
+// path with their concrete methods, as in repo.getAccount('key')
+func (t *Transpiler) rewriteMethodCalls(path, content string) string {
+	calls := t.methodCalls[path]
+	if len(calls) == 0 {
+		return content
+	}
+	var result strings.Builder
+	result.Grow(len(content))
+	last := 0
+	for _, call := range calls {
+		result.WriteString(content[last:call.start])
+		result.WriteString(call.name)
+		last = call.end
+	}
+	result.WriteString(content[last:])
+	return result.String()
+}
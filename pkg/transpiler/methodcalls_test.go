@@ -0,0 +1,97 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_GenericMethodCalls(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n}",
+		"Repository.peak": "public class Repository {\n" +
+			"    public <T> T get(String key) {\n        return (T) cache.get(key);\n    }\n" +
+			"    public <T> void put(String key, T value) {\n        cache.put(key, value);\n    }\n" +
+			"    public <T> T load(String key) {\n        return get<T>(key);\n    }\n" +
+			"}",
+		"Example.peak": "public class Example {\n" +
+			"    void run(Repository repo) {\n" +
+			"        Account a = repo.get<Account>('a');\n" +
+			"        Account b = Repository.get<Account>('b');\n" +
+			"        repo.put<Queue<Integer>>('q', new Queue<Integer>());\n" +
+			"        // repo.get<Lead>('c')\n" +
+			"        String s = 'repo.get<Contact>(1)';\n" +
+			"        Boolean x = get < limit && size > (max);\n" +
+			"    }\n" +
+			"}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	example := outputs["Example.cls"]
+	for _, want := range []string{
+		"Account a = repo.getAccount('a');",
+		"Account b = Repository.getAccount('b');",
+		"repo.putQueueInteger('q', new QueueInteger());",
+		"// repo.get<Lead>('c')",
+		"String s = 'repo.get<Contact>(1)';",
+		"Boolean x = get < limit && size > (max);",
+	} {
+		if !strings.Contains(example, want) {
+			t.Errorf("expected %q in Example.cls, got:\n%s", want, example)
+		}
+	}
+
+	repository := outputs["Repository.cls"]
+	if strings.Count(repository, "Account getAccount(String key)") != 1 || !strings.Contains(repository, "void putQueueInteger(String key, QueueInteger value)") {
+		t.Errorf("expected getAccount once and putQueueInteger, got:\n%s", repository)
+	}
+	for _, unwanted := range []string{"getLead", "getContact", "getT("} {
+		if strings.Contains(repository, unwanted) {
+			t.Errorf("expected no %s, got:\n%s", unwanted, repository)
+		}
+	}
+}
+
+func TestTranspileFiles_InvalidGenericMethodCall(t *testing.T) {
+	tests := []struct {
+		name string
+		call string
+		code string
+	}{
+		{"ambiguous", "repo.get<Account>('key')", diagnostic.CodeAmbiguousMethodCall},
+		{"wrong type argument count", "Repository.get<Account, Contact>('key')", diagnostic.CodeInvalidInstantiation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"Repository.peak": "public class Repository {\n    public <T> T get(String key) {\n        return null;\n    }\n}",
+				"Cache.peak":      "public class Cache {\n    public <T> T get(String key) {\n        return null;\n    }\n}",
+				"Example.peak":    "public class Example {\n    Object o = " + tt.call + ";\n}",
+			}
+			results, err := NewTranspiler(nil).TranspileFiles(files)
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Error == nil {
+				t.Fatalf("expected a single error, got %+v", results)
+			}
+			d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+			column := 16 + strings.Index(tt.call, "get")
+			if d.File != "Example.peak" || d.Code != tt.code || d.Line != 2 || d.Column != column {
+				t.Errorf("expected %s at Example.peak:2:%d, got %s at %s:%d:%d: %s", tt.code, column, d.Code, d.File, d.Line, d.Column, d.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// OutputDirAnnotation puts the classes generated from a template in a directory of
+// their own, e.g. @PeakOutputDir('test') for test utilities, relative to the output
+// root set with SetOutputDirs
+const OutputDirAnnotation = "@PeakOutputDir"
+
+// SetOutputDirs sets the directories that the classes generated from the named
+// templates are written to, overriding both the default resolution and
+// @PeakOutputDir annotations. Relative directories, in dirs and in annotations, are
+// resolved against root: the output directory when one is configured, otherwise
+// the source directory.
+func (t *Transpiler) SetOutputDirs(root string, dirs map[string]string) {
+	t.outputRoot = root
+	t.outputDirConfig = dirs
+}
+
+// processOutputDirs resolves the output directory of every template that has one,
+// from config or its @PeakOutputDir annotation (Phase 1.5). Config entries naming
+// no template and malformed annotations are errors.
+func (t *Transpiler) processOutputDirs(results *[]FileResult) bool {
+	hasErrors := false
+	t.outputDirs = make(map[string]string)
+
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args, ok := findAnnotation(t.templates[name], OutputDirAnnotation)
+		if !ok {
+			continue
+		}
+		dir := ""
+		if len(args) == 1 && len(args[0]) > 2 && strings.HasPrefix(args[0], "'") && strings.HasSuffix(args[0], "'") {
+			dir = args[0][1 : len(args[0])-1]
+		}
+		if dir == "" || filepath.IsAbs(dir) {
+			hasErrors = true
+			*results = append(*results, FileResult{
+				OriginalPath: t.templatePaths[name],
+				Error: diagnostic.WithCode(diagnostic.CodeInvalidOutputDir,
+					fmt.Errorf("%s on %s must name a relative directory, e.g. %s('test')", OutputDirAnnotation, name, OutputDirAnnotation)),
+			})
+			continue
+		}
+		t.outputDirs[name] = t.resolveOutputDir(dir)
+	}
+
+	configNames := make([]string, 0, len(t.outputDirConfig))
+	for name := range t.outputDirConfig {
+		configNames = append(configNames, name)
+	}
+	sort.Strings(configNames)
+	for _, name := range configNames {
+		if _, exists := t.templates[name]; !exists {
+			hasErrors = true
+			*results = append(*results, FileResult{
+				OriginalPath: "peakconfig.json",
+				Error: diagnostic.WithCode(diagnostic.CodeUndefinedTemplate,
+					fmt.Errorf("outputDirs entry '%s' references undefined template%s", name, t.templateSuggestion(name))),
+			})
+			continue
+		}
+		t.outputDirs[name] = t.resolveOutputDir(t.outputDirConfig[name])
+	}
+	return hasErrors
+}
+
+// resolveOutputDir resolves a configured or annotated output directory against the output root
+func (t *Transpiler) resolveOutputDir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(t.outputRoot, dir)
+}
+
+// generatedOutputPath returns the output path of the class called name that is
+// generated from template, such as a concrete class for expr or a holder or factory
+// class (expr nil): in the template's output directory when it has one, in the test
+// directory when the class is test-only, otherwise where outputPathFn puts a source
+// next to the template
+func (t *Transpiler) generatedOutputPath(template string, expr *parser.GenericExpr, name string) string {
+	if dir, ok := t.outputDirs[template]; ok {
+		return filepath.Join(dir, name+".cls")
+	}
+	if dir, ok := t.testOutputDir(template, expr); ok {
+		return filepath.Join(dir, name+".cls")
+	}
+	templateDir := filepath.Dir(t.templatePaths[template])
+	outputPath, err := t.outputPathFn(filepath.Join(templateDir, name+".peak"))
+	if err != nil {
+		// Fall back to the template directory
+		outputPath = filepath.Join(templateDir, name+".cls")
+	}
+	return outputPath
+}
@@ -0,0 +1,105 @@
+package transpiler
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_OutputDirAnnotation(t *testing.T) {
+	files := map[string]string{
+		"src/Fixture.peak": "@PeakOutputDir('test')\npublic class Fixture<T> {\n    public Fixture() {}\n    private List<T> items;\n}",
+		"src/Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"src/Example.peak": "public class Example {\n    Fixture<Integer> f;\n    Queue<Integer> q;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetFactories(true)
+	tr.SetOutputDirs("out", nil)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	fixture, ok := outputs[filepath.Join("out", "test", "FixtureInteger.cls")]
+	if !ok {
+		t.Fatalf("expected FixtureInteger.cls in out/test, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+	if strings.Contains(fixture, "@PeakOutputDir") {
+		t.Errorf("expected the annotation to be removed, got:\n%s", fixture)
+	}
+	if _, ok := outputs[filepath.Join("out", "test", "FixtureFactory.cls")]; !ok {
+		t.Errorf("expected FixtureFactory.cls in out/test, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+	if _, ok := outputs[filepath.Join("src", "QueueInteger.cls")]; !ok {
+		t.Errorf("expected QueueInteger.cls next to its template, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+}
+
+func TestTranspileFiles_OutputDirConfig(t *testing.T) {
+	files := map[string]string{
+		"Fixture.peak": "@PeakOutputDir('test')\npublic class Fixture<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    Fixture<Integer> f;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetOutputDirs("out", map[string]string{"Fixture": "classes/fixtures"})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	if _, ok := outputs[filepath.Join("out", "classes", "fixtures", "FixtureInteger.cls")]; !ok {
+		t.Errorf("expected config to override the annotation, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+}
+
+func TestTranspileFiles_InvalidOutputDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		dirs   map[string]string
+		file   string
+		code   string
+	}{
+		{"unquoted annotation", "@PeakOutputDir(test)\npublic class Fixture<T> {\n}", nil, "Fixture.peak", diagnostic.CodeInvalidOutputDir},
+		{"annotation without argument", "@PeakOutputDir\npublic class Fixture<T> {\n}", nil, "Fixture.peak", diagnostic.CodeInvalidOutputDir},
+		{"absolute annotation", "@PeakOutputDir('/tmp/test')\npublic class Fixture<T> {\n}", nil, "Fixture.peak", diagnostic.CodeInvalidOutputDir},
+		{"undefined template in config", "public class Fixture<T> {\n}", map[string]string{"Stack": "test"}, "peakconfig.json", diagnostic.CodeUndefinedTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTranspiler(nil)
+			tr.SetOutputDirs("", tt.dirs)
+			results, err := tr.TranspileFiles(map[string]string{"Fixture.peak": tt.source})
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Error == nil {
+				t.Fatalf("expected a single error, got %+v", results)
+			}
+			d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+			if d.File != tt.file || d.Code != tt.code {
+				t.Errorf("expected %s in %s, got %s in %s: %s", tt.code, tt.file, d.Code, d.File, d.Message)
+			}
+		})
+	}
+}
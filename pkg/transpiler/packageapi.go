@@ -0,0 +1,152 @@
+package transpiler
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// PackageApiAnnotation marks a template as part of a managed package's API. When
+// building for a managed package, its concrete classes are declared global, and so
+// are their public members, or only those named in its arguments, as in
+// @PeakPackageApi(push, pop).
+const PackageApiAnnotation = "@PeakPackageApi"
+
+// publicMember is a public member declared directly in a class body
+type publicMember struct {
+	offset int    // Offset of the "public" modifier
+	name   string // Name of the method, property, field or inner type
+}
+
+// SetManagedPackage enables rewriting public to global in the concrete classes of
+// templates marked with @PeakPackageApi, for output that goes into a managed
+// package. apiTemplates lists the templates that must carry the annotation.
+func (t *Transpiler) SetManagedPackage(enabled bool, apiTemplates []string) {
+	t.managedPackage = enabled
+	t.packageApi = apiTemplates
+}
+
+// processPackageApi checks that the templates listed as package API carry
+// @PeakPackageApi, and that the members the annotations name are public members
+// of their templates (Phase 1.5)
+func (t *Transpiler) processPackageApi(results *[]FileResult) bool {
+	hasErrors := false
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		template := t.templates[name]
+		selected, ok := findAnnotation(template, PackageApiAnnotation)
+		if !ok {
+			continue
+		}
+		members := publicMembers(template.Body)
+		for _, member := range selected {
+			if !slices.ContainsFunc(members, func(m publicMember) bool { return strings.EqualFold(m.name, member) }) {
+				hasErrors = true
+				*results = append(*results, FileResult{
+					OriginalPath: t.templatePaths[name],
+					Error: diagnostic.WithCode(diagnostic.CodePackageApi,
+						fmt.Errorf("%s member '%s' is not a public member of %s", PackageApiAnnotation, member, name)),
+				})
+			}
+		}
+	}
+
+	for _, name := range t.packageApi {
+		template, exists := t.templates[name]
+		if !exists {
+			hasErrors = true
+			*results = append(*results, FileResult{
+				OriginalPath: "peakconfig.json",
+				Error: diagnostic.WithCode(diagnostic.CodeUndefinedTemplate,
+					fmt.Errorf("packageApi entry '%s' references undefined template%s", name, t.templateSuggestion(name))),
+			})
+			continue
+		}
+		if _, ok := findAnnotation(template, PackageApiAnnotation); !ok {
+			hasErrors = true
+			*results = append(*results, FileResult{
+				OriginalPath: t.templatePaths[name],
+				Error: diagnostic.WithCode(diagnostic.CodePackageApi,
+					fmt.Errorf("template %s is listed in packageApi but lacks %s", name, PackageApiAnnotation)),
+			})
+		}
+	}
+	return hasErrors
+}
+
+// isPackageApi reports whether the concrete classes of template are built as package API
+func (t *Transpiler) isPackageApi(template *parser.GenericClassDef) bool {
+	if !t.managedPackage {
+		return false
+	}
+	_, ok := findAnnotation(template, PackageApiAnnotation)
+	return ok
+}
+
+// globalMembers rewrites public to global on the members of content, a concrete class
+// called className generated from template, that its @PeakPackageApi annotation
+// selects: those it names, with the template name standing for the constructors, or
+// every public member if it names none. Offsets and lines are unchanged.
+func globalMembers(template *parser.GenericClassDef, content, className string) string {
+	selected, _ := findAnnotation(template, PackageApiAnnotation)
+	b := []byte(content)
+	for _, member := range publicMembers(content) {
+		name := member.name
+		if strings.EqualFold(name, className) {
+			name = template.ClassName
+		}
+		if len(selected) > 0 && !slices.ContainsFunc(selected, func(s string) bool { return strings.EqualFold(s, name) }) {
+			continue
+		}
+		copy(b[member.offset:], "global")
+	}
+	return string(b)
+}
+
+// publicMembers returns the public members declared directly in the body of content,
+// a class declaration or body, in source order
+func publicMembers(content string) []publicMember {
+	code := maskNonCode(content)
+	var members []publicMember
+	depth := 0
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case '{':
+			depth++
+			continue
+		case '}':
+			depth--
+			continue
+		}
+		if depth != 1 || !hasKeywordAt(code, i, "public") {
+			continue
+		}
+		// The name is the last identifier before the parameters, initializer or body
+		end := strings.IndexAny(code[i:], "(=;{")
+		if end < 0 {
+			break
+		}
+		words := strings.FieldsFunc(code[i:i+end], func(r rune) bool { return !isIdentifierChar(r) })
+		members = append(members, publicMember{offset: i, name: words[len(words)-1]})
+		i += len("public") - 1
+	}
+	return members
+}
+
+// hasKeywordAt reports whether the whole word keyword starts at offset i of code,
+// in any case like Apex keywords
+func hasKeywordAt(code string, i int, keyword string) bool {
+	if len(code) < i+len(keyword) || !strings.EqualFold(code[i:i+len(keyword)], keyword) || i > 0 && isIdentifierChar(rune(code[i-1])) {
+		return false
+	}
+	end := i + len(keyword)
+	return end == len(code) || !isIdentifierChar(rune(code[end]))
+}
@@ -0,0 +1,116 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestPublicMembers(t *testing.T) {
+	content := "public class Queue {\n" +
+		"    public Queue() {}\n" +
+		"    public List<T> items;\n" +
+		"    public Integer size = 0;\n" +
+		"    public T peek { get; set; }\n" +
+		"    private void reset() { String s = 'public x;'; }\n" +
+		"    Public void push(T item) {}\n" +
+		"    public class Node {\n        public T value;\n    }\n" +
+		"}"
+	var names []string
+	for _, member := range publicMembers(content) {
+		names = append(names, member.name)
+	}
+	if got, want := strings.Join(names, " "), "Queue items size peek push Node"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTranspileFiles_ManagedPackage(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": "@PeakPackageApi\npublic virtual class Queue<T> {\n" +
+			"    public Queue() {}\n    public void push(T item) {}\n    private void reset() {}\n}",
+		"Stack.peak": "@PeakPackageApi(Stack, push)\npublic class Stack<T> {\n" +
+			"    public Stack() {}\n    public void push(T item) {}\n    public T pop() { return null; }\n}",
+		"Dict.peak":    "public class Dict<K, V> {\n    public V get(K key) { return null; }\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer> q;\n    Stack<Integer> s;\n    Dict<String, Integer> d;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetManagedPackage(true, []string{"Queue", "Stack"})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	for path, want := range map[string][]string{
+		"QueueInteger.cls":      {"global virtual class QueueInteger {", "    global QueueInteger() {}", "    global void push(Integer item) {}", "    private void reset() {}"},
+		"StackInteger.cls":      {"global class StackInteger {", "    global StackInteger() {}", "    global void push(Integer item) {}", "    public Integer pop()"},
+		"DictStringInteger.cls": {"public class DictStringInteger {", "    public Integer get(String key)"},
+	} {
+		for _, line := range want {
+			if !strings.Contains(outputs[path], line) {
+				t.Errorf("expected %q in %s, got:\n%s", line, path, outputs[path])
+			}
+		}
+	}
+	if strings.Contains(outputs["QueueInteger.cls"], PackageApiAnnotation) {
+		t.Errorf("expected the annotation to be removed, got:\n%s", outputs["QueueInteger.cls"])
+	}
+}
+
+func TestTranspileFiles_PackageApiDisabled(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "@PeakPackageApi\npublic class Queue<T> {\n    public void push(T item) {}\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer> q;\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		if result.OutputPath == "QueueInteger.cls" && strings.Contains(result.Content, "global") {
+			t.Errorf("expected public output outside managed packages, got:\n%s", result.Content)
+		}
+	}
+}
+
+func TestTranspileFiles_InvalidPackageApi(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		api    []string
+		file   string
+		code   string
+	}{
+		{"missing annotation", "public class Queue<T> {\n}", []string{"Queue"}, "Queue.peak", diagnostic.CodePackageApi},
+		{"unknown member", "@PeakPackageApi(pop)\npublic class Queue<T> {\n    public void push(T item) {}\n}", nil, "Queue.peak", diagnostic.CodePackageApi},
+		{"private member", "@PeakPackageApi(reset)\npublic class Queue<T> {\n    private void reset() {}\n}", nil, "Queue.peak", diagnostic.CodePackageApi},
+		{"undefined template", "public class Queue<T> {\n}", []string{"Stack"}, "peakconfig.json", diagnostic.CodeUndefinedTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTranspiler(nil)
+			tr.SetManagedPackage(true, tt.api)
+			results, err := tr.TranspileFiles(map[string]string{"Queue.peak": tt.source})
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Error == nil {
+				t.Fatalf("expected a single error, got %+v", results)
+			}
+			d := diagnostic.FromError(results[0].OriginalPath, results[0].Error)
+			if d.File != tt.file || d.Code != tt.code {
+				t.Errorf("expected %s in %s, got %s in %s: %s", tt.code, tt.file, d.Code, d.File, d.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GeneratedMarker starts the first line of every file Peak generates. Files without
+// it were written by hand (or by a Peak version that predates the marker).
+const GeneratedMarker = "// Generated by Peak"
+
+// IsGenerated reports whether content was generated by Peak, judging by its first line
+func IsGenerated(content string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(content, "\ufeff"), GeneratedMarker)
+}
+
+// GeneratedVersion returns the Peak version named by the provenance header of
+// content, such as "v1.4.0", or "" if content was not generated by Peak or by a
+// version that did not stamp its outputs
+func GeneratedVersion(content string) string {
+	if !IsGenerated(content) {
+		return ""
+	}
+	header, _, _ := strings.Cut(strings.TrimPrefix(content, "\ufeff"), "\n")
+	fields := strings.Fields(strings.TrimPrefix(header, GeneratedMarker))
+	if len(fields) == 0 || fields[0] == "from" || strings.HasPrefix(fields[0], ".") {
+		return ""
+	}
+	return strings.TrimSuffix(fields[0], ".")
+}
+
+// SetVersion sets the Peak version that provenance headers name, as in
+// "// Generated by Peak v1.4.0 from Queue.peak. Do not edit.", so outputs of
+// older versions can be found and regenerated. Without a version, the default,
+// headers name none.
+func (t *Transpiler) SetVersion(version string) {
+	t.version = version
+}
+
+// StripProvenance returns content without its provenance header, if it has one
+func StripProvenance(content string) string {
+	if !IsGenerated(content) {
+		return content
+	}
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		return content[i+1:]
+	}
+	return ""
+}
+
+// withProvenance prepends a header naming the source file of a generated result
+// (the template, for concrete classes) and the Peak version, if set, so generated
+// files can be told apart from hand-written ones. Only the base name is used, so
+// output does not depend on where the project is checked out, and generic
+// expressions are left out so that no generic syntax remains in generated Apex.
+func (t *Transpiler) withProvenance(result FileResult) FileResult {
+	origin := result.OriginalPath
+	if result.TemplatePath != "" {
+		origin = result.TemplatePath
+	}
+
+	marker := GeneratedMarker
+	if t.version != "" {
+		marker += " " + t.version
+	}
+	result.Content = fmt.Sprintf("%s from %s. Do not edit.\n", marker, filepath.Base(origin)) + result.Content
+	if result.SourceLines != nil {
+		// The header is generated code, and shifts every other line down by one
+		result.SourceLines = append([]int{0}, result.SourceLines...)
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithProvenance(t *testing.T) {
+	tr := NewTranspiler(nil)
+	source := tr.withProvenance(FileResult{OriginalPath: "src/Example.peak", Content: "public class Example {}", SourceLines: []int{1}})
+	if !strings.HasPrefix(source.Content, "// Generated by Peak from Example.peak. Do not edit.\npublic class Example {}") {
+		t.Errorf("unexpected header:\n%s", source.Content)
+	}
+	if len(source.SourceLines) != 2 || source.SourceLines[0] != 0 || source.SourceLines[1] != 1 {
+		t.Errorf("expected the header to shift the line map, got %v", source.SourceLines)
+	}
+
+	concrete := tr.withProvenance(FileResult{TemplatePath: "src/Queue.peak", Instantiation: "Queue<Integer>", Content: "public class QueueInteger {}"})
+	if !strings.HasPrefix(concrete.Content, "// Generated by Peak from Queue.peak. Do not edit.\n") {
+		t.Errorf("expected the template in the header:\n%s", concrete.Content)
+	}
+
+	tr.SetVersion("v1.4.0")
+	stamped := tr.withProvenance(FileResult{TemplatePath: "src/Queue.peak", Content: "public class QueueInteger {}"})
+	if !strings.HasPrefix(stamped.Content, "// Generated by Peak v1.4.0 from Queue.peak. Do not edit.\n") {
+		t.Errorf("expected the version in the header:\n%s", stamped.Content)
+	}
+}
+
+func TestGeneratedVersion(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"// Generated by Peak v1.4.0 from Queue.peak. Do not edit.\npublic class QueueInteger {}", "v1.4.0"},
+		{"\ufeff// Generated by Peak v1.4.0 from Queue.peak. Do not edit.\r\npublic class QueueInteger {}", "v1.4.0"},
+		{"// Generated by Peak from Queue.peak. Do not edit.\npublic class QueueInteger {}", ""},
+		{"// Generated by Peak. Do not edit.\npublic class PeakRegistry {}", ""},
+		{"public class QueueInteger {} // Generated by Peak v1.4.0", ""},
+	}
+	for _, tt := range tests {
+		if got := GeneratedVersion(tt.content); got != tt.expected {
+			t.Errorf("GeneratedVersion(%q) = %q, expected %q", tt.content, got, tt.expected)
+		}
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected bool
+	}{
+		{"// Generated by Peak from Queue.peak. Do not edit.\npublic class QueueInteger {}", true},
+		{"// Generated by Peak. Do not edit.\npublic class PeakRegistry {}", true},
+		{"\ufeff// Generated by Peak from Queue.peak. Do not edit.\r\npublic class QueueInteger {}", true},
+		{"public class QueueInteger {}", false},
+		{"// QueueInteger, expanded by hand\n// Generated by Peak", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsGenerated(tt.content); got != tt.expected {
+			t.Errorf("IsGenerated(%q) = %v, expected %v", tt.content, got, tt.expected)
+		}
+	}
+}
+
+func TestStripProvenance(t *testing.T) {
+	if got := StripProvenance("// Generated by Peak from Queue.peak. Do not edit.\npublic class QueueInteger {}"); got != "public class QueueInteger {}" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if got := StripProvenance("public class QueueInteger {}"); got != "public class QueueInteger {}" {
+		t.Errorf("expected hand-written content unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RegistryClassName is the name of the generated registry class
+const RegistryClassName = "PeakRegistry"
+
+// GenerateRegistry generates an Apex class mapping generic expressions to the
+// concrete classes generated for them, so runtime code can look up generated
+// classes without hardcoding their names. Keys are normalized the same way as
+// lookups: whitespace removed and lowercased, since Apex type names are
+// case-insensitive. Test-only classes are left out, since the registry is not a
+// test class and cannot reference them.
+func GenerateRegistry(results []FileResult) string {
+	entries := make(map[string]string)
+	for _, result := range results {
+		if result.Test {
+			continue
+		}
+		for instantiation, className := range result.Members {
+			entries[normalizeRegistryKey(instantiation)] = className
+		}
+		if result.Error != nil || result.Instantiation == "" {
+			continue
+		}
+		className := strings.TrimSuffix(filepath.Base(result.OutputPath), filepath.Ext(result.OutputPath))
+		entries[normalizeRegistryKey(result.Instantiation)] = className
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(GeneratedMarker + ". Do not edit.\n")
+	fmt.Fprintf(&b, "public class %s {\n", RegistryClassName)
+	if len(keys) == 0 {
+		b.WriteString("    private static final Map<String, Type> TYPES = new Map<String, Type>();\n")
+	} else {
+		b.WriteString("    private static final Map<String, Type> TYPES = new Map<String, Type>{\n")
+		for i, key := range keys {
+			sep := ","
+			if i == len(keys)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, "        '%s' => %s.class%s\n", key, entries[key], sep)
+		}
+		b.WriteString("    };\n")
+	}
+	b.WriteString(`
+    // Returns the generated class for a generic expression such as 'Queue<Integer>', or null
+    public static Type forName(String expression) {
+        if (expression == null) {
+            return null;
+        }
+        return TYPES.get(expression.deleteWhitespace().toLowerCase());
+    }
+
+    // Instantiates the generated class for a generic expression, or returns null
+    public static Object newInstance(String expression) {
+        Type t = forName(expression);
+        return t == null ? null : t.newInstance();
+    }
+
+    // Returns the normalized generic expressions of all generated classes
+    public static Set<String> expressions() {
+        return TYPES.keySet();
+    }
+}
+`)
+	return b.String()
+}
+
+// normalizeRegistryKey mirrors the Apex lookup normalization in PeakRegistry.forName
+func normalizeRegistryKey(expression string) string {
+	return strings.ToLower(strings.Join(strings.Fields(expression), ""))
+}
@@ -0,0 +1,46 @@
+package transpiler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRegistry(t *testing.T) {
+	results := []FileResult{
+		{OriginalPath: "Example.peak", OutputPath: "Example.cls", Content: "..."},
+		{OutputPath: "out/QueueInteger.cls", Instantiation: "Queue<Integer>"},
+		{OutputPath: "out/DictStringInteger.cls", Instantiation: "Dict<String, Integer>"},
+		{OutputPath: "out/Broken.cls", Instantiation: "Broken<Integer>", Error: errors.New("failed")},
+		{OutputPath: "out/test/FixtureInteger.cls", Instantiation: "Fixture<Integer>", Test: true},
+	}
+
+	registry := GenerateRegistry(results)
+
+	if !strings.Contains(registry, "public class PeakRegistry {") {
+		t.Errorf("expected PeakRegistry class declaration:\n%s", registry)
+	}
+	if !strings.Contains(registry, "'dict<string,integer>' => DictStringInteger.class,\n        'queue<integer>' => QueueInteger.class\n") {
+		t.Errorf("expected sorted, normalized entries:\n%s", registry)
+	}
+	if strings.Contains(registry, "Example.class") || strings.Contains(registry, "Broken") {
+		t.Errorf("registry should only contain successfully generated classes:\n%s", registry)
+	}
+	if strings.Contains(registry, "Fixture") {
+		t.Errorf("registry should not reference test classes:\n%s", registry)
+	}
+}
+
+func TestGenerateRegistry_Empty(t *testing.T) {
+	registry := GenerateRegistry(nil)
+
+	if !strings.Contains(registry, "new Map<String, Type>();") {
+		t.Errorf("expected empty map literal:\n%s", registry)
+	}
+}
+
+func TestNormalizeRegistryKey(t *testing.T) {
+	if got := normalizeRegistryKey("Dict<String, List<Integer>>"); got != "dict<string,list<integer>>" {
+		t.Errorf("unexpected key: %s", got)
+	}
+}
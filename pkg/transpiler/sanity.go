@@ -0,0 +1,143 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// typeDeclarationPattern matches the declaration of a class, interface or enum,
+// capturing its name
+var typeDeclarationPattern = regexp.MustCompile(`(?i)\b(?:class|interface|enum)\s+([A-Za-z_]\w*)`)
+
+// identifierPattern matches an Apex identifier
+var identifierPattern = regexp.MustCompile(`[A-Za-z_]\w*`)
+
+// closingDelimiters maps each closing delimiter to its opening one
+var closingDelimiters = map[byte]byte{')': '(', '}': '{', ']': '['}
+
+// checkOutput runs a structural check on a generated file, so that a transpiler
+// bug or an unusual source surfaces as a diagnostic instead of a .cls file that
+// fails to deploy. Outside comments and strings, the check requires balanced
+// parentheses, braces and brackets, a first declared type named after the file,
+// no generic usages of templates, and none of typeParams, the type parameters
+// that were substituted. Generic method templates are left in sources as written
+// and are not reported. With SetSelfCheck, the file is also re-parsed and compared
+// with input, the source or template body it was generated from. Lines that
+// peak:ignore pragmas kept as written are not checked. Problems are located at
+// the source line of result, when known.
+func (t *Transpiler) checkOutput(result FileResult, input string, typeParams []string) error {
+	masked := maskNonCode(t.maskIgnoredOutput(result))
+	if result.TemplatePath == "" {
+		input = maskLines(input, t.ignored[result.OriginalPath])
+	}
+	code, failure := diagnostic.CodeMalformedOutput, "is malformed"
+	offset, problem := t.findMalformation(masked, strings.TrimSuffix(filepath.Base(result.OutputPath), ".cls"), typeParams)
+	if problem == "" && t.selfCheck {
+		code, failure = diagnostic.CodeSelfCheck, "failed the self-check"
+		offset, problem = t.findRegression(masked, input, typeParams)
+	}
+	if problem == "" {
+		return nil
+	}
+
+	err := fmt.Errorf("generated %s %s: %s", filepath.Base(result.OutputPath), failure, problem)
+	line := 0
+	if index := strings.Count(masked[:offset], "\n"); index < len(result.SourceLines) {
+		line = result.SourceLines[index]
+	}
+	return diagnostic.WithCode(code, diagnostic.At(line, 0, err))
+}
+
+// findMalformation returns the offset in code of the first structural problem and
+// a description of it, or an empty description if there is none
+func (t *Transpiler) findMalformation(code, className string, typeParams []string) (int, string) {
+	var open []int // Offsets of the unclosed delimiters
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; c {
+		case '(', '{', '[':
+			open = append(open, i)
+		case ')', '}', ']':
+			if len(open) == 0 {
+				return i, fmt.Sprintf("unmatched '%c'", c)
+			}
+			if opening := code[open[len(open)-1]]; opening != closingDelimiters[c] {
+				return i, fmt.Sprintf("'%c' closes '%c'", c, opening)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return open[len(open)-1], fmt.Sprintf("unclosed '%c'", code[open[len(open)-1]])
+	}
+
+	declaration := typeDeclarationPattern.FindStringSubmatchIndex(code)
+	if declaration == nil {
+		return 0, "no class, interface or enum is declared"
+	}
+	if name := code[declaration[2]:declaration[3]]; !strings.EqualFold(name, className) {
+		return declaration[2], fmt.Sprintf("declares %s, but the file is named %s.cls", name, className)
+	}
+
+	if generics, err := t.newParser(code).FindGenerics(); err == nil {
+		first, usage := -1, ""
+		for text, expr := range generics {
+			if _, ok := t.templateName(expr.BaseType); !ok {
+				continue
+			}
+			if offset := strings.Index(code, text); offset >= 0 && (first < 0 || offset < first) {
+				first, usage = offset, text
+			}
+		}
+		if first >= 0 {
+			return first, fmt.Sprintf("generic usage %s was not replaced", usage)
+		}
+	}
+
+	if len(typeParams) > 0 {
+		params := make(map[string]bool, len(typeParams))
+		for _, param := range typeParams {
+			params[param] = true
+		}
+		for _, loc := range identifierPattern.FindAllStringIndex(code, -1) {
+			if name := code[loc[0]:loc[1]]; params[name] && !isQualified(code, loc[0]) {
+				return loc[0], fmt.Sprintf("type parameter %s was not substituted", name)
+			}
+		}
+	}
+	return 0, ""
+}
+
+// substitutedParams returns the type parameters of template that must not remain in a
+// class generated for instantiations: all of them, except those that are also type
+// arguments, as A is in Pair<A, String>
+func substitutedParams(template *parser.GenericClassDef, instantiations []concretePlan) []string {
+	var params []string
+	for _, param := range template.TypeParams {
+		used := false
+		for _, plan := range instantiations {
+			used = used || usesType(plan.expr.TypeArgs, param)
+		}
+		if !used {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// isQualified reports whether the identifier at offset in code is part of a number,
+// as in 10L, or follows a '.', as in Schema.T, so that it is not a type parameter
+func isQualified(code string, offset int) bool {
+	if offset > 0 && code[offset-1] >= '0' && code[offset-1] <= '9' {
+		return true
+	}
+	i := offset - 1
+	for i >= 0 && (code[i] == ' ' || code[i] == '\t') {
+		i--
+	}
+	return i >= 0 && code[i] == '.'
+}
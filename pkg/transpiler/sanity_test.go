@@ -0,0 +1,104 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+func TestFindMalformation(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.templates["Queue"] = &parser.GenericClassDef{ClassName: "Queue", TypeParams: []string{"T"}}
+
+	tests := []struct {
+		name       string
+		content    string
+		typeParams []string
+		problem    string // Empty if the content is well-formed
+	}{
+		{"well-formed", "public class QueueInteger {\n    private List<Integer> items;\n}", []string{"T"}, ""},
+		{"delimiters in comments and strings", "public class QueueInteger {\n    // }\n    String s = '(';\n}", nil, ""},
+		{"case-insensitive name", "public class queueinteger {\n}", nil, ""},
+		{"unclosed brace", "public class QueueInteger {\n    void f() {\n}", nil, "unclosed '{'"},
+		{"unmatched parenthesis", "public class QueueInteger {\n}\n)", nil, "unmatched ')'"},
+		{"mismatched delimiters", "public class QueueInteger {\n    void f()) {}\n}", nil, "')' closes '{'"},
+		{"wrong class name", "public class QueueString {\n}", nil, "declares QueueString, but the file is named QueueInteger.cls"},
+		{"no class", "// nothing\n", nil, "no class, interface or enum is declared"},
+		{"leftover template usage", "public class QueueInteger {\n    Queue<Integer> next;\n}", nil, "generic usage Queue<Integer> was not replaced"},
+		{"leftover type parameter", "public class QueueInteger {\n    private List<T> items;\n}", []string{"T"}, "type parameter T was not substituted"},
+		{"qualified names and literals", "public class QueueInteger {\n    Long l = 10T;\n    Object o = Schema.T;\n}", []string{"T"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problem := tr.findMalformation(maskNonCode(tt.content), "QueueInteger", tt.typeParams)
+			if problem != tt.problem {
+				t.Errorf("findMalformation() = %q, expected %q", problem, tt.problem)
+			}
+		})
+	}
+}
+
+func TestCheckOutput_SourceLine(t *testing.T) {
+	result := FileResult{
+		OutputPath:  "classes/QueueInteger.cls",
+		Content:     "public class QueueInteger {\n    private List<T> items;\n}",
+		SourceLines: []int{1, 4, 5},
+	}
+
+	err := NewTranspiler(nil).checkOutput(result, "", []string{"T"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	d := diagnostic.FromError("Queue.peak", err)
+	if d.Code != diagnostic.CodeMalformedOutput || d.Line != 4 {
+		t.Errorf("expected %s at line 4, got %s at line %d", diagnostic.CodeMalformedOutput, d.Code, d.Line)
+	}
+	if !strings.Contains(d.Message, "generated QueueInteger.cls is malformed") {
+		t.Errorf("unexpected message: %s", d.Message)
+	}
+}
+
+func TestSubstitutedParams(t *testing.T) {
+	template := &parser.GenericClassDef{ClassName: "Pair", TypeParams: []string{"A", "B"}}
+	generics, err := parser.NewParser("Pair<A, String> p;").FindGenerics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := substitutedParams(template, []concretePlan{{template: template, expr: generics["Pair<A, String>"]}})
+	if len(got) != 1 || got[0] != "B" {
+		t.Errorf("expected [B], got %v", got)
+	}
+}
+
+func TestTranspileFiles_MalformedSource(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n    void f() {\n}",
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	var found bool
+	for _, result := range results {
+		switch {
+		case result.OriginalPath == "Example.peak":
+			found = true
+			if result.Error == nil || result.Content != "" {
+				t.Fatalf("expected an error instead of output, got %+v", result)
+			}
+			if code := diagnostic.FromError("", result.Error).Code; code != diagnostic.CodeMalformedOutput {
+				t.Errorf("expected %s, got %s", diagnostic.CodeMalformedOutput, code)
+			}
+		case result.Error != nil:
+			t.Errorf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+	}
+	if !found {
+		t.Fatal("expected a result for Example.peak")
+	}
+}
@@ -0,0 +1,119 @@
+package transpiler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// SetSelfCheck enables re-parsing every generated file with the Peak parser before
+// it is written, as a regression net for substitution bugs: on top of the structural
+// check, which already rules out template usages, the file must parse, declare no
+// templates, pass no substituted type parameter as a type argument, and use no generic
+// type that the file it was generated from does not use. Failures are PEAK112 errors,
+// and the file is not written.
+func (t *Transpiler) SetSelfCheck(enabled bool) {
+	t.selfCheck = enabled
+}
+
+// findRegression re-parses code, a generated file with comments and strings masked,
+// and returns the offset of the first problem the self-check finds and a description
+// of it, or an empty description if there is none. input is the source or template
+// body the file was generated from, and typeParams the substituted type parameters.
+func (t *Transpiler) findRegression(code, input string, typeParams []string) (int, string) {
+	defs, err := parser.NewParser(code).FindGenericClassDefinitions()
+	var template *parser.GenericClassDef
+	for _, def := range defs {
+		if template == nil || def.StartPos < template.StartPos {
+			template = def
+		}
+	}
+	if template != nil {
+		return template.StartPos, fmt.Sprintf("declares template %s", template.ClassName)
+	}
+	var generics map[string]*parser.GenericExpr
+	if err == nil {
+		generics, err = allGenerics(code)
+	}
+	if err != nil {
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			return lineOffset(code, parseErr.Line), "does not parse: " + parseErr.Message
+		}
+		return 0, "does not parse: " + err.Error()
+	}
+
+	// Generic types the input uses, such as Iterable in Iterable<T>
+	known := make(map[string]bool)
+	if inputGenerics, err := allGenerics(maskNonCode(input)); err == nil {
+		for _, expr := range inputGenerics {
+			known[strings.ToLower(expr.BaseType)] = true
+		}
+	}
+
+	first, found, problem := -1, "", ""
+	for text, expr := range generics {
+		offset := max(strings.Index(code, text), 0)
+		if first >= 0 && (offset > first || offset == first && text > found) {
+			continue
+		}
+		switch param := usesAny(expr.TypeArgs, typeParams); {
+		case param != "":
+			problem = fmt.Sprintf("type parameter %s remains in %s", param, text)
+		case !known[strings.ToLower(expr.BaseType)] && !t.isBuiltInGeneric(expr.BaseType):
+			problem = fmt.Sprintf("generic usage %s does not come from the source", text)
+		default:
+			continue
+		}
+		first, found = offset, text
+	}
+	if first < 0 {
+		return 0, ""
+	}
+	return first, problem
+}
+
+// allGenerics finds every generic usage in code, those of built-in generic types
+// included, since a substituted type parameter must not remain in Iterable<T> either
+func allGenerics(code string) (map[string]*parser.GenericExpr, error) {
+	p := parser.NewParser(code)
+	p.SetBuiltInGenerics(map[string]int{})
+	return p.FindGenerics()
+}
+
+// templateSource returns the parts of template that classes generated from it are
+// instantiated from: its supertypes and body
+func templateSource(template *parser.GenericClassDef) string {
+	return template.Supertypes + "\n" + template.Body
+}
+
+// usesAny returns the first of names that is used as a type, compared case-sensitively
+// like type parameters, in args or their type arguments, or an empty string
+func usesAny(args []parser.GenericExpr, names []string) string {
+	for _, arg := range args {
+		for _, name := range names {
+			if arg.BaseType == name {
+				return name
+			}
+		}
+		if name := usesAny(arg.TypeArgs, names); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// lineOffset returns the offset in content at which the 1-based line starts
+func lineOffset(content string, line int) int {
+	offset := 0
+	for ; line > 1; line-- {
+		next := strings.IndexByte(content[offset:], '\n')
+		if next < 0 {
+			break
+		}
+		offset += next + 1
+	}
+	return offset
+}
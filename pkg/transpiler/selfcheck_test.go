@@ -0,0 +1,69 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestFindRegression(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		input      string
+		typeParams []string
+		problem    string // Empty if the self-check passes
+	}{
+		{"clean", "public class QueueInteger implements Iterable<Integer> {\n    List<Integer> items;\n}", "public class Queue<T> implements Iterable<T> {", []string{"T"}, ""},
+		{"type parameter argument", "public class QueueInteger implements Iterable<T> {\n}", "Iterable<T>", []string{"T"}, "type parameter T remains in Iterable<T>"},
+		{"nested type parameter", "public class QueueInteger {\n    Iterable<List<T>> all;\n}", "Iterable<List<T>>", []string{"T"}, "type parameter T remains in Iterable<List<T>>"},
+		{"built-in type parameter", "public class QueueInteger {\n    List<T> items;\n}", "List<T> items;", []string{"T"}, "type parameter T remains in List<T>"},
+		{"accidental generic", "public class QueueInteger {\n    Integer<String> broken;\n}", "T broken;", []string{"T"}, "generic usage Integer<String> does not come from the source"},
+		{"template declaration", "public class Inner<T> {\n}", "", nil, "declares template Inner"},
+		{"unparseable", "public class Broken<T U> {\n}", "", nil, "does not parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problem := NewTranspiler(nil).findRegression(maskNonCode(tt.content), tt.input, tt.typeParams)
+			if !strings.HasPrefix(problem, tt.problem) || (tt.problem == "") != (problem == "") {
+				t.Errorf("findRegression() = %q, expected %q", problem, tt.problem)
+			}
+		})
+	}
+}
+
+func TestLineOffset(t *testing.T) {
+	content := "a\nbc\nd"
+	for line, expected := range map[int]int{1: 0, 2: 2, 3: 5, 9: 5} {
+		if got := lineOffset(content, line); got != expected {
+			t.Errorf("lineOffset(%d) = %d, expected %d", line, got, expected)
+		}
+	}
+}
+
+func TestTranspileFiles_SelfCheck(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> implements Iterable<T> {\n    private List<T> items;\n    public Iterator<T> iterator() {\n        return items.iterator();\n    }\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetSelfCheck(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	var generated int
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("unexpected error for %s: %v (code %s)", result.OriginalPath, result.Error, diagnostic.FromError("", result.Error).Code)
+		}
+		if result.Content != "" {
+			generated++
+		}
+	}
+	if generated != 2 {
+		t.Errorf("expected Example.cls and QueueInteger.cls, got %d outputs", generated)
+	}
+}
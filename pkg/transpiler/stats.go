@@ -0,0 +1,44 @@
+package transpiler
+
+import "time"
+
+// Stats describes the last TranspileStream, for tracking transpiler performance over
+// time. Phase durations exclude the time spent in the read and emit functions, which
+// belong to the caller.
+type Stats struct {
+	Templates   time.Duration // Phase 1 and 1.5: collecting templates and checking configuration
+	Usages      time.Duration // Phase 2 and planning: collecting instantiations and planning outputs
+	Sources     time.Duration // Phase 3: transpiling sources
+	Generate    time.Duration // Phase 4: generating concrete, holder and factory classes
+	CacheHits   int           // Files whose templates were read from the template cache
+	CacheMisses int           // Files parsed although a template cache was set
+}
+
+// Stats returns statistics about the last TranspileStream
+func (t *Transpiler) Stats() Stats {
+	return t.stats
+}
+
+// phaseTimer measures consecutive phases, excluding time spent outside the transpiler
+type phaseTimer struct {
+	start    time.Time
+	external time.Duration // Time spent in read and emit since start
+}
+
+// newPhaseTimer starts timing the first phase
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{start: time.Now()}
+}
+
+// exclude excludes the time since start, when a call to read or emit started, from
+// the current phase
+func (p *phaseTimer) exclude(start time.Time) {
+	p.external += time.Since(start)
+}
+
+// next ends the current phase, storing its duration in phase, and starts the next one
+func (p *phaseTimer) next(phase *time.Duration) {
+	now := time.Now()
+	*phase = now.Sub(p.start) - p.external
+	p.start, p.external = now, 0
+}
@@ -0,0 +1,50 @@
+package transpiler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTranspileStream_Stats(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	}
+	paths := []string{"Example.peak", "Queue.peak"}
+	cache := &memoryTemplateCache{entries: make(map[string][]byte)}
+
+	run := func() Stats {
+		tr := NewTranspiler(nil)
+		tr.SetTemplateCache(cache)
+		read := func(path string) (string, error) { return files[path], nil }
+		emit := func(FileResult) error {
+			time.Sleep(20 * time.Millisecond) // Writing is not transpiling
+			return nil
+		}
+		if err := tr.TranspileStream(paths, read, emit); err != nil {
+			t.Fatalf("TranspileStream failed: %v", err)
+		}
+		return tr.Stats()
+	}
+
+	cold := run()
+	if cold.CacheHits != 0 || cold.CacheMisses != 2 {
+		t.Errorf("expected 0 hits and 2 misses, got %d and %d", cold.CacheHits, cold.CacheMisses)
+	}
+	warm := run()
+	if warm.CacheHits != 2 || warm.CacheMisses != 0 {
+		t.Errorf("expected 2 hits and 0 misses, got %d and %d", warm.CacheHits, warm.CacheMisses)
+	}
+
+	phases := map[string]time.Duration{
+		"templates": warm.Templates,
+		"usages":    warm.Usages,
+		"sources":   warm.Sources,
+		"generate":  warm.Generate,
+	}
+	for name, d := range phases {
+		if d < 0 || d >= 20*time.Millisecond {
+			t.Errorf("expected the %s phase to exclude time spent in emit, got %v", name, d)
+		}
+	}
+}
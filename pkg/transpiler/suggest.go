@@ -0,0 +1,70 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// templateSuggestion returns "; did you mean 'Queue'?" for name, an undefined template,
+// if a template has a similar name, or "" otherwise
+func (t *Transpiler) templateSuggestion(name string) string {
+	names := make([]string, 0, len(t.templates))
+	for template := range t.templates {
+		names = append(names, template)
+	}
+	return suggestion(name, names)
+}
+
+// methodSuggestion returns "; did you mean 'Repo.get'?" for key, an undefined generic
+// method, if a generic method has a similar key, or "" otherwise
+func (t *Transpiler) methodSuggestion(key string) string {
+	keys := make([]string, 0, len(t.methodTemplates))
+	for method := range t.methodTemplates {
+		keys = append(keys, method)
+	}
+	return suggestion(key, keys)
+}
+
+// suggestion returns "; did you mean '<candidate>'?" for the candidate closest to name,
+// ignoring case, if it is close enough to be a likely typo, or "" otherwise. Ties go to
+// the first candidate in alphabetical order.
+func suggestion(name string, candidates []string) string {
+	sort.Strings(candidates)
+	limit := max(2, len(name)/3) // Edits allowed, more for longer names
+	best, bestDistance := "", limit+1
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean '%s'?", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b: the number of
+// single-byte insertions, deletions and substitutions that turn one into the other
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
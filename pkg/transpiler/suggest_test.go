@@ -0,0 +1,81 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"queue", "queue", 0},
+		{"que", "queue", 2},
+		{"queeu", "queue", 2},
+		{"stack", "queue", 5},
+		{"", "map", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestion(t *testing.T) {
+	candidates := []string{"Queue", "Optional", "Dict", "Repo.get"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Que", "; did you mean 'Queue'?"},
+		{"queue", "; did you mean 'Queue'?"},
+		{"Optinal", "; did you mean 'Optional'?"},
+		{"Repo.gt", "; did you mean 'Repo.get'?"},
+		{"Stack", ""},
+		{"Queue", ""},
+	}
+	for _, tt := range tests {
+		if got := suggestion(tt.name, candidates); got != tt.want {
+			t.Errorf("suggestion(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTranspileFiles_UndefinedTemplateSuggestions(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{
+		Classes: map[string][]string{"Que": {"Integer"}, "Queue": {"Optinal<String>"}},
+		Methods: map[string][]string{"Repo.gt": {"String"}},
+	})
+	files := map[string]string{
+		"Queue.peak":    "public class Queue<T> {\n    private T item;\n}",
+		"Optional.peak": "public class Optional<T> {\n    private T value;\n}",
+		"Repo.peak":     "public class Repo {\n    public <T> T get(String key) { return null; }\n}",
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	var messages []string
+	for _, result := range results {
+		if result.Error != nil {
+			messages = append(messages, result.Error.Error())
+		}
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"'Que' references undefined template; did you mean 'Queue'?",
+		"'Optinal' is not a template or a built-in generic type; did you mean 'Optional'?",
+		"'Repo.gt' references undefined generic method; did you mean 'Repo.get'?",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected an error containing %q, got:\n%s", want, all)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// TestAnnotation marks a template as test-only. Apex requires it on test classes, so
+// unlike Peak's own annotations it is kept on the generated classes.
+const TestAnnotation = "@IsTest"
+
+// SetTestClasses marks the templates and instantiations in entries as test-only,
+// besides templates annotated with @IsTest: entries name a template, as in
+// "Fixture", or a single instantiation, as in "Queue<Account>". The concrete classes
+// of test-only templates and instantiations are declared @IsTest and, when dir is
+// not empty, written to dir, relative to the output root set with SetOutputDirs, so
+// test scaffolding stays out of production packages. A template's own output
+// directory takes precedence over dir.
+func (t *Transpiler) SetTestClasses(dir string, entries []string) {
+	t.testDirConfig = dir
+	t.testConfig = entries
+}
+
+// processTestClasses resolves the test-only templates and instantiations from
+// @IsTest annotations and config (Phase 1.5). Config entries naming no template or
+// malformed instantiations are errors.
+func (t *Transpiler) processTestClasses(results *[]FileResult) bool {
+	hasErrors := false
+	t.testTemplates = make(map[string]bool)
+	t.testClasses = make(map[string]bool)
+
+	for name, template := range t.templates {
+		if _, ok := findAnnotation(template, TestAnnotation); ok {
+			t.testTemplates[name] = true
+		}
+	}
+
+	configError := func(code string, err error) {
+		hasErrors = true
+		*results = append(*results, FileResult{
+			OriginalPath: "peakconfig.json",
+			Error:        diagnostic.WithCode(code, err),
+		})
+	}
+	for _, entry := range t.testConfig {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "<") {
+			name, exists := t.templateName(entry)
+			if !exists {
+				configError(diagnostic.CodeUndefinedTemplate,
+					fmt.Errorf("testClasses entry '%s' references undefined template%s", entry, t.templateSuggestion(entry)))
+				continue
+			}
+			t.testTemplates[name] = true
+			continue
+		}
+
+		expr, err := t.parseInstantiation(entry)
+		if err == nil && t.templates[expr.BaseType] == nil {
+			configError(diagnostic.CodeUndefinedTemplate,
+				fmt.Errorf("testClasses entry '%s' references undefined template%s", entry, t.templateSuggestion(expr.BaseType)))
+			continue
+		}
+		if err == nil {
+			err = t.validateTypeArgs(expr.BaseType, len(t.templates[expr.BaseType].TypeParams), expr.TypeArgs)
+		}
+		if err != nil {
+			configError(diagnostic.CodeInvalidInstantiation,
+				fmt.Errorf("invalid testClasses entry '%s': %w", entry, err))
+			continue
+		}
+		t.testClasses[strings.ToLower(parser.GenerateConcreteClassName(expr))] = true
+	}
+	return hasErrors
+}
+
+// isTestInstantiation reports whether the concrete class for expr is test-only, as
+// an instantiation of a test-only template or an instantiation marked in config
+func (t *Transpiler) isTestInstantiation(expr *parser.GenericExpr) bool {
+	return t.testTemplates[expr.BaseType] || t.testClasses[strings.ToLower(parser.GenerateConcreteClassName(expr))]
+}
+
+// testAnnotation returns the annotation that declares the concrete class for expr
+// a test class, or nothing when it is not test-only or its template already carries
+// @IsTest. Inner classes of holders cannot be test classes; a holder is declared
+// @IsTest instead when its whole template is test-only.
+func (t *Transpiler) testAnnotation(template *parser.GenericClassDef, expr *parser.GenericExpr) string {
+	if t.holderClasses || !t.isTestInstantiation(expr) {
+		return ""
+	}
+	if _, ok := findAnnotation(template, TestAnnotation); ok {
+		return ""
+	}
+	return TestAnnotation
+}
+
+// testOutputDir returns the test directory when the class generated from template
+// for expr (nil for holder and factory classes, which serve the whole template) is
+// test-only and the template has no output directory of its own
+func (t *Transpiler) testOutputDir(template string, expr *parser.GenericExpr) (string, bool) {
+	if t.testDirConfig == "" {
+		return "", false
+	}
+	if _, ok := t.outputDirs[template]; ok {
+		return "", false
+	}
+	if t.testTemplates[template] || (expr != nil && !t.holderClasses && t.isTestInstantiation(expr)) {
+		return t.resolveOutputDir(t.testDirConfig), true
+	}
+	return "", false
+}
@@ -0,0 +1,178 @@
+package transpiler
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_TestTemplate(t *testing.T) {
+	files := map[string]string{
+		"src/Fixture.peak": "@IsTest\npublic class Fixture<T> {\n    private List<T> items;\n}",
+		"src/Example.peak": "public class Example {\n    Fixture<Integer> f;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetFactories(true)
+	tr.SetOutputDirs("out", nil)
+	tr.SetTestClasses("test", nil)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	fixture, ok := outputs[filepath.Join("out", "test", "FixtureInteger.cls")]
+	if !ok {
+		t.Fatalf("expected FixtureInteger.cls in out/test, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+	if strings.Count(fixture, "@IsTest") != 1 {
+		t.Errorf("expected a single @IsTest, got:\n%s", fixture)
+	}
+	factory, ok := outputs[filepath.Join("out", "test", "FixtureFactory.cls")]
+	if !ok {
+		t.Fatalf("expected FixtureFactory.cls in out/test, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+	if !strings.Contains(factory, "@IsTest public virtual class FixtureFactory {") {
+		t.Errorf("expected FixtureFactory to be declared @IsTest, got:\n%s", factory)
+	}
+	if registry := GenerateRegistry(results); strings.Contains(registry, "Fixture") {
+		t.Errorf("expected the registry not to reference test classes, got:\n%s", registry)
+	}
+}
+
+func TestTranspileFiles_TestTemplateConfigCase(t *testing.T) {
+	files := map[string]string{
+		"Fixture.peak": "public class Fixture<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    Fixture<Integer> f;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetTestClasses("test", []string{"fixture"}) // Apex names are case-insensitive
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		if result.OutputPath != filepath.Join("test", "FixtureInteger.cls") {
+			continue
+		}
+		if !result.Test || !strings.Contains(result.Content, "@IsTest public class FixtureInteger") {
+			t.Errorf("expected FixtureInteger to be declared @IsTest, got:\n%s", result.Content)
+		}
+		return
+	}
+	t.Fatal("expected FixtureInteger.cls in test")
+}
+
+func TestTranspileFiles_TestInstantiation(t *testing.T) {
+	files := map[string]string{
+		"src/Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"src/Example.peak": "public class Example {\n    Queue<Integer> a;\n    Queue<Account> b;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetFactories(true)
+	tr.SetOutputDirs("out", nil)
+	tr.SetTestClasses("test", []string{"Queue<Account>"})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	account, ok := outputs[filepath.Join("out", "test", "QueueAccount.cls")]
+	if !ok {
+		t.Fatalf("expected QueueAccount.cls in out/test, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+	if !strings.Contains(account, "@IsTest public class QueueAccount") {
+		t.Errorf("expected QueueAccount to be declared @IsTest, got:\n%s", account)
+	}
+	integer, ok := outputs[filepath.Join("src", "QueueInteger.cls")]
+	if !ok {
+		t.Fatalf("expected QueueInteger.cls next to its template, got %v", slices.Sorted(maps.Keys(outputs)))
+	}
+	if strings.Contains(integer, "@IsTest") {
+		t.Errorf("expected QueueInteger not to be a test class, got:\n%s", integer)
+	}
+
+	// Production classes cannot reference test classes
+	if factory := outputs[filepath.Join("src", "QueueFactory.cls")]; !strings.Contains(factory, "newIntegerQueue") || strings.Contains(factory, "QueueAccount") {
+		t.Errorf("expected QueueFactory to create QueueInteger only, got:\n%s", factory)
+	}
+	if registry := GenerateRegistry(results); !strings.Contains(registry, "QueueInteger") || strings.Contains(registry, "QueueAccount") {
+		t.Errorf("expected the registry to reference QueueInteger only, got:\n%s", registry)
+	}
+}
+
+func TestTranspileFiles_TestClassesConfigErrors(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": "public class Queue<T> {\n    private List<T> items;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetTestClasses("", []string{"Fixture", "Queue<Integer, String>"})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var codes []string
+	for _, result := range results {
+		if result.Error != nil && result.OriginalPath == "peakconfig.json" {
+			codes = append(codes, diagnostic.FromError(result.OriginalPath, result.Error).Code)
+		}
+	}
+	want := []string{diagnostic.CodeUndefinedTemplate, diagnostic.CodeInvalidInstantiation}
+	if !slices.Equal(codes, want) {
+		t.Errorf("expected codes %v, got %v", want, codes)
+	}
+}
+
+func TestTranspileFiles_TestTemplateHolder(t *testing.T) {
+	files := map[string]string{
+		"Fixture.peak": "@IsTest\npublic class Fixture<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    Fixture<Integer> f;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetHolderClasses(true)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		if result.OutputPath != "Fixtures.cls" {
+			continue
+		}
+		if !strings.Contains(result.Content, "\n@IsTest public class Fixtures {") || strings.Count(result.Content, "@IsTest") != 1 {
+			t.Errorf("expected only the holder to be declared @IsTest, got:\n%s", result.Content)
+		}
+		return
+	}
+	t.Fatal("expected Fixtures.cls")
+}
@@ -8,33 +8,118 @@
 package transpiler
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
 	"github.com/ipavlic/peak/pkg/parser"
 )
 
 // FileResult represents the transpilation result for a single file
 type FileResult struct {
-	OriginalPath string
-	OutputPath   string
-	Content      string
-	IsTemplate   bool  // true if this file contains a generic class definition
-	Error        error // error encountered during transpilation
+	OriginalPath  string
+	OutputPath    string
+	Content       string
+	IsTemplate    bool              // true if this file contains a generic class definition
+	Error         error             // error encountered during transpilation
+	TemplatePath  string            // Template source file (concrete classes only)
+	Instantiation string            // Generic expression that produced this class, e.g. "Queue<Integer>" (concrete classes only)
+	SourceLines   []int             // SourceLines[i] is the source line that produced output line i+1 (0 = generated code)
+	Members       map[string]string // Instantiations to qualified inner class names (holder classes only)
+	Test          bool              // The class is test-only and declared @IsTest, see SetTestClasses (generated classes only)
+	Unchanged     bool              // Generation was skipped as the output is the same as in the previous run, see SetIncremental; Content is empty
+	Timings       Timings           // Time spent producing this result
+}
+
+// Timings are the durations spent on a single result, for finding slow files
+type Timings struct {
+	Parse     time.Duration // Collecting templates and usages from the source (zero for generated classes)
+	Transpile time.Duration // Generating the output
 }
 
 // Transpiler handles transpilation of Peak files to Apex
 type Transpiler struct {
 	templates        map[string]*parser.GenericClassDef  // Generic class definitions
 	templatePaths   map[string]string                   // Template name to file path
+	templateNames   map[string]string                   // Lower case template name to the declared one
 	methodTemplates map[string]*parser.GenericMethodDef // Generic method definitions (keyed by "ClassName.methodName")
 	usages          map[string]*parser.GenericExpr      // Generic instantiations
 	outputPathFn    func(string) (string, error)        // Function to resolve output paths
 	instantiate     *config.Instantiate                 // Structured instantiation config (classes + methods)
 	methodUsages    map[string][]string                 // Method instantiations: "ClassName.methodName" -> ["String", "Decimal", ...]
+	methodPaths     map[string]string                   // Method template key to file path
+	methodCalls     map[string][]methodCall             // Generic method calls to rewrite, by source path
+	templateCache   TemplateCache                       // Optional cache of Phase 1 parse results
+	forced          map[string]forcedInstantiation      // Class instantiations forced by config, keyed by expression
+	usedClasses     map[string]bool                     // Lowercased concrete class names instantiated in sources
+	usedTemplates   map[string]bool                     // Templates referenced from sources other than their own file
+	ignored         map[string][]lineRange              // Lines skipped by peak:ignore pragmas, by source path
+	symbols         map[string]bool                     // Lowercased symbols defined for peak:if sections, see SetSymbols
+	constants       map[string]string                   // Values of ${NAME} placeholders by lowercased name, see SetConstants
+	inactive        map[string][]lineRange              // Lines of inactive peak:if sections, by source path
+	included        map[string][]includedLine           // Origins of the lines of sources with peak:include, by source path
+	readInclude     func(string) (string, error)        // Reads peak:include snippets, see SetIncludeReader
+	outputRoot      string                              // Directory that template output directories are relative to
+	outputDirConfig map[string]string                   // Output directories by template name from config, see SetOutputDirs
+	outputDirs      map[string]string                   // Resolved output directories by template name, see processOutputDirs
+	testDirConfig   string                              // Output directory of test-only classes from config, see SetTestClasses
+	testConfig      []string                            // Test-only templates and instantiations from config
+	testTemplates   map[string]bool                     // Test-only templates, see processTestClasses
+	testClasses     map[string]bool                     // Lowercased concrete class names of test-only instantiations
+	visibility      *config.Visibility                  // Access modifiers of generated code (nil = copied from templates)
+	managedPackage  bool                                // Make @PeakPackageApi templates global, see SetManagedPackage
+	packageApi      []string                            // Templates that must carry @PeakPackageApi
+	warnings        []diagnostic.Diagnostic             // Warnings about the configuration, see Warnings
+	docComments     bool                                // Rewrite generic references in /** */ doc comments
+	dynamicTypes    bool                                // Rewrite type names in Type.forName and JSON.deserialize strings
+	factories       bool                                // Generate a factory class for each instantiated template
+	holderClasses   bool                                // Generate concrete classes as inner classes of a holder per template
+	classLimit      *config.ClassLimit                  // Concrete class count to report exceeding (nil = unlimited)
+	longClassNames  string                              // Policy for class names longer than Apex allows, see SetLongClassNames
+	classNaming     *config.ClassNaming                 // Naming pattern of top-level concrete classes (nil = run together)
+	builtInGenerics map[string]int                      // Generic types passed through unchanged, see SetBuiltInGenerics
+	selfCheck       bool                                // Re-parse every generated file, see SetSelfCheck
+	selected        map[string]bool                     // Sources to generate output for, see SetSelection (nil = all)
+	incremental     bool                                // Fingerprint outputs and skip unchanged ones, see SetIncremental
+	previous        Fingerprints                        // Fingerprints of the previous run, see SetIncremental
+	fingerprints    Fingerprints                        // Fingerprints of the outputs of this run, see Fingerprints
+	contentHashes   map[string]string                   // Hashes of expanded sources, by path, for fingerprints
+	parseTimes      map[string]time.Duration            // Time spent collecting templates and usages, by source path
+	users           map[string]map[string]bool          // Sources using each class or method template, see Usage
+	generatedLines  map[string]int                      // Lines generated from each class or method template, see Usage
+	unusedParams    map[string][]string                 // Type parameters each template never mentions, see Usage
+	version         string                              // Peak version named in provenance headers, see SetVersion
+	stats           Stats                               // Statistics about the last run, see Stats
+	logger          *slog.Logger                        // Debug records about each phase, see SetLogger
+}
+
+// ParsedTemplates holds the class and method templates parsed from a single file
+type ParsedTemplates struct {
+	Classes map[string]*parser.GenericClassDef  `json:"classes,omitempty"`
+	Methods map[string]*parser.GenericMethodDef `json:"methods,omitempty"` // Keyed by "ClassName.methodName"
+}
+
+// TemplateCache stores the templates parsed from a file, keyed by the file's content,
+// so unchanged template libraries need not be re-parsed. Implementations must not
+// retain or return definitions that the transpiler may modify; they should copy them.
+type TemplateCache interface {
+	Get(content string) (*ParsedTemplates, bool)
+	Put(content string, parsed *ParsedTemplates)
+}
+
+// TemplateInfo describes a generic class or method template found during transpilation
+type TemplateInfo struct {
+	Name       string   // Class name, or "ClassName.methodName" for generic methods
+	Path       string   // Source file containing the template
+	Line       int      // Line of the definition in source (1-based)
+	TypeParams []string // Type parameter names, e.g. ["K", "V"]
+	IsMethod   bool     // true for generic methods
 }
 
 // NewTranspiler creates a new transpiler with a custom output path resolver.
@@ -47,15 +132,57 @@ func NewTranspiler(outputPathFn func(string) (string, error)) *Transpiler {
 		}
 	}
 
-	return &Transpiler{
-		templates:        make(map[string]*parser.GenericClassDef),
-		templatePaths:    make(map[string]string),
-		methodTemplates: make(map[string]*parser.GenericMethodDef),
-		usages:          make(map[string]*parser.GenericExpr),
-		outputPathFn:    outputPathFn,
-		instantiate:     nil,
-		methodUsages:    make(map[string][]string),
+	t := &Transpiler{
+		outputPathFn: outputPathFn,
+		readInclude:  readIncludeFile,
+		logger:       slog.New(slog.DiscardHandler),
 	}
+	t.reset()
+	return t
+}
+
+// reset clears what a previous run collected, so a transpiler reused across runs,
+// as in watch mode, neither grows nor generates classes for usages that are gone.
+// Settings are kept.
+func (t *Transpiler) reset() {
+	t.templates = make(map[string]*parser.GenericClassDef)
+	t.templatePaths = make(map[string]string)
+	t.templateNames = make(map[string]string)
+	t.methodTemplates = make(map[string]*parser.GenericMethodDef)
+	t.usages = make(map[string]*parser.GenericExpr)
+	t.methodUsages = make(map[string][]string)
+	t.methodPaths = make(map[string]string)
+	t.methodCalls = make(map[string][]methodCall)
+	t.forced = make(map[string]forcedInstantiation)
+	t.usedClasses = make(map[string]bool)
+	t.usedTemplates = make(map[string]bool)
+	t.ignored = make(map[string][]lineRange)
+	t.inactive = make(map[string][]lineRange)
+	t.included = make(map[string][]includedLine)
+	t.outputDirs = nil
+	t.testTemplates = nil
+	t.testClasses = nil
+	t.warnings = nil
+	t.parseTimes = nil
+	t.users = make(map[string]map[string]bool)
+	t.fingerprints = make(Fingerprints)
+	t.contentHashes = make(map[string]string)
+	t.generatedLines = make(map[string]int)
+	t.unusedParams = make(map[string][]string)
+	t.stats = Stats{}
+}
+
+// SetLogger sets the logger that receives debug records about each phase, such as
+// the number of templates and usages found and the outputs planned. By default,
+// nothing is logged.
+func (t *Transpiler) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// SetTemplateCache sets a cache for parsed templates. Files whose content is
+// cached skip template parsing in Phase 1 and 1.1.
+func (t *Transpiler) SetTemplateCache(cache TemplateCache) {
+	t.templateCache = cache
 }
 
 // SetInstantiate sets the structured instantiation configuration.
@@ -64,41 +191,455 @@ func (t *Transpiler) SetInstantiate(spec *config.Instantiate) {
 	t.instantiate = spec
 }
 
+// SetDocComments enables rewriting generic expressions inside /** */ doc comments,
+// so that ApexDoc references such as "@see Queue<Integer>" name the generated class.
+// Other comments are never rewritten.
+func (t *Transpiler) SetDocComments(enabled bool) {
+	t.docComments = enabled
+}
+
+// SetDynamicTypes enables rewriting string literals that name a generic type in
+// Type.forName, JSON.deserialize and JSON.deserializeStrict calls, such as
+// Type.forName('Queue<Integer>'), to the generated class name. The literal counts as
+// a usage, so the class is generated. Other string literals are never rewritten.
+func (t *Transpiler) SetDynamicTypes(enabled bool) {
+	t.dynamicTypes = enabled
+}
+
+// SetSelection limits the sources that are compiled to those at paths: the other
+// sources passed to TranspileStream still contribute templates and usages, so every
+// concrete class is generated as in a full build, but produce no results of their own.
+// A nil selection compiles every source.
+func (t *Transpiler) SetSelection(paths []string) {
+	if paths == nil {
+		t.selected = nil
+		return
+	}
+	t.selected = make(map[string]bool, len(paths))
+	for _, path := range paths {
+		t.selected[path] = true
+	}
+}
+
 // TranspileFiles processes multiple files and generates concrete classes
 func (t *Transpiler) TranspileFiles(files map[string]string) ([]FileResult, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
 	var results []FileResult
+	read := func(path string) (string, error) {
+		return files[path], nil
+	}
+	emit := func(result FileResult) error {
+		results = append(results, result)
+		return nil
+	}
+	if err := t.TranspileStream(paths, read, emit); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
 
-	// Phase 1: Collect all generic class definitions (templates)
-	hasErrors := t.collectTemplates(files, &results)
+// TranspileStream transpiles the files at paths without holding them all in memory,
+// for very large projects. read loads a file each time it is needed (up to three
+// times per file, once per pass), and emit receives each result as soon as it is
+// produced. Template bodies are released once all their instantiations have been
+// generated. An error from read or emit aborts transpilation and is returned.
+func (t *Transpiler) TranspileStream(paths []string, read func(path string) (string, error), emit func(FileResult) error) error {
+	var errs []FileResult
+	t.reset()
+	timer := newPhaseTimer()
+	readSource, emitResult := read, emit
+	read = func(path string) (string, error) {
+		defer timer.exclude(time.Now())
+		return readSource(path)
+	}
+	emit = func(result FileResult) error {
+		defer timer.exclude(time.Now())
+		return emitResult(result)
+	}
+
+	// Snippets are spliced in, lines of inactive peak:if sections blanked out and
+	// constants substituted when sources are loaded. Outputs are only fixed up once they have been
+	// generated: inactive lines are removed, and lines located in the source. Generated
+	// classes close to the Apex size limit are reported then.
+	emitOutput := emit
+	emit = func(result FileResult) error {
+		result = t.locateIncludedLines(t.stripInactiveLines(result))
+		t.checkClassSize(result)
+		t.countGeneratedLines(result)
+		return emitOutput(result)
+	}
 
-	// Phase 1.1: Collect all generic method definitions
-	hasErrors = t.collectMethodTemplates(files, &results) || hasErrors
+	// load reads a single file as a one-entry map for the collection phases.
+	// Line endings are normalized so output is identical whether sources were
+	// checked out with CRLF (Windows) or LF. A peak:include that cannot be read, a
+	// malformed peak:if section or an undefined constant is recorded in loadErrors
+	// and reported in Phase 1.
+	loadErrors := make(map[string]error)
+	load := func(path string) (map[string]string, error) {
+		content, err := read(path)
+		if err != nil {
+			return nil, err
+		}
+		files := normalizeLineEndings(map[string]string{path: content})
+		if files[path], err = t.expandIncludes(path, files[path]); err != nil {
+			loadErrors[path] = err
+		} else if files[path], err = t.applyConditionals(path, files[path]); err != nil {
+			loadErrors[path] = err
+		} else if files[path], err = t.applyConstants(path, files[path]); err != nil {
+			loadErrors[path] = err
+		}
+		return files, nil
+	}
 
-	// Phase 1.5: Process forced instantiations from config
-	hasErrors = t.processInstantiations(&results) || hasErrors
+	// Phase 1 and 1.1: Collect all generic class and method definitions (templates)
+	hasErrors := false
+	t.parseTimes = make(map[string]time.Duration, len(paths))
+	for _, path := range paths {
+		files, err := load(path)
+		if err != nil {
+			return err
+		}
+		if err := loadErrors[path]; err != nil {
+			hasErrors = true
+			t.recordError(path, err, &errs)
+			continue
+		}
+		start := time.Now()
+		if t.templateCache != nil {
+			if parsed, ok := t.templateCache.Get(files[path]); ok {
+				t.logger.Debug("template cache hit", "path", path)
+				t.stats.CacheHits++
+				t.addParsedTemplates(path, parsed)
+				t.parseTimes[path] = time.Since(start)
+				continue
+			}
+			t.stats.CacheMisses++
+		}
+
+		fileErrors := t.collectTemplates(files, &errs)
+		fileErrors = t.collectMethodTemplates(files, &errs) || fileErrors
+		if fileErrors {
+			hasErrors = true
+		} else if t.templateCache != nil {
+			t.templateCache.Put(files[path], t.parsedTemplates(path))
+		}
+		t.parseTimes[path] = time.Since(start)
+	}
+
+	t.logger.Debug("collected templates", "classes", len(t.templates), "methods", len(t.methodTemplates))
+
+	// Phase 1.5: Process forced instantiations, output directories, test classes, visibility and package API
+	hasErrors = t.processInstantiations(&errs) || hasErrors
+	hasErrors = t.processOutputDirs(&errs) || hasErrors
+	hasErrors = t.processTestClasses(&errs) || hasErrors
+	hasErrors = t.processVisibility(&errs) || hasErrors
+	hasErrors = t.processPackageApi(&errs) || hasErrors
+	t.findUnusedTypeParams()
+	timer.next(&t.stats.Templates)
 
 	// Phase 2: Collect all generic instantiations
-	hasErrors = t.collectUsages(files, &results) || hasErrors
+	for _, path := range paths {
+		files, err := load(path)
+		if err != nil {
+			return err
+		}
+		if loadErrors[path] != nil {
+			continue // Reported in Phase 1
+		}
+		t.recordContent(path, files[path])
+		start := time.Now()
+		hasErrors = t.collectUsages(files, &errs) || hasErrors
+		t.parseTimes[path] += time.Since(start)
+	}
+	t.warnings = t.checkForcedInstantiations()
+	expandErrors := t.expandDependencies(&errs)
+	hasErrors = expandErrors || hasErrors
+	t.warnings = append(t.warnings, t.checkUnusedTemplates()...)
+	if !expandErrors { // Runaway instantiations are reported once, not for every name
+		hasErrors = t.checkClassNames(&errs) || hasErrors
+	}
+	t.logger.Debug("collected usages", "classes", len(t.usages), "methods", len(t.methodUsages))
 
 	// If there were errors in parsing, return now with error results
 	if hasErrors {
-		return results, nil
+		timer.next(&t.stats.Usages)
+		for _, result := range errs {
+			if err := emit(result); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	// Phase 3: Generate output for each file
-	for path, content := range files {
-		result, err := t.transpileFile(path, content)
-		if err != nil {
-			result.Error = err
+	// Plan every output before generating any, so outputs that would
+	// overwrite each other are detected without holding their contents
+	templateFiles := make(map[string]bool, len(t.templatePaths))
+	for _, path := range t.templatePaths {
+		templateFiles[path] = true
+	}
+	var planned []FileResult
+	for _, path := range paths {
+		if templateFiles[path] {
+			continue
+		}
+		if outputPath, err := t.outputPathFn(path); err == nil {
+			planned = append(planned, FileResult{OriginalPath: path, OutputPath: outputPath})
+		}
+	}
+	sourceCount := len(planned)
+	concrete := t.planConcreteClasses()
+	var holders []holderPlan
+	holderIndex := make(map[*parser.GenericClassDef]int)
+	if t.holderClasses {
+		holders = t.planHolders(concrete)
+		for i, plan := range holders {
+			holderIndex[plan.template] = i
+			planned = append(planned, plan.result)
+		}
+	} else {
+		for _, plan := range concrete {
+			planned = append(planned, plan.result)
+		}
+	}
+	var factories []factoryPlan
+	if t.factories {
+		factories = t.planFactories(concrete)
+	}
+	factoryOffset := len(planned)
+	factoryIndex := make(map[*parser.GenericClassDef]int, len(factories))
+	for i, plan := range factories {
+		factoryIndex[plan.template] = i
+		planned = append(planned, plan.result)
+	}
+	t.fingerprintPlans(planned[:sourceCount], concrete, holders, factories)
+	t.logger.Debug("planned outputs", "sources", sourceCount, "concrete", len(concrete),
+		"holders", len(holders), "factories", len(factories))
+	collisions, duplicates := findOutputCollisions(planned)
+	duplicate := func(i int) bool { return duplicates[sourceCount+i] }
+	concreteCollision := func(i int) error { return collisions[sourceCount+i] }
+	if t.holderClasses {
+		// Inner classes are not files; only their names within a holder can clash
+		concreteResults := make([]FileResult, len(concrete))
+		for i, plan := range concrete {
+			concreteResults[i] = plan.result
+		}
+		innerCollisions, innerDuplicates := findOutputCollisions(concreteResults)
+		duplicate = func(i int) bool { return innerDuplicates[i] }
+		concreteCollision = func(i int) error { return innerCollisions[i] }
+	}
+	timer.next(&t.stats.Usages)
+	if d := t.checkClassLimit(concrete, duplicate); d != nil {
+		if d.Severity != diagnostic.SeverityError {
+			t.warnings = append(t.warnings, *d)
+		} else {
+			// Stop before writing anything, so a runaway expansion never reaches the org
+			return emit(FileResult{OriginalPath: d.File, Error: diagnostic.WithCode(d.Code, errors.New(d.Message))})
+		}
+	}
+	sourceCollisions := make(map[string]error)
+	for i, err := range collisions {
+		if i < sourceCount {
+			sourceCollisions[planned[i].OriginalPath] = err
+		}
+	}
+	sourcePlans := make(map[string]FileResult, sourceCount)
+	for _, result := range planned[:sourceCount] {
+		sourcePlans[result.OriginalPath] = result
+	}
+
+	// Phase 3: Generate output for each selected file
+	for _, path := range paths {
+		if t.selected != nil && !t.selected[path] {
+			continue
+		}
+		var result FileResult
+		start := time.Now()
+		switch {
+		case templateFiles[path]:
+			// This is a template file - don't generate output
+			result = FileResult{OriginalPath: path, IsTemplate: true}
+		case sourceCollisions[path] != nil:
+			result = FileResult{OriginalPath: path, Error: sourceCollisions[path]}
+		case t.unchanged(sourcePlans[path]):
+			result = unchangedResult(sourcePlans[path])
+		default:
+			files, err := load(path)
+			if err != nil {
+				return err
+			}
+			start = time.Now() // Reading is not transpiling
+			result, err = t.transpileFile(path, files[path])
+			if err != nil {
+				result.Error = err
+			} else if !result.IsTemplate {
+				if err := t.checkOutput(result, files[path], nil); err != nil {
+					result = FileResult{OriginalPath: path, Error: err}
+				}
+			}
+		}
+		result.Timings = Timings{Parse: t.parseTimes[path], Transpile: time.Since(start)}
+		if err := emit(result); err != nil {
+			return err
 		}
-		results = append(results, result)
 	}
 
-	// Phase 4: Generate concrete class files
-	concreteClasses := t.generateConcreteClasses()
-	results = append(results, concreteClasses...)
+	timer.next(&t.stats.Sources)
+
+	// Phase 4: Generate concrete class files, grouped by template, or one holder class
+	// per template in holder mode, each followed by the template's factory class if
+	// factories are enabled
+	var created []concretePlan // Concrete classes of the current template generated without errors
+	for i, plan := range concrete {
+		switch {
+		case duplicate(i):
+		case concreteCollision(i) != nil:
+			if err := emit(FileResult{OriginalPath: plan.result.TemplatePath, Error: concreteCollision(i)}); err != nil {
+				return err
+			}
+		case t.holderClasses:
+			created = append(created, plan) // Generated with its holder below
+		case t.unchanged(plan.result):
+			if err := emit(unchangedResult(plan.result)); err != nil {
+				return err
+			}
+			created = append(created, plan)
+		default:
+			start := time.Now()
+			result := t.generateConcreteClass(plan)
+			result.Timings.Transpile = time.Since(start)
+			if err := emit(result); err != nil {
+				return err
+			}
+			if result.Error == nil {
+				created = append(created, plan)
+			}
+		}
 
-	return results, nil
+		if i+1 < len(concrete) && concrete[i+1].template == plan.template {
+			continue
+		}
+		if index, ok := holderIndex[plan.template]; ok && len(created) > 0 {
+			holder := FileResult{OriginalPath: plan.result.TemplatePath, Error: collisions[sourceCount+index]}
+			var failures []FileResult
+			if holder.Error == nil && t.unchanged(holders[index].result) {
+				holder = unchangedResult(holders[index].result)
+			} else if holder.Error == nil {
+				start := time.Now()
+				holder, created, failures = t.generateHolder(holders[index], created)
+				holder.Timings.Transpile = time.Since(start)
+			} else {
+				created = nil
+			}
+			for _, result := range append(failures, holder) {
+				if err := emit(result); err != nil {
+					return err
+				}
+			}
+		}
+		if index, ok := factoryIndex[plan.template]; ok && len(created) > 0 {
+			factory := FileResult{OriginalPath: plan.result.TemplatePath, Error: collisions[factoryOffset+index]}
+			if factory.Error == nil && t.unchanged(factories[index].result) {
+				factory = unchangedResult(factories[index].result)
+			} else if factory.Error == nil {
+				start := time.Now()
+				factory = t.generateFactory(factories[index], created)
+				factory.Timings.Transpile = time.Since(start)
+			}
+			if err := emit(factory); err != nil {
+				return err
+			}
+		}
+		created = created[:0]
+
+		// Release the template body after its last instantiation
+		plan.template.Body = ""
+	}
+	timer.next(&t.stats.Generate)
+
+	return nil
+}
+
+// findOutputCollisions detects outputs whose paths differ only in case, or not at all.
+// Apex class names are case-insensitive and so are the default filesystems on Windows
+// and macOS, so such outputs would silently overwrite each other. Concrete classes
+// whose instantiations differ only in case (Queue<string> and Queue<String>) name the
+// same type and are reported as duplicates to skip; any other collision is reported
+// as an error for the later output. Source outputs take precedence over generated classes,
+// and factory and holder classes over concrete classes.
+func findOutputCollisions(results []FileResult) (map[int]error, map[int]bool) {
+	// Visit source outputs first, then generated classes in a deterministic order
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := results[order[a]], results[order[b]]
+		if (ra.OriginalPath != "") != (rb.OriginalPath != "") {
+			return ra.OriginalPath != ""
+		}
+		return ra.Instantiation < rb.Instantiation
+	})
+
+	collisions := make(map[int]error)
+	duplicates := make(map[int]bool)
+	seen := make(map[string]FileResult)
+	classes := make(map[string]FileResult) // By class name, for concrete classes in other directories
+	for _, i := range order {
+		result := results[i]
+		key := strings.ToLower(filepath.Clean(result.OutputPath))
+		className := strings.TrimSuffix(filepath.Base(result.OutputPath), filepath.Ext(result.OutputPath))
+		first, exists := seen[key]
+		if !exists {
+			// Apex class names are global to the org, so a generated class may not share
+			// its name with a class declared by a source elsewhere in the project
+			other, declared := classes[strings.ToLower(className)]
+			if declared && result.OriginalPath == "" {
+				collisions[i] = diagnostic.WithCode(diagnostic.CodeOutputCollision, fmt.Errorf("class %s (from %s) is also declared by %s (output %s)",
+					className, describeOutput(result), describeOutput(other), other.OutputPath))
+				continue
+			}
+			seen[key] = result
+			if !declared {
+				classes[strings.ToLower(className)] = result
+			}
+			continue
+		}
+
+		if result.Instantiation != "" && strings.EqualFold(result.Instantiation, first.Instantiation) {
+			duplicates[i] = true
+			continue
+		}
+
+		collisions[i] = diagnostic.WithCode(diagnostic.CodeOutputCollision, fmt.Errorf("output %s (from %s) collides with %s (from %s)",
+			result.OutputPath, describeOutput(result), first.OutputPath, describeOutput(first)))
+	}
+	return collisions, duplicates
+}
+
+// describeOutput names what produced an output, for collision errors
+func describeOutput(result FileResult) string {
+	switch {
+	case result.Instantiation != "":
+		return result.Instantiation
+	case result.OriginalPath == "":
+		return result.TemplatePath // A factory or holder class
+	}
+	return result.OriginalPath
+}
+
+// normalizeLineEndings returns files with CRLF line endings converted to LF.
+// The input map is not modified.
+func normalizeLineEndings(files map[string]string) map[string]string {
+	normalized := make(map[string]string, len(files))
+	for path, content := range files {
+		normalized[path] = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	return normalized
 }
 
 // collectTemplates scans all files for generic class definitions (Phase 1)
@@ -110,16 +651,18 @@ func (t *Transpiler) collectTemplates(files map[string]string, results *[]FileRe
 		defs, err := p.FindGenericClassDefinitions()
 		if err != nil {
 			hasErrors = true
-			*results = append(*results, FileResult{
-				OriginalPath: path,
-				Error:        err,
-			})
+			// One result per error, as the parser reports all errors in the file
+			for _, err := range parser.SplitErrors(err) {
+				*results = append(*results, FileResult{
+					OriginalPath: path,
+					Error:        err,
+				})
+			}
 			continue
 		}
 
 		for className, def := range defs {
-			t.templates[className] = def
-			t.templatePaths[className] = path
+			t.addTemplate(className, path, def)
 		}
 	}
 	return hasErrors
@@ -157,6 +700,7 @@ func (t *Transpiler) collectMethodTemplates(files map[string]string, results *[]
 			// Store method templates
 			for key, method := range methods {
 				t.methodTemplates[key] = method
+				t.methodPaths[key] = path
 			}
 		}
 
@@ -165,7 +709,7 @@ func (t *Transpiler) collectMethodTemplates(files map[string]string, results *[]
 		regularClassParser := parser.NewParser(content)
 		regularClassParser.SetFileName(path)
 
-		// Try to find class name from content (simple heuristic)
+		// Find the class name from the outline of the content
 		className := t.extractClassName(content)
 		if className != "" && len(classDefs) == 0 {
 			// This is a non-template class, check for generic methods
@@ -183,33 +727,84 @@ func (t *Transpiler) collectMethodTemplates(files map[string]string, results *[]
 
 			for key, method := range methods {
 				t.methodTemplates[key] = method
+				t.methodPaths[key] = path
 			}
 		}
 	}
 	return hasErrors
 }
 
-// extractClassName extracts the class name from file content (simple heuristic)
+// addParsedTemplates registers templates parsed from path, e.g. from a TemplateCache
+func (t *Transpiler) addParsedTemplates(path string, parsed *ParsedTemplates) {
+	for name, def := range parsed.Classes {
+		t.addTemplate(name, path, def)
+	}
+	for key, def := range parsed.Methods {
+		t.methodTemplates[key] = def
+		t.methodPaths[key] = path
+	}
+}
+
+// parsedTemplates returns the templates collected from path
+func (t *Transpiler) parsedTemplates(path string) *ParsedTemplates {
+	parsed := &ParsedTemplates{
+		Classes: make(map[string]*parser.GenericClassDef),
+		Methods: make(map[string]*parser.GenericMethodDef),
+	}
+	for name, templatePath := range t.templatePaths {
+		if templatePath == path {
+			parsed.Classes[name] = t.templates[name]
+		}
+	}
+	for key, methodPath := range t.methodPaths {
+		if methodPath == path {
+			parsed.Methods[key] = t.methodTemplates[key]
+		}
+	}
+	return parsed
+}
+
+// Templates returns the class and method templates collected by TranspileFiles, sorted by name
+func (t *Transpiler) Templates() []TemplateInfo {
+	infos := make([]TemplateInfo, 0, len(t.templates)+len(t.methodTemplates))
+	for name, def := range t.templates {
+		infos = append(infos, TemplateInfo{
+			Name:       name,
+			Path:       t.templatePaths[name],
+			Line:       t.sourceLine(t.templatePaths[name], def.BodyLine),
+			TypeParams: def.TypeParams,
+		})
+	}
+	for key, def := range t.methodTemplates {
+		infos = append(infos, TemplateInfo{
+			Name:       key,
+			Path:       t.methodPaths[key],
+			Line:       t.sourceLine(t.methodPaths[key], def.Line),
+			TypeParams: def.TypeParams,
+			IsMethod:   true,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// extractClassName returns the name of the first class declared in the content,
+// looking into nested types, or "" if it declares none
 func (t *Transpiler) extractClassName(content string) string {
-	// Simple approach: look for "class ClassName" with any whitespace
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		// Use Fields to split on any whitespace, then look for "class" keyword
-		words := strings.Fields(trimmed)
-		for i, word := range words {
-			if word == "class" && i+1 < len(words) {
-				// Next word is the class name (might have < or { after it)
-				className := words[i+1]
-				// Strip off any < or {
-				if idx := strings.IndexAny(className, "<{"); idx >= 0 {
-					className = className[:idx]
-				}
-				return className
+	file, _ := parser.NewParser(content).ParseFile()
+	var find func(types []*parser.TypeDecl) string
+	find = func(types []*parser.TypeDecl) string {
+		for _, decl := range types {
+			if decl.Keyword == "class" {
+				return decl.Name
+			}
+			if name := find(decl.Types); name != "" {
+				return name
 			}
 		}
+		return ""
 	}
-	return ""
+	return find(file.Types)
 }
 
 // processInstantiations validates and processes forced instantiations from config (Phase 1.5)
@@ -220,95 +815,155 @@ func (t *Transpiler) processInstantiations(results *[]FileResult) bool {
 
 	hasErrors := false
 
+	// configError records an error for a config entry, at its position in
+	// peakconfig.json when known (index -1 for the key itself)
+	configError := func(section, key string, index int, code string, err error) {
+		hasErrors = true
+		line, column := t.instantiate.Position(section, key, index)
+		*results = append(*results, FileResult{
+			OriginalPath: "peakconfig.json",
+			Error:        diagnostic.WithCode(code, diagnostic.At(line, column, err)),
+		})
+	}
+
 	// Process class instantiations
-	for className, typeArgsList := range t.instantiate.Classes {
+	for key, typeArgsList := range t.instantiate.Classes {
 		// Validate that the template exists
-		if _, exists := t.templates[className]; !exists {
-			hasErrors = true
-			*results = append(*results, FileResult{
-				OriginalPath: "peakconfig.json",
-				Error:        fmt.Errorf("class instantiation '%s' references undefined template", className),
-			})
+		className, exists := t.templateName(key)
+		if !exists {
+			configError("classes", key, -1, diagnostic.CodeUndefinedTemplate,
+				fmt.Errorf("class instantiation '%s' references undefined template%s", key, t.templateSuggestion(key)))
 			continue
 		}
 
 		// Generate instantiation expressions for each type argument set
-		for _, typeArgs := range typeArgsList {
+		for i, typeArgs := range typeArgsList {
 			// Build the instantiation string (e.g., "Queue<Integer>")
 			instantiationStr := className + "<" + typeArgs + ">"
 
 			// Parse the instantiation string to create GenericExpr
 			expr, err := t.parseInstantiation(instantiationStr)
+			if err == nil {
+				err = t.validateTypeArgs(className, len(t.templates[className].TypeParams), expr.TypeArgs)
+			}
 			if err != nil {
-				hasErrors = true
-				*results = append(*results, FileResult{
-					OriginalPath: "peakconfig.json",
-					Error:        fmt.Errorf("invalid class instantiation '%s': %w", instantiationStr, err),
-				})
+				configError("classes", key, i, diagnostic.CodeInvalidInstantiation,
+					fmt.Errorf("invalid class instantiation '%s': %w", instantiationStr, err))
 				continue
 			}
 
 			// Add to usages (same as discovered usages)
 			t.usages[instantiationStr] = expr
+			t.forced[instantiationStr] = forcedInstantiation{expr: expr, key: key, index: i}
 		}
 	}
 
 	// Process method instantiations
-	for methodKey, typeArgs := range t.instantiate.Methods {
+	for key, typeArgs := range t.instantiate.Methods {
 		// Validate that the method template exists
-		if _, exists := t.methodTemplates[methodKey]; !exists {
-			hasErrors = true
-			*results = append(*results, FileResult{
-				OriginalPath: "peakconfig.json",
-				Error:        fmt.Errorf("method instantiation '%s' references undefined generic method", methodKey),
-			})
+		methodKey, exists := t.methodKey(key)
+		if !exists {
+			configError("methods", key, -1, diagnostic.CodeUndefinedMethod,
+				fmt.Errorf("method instantiation '%s' references undefined generic method%s", key, t.methodSuggestion(key)))
 			continue
 		}
+		methodTemplate := t.methodTemplates[methodKey]
 
 		// Store method usages
-		for _, typeArg := range typeArgs {
-			// Add each type argument to the list of usages for this method
-			t.methodUsages[methodKey] = append(t.methodUsages[methodKey], typeArg)
+		for i, typeArg := range typeArgs {
+			args, err := parser.ParseTypeArguments(typeArg)
+			if err == nil {
+				err = t.validateTypeArgs(methodKey, len(methodTemplate.TypeParams), t.resolveTypeArgs(args))
+			}
+			if err != nil {
+				configError("methods", key, i, diagnostic.CodeInvalidInstantiation,
+					fmt.Errorf("invalid method instantiation '%s<%s>': %w", key, typeArg, err))
+				continue
+			}
+
+			// Add each type argument to the list of usages for this method, formatted
+			// like those of calls, e.g. "List<Account>" for "Account[]"
+			t.methodUsages[methodKey] = append(t.methodUsages[methodKey], joinTypeArgs(args))
 		}
 	}
 
 	return hasErrors
 }
 
-// parseInstantiation parses an instantiation string like "Queue<Integer>" into a GenericExpr
+// parseInstantiation parses an instantiation string like "Queue<Integer>" into a GenericExpr,
+// with template and generic method names spelled as declared
 func (t *Transpiler) parseInstantiation(instantiation string) (*parser.GenericExpr, error) {
-	// Use FindGenerics to parse the instantiation string
-	// It should find exactly one generic expression
-	p := parser.NewParser(instantiation)
-	p.SetFileName("peakconfig.json")
+	baseType, typeArgs, found := strings.Cut(instantiation, "<")
+	if !found || !strings.HasSuffix(typeArgs, ">") {
+		return nil, fmt.Errorf("no generic expression found")
+	}
 
-	generics, err := p.FindGenerics()
+	args, err := parser.ParseTypeArguments(strings.TrimSuffix(typeArgs, ">"))
 	if err != nil {
 		return nil, err
 	}
-
-	if len(generics) == 0 {
-		return nil, fmt.Errorf("no generic expression found")
+	baseType = strings.TrimSpace(baseType)
+	if key, ok := t.methodKey(baseType); ok {
+		baseType = key
+	} else if name, ok := t.templateName(baseType); ok {
+		baseType = name
 	}
+	return &parser.GenericExpr{BaseType: baseType, TypeArgs: t.resolveTypeArgs(args)}, nil
+}
 
-	if len(generics) > 1 {
-		return nil, fmt.Errorf("multiple generic expressions found, expected one")
+// validateTypeArgs checks type arguments from config for the generic class or method
+// name, which takes arity type arguments. Every type must be a legal, optionally
+// namespaced, Apex type name, and every generic type must be a template or a built-in
+// generic with the right number of type arguments.
+func (t *Transpiler) validateTypeArgs(name string, arity int, args []parser.GenericExpr) error {
+	if len(args) != arity {
+		return fmt.Errorf("%s takes %d type argument(s), got %d", name, arity, len(args))
 	}
 
-	// Return the single generic expression
-	for _, expr := range generics {
-		return expr, nil
+	for _, arg := range args {
+		if !isTypeName(arg.BaseType) {
+			return fmt.Errorf("'%s' is not a valid type name", arg.BaseType)
+		}
+
+		argArity, generic := t.builtInArity(arg.BaseType)
+		if template, ok := t.templates[arg.BaseType]; ok {
+			argArity, generic = len(template.TypeParams), true
+		}
+		switch {
+		case arg.IsSimple && generic:
+			return fmt.Errorf("'%s' needs %d type argument(s)", arg.BaseType, argArity)
+		case arg.IsSimple:
+			continue
+		case !generic:
+			return fmt.Errorf("'%s' is not a template or a built-in generic type%s", arg.BaseType, t.templateSuggestion(arg.BaseType))
+		}
+		if err := t.validateTypeArgs(arg.BaseType, argArity, arg.TypeArgs); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return nil, fmt.Errorf("unexpected error parsing instantiation")
+// isTypeName reports whether name is a legal Apex type name, optionally qualified
+// by a namespace or outer class: identifiers that start with a letter, separated by dots
+func isTypeName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || !(part[0] >= 'a' && part[0] <= 'z' || part[0] >= 'A' && part[0] <= 'Z') {
+			return false
+		}
+		for _, r := range part {
+			if !isIdentifierChar(r) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // collectUsages scans all files for generic instantiations (Phase 2)
 func (t *Transpiler) collectUsages(files map[string]string, results *[]FileResult) bool {
 	hasErrors := false
 	for path, content := range files {
-		contentToScan := t.getContentToScan(content)
-
 		// Get the template definition for this file (if any)
 		var currentTemplate *parser.GenericClassDef
 		p := parser.NewParser(content)
@@ -321,14 +976,15 @@ func (t *Transpiler) collectUsages(files map[string]string, results *[]FileResul
 			}
 		}
 
-		p = parser.NewParser(contentToScan)
-		p.SetFileName(path)
-		generics, err := p.FindGenerics()
+		generics, ignored, err := t.scanWithSuppressions(path, content)
 		if err != nil {
 			hasErrors = true
 			t.recordError(path, err, results)
 			continue
 		}
+		if len(ignored) > 0 {
+			t.ignored[path] = ignored
+		}
 
 		for original, expr := range generics {
 			if _, isTemplate := t.templates[expr.BaseType]; isTemplate {
@@ -339,13 +995,119 @@ func (t *Transpiler) collectUsages(files map[string]string, results *[]FileResul
 						continue
 					}
 				}
+				t.addUser(expr.BaseType, path)
+				if t.templatePaths[expr.BaseType] != path {
+					t.usedTemplates[expr.BaseType] = true
+				}
+				// Usages with the template's type parameters, such as Box<T>, name no
+				// concrete class; they are instantiated along with the template, see
+				// expandDependencies
+				if currentTemplate != nil && mentionsTypeParams(*expr, currentTemplate.TypeParams) {
+					continue
+				}
 				t.usages[original] = expr
+				t.usedClasses[strings.ToLower(parser.GenerateConcreteClassName(expr))] = true
 			}
 		}
 	}
 	return hasErrors
 }
 
+// scanUsages finds the generic usages in the source at path, skipping the ignored
+// lines, and adds the instantiations its peak:instantiate directives request
+func (t *Transpiler) scanUsages(path, content string, ignored []lineRange) (map[string]*parser.GenericExpr, error) {
+	content = maskLines(content, ignored)
+	contentToScan := t.getContentToScan(content)
+	p := t.newParser(maskStringLiterals(contentToScan))
+	p.SetFileName(path)
+	generics, err := p.FindGenerics()
+	t.resolveGenerics(generics)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkTypeArgCounts(path, content, generics); err != nil {
+		return nil, err
+	}
+	if err := t.collectDirectives(path, content); err != nil {
+		return nil, err
+	}
+	if err := t.collectMethodCalls(path, content); err != nil {
+		return nil, err
+	}
+	if t.dynamicTypes {
+		for _, literal := range findDynamicTypeLiterals(contentToScan) {
+			for original, expr := range t.dynamicTypeGenerics(literal) {
+				generics[original] = expr
+			}
+		}
+	}
+	return generics, nil
+}
+
+// forcedInstantiation is a class instantiation from instantiate.classes, with the
+// index of its type arguments in the config entry
+type forcedInstantiation struct {
+	expr  *parser.GenericExpr
+	key   string // Template name as written in instantiate.classes
+	index int
+}
+
+// checkForcedInstantiations warns about instantiate.classes entries that are no longer
+// needed: instantiations that sources also use, and templates no other source uses.
+// Generic method instantiations from config and peak:instantiate directives are
+// merged, so they are not checked.
+func (t *Transpiler) checkForcedInstantiations() []diagnostic.Diagnostic {
+	instantiations := make([]string, 0, len(t.forced))
+	for instantiation := range t.forced {
+		instantiations = append(instantiations, instantiation)
+	}
+	sort.Strings(instantiations)
+
+	var warnings []diagnostic.Diagnostic
+	unused := make(map[string]bool)
+	for _, instantiation := range instantiations {
+		forced := t.forced[instantiation]
+		switch {
+		case !t.usedTemplates[forced.expr.BaseType]:
+			unused[forced.key] = true
+		case t.usedClasses[strings.ToLower(parser.GenerateConcreteClassName(forced.expr))]:
+			line, column := t.instantiate.Position("classes", forced.key, forced.index)
+			warnings = append(warnings, diagnostic.Diagnostic{
+				Severity: diagnostic.SeverityWarning,
+				Code:     diagnostic.CodeRedundantInstantiation,
+				File:     "peakconfig.json",
+				Line:     line,
+				Column:   column,
+				Message:  fmt.Sprintf("instantiation '%s' is already used in source; remove it from instantiate.classes", instantiation),
+			})
+		}
+	}
+
+	templates := make([]string, 0, len(unused))
+	for template := range unused {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	for _, template := range templates {
+		line, column := t.instantiate.Position("classes", template, -1)
+		warnings = append(warnings, diagnostic.Diagnostic{
+			Severity: diagnostic.SeverityWarning,
+			Code:     diagnostic.CodeUnusedForcedTemplate,
+			File:     "peakconfig.json",
+			Line:     line,
+			Column:   column,
+			Message:  fmt.Sprintf("template '%s' in instantiate.classes is not used by any other source; remove the entry unless Apex code references its generated classes", template),
+		})
+	}
+	return warnings
+}
+
+// Warnings returns warnings found during transpilation, such as forced
+// instantiations that are no longer needed. Call it after TranspileStream.
+func (t *Transpiler) Warnings() []diagnostic.Diagnostic {
+	return t.warnings
+}
+
 // isSelfReference checks if a generic expression only uses the template's type parameters.
 // For example, in a template "Optional<T>", the reference "Optional<T>" is a self-reference,
 // but "Optional<String>" is an actual instantiation.
@@ -428,20 +1190,29 @@ func (t *Transpiler) transpileFile(path, content string) (FileResult, error) {
 			IsTemplate:   true,
 		}, nil
 	}
+	if err := checkClassFile(path, content); err != nil {
+		return FileResult{OriginalPath: path, Error: err}, err
+	}
 
-	// Find and replace generic usages with concrete class names
-	p = parser.NewParser(content)
+	// Find and replace generic usages with concrete class names, leaving the
+	// lines covered by peak:ignore pragmas as they are. Generic method calls are
+	// rewritten first, as their type arguments are part of the concrete method name.
+	content = t.rewriteMethodCalls(path, content)
+	ignored := t.ignored[path]
+	p = t.newParser(maskStringLiterals(maskLines(content, ignored)))
 	generics, err := p.FindGenerics()
 	if err != nil {
 		return FileResult{OriginalPath: path, Error: err}, err
 	}
 
-	output := t.replaceGenericUsages(content, generics)
+	output := restoreLines(content, t.replaceGenericUsages(content, generics), ignored)
+	sourceLines := identityLines(output)
 
 	// Check if this file contains generic methods that need instantiation
 	className := t.extractClassName(output)
 	if className != "" && len(t.methodUsages) > 0 {
 		var concreteMethods []string
+		var methodLines []int
 
 		// Check each method usage to see if it belongs to this class
 		for methodKey, typeArgsList := range t.methodUsages {
@@ -455,20 +1226,35 @@ func (t *Transpiler) transpileFile(path, content string) (FileResult, error) {
 
 				// Generate concrete methods for each type argument
 				for _, typeArg := range typeArgsList {
-					// Split comma-separated type arguments for multi-parameter methods
-					typeArgs := strings.Split(typeArg, ",")
-					// Trim whitespace from each type argument
-					for i, arg := range typeArgs {
-						typeArgs[i] = strings.TrimSpace(arg)
+					// Split comma-separated type arguments for multi-parameter methods,
+					// keeping nested generics such as Map<String, Integer> whole
+					args, err := parser.ParseTypeArguments(typeArg)
+					if err != nil {
+						continue // Reported in Phase 1.5
+					}
+					typeArgs := make([]string, len(args))
+					for i, arg := range args {
+						typeArgs[i] = arg.String()
 					}
 					concreteMethod := t.instantiateMethod(methodTemplate, typeArgs)
+					// Type arguments may use templates, as in put<Queue<Integer>>
+					if generics, err := t.newParser(maskStringLiterals(concreteMethod)).FindGenerics(); err == nil {
+						concreteMethod = t.replaceGenericUsages(concreteMethod, generics)
+					}
 					concreteMethods = append(concreteMethods, concreteMethod)
+					t.generatedLines[methodKey] += lineCount(concreteMethod)
+					if methodTemplate.DocComment != "" {
+						methodLines = append(methodLines, methodTemplate.DocLine)
+					} else {
+						methodLines = append(methodLines, methodTemplate.Line)
+					}
 				}
 			}
 		}
 
 		// Insert concrete methods into the class body
 		if len(concreteMethods) > 0 {
+			sourceLines = insertedMethodLines(output, concreteMethods, methodLines)
 			output = t.insertMethods(output, concreteMethods)
 		}
 	}
@@ -476,19 +1262,27 @@ func (t *Transpiler) transpileFile(path, content string) (FileResult, error) {
 	// Generate output path using configured resolver
 	outputPath, err := t.outputPathFn(path)
 	if err != nil {
+		err = diagnostic.WithCode(diagnostic.CodeOutputPath, err)
 		return FileResult{OriginalPath: path, Error: err}, err
 	}
 
-	return FileResult{
+	return t.withProvenance(FileResult{
 		OriginalPath: path,
 		OutputPath:   outputPath,
 		Content:      output,
 		IsTemplate:   false,
-	}, nil
+		SourceLines:  sourceLines,
+	}), nil
 }
 
 // insertMethods inserts generated concrete methods into the class body before the closing brace
 func (t *Transpiler) insertMethods(content string, methods []string) string {
+	return insertMembers(content, "// Generated concrete methods", methods)
+}
+
+// insertMembers inserts generated methods into the class body before the closing
+// brace, after a one-line header comment
+func insertMembers(content, header string, methods []string) string {
 	// Find the last closing brace (end of class)
 	lastBraceIdx := strings.LastIndex(content, "}")
 	if lastBraceIdx == -1 {
@@ -498,7 +1292,7 @@ func (t *Transpiler) insertMethods(content string, methods []string) string {
 
 	// Build the methods to insert with proper indentation
 	var methodsBlock strings.Builder
-	methodsBlock.WriteString("\n    // Generated concrete methods\n")
+	methodsBlock.WriteString("\n    " + header + "\n")
 	for _, method := range methods {
 		// Add indentation to each line of the method
 		lines := strings.Split(method, "\n")
@@ -517,32 +1311,76 @@ func (t *Transpiler) insertMethods(content string, methods []string) string {
 	return result
 }
 
+// identityLines returns a line map where every output line comes from the same source line
+func identityLines(content string) []int {
+	lines := make([]int, strings.Count(content, "\n")+1)
+	for i := range lines {
+		lines[i] = i + 1
+	}
+	return lines
+}
+
+// insertedMethodLines returns the line map for content after insertMethods has inserted
+// methods, where startLines[i] is the source line on which methods[i]'s template starts,
+// or 0 for methods that are generated entirely. It mirrors the layout produced by insertMembers.
+func insertedMethodLines(content string, methods []string, startLines []int) []int {
+	lastBraceIdx := strings.LastIndex(content, "}")
+	if lastBraceIdx == -1 {
+		return identityLines(content)
+	}
+
+	// Lines before the insertion point are unchanged; the line holding the
+	// closing brace is split, and its first half keeps the source line
+	braceLine := strings.Count(content[:lastBraceIdx], "\n") + 1
+	lines := identityLines(content[:lastBraceIdx])
+
+	lines = append(lines, 0) // "// Generated concrete methods"
+	for i, method := range methods {
+		for k, line := range strings.Split(method, "\n") {
+			if line == "" {
+				continue
+			}
+			if startLines[i] == 0 {
+				lines = append(lines, 0)
+			} else {
+				lines = append(lines, startLines[i]+k)
+			}
+		}
+		lines = append(lines, 0) // Blank line after each method
+	}
+
+	// The closing brace and everything after it
+	for i := 0; i <= strings.Count(content[lastBraceIdx:], "\n"); i++ {
+		lines = append(lines, braceLine+i)
+	}
+	return lines
+}
+
 // replaceGenericUsages replaces all generic template usages in content with concrete class names.
 // It sorts generics by length (longest first) to handle nested generics correctly.
-// Comments are preserved and not modified.
+// Comments and string literals are preserved and not modified, except doc comments and
+// dynamic type names if enabled with SetDocComments and SetDynamicTypes.
 func (t *Transpiler) replaceGenericUsages(content string, generics map[string]*parser.GenericExpr) string {
 	// Build replacement map
 	replacements := make(map[string]string)
-	for original, expr := range generics {
+	for original, expr := range t.resolveGenerics(generics) {
 		// Only replace if it's a usage of a known template
 		if _, isTemplate := t.templates[expr.BaseType]; isTemplate {
-			concrete := parser.GenerateConcreteClassName(expr)
-			replacements[original] = concrete
+			replacements[original] = t.classReference(expr)
 		}
 	}
 
-	if len(replacements) == 0 {
+	if len(replacements) == 0 && !t.docComments && !t.dynamicTypes {
 		return content
 	}
 
-	// Sort keys by length (longest first) to handle nested generics
-	sortedKeys := make([]string, 0, len(replacements))
-	for key := range replacements {
-		sortedKeys = append(sortedKeys, key)
+	var dynamic map[int]string // Opening quote position to replacement literal
+	if t.dynamicTypes {
+		dynamic = t.dynamicTypeReplacements(content)
 	}
-	sort.Slice(sortedKeys, func(i, j int) bool {
-		return len(sortedKeys[i]) > len(sortedKeys[j])
-	})
+
+	// Match the longest key at each position to handle nested generics
+	matcher := newPatternMatcher(replacements)
 
 	// Replace while skipping comments
 	var result strings.Builder
@@ -576,35 +1414,147 @@ func (t *Transpiler) replaceGenericUsages(content string, generics map[string]*p
 				}
 				i++
 			}
-			result.WriteString(content[start:i])
+			comment := content[start:i]
+			if t.docComments && strings.HasPrefix(comment, "/**") {
+				comment = t.rewriteDocComment(comment)
+			}
+			result.WriteString(comment)
 			continue
 		}
 
-		// Try to match any generic pattern at current position
-		matched := false
-		for _, original := range sortedKeys {
-			if i+len(original) <= len(content) && content[i:i+len(original)] == original {
-				// Found a match - replace it
-				result.WriteString(replacements[original])
-				i += len(original)
-				matched = true
-				break
+		// Copy string literals as-is, unless they name a type dynamically
+		if content[i] == '\'' {
+			end := stringLiteralEnd(content, i)
+			if replacement, ok := dynamic[i]; ok {
+				result.WriteString(replacement)
+			} else {
+				result.WriteString(content[i:end])
 			}
+			i = end
+			continue
 		}
 
-		if !matched {
-			result.WriteByte(content[i])
-			i++
+		// Try to match any generic pattern at current position
+		if replacement, length := matcher.match(content, i); length > 0 {
+			result.WriteString(replacement)
+			i += length
+			continue
+		}
+
+		result.WriteByte(content[i])
+		i++
+	}
+
+	return result.String()
+}
+
+// rewriteDocComment replaces the generic expressions in a doc comment with the names
+// of their generated classes. Only expressions whose class is generated somewhere in
+// the project are replaced, so a code sample mentioning an uninstantiated type, or
+// a type that is not a template at all, is left alone.
+func (t *Transpiler) rewriteDocComment(comment string) string {
+	// The parser skips comments and string literals, so it is given only the text
+	// between the delimiters, without the apostrophes of prose such as "it's"
+	body := strings.TrimSuffix(strings.TrimPrefix(comment, "/**"), "*/")
+	body = strings.ReplaceAll(body, "'", " ")
+	found, err := t.newParser(body).FindGenerics()
+	if err != nil || len(found) == 0 {
+		return comment
+	}
+	t.resolveGenerics(found)
+
+	generated := t.generatedClasses()
+	replacements := make(map[string]string)
+	for original, expr := range found {
+		if _, isTemplate := t.templates[expr.BaseType]; !isTemplate {
+			continue
+		}
+		if generated[parser.GenerateConcreteClassName(expr)] {
+			replacements[original] = t.classReference(expr)
 		}
 	}
+	if len(replacements) == 0 {
+		return comment
+	}
 
+	matcher := newPatternMatcher(replacements)
+	var result strings.Builder
+	result.Grow(len(comment))
+	for i := 0; i < len(comment); {
+		// Only at the start of a word: Queue<Integer> must not match inside MyQueue<Integer>
+		if i == 0 || !isIdentifierChar(rune(comment[i-1])) {
+			if replacement, length := matcher.match(comment, i); length > 0 {
+				result.WriteString(replacement)
+				i += length
+				continue
+			}
+		}
+		result.WriteByte(comment[i])
+		i++
+	}
 	return result.String()
 }
 
-// generateConcreteClasses creates concrete class files from templates by instantiating
-// each template with its concrete type arguments.
-func (t *Transpiler) generateConcreteClasses() []FileResult {
-	results := make([]FileResult, 0, len(t.usages))
+// dynamicTypeReplacements returns the quoted concrete class name for each string
+// literal in content that names a generated class in a dynamic type call, keyed by
+// the position of its opening quote
+func (t *Transpiler) dynamicTypeReplacements(content string) map[int]string {
+	literals := findDynamicTypeLiterals(content)
+	if len(literals) == 0 {
+		return nil
+	}
+
+	generated := t.generatedClasses()
+	replacements := make(map[int]string)
+	for start, literal := range literals {
+		expr, ok := t.dynamicTypeGenerics(literal)[literal]
+		if !ok {
+			continue
+		}
+		t.resolveNames(expr)
+		if _, isTemplate := t.templates[expr.BaseType]; !isTemplate {
+			continue
+		}
+		if generated[parser.GenerateConcreteClassName(expr)] {
+			replacements[start] = "'" + t.classReference(expr) + "'"
+		}
+	}
+	return replacements
+}
+
+// dynamicTypeGenerics returns the generic expressions in the contents of a dynamic
+// type literal, including nested ones, or nothing unless the whole literal is a
+// single generic expression such as "Queue<Integer>"
+func (t *Transpiler) dynamicTypeGenerics(literal string) map[string]*parser.GenericExpr {
+	generics, err := t.newParser(literal).FindGenerics()
+	if err != nil || generics[literal] == nil {
+		return nil
+	}
+	return generics
+}
+
+// generatedClasses returns the names of the concrete classes generated for the project
+func (t *Transpiler) generatedClasses() map[string]bool {
+	generated := make(map[string]bool, len(t.usages))
+	for _, expr := range t.usages {
+		if _, isTemplate := t.templates[expr.BaseType]; isTemplate {
+			generated[parser.GenerateConcreteClassName(expr)] = true
+		}
+	}
+	return generated
+}
+
+// concretePlan is a concrete class to generate, with its output path resolved
+type concretePlan struct {
+	template *parser.GenericClassDef
+	expr     *parser.GenericExpr
+	result   FileResult // Output path and provenance, without content
+}
+
+// planConcreteClasses resolves the output of every instantiation of a known template,
+// ordered by template and then instantiation
+func (t *Transpiler) planConcreteClasses() []concretePlan {
+	plans := make([]concretePlan, 0, len(t.usages))
 
 	for _, expr := range t.usages {
 		template, exists := t.templates[expr.BaseType]
@@ -612,40 +1562,95 @@ func (t *Transpiler) generateConcreteClasses() []FileResult {
 			continue
 		}
 
-		// Get the directory where the template is located
 		templatePath := t.templatePaths[expr.BaseType]
+		outputPath := t.generatedOutputPath(expr.BaseType, expr, t.concreteClassName(expr))
+
+		plans = append(plans, concretePlan{
+			template: template,
+			expr:     expr,
+			result: FileResult{
+				OutputPath:    outputPath,
+				TemplatePath:  templatePath,
+				Instantiation: expr.String(),
+				Test:          t.isTestInstantiation(expr),
+			},
+		})
+	}
 
-		// Generate concrete class content
-		content := t.instantiateTemplate(template, expr)
-		concreteName := parser.GenerateConcreteClassName(expr)
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].template.ClassName != plans[j].template.ClassName {
+			return plans[i].template.ClassName < plans[j].template.ClassName
+		}
+		return plans[i].result.Instantiation < plans[j].result.Instantiation
+	})
+	return plans
+}
 
-		// Create a virtual path for the concrete class (in same dir as template)
-		templateDir := filepath.Dir(templatePath)
-		virtualPath := filepath.Join(templateDir, concreteName+".peak")
+// generateConcreteClass instantiates a planned concrete class
+func (t *Transpiler) generateConcreteClass(plan concretePlan) FileResult {
+	result := plan.result
+	var err error
+	result.Content, result.SourceLines, err = t.concreteClassContent(plan)
+	if err != nil {
+		// Reported on the template, like other problems with its instantiations
+		return FileResult{OriginalPath: plan.result.TemplatePath, Error: err}
+	}
+	result = t.withProvenance(result)
+	if err := t.checkOutput(result, templateSource(plan.template), substitutedParams(plan.template, []concretePlan{plan})); err != nil {
+		return FileResult{OriginalPath: plan.result.TemplatePath, Error: err}
+	}
+	return result
+}
 
-		// Resolve output path using configured resolver
-		outputPath, err := t.outputPathFn(virtualPath)
+// concreteClassContent instantiates a planned concrete class, with the members that
+// template annotations add, and returns it with its line map
+func (t *Transpiler) concreteClassContent(plan concretePlan) (string, []int, error) {
+	content := t.instantiateTemplate(plan.template, plan.expr)
+	sourceLines := concreteClassLines(plan.template, content)
+	className := t.declaredClassName(plan.template, plan.expr)
+	if isDTO(plan.template) {
+		content, sourceLines = addJSONHelpers(content, sourceLines, className)
+	}
+	if fields, ok := findAnnotation(plan.template, ComparableAnnotation); ok {
+		method, err := compareToMethod(plan.template, plan.expr, className, fields)
 		if err != nil {
-			// Fall back to template directory if path resolution fails
-			outputPath = filepath.Join(templateDir, concreteName+".cls")
+			return "", nil, err
 		}
-
-		results = append(results, FileResult{
-			OriginalPath: "",
-			OutputPath:   outputPath,
-			Content:      content,
-			IsTemplate:   false,
-		})
+		content, sourceLines = insertGenerated(content, sourceLines, "// Generated comparison", method)
+	}
+	if t.isPackageApi(plan.template) {
+		content = globalMembers(plan.template, content, className)
 	}
+	return content, sourceLines, nil
+}
 
+// generateConcreteClasses creates concrete class files from templates by instantiating
+// each template with its concrete type arguments.
+func (t *Transpiler) generateConcreteClasses() []FileResult {
+	plans := t.planConcreteClasses()
+	results := make([]FileResult, 0, len(plans))
+	for _, plan := range plans {
+		results = append(results, t.generateConcreteClass(plan))
+	}
 	return results
 }
 
+// concreteClassLines returns the line map for a concrete class instantiated from template.
+// The generated declaration replaces the template's declaration on the line of the body's
+// opening brace, and substitution never adds or removes lines within the body.
+func concreteClassLines(template *parser.GenericClassDef, content string) []int {
+	lines := make([]int, strings.Count(content, "\n")+1)
+	for i := range lines {
+		lines[i] = template.BodyLine + i
+	}
+	return lines
+}
+
 // instantiateTemplate generates a concrete class by substituting type parameters in a template.
-// It performs three substitution passes:
-//  1. Replace type parameters (T, K, V) with concrete types
+// It performs two substitution passes:
+//  1. Replace type parameters (T, K, V) with concrete types, and the template class name
+//     (constructors, static references) with the concrete name, in a single pass
 //  2. Replace nested template usages (Queue<Boolean>) with concrete names (QueueBoolean)
-//  3. Replace template class name and constructors with concrete name
 func (t *Transpiler) instantiateTemplate(template *parser.GenericClassDef, instantiation *parser.GenericExpr) string {
 	if len(template.TypeParams) != len(instantiation.TypeArgs) {
 		// Mismatch in type parameter count - return error comment
@@ -653,71 +1658,120 @@ func (t *Transpiler) instantiateTemplate(template *parser.GenericClassDef, insta
 			template.ClassName, len(template.TypeParams), len(instantiation.TypeArgs))
 	}
 
-	// Build substitution map for type parameters
-	// IMPORTANT: For complex type arguments (e.g., List<Integer>), we must preserve
-	// the full generic expression, not flatten it to a concrete class name.
-	// This ensures that "T" in "List<T>" becomes "List<Integer>" not "ListInteger".
-	substitutions := make(map[string]string, len(template.TypeParams))
-	for i, param := range template.TypeParams {
-		typeArg := instantiation.TypeArgs[i]
-		// Use String() to preserve the generic expression (List<Integer>)
-		// instead of GenerateConcreteClassName which would flatten it (ListInteger)
-		substitutions[param] = typeArg.String()
-	}
+	concreteName := t.declaredClassName(template, instantiation)
+	substitutions := templateSubstitutions(template, instantiation, concreteName)
 
-	// Pass 1: Replace type parameters with concrete types
-	output := template.Body
-	for param, concreteType := range substitutions {
-		output = replaceTypeParameter(output, param, concreteType)
-	}
+	// Pass 1: Replace type parameters and the class name. Self-references such as
+	// Queue<T> keep the template name, becoming Queue<Integer> for Pass 2.
+	output := substituteIdentifiers(template.Body, substitutions)
+
+	// Remove type parameters from class declaration
+	output = strings.Replace(output, "<"+strings.Join(template.TypeParams, ", ")+">", "", 1)
 
 	// Pass 2: Replace nested generic template usages (e.g., Queue<Boolean> -> QueueBoolean)
-	p := parser.NewParser(output)
+	p := t.newParser(maskStringLiterals(output))
 	if generics, err := p.FindGenerics(); err == nil {
 		output = t.replaceGenericUsages(output, generics)
 	}
 
-	// Pass 3: Replace class name in declaration and constructors
-	concreteName := parser.GenerateConcreteClassName(instantiation)
-	// Remove type parameters from class declaration
-	output = strings.Replace(output, "<"+strings.Join(template.TypeParams, ", ")+">", "", 1)
-	// Replace template class name with concrete name (affects constructors too)
-	output = replaceTypeParameter(output, template.ClassName, concreteName)
+	// Keep extends and implements clauses, on the line of the body's opening brace
+	supertypes := strings.Join(strings.Fields(template.Supertypes), " ")
+	if supertypes != "" {
+		supertypes = t.instantiateTypes(supertypes, substitutions)
+	}
+	if _, ok := findAnnotation(template, ComparableAnnotation); ok {
+		supertypes = withInterface(supertypes, "Comparable")
+	}
+	if supertypes != "" {
+		output = supertypes + " " + output
+	}
 
-	// Build final class with concrete name, preserving modifiers
-	modifiers := template.Modifiers
-	if modifiers == "" {
-		modifiers = "public" // Default to public if no modifiers specified
+	// Build final class with concrete name, preserving annotations and modifiers
+	modifiers := t.classModifiers(template)
+	if annotations := classAnnotations(template, t.holderClasses); annotations != "" {
+		modifiers = annotations + " " + modifiers
+	}
+	if annotation := t.testAnnotation(template, instantiation); annotation != "" {
+		modifiers = annotation + " " + modifiers
 	}
 	return fmt.Sprintf("%s class %s %s", modifiers, concreteName, output)
 }
 
+// templateSubstitutions maps the type parameters of template to the type arguments of
+// instantiation, and the template name to className, the name of the concrete class.
+// IMPORTANT: For complex type arguments (e.g., List<Integer>), we must preserve
+// the full generic expression, not flatten it to a concrete class name.
+// This ensures that "T" in "List<T>" becomes "List<Integer>" not "ListInteger".
+func templateSubstitutions(template *parser.GenericClassDef, instantiation *parser.GenericExpr, className string) map[string]string {
+	substitutions := make(map[string]string, len(template.TypeParams)+1)
+	substitutions[template.ClassName] = className
+	for i, param := range template.TypeParams {
+		typeArg := instantiation.TypeArgs[i]
+		// Use String() to preserve the generic expression (List<Integer>)
+		// instead of GenerateConcreteClassName which would flatten it (ListInteger)
+		substitutions[param] = typeArg.String()
+	}
+	return substitutions
+}
+
+// instantiateTypes applies substitutions to a short piece of a template outside its
+// body, such as its supertypes, and replaces the generic usages that result
+func (t *Transpiler) instantiateTypes(text string, substitutions map[string]string) string {
+	text = substituteIdentifiers(text, substitutions)
+	if generics, err := t.newParser(text).FindGenerics(); err == nil {
+		text = t.replaceGenericUsages(text, generics)
+	}
+	return text
+}
+
 // replaceTypeParameter replaces all occurrences of param with concreteType, respecting word boundaries.
 // It ensures that 'T' in "String" is not replaced, only standalone 'T' tokens.
 func replaceTypeParameter(input, param, concreteType string) string {
+	return substituteIdentifiers(input, map[string]string{param: concreteType})
+}
+
+// substituteIdentifiers replaces each whole identifier that has an entry in substitutions,
+// in a single pass over input. Replacements are not scanned again, so one substitution
+// never applies to the result of another (T -> U, U -> Integer turns "T, U" into "U, Integer").
+// Identifiers followed by type arguments, like Queue in "Queue<T>", are generic usages
+// and are left unchanged.
+func substituteIdentifiers(input string, substitutions map[string]string) string {
 	var result strings.Builder
 	result.Grow(len(input)) // Pre-allocate to reduce allocations
 
 	for i := 0; i < len(input); {
-		// Check if we found the parameter at this position
-		if i+len(param) <= len(input) && input[i:i+len(param)] == param {
-			// Verify word boundaries to avoid partial matches
-			before := i == 0 || !isIdentifierChar(rune(input[i-1]))
-			after := i+len(param) >= len(input) || !isIdentifierChar(rune(input[i+len(param)]))
-
-			if before && after {
-				result.WriteString(concreteType)
-				i += len(param)
-				continue
-			}
+		if !isIdentifierChar(rune(input[i])) {
+			result.WriteByte(input[i])
+			i++
+			continue
 		}
-		result.WriteByte(input[i])
-		i++
+
+		// Read the whole identifier so partial matches are impossible
+		end := i + 1
+		for end < len(input) && isIdentifierChar(rune(input[end])) {
+			end++
+		}
+		ident := input[i:end]
+
+		if replacement, ok := substitutions[ident]; ok && !followedByTypeArgs(input, end) {
+			result.WriteString(replacement)
+		} else {
+			result.WriteString(ident)
+		}
+		i = end
 	}
 
 	return result.String()
 }
 
+// followedByTypeArgs reports whether input[i:] starts with type arguments, ignoring spaces
+func followedByTypeArgs(input string, i int) bool {
+	for i < len(input) && (input[i] == ' ' || input[i] == '\t') {
+		i++
+	}
+	return i < len(input) && input[i] == '<'
+}
+
 // isIdentifierChar reports whether r can be part of an Apex identifier.
 func isIdentifierChar(r rune) bool {
 	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
@@ -741,24 +1795,60 @@ func (t *Transpiler) instantiateMethod(methodDef *parser.GenericMethodDef, typeA
 	// Generate concrete method name
 	concreteMethodName := parser.GenerateConcreteMethodName(methodDef.MethodName, typeArgs)
 
-	// Pass 1: Remove the type parameter declaration from signature FIRST (e.g., <K> or <K, V>)
+	// Pass 1: Remove the type parameter declaration from signature FIRST (e.g., <K> or <K, V>),
+	// with the whitespace after it, so "public static <T> T" becomes "public static T"
 	// This must be done before substituting type parameters, otherwise <K> becomes <String>
 	typeParamDecl := "<" + strings.Join(methodDef.TypeParams, ", ") + ">"
-	signature := strings.Replace(methodDef.Signature, typeParamDecl, "", 1)
-
-	// Pass 2: Replace type parameters in signature and body
-	for param, concreteType := range substitutions {
-		signature = replaceTypeParameter(signature, param, concreteType)
+	signature := methodDef.Signature
+	if i := strings.Index(signature, typeParamDecl); i >= 0 {
+		signature = signature[:i] + strings.TrimLeft(signature[i+len(typeParamDecl):], " \t")
 	}
 
-	// Pass 3: Replace method name in signature only (not in body)
-	signature = replaceTypeParameter(signature, methodDef.MethodName, concreteMethodName)
+	// Pass 2: Replace type parameters in body (but not method name)
+	body := substituteIdentifiers(methodDef.Body, substitutions)
+
+	// Copy the doc comment before substituting the method name, which it may mention
+	doc := methodDocComment(methodDef.DocComment, substitutions)
+	if doc != "" && t.docComments {
+		doc = t.rewriteDocComment(doc)
+	}
 
-	// Pass 4: Replace type parameters in body (but not method name)
-	body := methodDef.Body
-	for param, concreteType := range substitutions {
-		body = replaceTypeParameter(body, param, concreteType)
+	// Pass 3: Replace type parameters and the method name in signature, in one pass
+	substitutions[methodDef.MethodName] = concreteMethodName
+	signature = substituteIdentifiers(signature, substitutions)
+	v := t.methodVisibility(methodDef)
+	if _, ok := findMethodAnnotation(methodDef, "@TestVisible"); ok {
+		v.testVisible = false // Copied with the method's other annotations
+	}
+	signature = withMethodVisibility(signature, v)
+	if annotations := methodAnnotations(methodDef); annotations != "" {
+		signature = annotations + " " + signature
 	}
 
+	if doc != "" {
+		return doc + "\n" + signature + " " + body
+	}
 	return signature + " " + body
 }
+
+// methodDocComment returns the doc comment of a generic method for one of its concrete
+// methods, with type parameters substituted in @param and @return lines and the
+// indentation of continuation lines reset, so that " * " lines up under "/**".
+// Other lines are copied as written, since prose may use a type parameter's letter as
+// a word. It returns an empty string if doc is empty.
+func methodDocComment(doc string, substitutions map[string]string) string {
+	if doc == "" {
+		return ""
+	}
+	lines := strings.Split(doc, "\n")
+	for i, line := range lines {
+		if i > 0 {
+			line = " " + strings.TrimSpace(line)
+		}
+		if strings.Contains(line, "@param") || strings.Contains(line, "@return") {
+			line = substituteIdentifiers(line, substitutions)
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,10 +1,17 @@
 package transpiler
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
 	"github.com/ipavlic/peak/pkg/parser"
 )
 
@@ -576,6 +583,69 @@ func TestInstantiateTemplate(t *testing.T) {
 	}
 }
 
+func TestInstantiateTemplate_NoChainedSubstitution(t *testing.T) {
+	tr := NewTranspiler(nil)
+	template := &parser.GenericClassDef{
+		ClassName:  "Pair",
+		TypeParams: []string{"A", "B"},
+		Body:       "{ A first; B second; }",
+	}
+	// The first argument is itself named like the second parameter
+	instantiation := &parser.GenericExpr{
+		BaseType: "Pair",
+		TypeArgs: []parser.GenericExpr{
+			{BaseType: "B", IsSimple: true},
+			{BaseType: "Integer", IsSimple: true},
+		},
+	}
+
+	for i := 0; i < 20; i++ {
+		result := tr.instantiateTemplate(template, instantiation)
+		if !strings.Contains(result, "{ B first; Integer second; }") {
+			t.Fatalf("substitutions should not chain, got:\n%s", result)
+		}
+	}
+}
+
+func TestInstantiateTemplate_SelfReference(t *testing.T) {
+	tr := NewTranspiler(nil)
+	template := &parser.GenericClassDef{
+		ClassName:  "Node",
+		TypeParams: []string{"T"},
+		Body:       "{ Node<T> next; public Node() {} public static Node empty() { return null; } }",
+	}
+	tr.templates["Node"] = template
+	instantiation := &parser.GenericExpr{
+		BaseType: "Node",
+		TypeArgs: []parser.GenericExpr{{BaseType: "Integer", IsSimple: true}},
+	}
+
+	result := tr.instantiateTemplate(template, instantiation)
+	expected := "public class NodeInteger { NodeInteger next; public NodeInteger() {} public static NodeInteger empty() { return null; } }"
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestSubstituteIdentifiers(t *testing.T) {
+	substitutions := map[string]string{"K": "String", "V": "List<K>", "Dict": "DictStringInteger"}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Map<K, V> m;", "Map<String, List<K>> m;"},
+		{"KV Kind V_ _V V", "KV Kind V_ _V List<K>"},
+		{"public Dict() {}", "public DictStringInteger() {}"},
+		{"Dict<K, V> inner;", "Dict<String, List<K>> inner;"},
+		{"Dict <K, V> inner;", "Dict <String, List<K>> inner;"},
+	}
+	for _, tt := range tests {
+		if result := substituteIdentifiers(tt.input, substitutions); result != tt.expected {
+			t.Errorf("substituteIdentifiers(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
 func TestInstantiateTemplate_TypeParameterMismatch(t *testing.T) {
 	tr := NewTranspiler(nil)
 	template := &parser.GenericClassDef{
@@ -968,6 +1038,29 @@ func TestTranspileFiles_MultipleParseErrors(t *testing.T) {
 	}
 }
 
+func TestTranspileFiles_AllParseErrorsInFile(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Bad.peak": "public class Bad<T, T> {}\npublic class Worse<Type> {}\npublic class Fine<T> {}",
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles should not return error, got: %v", err)
+	}
+
+	var codes []string
+	for _, result := range results {
+		if result.OriginalPath == "Bad.peak" && result.Error != nil {
+			codes = append(codes, diagnostic.FromError(result.OriginalPath, result.Error).Code)
+		}
+	}
+	expected := []string{diagnostic.CodeDuplicateTypeParam, diagnostic.CodeInvalidTypeParam}
+	if !slices.Equal(codes, expected) {
+		t.Errorf("expected one result per error with codes %v, got %v", expected, codes)
+	}
+}
+
 func TestCollectTemplates_Errors(t *testing.T) {
 	tr := NewTranspiler(nil)
 	results := []FileResult{}
@@ -1213,6 +1306,7 @@ func TestProcessInstantiations(t *testing.T) {
 		name            string
 		spec            *config.Instantiate
 		expectErrors    bool
+		expectedCode    string
 		expectedUsages  int
 		expectedMethods int
 	}{
@@ -1246,9 +1340,127 @@ func TestProcessInstantiations(t *testing.T) {
 				},
 			},
 			expectErrors:    true,
+			expectedCode:    diagnostic.CodeUndefinedTemplate,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "method not found",
+			spec: &config.Instantiate{
+				Methods: map[string][]string{
+					"Repository.fetch": {"Account"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeUndefinedMethod,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "invalid type arguments",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"String,"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeInvalidInstantiation,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "wrong number of type arguments",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"String, Integer"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeInvalidInstantiation,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "unknown nested generic",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"Stack<Integer>"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeInvalidInstantiation,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "generic type without type arguments",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"List"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeInvalidInstantiation,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "invalid type name",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"1Account"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeInvalidInstantiation,
+			expectedUsages:  0,
+			expectedMethods: 0,
+		},
+		{
+			name: "namespaced and nested type arguments",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"Schema.Account", "Map<String, List<Queue<Integer>>>"},
+				},
+			},
+			expectErrors:    false,
+			expectedUsages:  2,
+			expectedMethods: 0,
+		},
+		{
+			name: "built-in Comparator type argument",
+			spec: &config.Instantiate{
+				Classes: map[string][]string{
+					"Queue": {"Comparator<Account>"},
+				},
+			},
+			expectErrors:    false,
+			expectedUsages:  1,
+			expectedMethods: 0,
+		},
+		{
+			name: "invalid method type arguments",
+			spec: &config.Instantiate{
+				Methods: map[string][]string{
+					"Repository.get": {"Account, Contact"},
+				},
+			},
+			expectErrors:    true,
+			expectedCode:    diagnostic.CodeInvalidInstantiation,
 			expectedUsages:  0,
 			expectedMethods: 0,
 		},
+		{
+			name: "nested generic method type argument",
+			spec: &config.Instantiate{
+				Methods: map[string][]string{
+					"Repository.get": {"Map<String, Integer>"},
+				},
+			},
+			expectErrors:    false,
+			expectedUsages:  0,
+			expectedMethods: 1,
+		},
 		{
 			name:            "nil spec",
 			spec:            nil,
@@ -1271,6 +1483,15 @@ func TestProcessInstantiations(t *testing.T) {
 				t.Errorf("expected errors=%v, got %v", tt.expectErrors, hasErrors)
 			}
 
+			if tt.expectedCode != "" {
+				if len(results) != 1 {
+					t.Fatalf("expected 1 error result, got %d", len(results))
+				}
+				if code := diagnostic.FromError("", results[0].Error).Code; code != tt.expectedCode {
+					t.Errorf("expected code %s, got %q", tt.expectedCode, code)
+				}
+			}
+
 			if len(tr.usages) != tt.expectedUsages {
 				t.Errorf("expected %d usages, got %d", tt.expectedUsages, len(tr.usages))
 			}
@@ -1287,6 +1508,49 @@ func TestProcessInstantiations(t *testing.T) {
 }
 
 
+func TestProcessInstantiations_ConfigPositions(t *testing.T) {
+	root := t.TempDir()
+	configJSON := `{
+  "compilerOptions": {
+    "instantiate": {
+      "classes": {
+        "Queue": ["Integer", "Map<String>"],
+        "Stack": ["Integer"]
+      }
+    }
+  }
+}`
+	if err := os.WriteFile(filepath.Join(root, "peakconfig.json"), []byte(configJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(root, config.CLIFlags{})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	tr := NewTranspiler(nil)
+	tr.templates["Queue"] = &parser.GenericClassDef{ClassName: "Queue", TypeParams: []string{"T"}}
+	tr.SetInstantiate(cfg.Instantiate)
+
+	var results []FileResult
+	if !tr.processInstantiations(&results) {
+		t.Fatal("expected errors")
+	}
+
+	positions := make(map[string][2]int)
+	for _, result := range results {
+		d := diagnostic.FromError(result.OriginalPath, result.Error)
+		positions[d.Code] = [2]int{d.Line, d.Column}
+	}
+	// The invalid type arguments, and the key of the undefined template
+	if got := positions[diagnostic.CodeInvalidInstantiation]; got != [2]int{5, 30} {
+		t.Errorf("expected invalid instantiation at 5:30, got %v", got)
+	}
+	if got := positions[diagnostic.CodeUndefinedTemplate]; got != [2]int{6, 9} {
+		t.Errorf("expected undefined template at 6:9, got %v", got)
+	}
+}
+
 func TestInstantiateMethod(t *testing.T) {
 	tr := NewTranspiler(nil)
 
@@ -1308,7 +1572,7 @@ func TestInstantiateMethod(t *testing.T) {
 			},
 			typeArgs: []string{"Account"},
 			shouldContain: []string{
-				"public  Account getAccount(String key)",
+				"public Account getAccount(String key)",
 				"return (Account) cache.get(key)",
 			},
 			shouldNotContain: []string{
@@ -1327,7 +1591,7 @@ func TestInstantiateMethod(t *testing.T) {
 			},
 			typeArgs: []string{"String", "Integer"},
 			shouldContain: []string{
-				"public  Map<String, Integer> transformStringInteger",
+				"public Map<String, Integer> transformStringInteger",
 				"return new Map<String, Integer>",
 			},
 			shouldNotContain: []string{
@@ -1336,6 +1600,27 @@ func TestInstantiateMethod(t *testing.T) {
 				"<V>",
 			},
 		},
+		{
+			name: "doc comment",
+			methodDef: &parser.GenericMethodDef{
+				ClassName:  "Repository",
+				MethodName: "get",
+				TypeParams: []string{"T"},
+				Signature:  "public <T> T get(String key)",
+				Body:       "{ return (T) cache.get(key); }",
+				DocComment: "/**\n     * Returns a cached value. A T is cached per key.\n     * @param key the key of the T\n     * @return the cached T\n     */",
+			},
+			typeArgs: []string{"Account"},
+			shouldContain: []string{
+				"/**\n * Returns a cached value. A T is cached per key.\n",
+				" * @param key the key of the Account\n",
+				" * @return the cached Account\n",
+				" */\npublic Account getAccount(String key)",
+			},
+			shouldNotContain: []string{
+				"the cached T",
+			},
+		},
 		{
 			name: "parameter count mismatch",
 			methodDef: &parser.GenericMethodDef{
@@ -1552,6 +1837,50 @@ func TestTranspileFiles_WithForcedInstantiations(t *testing.T) {
 	}
 }
 
+func TestTranspileFiles_ForcedInstantiationWarnings(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{
+		Classes: map[string][]string{
+			"Queue":    {"Integer", "Boolean"},
+			"Optional": {"Double"},
+		},
+	})
+
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Optional.peak": `public class Optional<T> {
+    public static Optional<String> none;
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> queue;
+}`,
+	}
+
+	if _, err := tr.TranspileFiles(files); err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	warnings := tr.Warnings()
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %d: %v", len(warnings), warnings)
+	}
+	// Queue<Boolean> is forced but not used: it is still needed
+	if warnings[0].Code != diagnostic.CodeRedundantInstantiation || !strings.Contains(warnings[0].Message, "Queue<Integer>") {
+		t.Errorf("expected redundant Queue<Integer> warning, got %+v", warnings[0])
+	}
+	// Optional is only used by its own file
+	if warnings[1].Code != diagnostic.CodeUnusedForcedTemplate || !strings.Contains(warnings[1].Message, "'Optional'") {
+		t.Errorf("expected unused Optional warning, got %+v", warnings[1])
+	}
+	for _, w := range warnings {
+		if w.Severity != diagnostic.SeverityWarning {
+			t.Errorf("expected warning severity, got %s", w.Severity)
+		}
+	}
+}
+
 func TestTranspileFiles_WithGenericMethods(t *testing.T) {
 	tr := NewTranspiler(nil)
 	tr.SetInstantiate(&config.Instantiate{
@@ -1648,6 +1977,16 @@ func TestExtractClassName(t *testing.T) {
 			content:  "interface ITest { }",
 			expected: "",
 		},
+		{
+			name:     "class in a comment and a string",
+			content:  "// A helper class for dates\n@IsTest\npublic class Dates {\n    String s = 'class Foo';\n}",
+			expected: "Dates",
+		},
+		{
+			name:     "nested in an interface",
+			content:  "public interface Shape {\n    class Circle { }\n}",
+			expected: "Circle",
+		},
 	}
 
 	for _, tt := range tests {
@@ -1722,3 +2061,802 @@ func TestTranspileFiles_NoSelfReference(t *testing.T) {
 		t.Error("OptionalT.cls should NOT be generated (template self-reference bug)")
 	}
 }
+
+func TestTranspileFiles_SourceLines(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Queue.peak": `// A queue
+public class Queue<T>
+{
+    private List<T> items;
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> q;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	for _, result := range results {
+		switch result.OutputPath {
+		case "QueueInteger.cls":
+			if result.TemplatePath != "Queue.peak" {
+				t.Errorf("expected template path Queue.peak, got %q", result.TemplatePath)
+			}
+			if result.Instantiation != "Queue<Integer>" {
+				t.Errorf("expected instantiation Queue<Integer>, got %q", result.Instantiation)
+			}
+			// The provenance header is generated; the body starts at the opening brace on line 3
+			want := []int{0, 3, 4, 5}
+			if len(result.SourceLines) != len(want) {
+				t.Fatalf("expected %v, got %v", want, result.SourceLines)
+			}
+			for i := range want {
+				if result.SourceLines[i] != want[i] {
+					t.Errorf("expected %v, got %v", want, result.SourceLines)
+					break
+				}
+			}
+		case "Example.cls":
+			if len(result.SourceLines) != 4 || result.SourceLines[0] != 0 || result.SourceLines[3] != 3 {
+				t.Errorf("expected identity line map, got %v", result.SourceLines)
+			}
+		}
+	}
+}
+
+func TestInsertedMethodLines(t *testing.T) {
+	content := "public class Repository {\n    private Integer x;\n}"
+	methods := []string{"public Account getAccount() {\n    return null;\n}"}
+
+	output := NewTranspiler(nil).insertMethods(content, methods)
+	lines := insertedMethodLines(content, methods, []int{7})
+
+	outputLines := strings.Split(output, "\n")
+	if len(lines) != len(outputLines) {
+		t.Fatalf("line map has %d entries for %d output lines:\n%s", len(lines), len(outputLines), output)
+	}
+
+	for i, line := range outputLines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "public Account getAccount() {":
+			if lines[i] != 7 {
+				t.Errorf("method signature should map to line 7, got %d", lines[i])
+			}
+		case trimmed == "return null;":
+			if lines[i] != 8 {
+				t.Errorf("method body should map to line 8, got %d", lines[i])
+			}
+		case trimmed == "// Generated concrete methods":
+			if lines[i] != 0 {
+				t.Errorf("generated comment should have no source line, got %d", lines[i])
+			}
+		case i == len(outputLines)-1:
+			if lines[i] != 3 {
+				t.Errorf("closing brace should map to line 3, got %d", lines[i])
+			}
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Dict.peak": `public class Dict<K, V> {
+    private Map<K, V> items;
+}`,
+		"Utils.peak": `public class Utils {
+
+    public static <T> List<T> wrap(T item) {
+        return new List<T>{item};
+    }
+}`,
+	}
+
+	if _, err := tr.TranspileFiles(files); err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	templates := tr.Templates()
+	if len(templates) != 2 {
+		t.Fatalf("expected 2 templates, got %d: %+v", len(templates), templates)
+	}
+
+	dict := templates[0]
+	if dict.Name != "Dict" || dict.Path != "Dict.peak" || dict.Line != 1 || dict.IsMethod {
+		t.Errorf("unexpected class template: %+v", dict)
+	}
+	if len(dict.TypeParams) != 2 || dict.TypeParams[0] != "K" || dict.TypeParams[1] != "V" {
+		t.Errorf("unexpected type params: %v", dict.TypeParams)
+	}
+
+	wrap := templates[1]
+	if wrap.Name != "Utils.wrap" || wrap.Path != "Utils.peak" || wrap.Line != 3 || !wrap.IsMethod {
+		t.Errorf("unexpected method template: %+v", wrap)
+	}
+}
+
+func TestTranspileFiles_CaseOnlyInstantiationsDeduplicated(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Example.peak": `public class Example {
+    private Queue<String> a;
+    private Queue<string> b;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	concrete := 0
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("unexpected error: %v", result.Error)
+		}
+		if result.Instantiation != "" {
+			concrete++
+		}
+	}
+	if concrete != 1 {
+		t.Errorf("expected 1 concrete class for Queue<String> and Queue<string>, got %d", concrete)
+	}
+}
+
+func TestTranspileFiles_OutputCollision(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Pair.peak": `public class Pair<A, B> {
+    private A first;
+    private B second;
+}`,
+		"Example.peak": `public class Example {
+    private Pair<Ab, C> x;
+    private Pair<A, BC> y;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var collisions []error
+	for _, result := range results {
+		if result.Error != nil {
+			collisions = append(collisions, result.Error)
+		}
+	}
+	if len(collisions) != 1 {
+		t.Fatalf("expected 1 collision error, got %v", collisions)
+	}
+	if !strings.Contains(collisions[0].Error(), "collides with") {
+		t.Errorf("unexpected error: %v", collisions[0])
+	}
+	if code := diagnostic.FromError("", collisions[0]).Code; code != diagnostic.CodeOutputCollision {
+		t.Errorf("expected code %s, got %q", diagnostic.CodeOutputCollision, code)
+	}
+}
+
+func TestTranspileFiles_CollisionWithSourceOutput(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"QueueInteger.peak": `public class QueueInteger {
+    private Queue<Integer> q;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	for _, result := range results {
+		if result.OutputPath == "QueueInteger.cls" && result.Instantiation != "" {
+			t.Error("concrete class should not overwrite the hand-written QueueInteger")
+		}
+		if result.Error != nil && result.OriginalPath != "Queue.peak" {
+			t.Errorf("expected collision to be reported on the template, got %s", result.OriginalPath)
+		}
+	}
+}
+
+func TestTranspileFiles_CollisionWithClassInOtherDirectory(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"templates/Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"legacy/QueueInteger.peak": `public class QueueInteger {
+    private Queue<Integer> q;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var collision error
+	for _, result := range results {
+		if result.Instantiation != "" {
+			t.Errorf("concrete class should not be generated next to a class of the same name, got %s", result.OutputPath)
+		}
+		if result.Error != nil {
+			collision = result.Error
+			if result.OriginalPath != filepath.Join("templates", "Queue.peak") {
+				t.Errorf("expected collision to be reported on the template, got %s", result.OriginalPath)
+			}
+		}
+	}
+	if collision == nil {
+		t.Fatal("expected a collision between QueueInteger classes in different directories")
+	}
+	if msg := collision.Error(); !strings.Contains(msg, "Queue<Integer>") || !strings.Contains(msg, filepath.Join("legacy", "QueueInteger.peak")) {
+		t.Errorf("expected both locations in %q", msg)
+	}
+}
+
+func TestTranspileFiles_CRLF(t *testing.T) {
+	lf := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	}
+	crlf := make(map[string]string)
+	for path, content := range lf {
+		crlf[path] = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+
+	outputs := func(files map[string]string) map[string]string {
+		results, err := NewTranspiler(nil).TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+		m := make(map[string]string)
+		for _, result := range results {
+			m[result.OutputPath] = result.Content
+		}
+		return m
+	}
+
+	want, got := outputs(lf), outputs(crlf)
+	for path, content := range want {
+		if got[path] != content {
+			t.Errorf("%s differs between LF and CRLF sources:\n%q\n%q", path, content, got[path])
+		}
+	}
+	if _, ok := crlf["Queue.peak"]; !ok || !strings.Contains(crlf["Queue.peak"], "\r\n") {
+		t.Error("input map should not be modified")
+	}
+}
+
+// memoryTemplateCache is a TemplateCache for tests that counts hits. It stores
+// entries as JSON, which copies them and checks that they serialize.
+type memoryTemplateCache struct {
+	entries map[string][]byte
+	hits    int
+}
+
+func (c *memoryTemplateCache) Get(content string) (*ParsedTemplates, bool) {
+	data, ok := c.entries[content]
+	if !ok {
+		return nil, false
+	}
+	var parsed ParsedTemplates
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, false
+	}
+	c.hits++
+	return &parsed, true
+}
+
+func (c *memoryTemplateCache) Put(content string, parsed *ParsedTemplates) {
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		panic(err)
+	}
+	c.entries[content] = data
+}
+
+func TestTranspileFiles_TemplateCache(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> q;
+}`,
+	}
+	cache := &memoryTemplateCache{entries: make(map[string][]byte)}
+
+	outputs := func() map[string]string {
+		tr := NewTranspiler(nil)
+		tr.SetTemplateCache(cache)
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+		m := make(map[string]string)
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			m[result.OutputPath] = result.Content
+		}
+		return m
+	}
+
+	cold := outputs()
+	if cache.hits != 0 || len(cache.entries) != 2 {
+		t.Fatalf("expected 2 cache entries and no hits, got %d entries and %d hits", len(cache.entries), cache.hits)
+	}
+	if cached, ok := cache.Get(files["Queue.peak"]); !ok || len(cached.Classes) != 1 {
+		t.Errorf("expected Queue template to be cached")
+	}
+	cache.hits = 0
+
+	warm := outputs()
+	if cache.hits != 2 {
+		t.Errorf("expected 2 cache hits, got %d", cache.hits)
+	}
+	for path, content := range cold {
+		if warm[path] != content {
+			t.Errorf("%s differs when templates come from the cache", path)
+		}
+	}
+}
+
+func TestTranspileFiles_ReusedTranspiler(t *testing.T) {
+	tr := NewTranspiler(nil)
+	outputs := func(files map[string]string) []string {
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+		var paths []string
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("unexpected error: %v", result.Error)
+			}
+			if result.OutputPath != "" {
+				paths = append(paths, result.OutputPath)
+			}
+		}
+		slices.Sort(paths)
+		return paths
+	}
+
+	queue := "public class Queue<T> {\n    private List<T> items;\n}"
+	outputs(map[string]string{
+		"Queue.peak":   queue,
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	})
+	second := outputs(map[string]string{
+		"Queue.peak":   queue,
+		"Example.peak": "public class Example {\n    private Queue<String> q;\n}",
+	})
+	if want := []string{"Example.cls", "QueueString.cls"}; !slices.Equal(second, want) {
+		t.Errorf("expected only the second run's outputs %v, got %v", want, second)
+	}
+	if templates := tr.Templates(); len(templates) != 1 {
+		t.Errorf("expected 1 template after the second run, got %d", len(templates))
+	}
+}
+
+func TestTranspileFiles_DocComments(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Example.peak": `/**
+ * Wraps a Queue<Integer>.
+ * It's got a Queue<Boolean> of flags.
+ * @see Queue<Integer>
+ * @see Queue<Date> (not instantiated)
+ * @see MyQueue<Integer>
+ */
+public class Example {
+    // Queue<Integer> in a line comment
+    /* Queue<Integer> in a block comment */
+    private Queue<Integer> q;
+    private Queue<Boolean> flags;
+}`,
+	}
+
+	transpile := func(docComments bool) string {
+		tr := NewTranspiler(nil)
+		tr.SetDocComments(docComments)
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+		for _, result := range results {
+			if result.OriginalPath == "Example.peak" {
+				return result.Content
+			}
+		}
+		t.Fatal("no output for Example.peak")
+		return ""
+	}
+
+	if content := transpile(false); !strings.Contains(content, "@see Queue<Integer>") {
+		t.Errorf("doc comments should not be rewritten by default:\n%s", content)
+	}
+
+	content := transpile(true)
+	for _, want := range []string{
+		" * Wraps a QueueInteger.",
+		" * It's got a QueueBoolean of flags.",
+		"@see QueueInteger\n",
+		"@see Queue<Date> (not instantiated)",
+		"@see MyQueue<Integer>",
+		"// Queue<Integer> in a line comment",
+		"/* Queue<Integer> in a block comment */",
+		"private QueueInteger q;",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in output:\n%s", want, content)
+		}
+	}
+}
+
+func TestTranspileFiles_DocCommentsWithoutCodeUsages(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetDocComments(true)
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Usage.peak": `public class Usage {
+    private Queue<String> q;
+}`,
+		"Docs.peak": `/** See {@link Queue<String>}. */
+public class Docs {
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		if result.OriginalPath == "Docs.peak" && !strings.Contains(result.Content, "{@link QueueString}") {
+			t.Errorf("expected the doc comment to name the class generated for another file:\n%s", result.Content)
+		}
+	}
+}
+
+func TestTranspileFiles_StringLiterals(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> q;
+    private String message = 'expected a Queue<String>';
+    private Type byName = Type.forName('Queue<Integer>');
+    private Object parsed = JSON.deserialize(body, Type.forName('Queue<Boolean>'));
+    private Type spaced = Type.forName(' Queue<Integer>');
+}`,
+	}
+
+	transpile := func(dynamicTypes bool) map[string]FileResult {
+		tr := NewTranspiler(nil)
+		tr.SetDynamicTypes(dynamicTypes)
+		results, err := tr.TranspileFiles(files)
+		if err != nil {
+			t.Fatalf("TranspileFiles failed: %v", err)
+		}
+		byPath := make(map[string]FileResult)
+		for _, result := range results {
+			byPath[result.OutputPath] = result
+		}
+		return byPath
+	}
+
+	// By default string literals are neither rewritten nor treated as usages
+	results := transpile(false)
+	content := results["Example.cls"].Content
+	for _, want := range []string{"'expected a Queue<String>'", "Type.forName('Queue<Integer>')", "Type.forName('Queue<Boolean>')"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q to be preserved:\n%s", want, content)
+		}
+	}
+	for _, unwanted := range []string{"QueueString.cls", "QueueBoolean.cls"} {
+		if _, ok := results[unwanted]; ok {
+			t.Errorf("string literals should not generate %s", unwanted)
+		}
+	}
+
+	// With dynamic types, literals naming a type in dynamic type calls are rewritten and generated
+	results = transpile(true)
+	content = results["Example.cls"].Content
+	for _, want := range []string{
+		"'expected a Queue<String>'",
+		"Type.forName('QueueInteger')",
+		"JSON.deserialize(body, Type.forName('QueueBoolean'))",
+		"Type.forName(' Queue<Integer>')",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in output:\n%s", want, content)
+		}
+	}
+	if _, ok := results["QueueBoolean.cls"]; !ok {
+		t.Error("expected Type.forName('Queue<Boolean>') to generate QueueBoolean")
+	}
+	if _, ok := results["QueueString.cls"]; ok {
+		t.Error("a message string should not generate QueueString")
+	}
+}
+
+func TestTranspileFiles_DTOHelpers(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Page.peak": `@PeakDto
+@JsonAccess(serializable='always')
+public class Page<T> {
+    public List<T> items;
+}`,
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Example.peak": `public class Example {
+    private Page<Account> page = Page<Account>.fromJson(body);
+    private Queue<Integer> q;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	byPath := make(map[string]FileResult)
+	for _, result := range results {
+		byPath[result.OutputPath] = result
+	}
+
+	page := byPath["PageAccount.cls"]
+	for _, want := range []string{
+		"@JsonAccess(serializable='always') public class PageAccount {",
+		"public static PageAccount fromJson(String jsonString) {",
+		"return (PageAccount) JSON.deserialize(jsonString, PageAccount.class);",
+	} {
+		if !strings.Contains(page.Content, want) {
+			t.Errorf("expected %q in output:\n%s", want, page.Content)
+		}
+	}
+	if strings.Contains(page.Content, "@PeakDto") {
+		t.Errorf("the DTO annotation should not be emitted:\n%s", page.Content)
+	}
+	if want := strings.Count(page.Content, "\n") + 1; len(page.SourceLines) != want {
+		t.Errorf("expected %d mapped lines, got %d", want, len(page.SourceLines))
+	}
+	// The declaration and the field keep their template lines; the helper is generated
+	if page.SourceLines[1] != 3 || page.SourceLines[2] != 4 {
+		t.Errorf("unexpected line map %v", page.SourceLines)
+	}
+	for i, line := range strings.Split(page.Content, "\n") {
+		if strings.Contains(line, "fromJson") && page.SourceLines[i] != 0 {
+			t.Errorf("expected the helper to map to generated code, got line %d", page.SourceLines[i])
+		}
+	}
+
+	if strings.Contains(byPath["QueueInteger.cls"].Content, "fromJson") {
+		t.Error("templates without the DTO annotation should not get helpers")
+	}
+	if !strings.Contains(byPath["Example.cls"].Content, "PageAccount.fromJson(body)") {
+		t.Errorf("expected the helper call to be rewritten:\n%s", byPath["Example.cls"].Content)
+	}
+}
+
+func TestTranspileFiles_Supertypes(t *testing.T) {
+	files := map[string]string{
+		"Box.peak": `public class Box<T>
+    extends Base
+    implements Holder, Marker {
+    public T value;
+}`,
+		"Example.peak": `public class Example {
+    private Box<Integer> b;
+}`,
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		if result.OutputPath != "BoxInteger.cls" {
+			continue
+		}
+		// Clauses are kept on the declaration line, so lines still match the template
+		if !strings.Contains(result.Content, "public class BoxInteger extends Base implements Holder, Marker {\n    public Integer value;") {
+			t.Errorf("expected extends and implements clauses on the declaration:\n%s", result.Content)
+		}
+		if result.SourceLines[1] != 3 || result.SourceLines[2] != 4 {
+			t.Errorf("unexpected line map %v", result.SourceLines)
+		}
+		return
+	}
+	t.Fatal("no output for Box<Integer>")
+}
+
+func TestTranspileFiles_Timings(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	}
+
+	tr := NewTranspiler(nil)
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, result := range results {
+		switch {
+		case result.OriginalPath == "":
+			if result.Timings.Parse != 0 {
+				t.Errorf("expected no parse time for generated %s, got %v", result.OutputPath, result.Timings.Parse)
+			}
+		case result.Timings.Parse != tr.parseTimes[result.OriginalPath]:
+			t.Errorf("expected the parse time of %s from both collection phases, got %v", result.OriginalPath, result.Timings.Parse)
+		}
+		if result.Timings.Transpile < 0 {
+			t.Errorf("negative transpile time for %s", result.OutputPath)
+		}
+	}
+	if _, ok := tr.parseTimes["Queue.peak"]; !ok {
+		t.Error("expected templates to be timed too")
+	}
+}
+
+func TestTranspileFiles_Logger(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "public class Queue<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    private Queue<Integer> q;\n}",
+	}
+
+	var buf bytes.Buffer
+	tr := NewTranspiler(nil)
+	tr.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if _, err := tr.TranspileFiles(files); err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+	for _, want := range []string{
+		`msg="collected templates" classes=1 methods=0`,
+		`msg="collected usages" classes=1 methods=0`,
+		`msg="planned outputs" sources=1 concrete=1 holders=0 factories=0`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in log:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestTranspileFiles_Selection(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetSelection([]string{"Example.peak"})
+	files := map[string]string{
+		"Queue.peak": `public class Queue<T> {
+    private List<T> items;
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> q;
+}`,
+		"Other.peak": `public class Other {
+    private Queue<String> q;
+}`,
+	}
+
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var outputs []string
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		if result.IsTemplate {
+			t.Errorf("expected no result for the unselected template %s", result.OriginalPath)
+			continue
+		}
+		outputs = append(outputs, result.OutputPath)
+	}
+	slices.Sort(outputs)
+	// Usages in unselected sources still produce their concrete classes
+	want := []string{"Example.cls", "QueueInteger.cls", "QueueString.cls"}
+	if strings.Join(outputs, ",") != strings.Join(want, ",") {
+		t.Errorf("expected outputs %v, got %v", want, outputs)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tr := NewTranspiler(nil)
+	files := map[string]string{
+		"Pair.peak": `public class Pair<K, V> {
+    private K key;
+}`,
+		"Example.peak": `public class Example {
+    private Pair<String, Integer> a;
+    private Pair<String, Integer> b;
+    private Pair<Id, Account> c;
+}`,
+	}
+
+	if _, err := tr.TranspileFiles(files); err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	usage := tr.Usage()
+	if len(usage) != 1 || usage[0].Name != "Pair" {
+		t.Fatalf("expected usage of Pair, got %+v", usage)
+	}
+	u := usage[0]
+	want := []string{"Pair<Id, Account>", "Pair<String, Integer>"}
+	if !slices.Equal(u.Instantiations, want) {
+		t.Errorf("expected instantiations %v, got %v", want, u.Instantiations)
+	}
+	if !slices.Equal(u.Users, []string{"Example.peak"}) {
+		t.Errorf("expected Example.peak as the only user, got %v", u.Users)
+	}
+	if u.GeneratedLines == 0 {
+		t.Error("expected generated lines to be counted")
+	}
+	if !slices.Equal(u.UnusedTypeParams, []string{"V"}) {
+		t.Errorf("expected V to be unused, got %v", u.UnusedTypeParams)
+	}
+}
+
+func TestTranspileFiles_Comparator(t *testing.T) {
+	files := map[string]string{
+		"ByField.peak": `public class ByField<T> implements Comparator<T> {
+    public Integer compare(T a, T b) {
+        return 0;
+    }
+}`,
+		"ByName.peak": `public class ByName implements Comparator<Account> {
+    public Integer compare(Account a, Account b) {
+        return a.Name.compareTo(b.Name);
+    }
+}`,
+		"Example.peak": `public class Example {
+    private List<Comparator<ByField<Contact>>> comparators;
+}`,
+	}
+
+	results, err := NewTranspiler(nil).TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	for path, want := range map[string]string{
+		"ByFieldContact.cls": "public class ByFieldContact implements Comparator<Contact> {\n    public Integer compare(Contact a, Contact b) {",
+		"ByName.cls":         "public class ByName implements Comparator<Account> {",
+		"Example.cls":        "private List<Comparator<ByFieldContact>> comparators;",
+	} {
+		if !strings.Contains(outputs[path], want) {
+			t.Errorf("expected %q in %s, got:\n%s", want, path, outputs[path])
+		}
+	}
+}
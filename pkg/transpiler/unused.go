@@ -0,0 +1,64 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+// checkUnusedTemplates returns a warning for every class template that no source,
+// config entry or peak:instantiate directive instantiates, and every generic method
+// that is never instantiated: neither generates any code. It runs after usages are
+// collected and expanded.
+func (t *Transpiler) checkUnusedTemplates() []diagnostic.Diagnostic {
+	instantiated := make(map[string]bool)
+	for _, expr := range t.usages {
+		instantiated[expr.BaseType] = true
+	}
+
+	var warnings []diagnostic.Diagnostic
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if instantiated[name] {
+			continue
+		}
+		template := t.templates[name]
+		path := t.templatePaths[name]
+		warnings = append(warnings, diagnostic.Diagnostic{
+			Severity: diagnostic.SeverityWarning,
+			Code:     diagnostic.CodeUnusedTemplate,
+			File:     path,
+			Line:     t.sourceLine(path, template.BodyLine),
+			Message: fmt.Sprintf("template %s<%s> is never instantiated, so no class is generated from it; use it in a source or list it in instantiate.classes, or remove it",
+				name, strings.Join(template.TypeParams, ", ")),
+		})
+	}
+
+	keys := make([]string, 0, len(t.methodTemplates))
+	for key := range t.methodTemplates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(t.methodUsages[key]) > 0 {
+			continue
+		}
+		method := t.methodTemplates[key]
+		path := t.methodPaths[key]
+		warnings = append(warnings, diagnostic.Diagnostic{
+			Severity: diagnostic.SeverityWarning,
+			Code:     diagnostic.CodeUnusedMethodTemplate,
+			File:     path,
+			Line:     t.sourceLine(path, method.Line),
+			Message: fmt.Sprintf("generic method %s<%s> is never instantiated, so no method is generated from it; call it, add a peak:instantiate directive or list it in instantiate.methods, or remove it",
+				key, strings.Join(method.TypeParams, ", ")),
+		})
+	}
+	return warnings
+}
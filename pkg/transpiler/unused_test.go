@@ -0,0 +1,49 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestTranspileFiles_UnusedTemplates(t *testing.T) {
+	tr := NewTranspiler(nil)
+	tr.SetInstantiate(&config.Instantiate{Classes: map[string][]string{"Forced": {"Integer"}}})
+	files := map[string]string{
+		"Queue.peak":  "public class Queue<T> {\n    private Box<T> box;\n}",
+		"Box.peak":    "public class Box<T> {\n    private T value;\n}",
+		"Forced.peak": "public class Forced<T> {\n    private T value;\n}",
+		"Pair.peak":   "/** Unused */\npublic class Pair<K, V> {\n    private K key;\n}",
+		"Repo.peak": `public class Repo {
+    public <T> T get(String key) { return null; }
+    public <T> T put(T value) { return value; }
+}`,
+		"Example.peak": `public class Example {
+    private Queue<Integer> queue;
+    private Integer n = new Repo().put<Integer>(1);
+}`,
+	}
+
+	if _, err := tr.TranspileFiles(files); err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	var unused []diagnostic.Diagnostic
+	for _, w := range tr.Warnings() {
+		if w.Code == diagnostic.CodeUnusedTemplate || w.Code == diagnostic.CodeUnusedMethodTemplate {
+			unused = append(unused, w)
+		}
+	}
+	// Box is instantiated through Queue<Integer>, Forced by the config
+	if len(unused) != 2 {
+		t.Fatalf("expected 2 unused template warnings, got %+v", unused)
+	}
+	if w := unused[0]; w.Code != diagnostic.CodeUnusedTemplate || w.File != "Pair.peak" || w.Line != 2 || !strings.Contains(w.Message, "Pair<K, V>") {
+		t.Errorf("expected an unused Pair warning at Pair.peak:2, got %+v", w)
+	}
+	if w := unused[1]; w.Code != diagnostic.CodeUnusedMethodTemplate || w.File != "Repo.peak" || w.Line != 2 || !strings.Contains(w.Message, "Repo.get<T>") {
+		t.Errorf("expected an unused Repo.get warning at Repo.peak:2, got %+v", w)
+	}
+}
@@ -0,0 +1,143 @@
+package transpiler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// TemplateUsage describes how the project uses a class or method template, for
+// maintainers of shared templates judging the impact of a change
+type TemplateUsage struct {
+	TemplateInfo
+	Instantiations   []string // Instantiations generated, e.g. "Queue<Integer>", or type arguments of a method, sorted
+	Users            []string // Sources other than the template's own file that use it, sorted
+	GeneratedLines   int      // Lines of the concrete classes or methods generated from it
+	UnusedTypeParams []string // Type parameters the template declares but never mentions
+}
+
+// addUser records that the source at path uses the template named name, unless
+// the template is defined there
+func (t *Transpiler) addUser(name, path string) {
+	if path == t.templatePaths[name] || path == t.methodPaths[name] {
+		return
+	}
+	if t.users[name] == nil {
+		t.users[name] = make(map[string]bool)
+	}
+	t.users[name][path] = true
+}
+
+// countGeneratedLines adds the lines of result, a concrete class or holder class, to
+// the generated lines of its template
+func (t *Transpiler) countGeneratedLines(result FileResult) {
+	if result.Error != nil || result.TemplatePath == "" {
+		return
+	}
+	name, _, _ := strings.Cut(result.Instantiation, "<")
+	if result.Members != nil {
+		// A holder class holds every concrete class of the template in its file
+		for template, path := range t.templatePaths {
+			if path == result.TemplatePath {
+				name = template
+			}
+		}
+	}
+	if name != "" {
+		t.generatedLines[name] += lineCount(result.Content)
+	}
+}
+
+// lineCount returns the number of lines of content
+func lineCount(content string) int {
+	if content == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+}
+
+// findUnusedTypeParams records, for every template, the type parameters that its
+// supertypes and body, or a method's signature and body, never mention. It runs
+// before template bodies are released.
+func (t *Transpiler) findUnusedTypeParams() {
+	for name, def := range t.templates {
+		code := maskNonCode(def.Supertypes + "\n" + def.Body)
+		t.unusedParams[name] = unusedParams(def.TypeParams, code, 0)
+	}
+	for key, def := range t.methodTemplates {
+		// The signature declares each type parameter once
+		code := maskNonCode(def.Signature + "\n" + def.Body)
+		t.unusedParams[key] = unusedParams(def.TypeParams, code, 1)
+	}
+}
+
+// unusedParams returns the params that occur in code no more than declared times
+func unusedParams(params []string, code string, declared int) []string {
+	var unused []string
+	for _, param := range params {
+		if identifierCount(code, param) <= declared {
+			unused = append(unused, param)
+		}
+	}
+	return unused
+}
+
+// identifierCount returns how often name occurs in code as a whole identifier
+func identifierCount(code, name string) int {
+	count := 0
+	for i := strings.Index(code, name); i >= 0; {
+		end := i + len(name)
+		if (i == 0 || !isIdentifierChar(rune(code[i-1]))) && (end == len(code) || !isIdentifierChar(rune(code[end]))) {
+			count++
+		}
+		next := strings.Index(code[end:], name)
+		if next < 0 {
+			break
+		}
+		i = end + next
+	}
+	return count
+}
+
+// Usage returns how the last run used each class and method template, in the order
+// of Templates. Run Usage after TranspileFiles or TranspileStream.
+func (t *Transpiler) Usage() []TemplateUsage {
+	templates := t.Templates()
+	usage := make([]TemplateUsage, 0, len(templates))
+	for _, info := range templates {
+		u := TemplateUsage{
+			TemplateInfo:     info,
+			GeneratedLines:   t.generatedLines[info.Name],
+			UnusedTypeParams: t.unusedParams[info.Name],
+		}
+		if info.IsMethod {
+			u.Instantiations = append(u.Instantiations, t.methodUsages[info.Name]...)
+		} else {
+			u.Instantiations = t.classInstantiations(info.Name)
+		}
+		sort.Strings(u.Instantiations)
+		for path := range t.users[info.Name] {
+			u.Users = append(u.Users, path)
+		}
+		sort.Strings(u.Users)
+		usage = append(usage, u)
+	}
+	return usage
+}
+
+// classInstantiations returns the instantiations of the class template name, one per
+// concrete class
+func (t *Transpiler) classInstantiations(name string) []string {
+	var instantiations []string
+	seen := make(map[string]bool)
+	for _, expr := range t.usages {
+		className := strings.ToLower(parser.GenerateConcreteClassName(expr))
+		if expr.BaseType != name || seen[className] {
+			continue
+		}
+		seen[className] = true
+		instantiations = append(instantiations, expr.String())
+	}
+	return instantiations
+}
@@ -0,0 +1,199 @@
+package transpiler
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+	"github.com/ipavlic/peak/pkg/parser"
+)
+
+// VisibilityAnnotation sets the access modifier of the concrete classes of a template,
+// as in @PeakVisibility(global), or of the concrete methods of a generic method, which
+// may also be made @TestVisible, as in @PeakVisibility(private, TestVisible)
+const VisibilityAnnotation = "@PeakVisibility"
+
+// testVisibleArgument is the @PeakVisibility argument that adds @TestVisible to concrete methods
+const testVisibleArgument = "TestVisible"
+
+// accessModifiers are the Apex access modifiers
+var accessModifiers = []string{"public", "global", "protected", "private"}
+
+// methodModifiers are the lowercased modifiers that can start a method declaration
+var methodModifiers = []string{"public", "global", "protected", "private", "static", "final", "override", "virtual", "abstract", "webservice", "testmethod"}
+
+// visibility is an access modifier and @TestVisible setting for generated code
+type visibility struct {
+	access      string // Lowercased access modifier, or "" to keep the template's
+	testVisible bool   // Annotate with @TestVisible
+}
+
+// SetVisibility sets the access modifiers of concrete classes and of the concrete
+// methods generated from generic methods, which @PeakVisibility annotations override.
+// Without it, generated code copies the modifiers of its template.
+func (t *Transpiler) SetVisibility(v *config.Visibility) {
+	t.visibility = v
+}
+
+// parseVisibility reads the arguments of a @PeakVisibility annotation. Classes take an
+// access modifier, public or global; methods take any access modifier, TestVisible or both.
+func parseVisibility(args []string, method bool) (visibility, error) {
+	var v visibility
+	for _, arg := range args {
+		switch lower := strings.ToLower(arg); {
+		case method && strings.EqualFold(arg, testVisibleArgument):
+			v.testVisible = true
+		case v.access == "" && (lower == "public" || lower == "global" || method && (lower == "protected" || lower == "private")):
+			v.access = lower
+		default:
+			if method {
+				return v, fmt.Errorf("unexpected %s argument '%s' (expected public, global, protected, private or %s)", VisibilityAnnotation, arg, testVisibleArgument)
+			}
+			return v, fmt.Errorf("unexpected %s argument '%s' (expected public or global)", VisibilityAnnotation, arg)
+		}
+	}
+	if v.access == "" && !v.testVisible {
+		return v, fmt.Errorf("%s requires an access modifier, e.g. %s(public)", VisibilityAnnotation, VisibilityAnnotation)
+	}
+	return v, nil
+}
+
+// processVisibility checks the @PeakVisibility annotations of templates and generic
+// methods (Phase 1.5)
+func (t *Transpiler) processVisibility(results *[]FileResult) bool {
+	hasErrors := false
+	fail := func(path, name string, err error) {
+		hasErrors = true
+		*results = append(*results, FileResult{
+			OriginalPath: path,
+			Error:        diagnostic.WithCode(diagnostic.CodeInvalidVisibility, fmt.Errorf("%s: %w", name, err)),
+		})
+	}
+
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if args, ok := findAnnotation(t.templates[name], VisibilityAnnotation); ok {
+			if _, err := parseVisibility(args, false); err != nil {
+				fail(t.templatePaths[name], name, err)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(t.methodTemplates))
+	for key := range t.methodTemplates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if args, ok := findMethodAnnotation(t.methodTemplates[key], VisibilityAnnotation); ok {
+			if _, err := parseVisibility(args, true); err != nil {
+				fail(t.methodPaths[key], key, err)
+			}
+		}
+	}
+	return hasErrors
+}
+
+// findMethodAnnotation is findAnnotation for generic methods
+func findMethodAnnotation(method *parser.GenericMethodDef, name string) ([]string, bool) {
+	return findAnnotation(&parser.GenericClassDef{Annotations: method.Annotations}, name)
+}
+
+// classModifiers returns the modifiers of the concrete classes of template: the
+// template's own, with the access modifier set by its @PeakVisibility annotation or
+// the configured visibility, and public if there is none. Package API classes are
+// global in managed packages.
+func (t *Transpiler) classModifiers(template *parser.GenericClassDef) string {
+	access := ""
+	if t.visibility != nil {
+		access = t.visibility.Classes
+	}
+	if args, ok := findAnnotation(template, VisibilityAnnotation); ok {
+		if v, err := parseVisibility(args, false); err == nil {
+			access = v.access
+		}
+	}
+	if t.isPackageApi(template) {
+		access = "global"
+	}
+	modifiers := withAccess(template.Modifiers, access)
+	if modifiers == "" {
+		return "public" // Default to public if no modifiers specified
+	}
+	return modifiers
+}
+
+// methodVisibility returns the visibility of the concrete methods of method: the
+// settings of its @PeakVisibility annotation, falling back on the configured visibility
+func (t *Transpiler) methodVisibility(method *parser.GenericMethodDef) visibility {
+	var v visibility
+	if t.visibility != nil {
+		v = visibility{access: t.visibility.Methods, testVisible: t.visibility.TestVisible}
+	}
+	if args, ok := findMethodAnnotation(method, VisibilityAnnotation); ok {
+		if annotated, err := parseVisibility(args, true); err == nil {
+			if annotated.access != "" {
+				v.access = annotated.access
+			}
+			v.testVisible = v.testVisible || annotated.testVisible
+		}
+	}
+	return v
+}
+
+// withAccess returns modifiers, the modifiers of a declaration, with their access
+// modifier replaced by access, or unchanged if access is empty
+func withAccess(modifiers, access string) string {
+	if access == "" {
+		return modifiers
+	}
+	fields := []string{access}
+	for _, field := range strings.Fields(modifiers) {
+		if !isAccessModifier(field) {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// isAccessModifier reports whether word is one of accessModifiers
+func isAccessModifier(word string) bool {
+	for _, modifier := range accessModifiers {
+		if strings.EqualFold(word, modifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// withMethodVisibility applies v to signature, the signature of a concrete method
+// without its annotations, which starts with the method's modifiers. @TestVisible is
+// added on the same line, so the method keeps the line layout of its template.
+func withMethodVisibility(signature string, v visibility) string {
+	if v.access != "" {
+		// Replace the modifiers, keeping the rest of the signature as it is
+		var modifiers []string
+		rest := signature
+		for {
+			trimmed := strings.TrimLeft(rest, " \t")
+			end := strings.IndexAny(trimmed, " \t\r\n")
+			if end < 0 || !slices.Contains(methodModifiers, strings.ToLower(trimmed[:end])) {
+				break
+			}
+			modifiers = append(modifiers, trimmed[:end])
+			rest = trimmed[end:]
+		}
+		signature = withAccess(strings.Join(modifiers, " "), v.access) + " " + strings.TrimLeft(rest, " \t")
+	}
+	if v.testVisible {
+		signature = "@TestVisible " + signature
+	}
+	return signature
+}
@@ -0,0 +1,102 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/peak/pkg/config"
+	"github.com/ipavlic/peak/pkg/diagnostic"
+)
+
+func TestWithMethodVisibility(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string
+		v         visibility
+		expected  string
+	}{
+		{"unchanged", "public static Contact getContact(String key)", visibility{}, "public static Contact getContact(String key)"},
+		{"access", "public static Contact getContact(String key)", visibility{access: "private"}, "private static Contact getContact(String key)"},
+		{"access after static", "static global Contact getContact(String key)", visibility{access: "public"}, "public static Contact getContact(String key)"},
+		{"no modifiers", "Contact getContact(String key)", visibility{access: "private"}, "private Contact getContact(String key)"},
+		{"test visible", "private Contact getContact(\n    String key)", visibility{testVisible: true}, "@TestVisible private Contact getContact(\n    String key)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withMethodVisibility(tt.signature, tt.v); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTranspileFiles_Visibility(t *testing.T) {
+	files := map[string]string{
+		"Queue.peak":   "@PeakVisibility(global)\npublic virtual class Queue<T> {\n    private List<T> items;\n}",
+		"Stack.peak":   "public class Stack<T> {\n    private List<T> items;\n}",
+		"Example.peak": "public class Example {\n    Queue<Integer> q;\n    Stack<Integer> s;\n}",
+		"Repository.peak": "public class Repository {\n" +
+			"    public <T> T get(String key) {\n        return (T) cache.get(key);\n    }\n" +
+			"    @PeakVisibility(public)\n" +
+			"    public static <T> void put(String key, T value) {\n        cache.put(key, value);\n    }\n" +
+			"}",
+	}
+
+	tr := NewTranspiler(nil)
+	tr.SetVisibility(&config.Visibility{Methods: "private", TestVisible: true})
+	tr.SetInstantiate(&config.Instantiate{Methods: map[string][]string{"Repository.get": {"Contact"}, "Repository.put": {"Contact"}}})
+	results, err := tr.TranspileFiles(files)
+	if err != nil {
+		t.Fatalf("TranspileFiles failed: %v", err)
+	}
+
+	outputs := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.OriginalPath, result.Error)
+		}
+		outputs[result.OutputPath] = result.Content
+	}
+	for path, want := range map[string]string{
+		"QueueInteger.cls": "global virtual class QueueInteger {",
+		"StackInteger.cls": "public class StackInteger {",
+		"Repository.cls":   "    @TestVisible private Contact getContact(String key) {",
+	} {
+		if !strings.Contains(outputs[path], want) {
+			t.Errorf("expected %q in %s, got:\n%s", want, path, outputs[path])
+		}
+	}
+	if want := "    @TestVisible public static void putContact(String key, Contact value) {"; !strings.Contains(outputs["Repository.cls"], want) {
+		t.Errorf("expected the annotation to override the access modifier, got:\n%s", outputs["Repository.cls"])
+	}
+	if strings.Contains(outputs["QueueInteger.cls"], VisibilityAnnotation) {
+		t.Errorf("expected the annotation to be removed, got:\n%s", outputs["QueueInteger.cls"])
+	}
+}
+
+func TestTranspileFiles_InvalidVisibility(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"private class", "@PeakVisibility(private)\npublic class Queue<T> {\n}"},
+		{"test visible class", "@PeakVisibility(public, TestVisible)\npublic class Queue<T> {\n}"},
+		{"no arguments", "@PeakVisibility\npublic class Queue<T> {\n}"},
+		{"unknown method modifier", "public class Repository {\n    @PeakVisibility(internal)\n    public <T> T get(String key) {\n        return null;\n    }\n}"},
+		{"two access modifiers", "public class Repository {\n    @PeakVisibility(public, private)\n    public <T> T get(String key) {\n        return null;\n    }\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := NewTranspiler(nil).TranspileFiles(map[string]string{"Source.peak": tt.source})
+			if err != nil {
+				t.Fatalf("TranspileFiles failed: %v", err)
+			}
+			if len(results) == 0 || results[0].Error == nil {
+				t.Fatalf("expected an error, got %+v", results)
+			}
+			if d := diagnostic.FromError(results[0].OriginalPath, results[0].Error); d.Code != diagnostic.CodeInvalidVisibility || d.File != "Source.peak" {
+				t.Errorf("expected %s in Source.peak, got %s in %s: %s", diagnostic.CodeInvalidVisibility, d.Code, d.File, d.Message)
+			}
+		})
+	}
+}